@@ -57,11 +57,14 @@ type templatePuzzle [][]templatePuzzleCell
 
 // A templatePuzzleCell contains the cell's index, value, and CSS
 // styling classes as expected by the puzzle grid section of the
-// solver page template.
+// solver page template.  Cells in killer cages also have cage
+// outline classes and, in the first cell of each cage, its sum.
 type templatePuzzleCell struct {
 	Index                   int
 	Value                   template.HTML
 	Shade, HBorder, VBorder string
+	Cage                    string
+	CageSum                 int
 }
 
 // add solver statics to the static list
@@ -74,18 +77,21 @@ func init() {
 // session and puzzle info, and returns the solver page content as a
 // string.
 func SolverPage(sessionID string, info *storage.PuzzleInfo, values []int) string {
-	var tp templatePuzzle
-	var err error
-	if info.Geometry == puzzle.StandardGeometryName {
-		tp, err = standardTemplatePuzzle(values)
-	} else if info.Geometry == puzzle.RectangularGeometryName {
-		tp, err = rectangularTemplatePuzzle(values)
-	} else {
-		err = fmt.Errorf("Can't generate puzzle grid for geometry %q", info.Geometry)
+	layout, err := puzzle.NewLayout(&puzzle.Summary{
+		Geometry:   info.Geometry,
+		SideLength: info.SideLength,
+		Regions:    info.Regions,
+	})
+	if err != nil {
+		return ErrorPage(err)
 	}
+	tp, err := layoutTemplatePuzzle(layout, values)
 	if err != nil {
 		return ErrorPage(err)
 	}
+	if len(info.Cages) > 0 {
+		addTemplateCages(tp, info.Cages)
+	}
 
 	tsp := templateSolverPage{
 		SessionID:         sessionID,
@@ -115,50 +121,85 @@ func SolverPage(sessionID string, info *storage.PuzzleInfo, values []int) string
 
 /*
 
-Standard puzzle templates
+Puzzle grid templates
 
 */
 
-// standardTemplatePuzzle takes the values of a puzzle and returns
-// the appropriate templatePuzzle.  Errors mean the given values
-// have the wrong shape to be a standardPuzzle.
-func standardTemplatePuzzle(vals []int) (templatePuzzle, error) {
-	slen, ok := findIntSquareRoot(len(vals))
-	if !ok {
-		return nil, fmt.Errorf("Puzzle square count is %v: not a square.", len(vals))
+// layoutTemplatePuzzle takes the layout and values of a puzzle
+// and returns the appropriate templatePuzzle.  Each square gets
+// a thick border on every side that is adjacent to a different
+// tile (or to the edge of the puzzle), so a square in an
+// irregular tile can have both a top and a bottom (or both a
+// left and a right) border.  Squares are shaded by the parity
+// of their layout shade, and get any layout marks as extra
+// classes.  Errors mean the given values have the wrong shape
+// for the layout.
+func layoutTemplatePuzzle(layout *puzzle.Layout, vals []int) (templatePuzzle, error) {
+	slen := layout.SideLength
+	if len(vals) != slen*slen {
+		return nil, fmt.Errorf("Puzzle square count is %v: should be %v.", len(vals), slen*slen)
 	}
-	tlen, ok := findIntSquareRoot(slen)
-	if !ok {
-		return nil, fmt.Errorf("Puzzle side length is %v: not a square.", slen)
+	// helpers: the tile, shade, and marks of a square (0 or
+	// empty if not given), with tile -1 for squares off the puzzle
+	tileAt := func(i, j int) int {
+		if i < 0 || i >= slen || j < 0 || j >= slen {
+			return -1
+		}
+		if len(layout.Tiles) == 0 {
+			return 0
+		}
+		return layout.Tiles[i*slen+j]
+	}
+	shadeAt := func(index int) int {
+		if len(layout.Shades) == 0 {
+			return 0
+		}
+		return layout.Shades[index]
+	}
+	marksAt := func(index int) string {
+		if len(layout.Marks) == 0 {
+			return ""
+		}
+		return layout.Marks[index]
 	}
 	rows := make(templatePuzzle, slen)
 	for i := 0; i < slen; i++ {
 		rows[i] = make([]templatePuzzleCell, slen)
-		// is this top, bottom, or middle row of quad
-		hborder := "middle"
-		if i%tlen == 0 {
-			hborder = "top"
-		} else if i%tlen == tlen-1 {
-			hborder = "bottom"
-		}
 		for j := 0; j < slen; j++ {
 			index := i*slen + j
 			value := template.HTML("&nbsp;")
 			if val := vals[index]; val > 0 {
 				value = template.HTML(fmt.Sprint(val))
 			}
-			quad := i/tlen + j/tlen
-			// even quad or odd quad shading
+			// even shade or odd shade
 			shade := "lighter"
-			if quad%2 == 0 {
+			if shadeAt(index)%2 == 0 {
 				shade = "darker"
 			}
-			// is this left, center, or right column of quad
-			vborder := "center"
-			if j%tlen == 0 {
-				vborder = "left"
-			} else if j%tlen == tlen-1 {
-				vborder = "right"
+			if marks := marksAt(index); marks != "" {
+				shade += " " + marks
+			}
+			// which sides of the square are tile edges
+			tile := tileAt(i, j)
+			var hborders, vborders []string
+			if tileAt(i-1, j) != tile {
+				hborders = append(hborders, "top")
+			}
+			if tileAt(i+1, j) != tile {
+				hborders = append(hborders, "bottom")
+			}
+			if tileAt(i, j-1) != tile {
+				vborders = append(vborders, "left")
+			}
+			if tileAt(i, j+1) != tile {
+				vborders = append(vborders, "right")
+			}
+			hborder, vborder := "middle", "center"
+			if len(hborders) > 0 {
+				hborder = strings.Join(hborders, " ")
+			}
+			if len(vborders) > 0 {
+				vborder = strings.Join(vborders, " ")
 			}
 			rows[i][j] = templatePuzzleCell{
 				Index:   index + 1,
@@ -172,86 +213,62 @@ func standardTemplatePuzzle(vals []int) (templatePuzzle, error) {
 	return rows, nil
 }
 
-// Find the integer square root of val, if it exists.
-func findIntSquareRoot(val int) (int, bool) {
-	var i int
-	for i = 1; i*i <= val; i++ {
-		if i*i == val {
-			return i, true
-		}
-	}
-	return i - 1, false
-}
-
 /*
 
-Rectangular puzzle templates
+Killer cage templates
 
 */
 
-// rectangularTemplatePuzzle takes the values of a puzzle and returns
-// the appropriate templatePuzzle.  Errors mean the given values
-// have the wrong shape to be a rectangularPuzzle.
-func rectangularTemplatePuzzle(vals []int) (templatePuzzle, error) {
-	slen, ok := findIntSquareRoot(len(vals))
-	if !ok {
-		return nil, fmt.Errorf("Puzzle square count is %v: not a square.", len(vals))
-	}
-	vtlen, htlen, ok := findDivisors(slen)
-	if !ok {
-		return nil, fmt.Errorf("Puzzle side length is %v: not the product of consecutive integers.", slen)
+// addTemplateCages adds the cage outline classes and the cage
+// sums to the cells of a templatePuzzle.  Each caged cell gets a
+// "cage" class, plus a class for each side that's on the edge
+// of its cage.
+func addTemplateCages(tp templatePuzzle, cages []puzzle.Cage) {
+	slen := len(tp)
+	cageOf := make([]int, slen*slen+1) // 1-based indices
+	for ci, c := range cages {
+		for _, idx := range c.Indices {
+			if idx >= 1 && idx <= slen*slen {
+				cageOf[idx] = ci + 1
+			}
+		}
 	}
-	rows := make(templatePuzzle, slen)
-	for i := 0; i < slen; i++ {
-		rows[i] = make([]templatePuzzleCell, slen)
-		// is this top, bottom, or middle row of quad
-		hborder := "middle"
-		if i%vtlen == 0 {
-			hborder = "top"
-		} else if i%vtlen == vtlen-1 {
-			hborder = "bottom"
+	// helper: whether the cell at i, j is in the given cage
+	inCage := func(i, j, cage int) bool {
+		if i < 0 || i >= slen || j < 0 || j >= slen {
+			return false
 		}
-		for j := 0; j < slen; j++ {
-			index := i*slen + j
-			value := template.HTML("&nbsp;")
-			if val := vals[index]; val > 0 {
-				value = template.HTML(fmt.Sprint(val))
-			}
-			quad := i/vtlen + j/htlen
-			// even quad or odd quad shading
-			shade := "lighter"
-			if quad%2 == 0 {
-				shade = "darker"
-			}
-			// is this left, center, or right column of quad
-			vborder := "center"
-			if j%htlen == 0 {
-				vborder = "left"
-			} else if j%htlen == htlen-1 {
-				vborder = "right"
-			}
-			rows[i][j] = templatePuzzleCell{
-				Index:   index + 1,
-				Value:   value,
-				Shade:   shade,
-				HBorder: hborder,
-				VBorder: vborder,
+		return cageOf[i*slen+j+1] == cage
+	}
+	for ci, c := range cages {
+		if len(c.Indices) > 0 {
+			if idx := c.Indices[0]; idx >= 1 && idx <= slen*slen {
+				tp[(idx-1)/slen][(idx-1)%slen].CageSum = c.Sum
 			}
 		}
-	}
-	return rows, nil
-}
-
-// findDivisors: find consecutive ints that multiply to give an
-// int, if they exist
-func findDivisors(val int) (int, int, bool) {
-	var low, high int
-	for low, high = 1, 2; low*high <= val; low, high = high, high+1 {
-		if low*high == val {
-			return low, high, true
+		cage := ci + 1
+		for i := 0; i < slen; i++ {
+			for j := 0; j < slen; j++ {
+				if cageOf[i*slen+j+1] != cage {
+					continue
+				}
+				classes := []string{"cage"}
+				if !inCage(i-1, j, cage) {
+					classes = append(classes, "cage-top")
+				}
+				if !inCage(i+1, j, cage) {
+					classes = append(classes, "cage-bottom")
+				}
+				if !inCage(i, j-1, cage) {
+					classes = append(classes, "cage-left")
+				}
+				if !inCage(i, j+1, cage) {
+					classes = append(classes, "cage-right")
+				}
+				tp[i][j].Cage = strings.Join(classes, " ")
+			}
 		}
 	}
-	return low - 1, low, false
 }
 
 /*
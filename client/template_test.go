@@ -55,6 +55,42 @@ var (
 		0, 0, 4, 0, 0, 0,
 		0, 0, 0, 5, 1, 4,
 	}
+	diagonal9Values = []int{
+		0, 0, 0, 4, 0, 6, 0, 0, 0,
+		0, 0, 6, 7, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 4, 5, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 7,
+		6, 1, 0, 0, 0, 8, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 5, 3, 0,
+		0, 0, 8, 3, 0, 0, 0, 7, 0,
+		0, 7, 0, 0, 0, 0, 9, 0, 0,
+		0, 0, 4, 0, 0, 0, 0, 0, 0,
+	}
+	jigsaw6Values = []int{
+		0, 0, 0, 0, 5, 0,
+		0, 0, 0, 6, 0, 3,
+		0, 0, 0, 0, 0, 1,
+		2, 0, 0, 0, 0, 0,
+		0, 4, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+	}
+	jigsaw6Regions = []int{
+		1, 1, 1, 2, 2, 2,
+		1, 1, 3, 3, 2, 2,
+		1, 4, 3, 3, 3, 2,
+		4, 4, 4, 3, 5, 5,
+		6, 4, 4, 5, 5, 5,
+		6, 6, 6, 6, 6, 5,
+	}
+	killer4Cages = []puzzle.Cage{
+		{Sum: 4, Indices: []int{1, 5}},
+		{Sum: 6, Indices: []int{2, 6}},
+		{Sum: 7, Indices: []int{3, 4}},
+		{Sum: 5, Indices: []int{7, 11}},
+		{Sum: 6, Indices: []int{8, 12, 16}},
+		{Sum: 7, Indices: []int{9, 10, 13}},
+		{Sum: 5, Indices: []int{14, 15}},
+	}
 	SuDozen78097Values = []int{
 		5, 7, 0, 6, 0, 0, 0, 0, 0, 1, 11, 12,
 		11, 0, 0, 0, 0, 0, 10, 0, 0, 0, 0, 3,
@@ -201,6 +237,78 @@ func TestSolverPage(t *testing.T) {
 	if err != "" {
 		t.Errorf("Test Solver 3: got unexpected result body:\n%s:\n%v\n", err, body3)
 	}
+
+	session4, info4 := "httpx-Test4", &storage.PuzzleInfo{
+		PuzzleId:   "test-4-id",
+		Name:       "test-4",
+		Geometry:   puzzle.DiagonalGeometryName,
+		SideLength: 9,
+		Choices:    []puzzle.Choice{{1, 1}},
+		Remaining:  countZeroes(diagonal9Values) - 1,
+	}
+	body4 := SolverPage(session4, info4, diagonal9Values)
+	err = sameAsResultFile(body4, "TestSolverPage4.html")
+	if err != "" {
+		t.Errorf("Test Solver 4: got unexpected result body:\n%s:\n%v\n", err, body4)
+	}
+
+	session5, info5 := "httpx-Test5", &storage.PuzzleInfo{
+		PuzzleId:   "test-5-id",
+		Name:       "test-5",
+		Geometry:   puzzle.JigsawGeometryName,
+		SideLength: 6,
+		Regions:    jigsaw6Regions,
+		Choices:    []puzzle.Choice{},
+		Remaining:  countZeroes(jigsaw6Values),
+	}
+	body5 := SolverPage(session5, info5, jigsaw6Values)
+	err = sameAsResultFile(body5, "TestSolverPage5.html")
+	if err != "" {
+		t.Errorf("Test Solver 5: got unexpected result body:\n%s:\n%v\n", err, body5)
+	}
+
+	session6, info6 := "httpx-Test6", &storage.PuzzleInfo{
+		PuzzleId:   "test-6-id",
+		Name:       "test-6",
+		Geometry:   puzzle.StandardGeometryName,
+		SideLength: 4,
+		Cages:      killer4Cages,
+		Choices:    []puzzle.Choice{},
+		Remaining:  16,
+	}
+	body6 := SolverPage(session6, info6, make([]int, 16))
+	err = sameAsResultFile(body6, "TestSolverPage6.html")
+	if err != "" {
+		t.Errorf("Test Solver 6: got unexpected result body:\n%s:\n%v\n", err, body6)
+	}
+}
+
+// A layout with no tiles has borders only at the puzzle edges,
+// and a layout with no shades is shaded uniformly.
+func TestLayoutTemplatePuzzle(t *testing.T) {
+	layout := &puzzle.Layout{SideLength: 4, Marks: make([]string, 16)}
+	layout.Marks[5] = "house special"
+	if _, err := layoutTemplatePuzzle(layout, make([]int, 9)); err == nil {
+		t.Errorf("Template puzzle accepted the wrong number of values")
+	}
+	tp, err := layoutTemplatePuzzle(layout, rotation4Puzzle1PartialValues)
+	if err != nil {
+		t.Fatalf("Template puzzle failed: %v", err)
+	}
+	hborders := []string{"top", "middle", "middle", "bottom"}
+	vborders := []string{"left", "center", "center", "right"}
+	for i, row := range tp {
+		for j, cell := range row {
+			shade := "darker"
+			if i == 1 && j == 1 {
+				shade = "darker house special"
+			}
+			if cell.Index != 4*i+j+1 || cell.Shade != shade ||
+				cell.HBorder != hborders[i] || cell.VBorder != vborders[j] {
+				t.Errorf("Template cell (%d, %d) is %+v", i, j, cell)
+			}
+		}
+	}
 }
 
 /*
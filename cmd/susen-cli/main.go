@@ -21,6 +21,9 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/ancientHacker/susen.go/puzzle"
 	"github.com/ancientHacker/susen.go/storage"
@@ -33,7 +36,20 @@ import (
 	"time"
 )
 
+// flags
+var (
+	lang = flag.String("lang", puzzle.DefaultLocale,
+		"language of puzzle error messages (one of "+strings.Join(puzzle.Locales(), ", ")+
+			"); hints and explanations are always in English")
+)
+
 func main() {
+	// parse flags, if anything left over it's a usage problem
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
 	// log initialization
 	log.SetOutput(os.Stderr)
 	// storage initialization
@@ -148,6 +164,142 @@ func hintsHandler(s *session, w io.Writer, r *request) {
 	}
 }
 
+func hintHandler(s *session, w io.Writer, r *request) {
+	// check the args
+	if len(r.args) > 0 {
+		usageHandler(fmt.Sprintf("%s takes no arguments", r.command), w, r)
+		return
+	}
+	hint, err := s.puzzle().Hint()
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "No hint: %v\n", localize(err))
+	case hint == nil:
+		fmt.Fprintf(w, "No logical step is available.\n")
+	default:
+		fmt.Fprintf(w, "%s\n", hint.Message)
+	}
+}
+
+func minimalHandler(s *session, w io.Writer, r *request) {
+	// check the args
+	if len(r.args) > 0 {
+		usageHandler(fmt.Sprintf("%s takes no arguments", r.command), w, r)
+		return
+	}
+	// givens come from the starting puzzle, not the working one
+	m, err := s.ss.StartingPuzzle().Minimality()
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "No analysis: %v\n", localize(err))
+	case !m.Unique:
+		fmt.Fprintf(w, "Puzzle does not have a unique solution.\n")
+	case m.Minimal:
+		fmt.Fprintf(w, "Puzzle is minimal (%d givens).\n", m.Givens)
+	default:
+		slen := s.ss.Info.SideLength
+		names := make([]string, len(m.Redundant))
+		for i, c := range m.Redundant {
+			row, col := (c.Index-1)/slen, (c.Index-1)%slen+1
+			names[i] = fmt.Sprintf("%s%d=%d", puzzle.RowLabel(row), col, c.Value)
+		}
+		fmt.Fprintf(w, "Puzzle is not minimal (%d givens), each of these can be removed: %s.\n",
+			m.Givens, strings.Join(names, " "))
+	}
+}
+
+func statsHandler(s *session, w io.Writer, r *request) {
+	// the search stops at 2 solutions unless specified
+	options := puzzle.SolveOptions{MaxSolutions: 2, Stats: true}
+	for _, arg := range r.args {
+		switch {
+		case arg == "trace":
+			options.Trace = true
+		case strings.HasPrefix(arg, "max="):
+			max, err := strconv.Atoi(arg[len("max="):])
+			if err != nil || max < 0 {
+				usageHandler(fmt.Sprintf("%s argument (%s) has a bad number", r.command, arg), w, r)
+				return
+			}
+			options.MaxSolutions = max
+		default:
+			usageHandler(fmt.Sprintf("%s argument (%s) is not known", r.command, arg), w, r)
+			return
+		}
+	}
+	// statistics come from the starting puzzle, not the working one
+	result, err := s.ss.StartingPuzzle().SolutionsContext(context.Background(), options)
+	if err != nil {
+		fmt.Fprintf(w, "No statistics: %v\n", localize(err))
+		return
+	}
+	statsString := func(stats puzzle.SolveStats) string {
+		return fmt.Sprintf("%d nodes, %d backtracks, depth %d, %d passes, %v",
+			stats.Nodes, stats.Backtracks, stats.MaxDepth, stats.Passes, stats.WallTime)
+	}
+	for i, stats := range result.SolutionStats {
+		fmt.Fprintf(w, "Solution %d (rating %d): %s.\n", i+1, result.Solutions[i].Rating, statsString(stats))
+	}
+	fmt.Fprintf(w, "Search (%v, %d solutions): %s.\n",
+		result.Reason, len(result.Solutions), statsString(*result.Stats))
+	if options.Trace {
+		trace, err := json.MarshalIndent(result.Trace, "", "  ")
+		if err != nil {
+			fmt.Fprintf(w, "No trace: %v\n", err)
+			return
+		}
+		fmt.Fprintf(w, "%s\n", trace)
+	}
+}
+
+func generateHandler(s *session, w io.Writer, r *request) {
+	// the puzzle is like the current one unless specified
+	options := puzzle.GenerateOptions{
+		Geometry:   s.ss.Info.Geometry,
+		SideLength: s.ss.Info.SideLength,
+		Regions:    s.ss.Info.Regions,
+	}
+	// read the args
+	for _, arg := range r.args {
+		var err error
+		switch {
+		case arg == "symmetric":
+			options.Symmetric = true
+		case strings.HasPrefix(arg, "rating="):
+			options.Rating, err = strconv.Atoi(arg[len("rating="):])
+		case strings.HasPrefix(arg, "seed="):
+			options.Seed, err = strconv.ParseInt(arg[len("seed="):], 10, 64)
+		case arg[0] >= '0' && arg[0] <= '9':
+			options.SideLength, err = strconv.Atoi(arg)
+		default:
+			options.Geometry = arg
+		}
+		if err != nil {
+			usageHandler(fmt.Sprintf("%s argument (%s) has a bad number", r.command, arg), w, r)
+			return
+		}
+	}
+	if options.Geometry != s.ss.Info.Geometry || options.SideLength != s.ss.Info.SideLength {
+		options.Regions = nil
+	}
+
+	// generate the puzzle and add it to the session
+	summary, err := puzzle.Generate(&options)
+	if err != nil {
+		fmt.Fprintf(w, "No puzzle generated: %v\n", localize(err))
+		return
+	}
+	s.ss.AddPuzzle(summary)
+	log.Printf("Generated puzzle %q (seed %s, rating %s) for session %s.",
+		s.name(), summary.Metadata["seed"], summary.Metadata["rating"], s.sid)
+
+	// provide feedback
+	fmt.Fprintf(w, "Generated puzzle %s (seed %s, rating %s).\n",
+		s.name(), summary.Metadata["seed"], summary.Metadata["rating"])
+	r.args = nil
+	solveHandler(s, w, r)
+}
+
 func backHandler(s *session, w io.Writer, r *request) {
 	// check the args
 	if len(r.args) > 0 {
@@ -173,10 +325,21 @@ func assignHandler(s *session, w io.Writer, r *request) {
 	var choice puzzle.Choice
 	var err error
 	idx := r.args[0]
-	if row := int(idx[0] - 'a'); row < 0 || row >= s.ss.Info.SideLength {
+	split := strings.IndexFunc(idx, func(c rune) bool { return c < 'a' || c > 'z' })
+	if split < 0 {
+		split = len(idx)
+	}
+	row := -1
+	for ri := 0; ri < s.ss.Info.SideLength; ri++ {
+		if puzzle.RowLabel(ri) == idx[:split] {
+			row = ri
+			break
+		}
+	}
+	if row < 0 {
 		usageHandler(fmt.Sprintf("%s index (%s) row is out of range", r.command, idx), w, r)
 		return
-	} else if col, err := strconv.Atoi(idx[1:]); err != nil {
+	} else if col, err := strconv.Atoi(idx[split:]); err != nil {
 		usageHandler(fmt.Sprintf("%s index (%s) column is not a number", r.command, idx), w, r)
 		return
 	} else if col < 1 || col > s.ss.Info.SideLength {
@@ -232,13 +395,15 @@ func solveHandler(s *session, w io.Writer, r *request) {
 	}
 	// output the puzzle
 	if useMarkdown {
-		fmt.Fprintf(w, "%s%s",
+		fmt.Fprintf(w, "%s%s%s",
 			s.puzzle().ValuesMarkdown(showBindings),
-			s.puzzle().ErrorsMarkdown())
+			s.puzzle().CagesMarkdown(),
+			s.puzzle().LocalizedErrorsMarkdown(*lang))
 	} else {
-		fmt.Fprintf(w, "%s%s",
+		fmt.Fprintf(w, "%s%s%s",
 			s.puzzle().ValuesString(showBindings),
-			s.puzzle().ErrorsString())
+			s.puzzle().CagesString(),
+			s.puzzle().LocalizedErrorsString(*lang))
 	}
 }
 
@@ -276,6 +441,15 @@ func usageHandler(msg string, w io.Writer, r *request) {
 	fmt.Fprintf(os.Stderr, "  and 'quit' or EOF to exit.\n")
 }
 
+// localize returns the message for an error in the language
+// given by the -lang flag.
+func localize(err error) string {
+	if e, ok := err.(puzzle.Error); ok {
+		return e.Localize(*lang)
+	}
+	return err.Error()
+}
+
 func errorHandler(err interface{}, w io.Writer, r *request) {
 	log.Printf("Panic executing %+q: %v", r, err)
 }
@@ -421,12 +595,16 @@ func init() {
 	dispatchInfo = []commandInfo{
 		{"assign", "index value", "assign a value to a square", assignHandler},
 		{"back", "", "go back one solution step", backHandler},
+		{"generate", "[options]", "add a new puzzle: [geometry] [size] [rating=N] [symmetric] [seed=N]", generateHandler},
+		{"hint", "", "show the next logical step", hintHandler},
 		{"hints", "on|off", "show hints in puzzle state", hintsHandler},
 		{"home", "", "show current session summary", homeHandler},
 		{"markdown", "on|off", "format output in Markdown", markdownHandler},
+		{"minimal", "", "show which givens can be removed", minimalHandler},
 		{"reset", "[name]", "reset current or another puzzle", solveHandler},
 		{"session", "[sessionID]", "get/set session info", homeHandler},
 		{"solve", "[name]", "work on current or another puzzle", solveHandler},
+		{"stats", "[options]", "show solver statistics: [max=N] [trace]", statsHandler},
 	}
 	dispatchTable = make(map[string]*commandInfo, len(dispatchInfo))
 	for i := range dispatchInfo {
@@ -24,6 +24,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -138,3 +139,100 @@ func TestBackFail(t *testing.T) {
 		t.Errorf("Got %q, expected %q", result, expected)
 	}
 }
+
+func TestHint(t *testing.T) {
+	testSetup(t)
+	defer storage.Close()
+
+	in := bytes.NewBufferString("reset\nhint\n")
+	out := new(bytes.Buffer)
+	err := listener(out, in)
+	if err != nil {
+		t.Fatalf("CLI failure: %v", err)
+	}
+	result := out.String()
+	if !strings.HasSuffix(result, ".\n") || !strings.Contains(result, ": ") {
+		t.Errorf("Got %q, expected a hint", result)
+	}
+}
+
+func TestStats(t *testing.T) {
+	testSetup(t)
+	defer storage.Close()
+
+	in := bytes.NewBufferString("reset\nstats max=1 trace\n")
+	out := new(bytes.Buffer)
+	err := listener(out, in)
+	if err != nil {
+		t.Fatalf("CLI failure: %v", err)
+	}
+	result := out.String()
+	if !strings.Contains(result, "Solution 1 (rating ") || !strings.Contains(result, "Search (") {
+		t.Errorf("Got %q, expected solver statistics", result)
+	}
+	if !strings.Contains(result, `"kind": "solution"`) {
+		t.Errorf("Got %q, expected a solver trace", result)
+	}
+}
+
+func TestMinimal(t *testing.T) {
+	testSetup(t)
+	defer storage.Close()
+
+	in := bytes.NewBufferString("reset\nminimal\nminimal now\n")
+	out := new(bytes.Buffer)
+	err := listener(out, in)
+	if err != nil {
+		t.Fatalf("CLI failure: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	found := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Puzzle ") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Got %q, expected a minimality analysis", out.String())
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	testSetup(t)
+	defer storage.Close()
+
+	in := bytes.NewBufferString("generate square 4 seed=1 symmetric\ngenerate square 4 rating=9\n")
+	out := new(bytes.Buffer)
+	err := listener(out, in)
+	if err != nil {
+		t.Fatalf("CLI failure: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[0], "Generated puzzle puzzle-") || !strings.HasSuffix(lines[0], "(seed 1, rating 1).") {
+		t.Errorf("Got %q, expected a generated puzzle", lines[0])
+	}
+	if last := lines[len(lines)-2]; !strings.HasPrefix(last, "No puzzle generated: ") {
+		t.Errorf("Got %q, expected a rating error", last)
+	}
+}
+
+func TestLang(t *testing.T) {
+	oldlang := *lang
+	*lang = "ja"
+	defer func() { *lang = oldlang }()
+
+	testSetup(t)
+	defer storage.Close()
+
+	in := bytes.NewBufferString("generate square 4 rating=9\n")
+	out := new(bytes.Buffer)
+	err := listener(out, in)
+	if err != nil {
+		t.Fatalf("CLI failure: %v", err)
+	}
+	expected := "No puzzle generated: 無効な引数: 難易度 (9): 5以下でなければなりません\n"
+	result := out.String()
+	if result != expected {
+		t.Errorf("Got %q, expected %q", result, expected)
+	}
+}
@@ -19,11 +19,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ancientHacker/susen.go/client"
 	"github.com/ancientHacker/susen.go/puzzle"
 	"github.com/ancientHacker/susen.go/storage"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -119,7 +122,7 @@ func (s *session) name() string {
 
 // step count of working puzzle
 func (s *session) step() int {
-	return len(s.ss.Info.Choices) + 1
+	return s.ss.Info.Steps + 1
 }
 
 /*
@@ -161,7 +164,13 @@ func serveHttp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.load(w, r)
-	s.rootHandler(w, r)
+	// puzzle errors are sent in the client's preferred language;
+	// hints and explanations are always in English
+	locale := puzzle.MatchLocale(r.Header.Get("Accept-Language"))
+	if *debugLog {
+		log.Printf("Using locale %q for Accept-Language %q", locale, r.Header.Get("Accept-Language"))
+	}
+	s.rootHandler(w, r.WithContext(puzzle.WithLocale(r.Context(), locale)))
 }
 
 func (s *session) rootHandler(w http.ResponseWriter, r *http.Request) {
@@ -234,6 +243,59 @@ func (s *session) apiHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			sendNotAllowed()
 		}
+	case "hint":
+		if r.Method == "GET" {
+			if err := s.puzzle().HintHandler(w, r); err != nil {
+				log.Printf("Hint at %s:%q step %d failed: %v", s.sid, s.name(), s.step(), err)
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "solutions":
+		if r.Method == "GET" {
+			if err := s.puzzle().SolutionsHandler(w, r); err != nil {
+				log.Printf("Solutions at %s:%q step %d failed: %v", s.sid, s.name(), s.step(), err)
+			} else {
+				log.Printf("Returned solutions for %s:%q step %d (query %q).",
+					s.sid, s.name(), s.step(), r.URL.RawQuery)
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "explain":
+		if r.Method == "GET" {
+			if err := s.puzzle().ExplainHandler(w, r); err != nil {
+				log.Printf("Explain at %s:%q step %d failed: %v", s.sid, s.name(), s.step(), err)
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "minimality":
+		if r.Method == "GET" {
+			if err := s.ss.StartingPuzzle().MinimalityHandler(w, r); err != nil {
+				log.Printf("Minimality at %s:%q failed: %v", s.sid, s.name(), err)
+			} else {
+				log.Printf("Returned minimality for %s:%q.", s.sid, s.name())
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "generate":
+		if r.Method == "POST" {
+			summary, err := puzzle.GenerateHandler(w, r)
+			if summary == nil {
+				log.Printf("Generate for session %s failed: %v", s.sid, err)
+			} else {
+				s.ss.AddPuzzle(summary)
+				log.Printf("Generated puzzle %q (seed %s, rating %s) for session %s.",
+					s.name(), summary.Metadata["seed"], summary.Metadata["rating"], s.sid)
+				if err != nil {
+					log.Printf("WARNING: Result of generate for session %s failed to encode!", s.sid)
+				}
+			}
+		} else {
+			sendNotAllowed()
+		}
 	case "assign":
 		if r.Method == "POST" {
 			choice, update, err := s.puzzle().AssignHandler(w, r)
@@ -257,6 +319,66 @@ func (s *session) apiHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			sendNotAllowed()
 		}
+	case "unassign":
+		if r.Method == "POST" {
+			if !s.unassignable(r) {
+				http.Error(w, apiNotAChoice(), http.StatusBadRequest)
+				log.Printf("Unassign at %s:%q step %d was not of a choice: returned a BadRequest error.",
+					s.sid, s.name(), s.step())
+				return
+			}
+			index, update, err := s.puzzle().UnassignHandler(w, r)
+			if update == nil {
+				log.Printf("Unassign of %v at %s:%q step %d failed: %v",
+					index, s.sid, s.name(), s.step(), err)
+			} else {
+				log.Printf("Unassign of %v at %v:%q step %d done.",
+					*index, s.sid, s.name(), s.step())
+				s.ss.AddUnassignStep(*index)
+				if err != nil {
+					log.Printf("WARNING: Result of unassign at %v:%q step %d failed to encode!",
+						s.sid, s.name(), s.step())
+				}
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "mark":
+		if r.Method == "POST" {
+			mark, update, err := s.puzzle().MarkHandler(w, r)
+			if update == nil {
+				log.Printf("Mark of %+v at %s:%q step %d failed: %v",
+					mark, s.sid, s.name(), s.step(), err)
+			} else {
+				log.Printf("Mark of %+v at %v:%q step %d done.",
+					*mark, s.sid, s.name(), s.step())
+				s.ss.AddMarkStep(*mark)
+				if err != nil {
+					log.Printf("WARNING: Result of mark at %v:%q step %d failed to encode!",
+						s.sid, s.name(), s.step())
+				}
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "usemarks":
+		if r.Method == "POST" {
+			use, update, err := s.puzzle().UseMarksHandler(w, r)
+			if update == nil {
+				log.Printf("Use marks %v at %s:%q step %d failed: %v",
+					use, s.sid, s.name(), s.step(), err)
+			} else {
+				log.Printf("Use marks %v at %v:%q step %d done.",
+					*use, s.sid, s.name(), s.step())
+				s.ss.AddUseMarksStep(*use)
+				if err != nil {
+					log.Printf("WARNING: Result of use marks at %v:%q step %d failed to encode!",
+						s.sid, s.name(), s.step())
+				}
+			}
+		} else {
+			sendNotAllowed()
+		}
 	default:
 		sendNotFound()
 	}
@@ -469,9 +591,58 @@ various low-level utilities
 
 */
 
-// apiEndpointUnknown: a pre-serialized JSON Error used when
+// unassignable: check whether a posted unassign request is for
+// a square the player chose, rather than one given by the
+// puzzle.  The request body is left for the handler to decode,
+// and it reports any decoding errors.
+func (s *session) unassignable(r *http.Request) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var index int
+	if err := json.Unmarshal(body, &index); err != nil {
+		return true
+	}
+	for _, choice := range s.ss.Info.Choices {
+		if choice.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// apiNotAChoice: a serialized JSON Error used when someone
+// tries to unassign a square that was given by the puzzle.
+func apiNotAChoice() string {
+	return apiError(puzzle.Error{
+		Scope:     puzzle.RequestScope,
+		Structure: puzzle.ScopeStructure,
+		Condition: puzzle.GeneralCondition,
+		Values:    puzzle.ErrorData{"Not a choice"},
+		Message:   "Only chosen squares can be unassigned",
+	})
+}
+
+// apiEndpointUnknown: a serialized JSON Error used when
 // someone calls a non-existent API endpoint.
 func apiEndpointUnknown(endpoint string) string {
-	return `{"scope": "1", "structure": "1", "condition": "1", "values": ["No such endpoint"], ` +
-		`"message": "No such endpoint: ` + endpoint + `"}`
+	return apiError(puzzle.Error{
+		Scope:     puzzle.RequestScope,
+		Structure: puzzle.ScopeStructure,
+		Condition: puzzle.GeneralCondition,
+		Values:    puzzle.ErrorData{"No such endpoint"},
+		Message:   "No such endpoint: " + endpoint,
+	})
+}
+
+// apiError serializes an Error, which can't fail because its
+// values are all strings.
+func apiError(err puzzle.Error) string {
+	b, e := json.Marshal(err)
+	if e != nil {
+		panic(e)
+	}
+	return string(b)
 }
@@ -0,0 +1,2 @@
+alter table puzzles
+  drop column regionList;
@@ -0,0 +1,3 @@
+-- irregular geometries (such as jigsaw) keep a region map per puzzle
+alter table puzzles
+  add column regionList int array; -- puzzle's region map, if any
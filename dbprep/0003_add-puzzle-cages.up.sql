@@ -0,0 +1,3 @@
+-- killer puzzles keep their cages with the puzzle
+alter table puzzles
+  add column cageList int array; -- flattened array of <sum, count, indices...> cages
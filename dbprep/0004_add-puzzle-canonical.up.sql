@@ -0,0 +1,5 @@
+-- equivalent puzzles (rotations, relabelings, ...) share a canonical signature
+alter table puzzles
+  add column canonicalId text; -- puzzle's canonical signature, if known
+-- look up puzzles by canonical signature
+create index on puzzles (canonicalId);
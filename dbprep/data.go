@@ -37,8 +37,10 @@ type dataFunction func(*pgx.Tx) error
 var (
 	upFunctions = []dataFunction{
 		insertSamples,
+		insertSampleSolutions,
 	}
 	downFunctions = []dataFunction{
+		deleteSampleSolutions,
 		deleteSamples,
 	}
 )
@@ -293,15 +295,7 @@ func insertSamples(tx *pgx.Tx) error {
 
 	// first save the puzzles
 	for i, sum := range samplePuzzles {
-		values := make([]int32, len(sum.Values))
-		for i, v := range sum.Values {
-			values[i] = int32(v) // use 4-byte ints in database
-		}
-		_, err := tx.Exec(
-			"INSERT INTO puzzles (puzzleId, geometry, sideLength, valueList, created) "+
-				"VALUES ($1, $2, $3, $4, $5)",
-			sampleHashes[i], sum.Geometry, int32(sum.SideLength), values, now)
-		if err != nil {
+		if err := insertPuzzle(tx, sampleHashes[i], sum, now); err != nil {
 			return fmt.Errorf("Database error saving sample puzzle %d: %v", i, err)
 		}
 	}
@@ -329,6 +323,38 @@ func insertSamples(tx *pgx.Tx) error {
 	return nil
 }
 
+// Insert a puzzle, given its summary, into the puzzles table
+func insertPuzzle(tx *pgx.Tx, id string, sum *puzzle.Summary, created time.Time) error {
+	values := make([]int32, len(sum.Values))
+	for i, v := range sum.Values {
+		values[i] = int32(v) // use 4-byte ints in database
+	}
+	var regions []int32
+	if len(sum.Regions) > 0 {
+		regions = make([]int32, len(sum.Regions))
+		for i, r := range sum.Regions {
+			regions[i] = int32(r)
+		}
+	}
+	var cages []int32 // flattened array of <sum, count, indices...> cages
+	for _, c := range sum.Cages {
+		cages = append(cages, int32(c.Sum), int32(len(c.Indices)))
+		for _, idx := range c.Indices {
+			cages = append(cages, int32(idx))
+		}
+	}
+	canonical, _, err := sum.CanonicalSignature()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO puzzles "+
+			"(puzzleId, geometry, sideLength, valueList, regionList, cageList, canonicalId, created) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		id, sum.Geometry, int32(sum.SideLength), values, regions, cages, string(canonical), created)
+	return err
+}
+
 // Delete the common puzzles
 func deleteSamples(tx *pgx.Tx) error {
 	// first remove the puzzle summaries from the database
@@ -355,3 +381,110 @@ func deleteSamples(tx *pgx.Tx) error {
 	}
 	return nil
 }
+
+/*
+
+insert the solutions of the sample puzzles
+
+*/
+
+// Solve the sample puzzles and save their solutions, with their
+// ratings.  Solutions are puzzles in their own right, so each is
+// also saved in the puzzles table (unless it's already there).
+func insertSampleSolutions(tx *pgx.Tx) error {
+	now := time.Now()
+	for i, sum := range samplePuzzles {
+		// idempotency: skip puzzles whose solutions are saved
+		var count int64
+		row := tx.QueryRow("SELECT COUNT(*) FROM solutions "+
+			"WHERE puzzleId = $1", sampleHashes[i])
+		if err := row.Scan(&count); err != nil {
+			return fmt.Errorf("Database error looking for sample puzzle %d solutions: %v", i, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		p, err := puzzle.New(sum)
+		if err != nil {
+			return fmt.Errorf("Can't create sample puzzle %d: %v", i, err)
+		}
+		solns, err := p.Solutions()
+		if err != nil {
+			return fmt.Errorf("Can't solve sample puzzle %d: %v", i, err)
+		}
+		for j, soln := range solns {
+			ssum := &puzzle.Summary{
+				Geometry:   sum.Geometry,
+				SideLength: sum.SideLength,
+				Values:     soln.Values,
+				Regions:    sum.Regions,
+				Cages:      sum.Cages,
+			}
+			hash, err := ssum.Hash()
+			if err != nil {
+				return fmt.Errorf("Can't happen! Sample puzzle %d solution %d is invalid!", i, j)
+			}
+			row := tx.QueryRow("SELECT COUNT(*) FROM puzzles "+
+				"WHERE puzzleId = $1", string(hash))
+			if err := row.Scan(&count); err != nil {
+				return fmt.Errorf("Database error looking for sample puzzle %d solution %d: %v", i, j, err)
+			}
+			if count == 0 {
+				if err := insertPuzzle(tx, string(hash), ssum, now); err != nil {
+					return fmt.Errorf("Database error saving sample puzzle %d solution %d: %v", i, j, err)
+				}
+			}
+			var choices []int32 // flattened array of <index, choice> pairs
+			for _, c := range soln.Choices {
+				choices = append(choices, int32(c.Index), int32(c.Value))
+			}
+			_, err = tx.Exec(
+				"INSERT INTO solutions (puzzleId, solutionId, choicePairs, rating) "+
+					"VALUES ($1, $2, $3, $4)",
+				sampleHashes[i], string(hash), choices, int32(soln.Rating))
+			if err != nil {
+				return fmt.Errorf("Database error saving sample puzzle %d solution %d: %v", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete the solutions of the sample puzzles, and the solution
+// puzzles themselves (unless something else refers to them)
+func deleteSampleSolutions(tx *pgx.Tx) error {
+	for i, hash := range sampleHashes {
+		var ids []string
+		rows, err := tx.Query(
+			"SELECT solutionId FROM solutions WHERE puzzleId = $1", hash)
+		if err != nil {
+			return fmt.Errorf("Database error finding sample puzzle %d solutions: %v", i, err)
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("Database error reading sample puzzle %d solutions: %v", i, err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		_, err = tx.Exec(
+			"DELETE from solutions where puzzleId = $1", hash)
+		if err != nil {
+			return fmt.Errorf("Database error deleting sample puzzle %d solutions: %v", i, err)
+		}
+		for j, id := range ids {
+			_, err := tx.Exec(
+				"DELETE from puzzles where puzzleId = $1 "+
+					"AND NOT EXISTS (SELECT 1 FROM solutions WHERE puzzleId = $1 OR solutionId = $1) "+
+					"AND NOT EXISTS (SELECT 1 FROM sessionEntries WHERE puzzleId = $1)", id)
+			if err != nil {
+				return fmt.Errorf("Database error deleting sample puzzle %d solution %d: %v", i, j, err)
+			}
+		}
+	}
+	return nil
+}
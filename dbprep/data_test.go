@@ -19,6 +19,7 @@
 package dbprep
 
 import (
+	"github.com/ancientHacker/susen.go/puzzle"
 	"strings"
 	"testing"
 )
@@ -36,3 +37,22 @@ func TestSampleData(t *testing.T) {
 		}
 	}
 }
+
+// make sure the sample solutions can be saved
+func TestSampleSolutions(t *testing.T) {
+	for i, sum := range samplePuzzles {
+		p, err := puzzle.New(sum)
+		if err != nil {
+			t.Fatalf("Sample %d can't be created: %v", i, err)
+		}
+		solns, err := p.Solutions()
+		if err != nil || len(solns) == 0 {
+			t.Fatalf("Sample %d has no solutions (error %v)", i, err)
+		}
+		for j, soln := range solns {
+			if soln.Rating < 1 || soln.Rating > 5 || soln.Grade == nil {
+				t.Errorf("Sample %d solution %d has rating %d and grade %v", i, j, soln.Rating, soln.Grade)
+			}
+		}
+	}
+}
@@ -0,0 +1,613 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"sort"
+)
+
+/*
+
+Canonical forms
+
+Puzzles that differ only by a symmetry of their geometry are
+really the same puzzle, so we want them to share a signature.
+We get one by transforming each puzzle into a canonical form,
+which is the least of all the forms the puzzle can be
+transformed into, and hashing that.
+
+The symmetries depend on the geometry.  Square and rectangular
+puzzles can have their bands (rows of tiles) and stacks (columns
+of tiles) permuted, and the rows within each band and the
+columns within each stack permuted; square puzzles can also be
+transposed.  Together these include all the rotations and
+reflections allowed by the tiles.  Diagonal puzzles can have
+their rows permuted in the same way if the permutation is
+symmetric about the middle (taking rows i and n-1-i to rows j
+and n-1-j) and the columns get the same permutation or its
+reverse; they can also be transposed.  These are the symmetries
+that keep both diagonals, such as the rotations and reflections,
+or swapping the first and last bands together with the first
+and last stacks.  Jigsaw puzzles can only be rotated and
+reflected, since those are the only symmetries
+that preserve their (arbitrary) region maps.  Puzzles of
+registered geometries have no known symmetries.  In every geometry, the values can be relabeled,
+unless the puzzle has cages, whose sums depend on the values.
+
+The forms are compared square by square: first the squares of
+the first band (the first tile's height of rows), column by
+column, and then the remaining squares in index order.  Each
+square is compared first by its value, then by the sum of its
+cage, then by its cage, and then by its region.  Values, cages
+and regions are numbered in the order they appear in the form
+(so the first value to appear is always 1), except that values
+aren't renumbered in puzzles with cages.  Empty squares sort
+after assigned ones, so the assigned values are collected at
+the start of the form.  (Going column by column in the first
+band matters because of the renumbering: every order of the
+columns gives the same numbers to a full first row, but not to
+a full first band.)
+
+To find the least form, we do a depth-first search that chooses
+the rows of the first band, then the columns (which fix the rest
+of the first band), then the other rows.  We abandon a choice as
+soon as the form it gives is bigger than the least form found so
+far, and at each step we only try the lines that give the least
+squares, since the squares they give come before all the squares
+given by later choices.  Two blank lines (with no values, cages
+or regions) in the same band or stack can be swapped without
+changing the puzzle, so we only try one of them.  In diagonal
+puzzles, the columns of the first band are matched to its rows,
+and the rows after the first band are matched to their columns.
+
+*/
+
+// A symmetryMode says which geometric symmetries a puzzle has.
+type symmetryMode int
+
+const (
+	noSymmetry       symmetryMode = iota // only the identity
+	dihedralSymmetry                     // rotations and reflections
+	tileSymmetry                         // band, stack, row, and column permutations
+	diagonalSymmetry                     // symmetric permutations, the same for rows and columns
+)
+
+// A canonicalKey is what is compared in each square of a form.
+type canonicalKey struct {
+	value, sum, cage, region int
+}
+
+// compare returns -1, 0, or 1 as key k is less than, equal to,
+// or greater than key o.
+func (k canonicalKey) compare(o canonicalKey) int {
+	switch {
+	case k.value != o.value:
+		return sign(k.value - o.value)
+	case k.sum != o.sum:
+		return sign(k.sum - o.sum)
+	case k.cage != o.cage:
+		return sign(k.cage - o.cage)
+	default:
+		return sign(k.region - o.region)
+	}
+}
+
+// sign returns the sign of n.
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// A canonicalizer holds the state of the search for a canonical
+// form.  The squares are indexed from 0 in its slices, and the
+// rows and columns are those of the puzzle after any
+// transposition.
+type canonicalizer struct {
+	n, h, w    int          // side length, band height, stack width
+	mode       symmetryMode // the geometric symmetries
+	relabel    bool         // whether values can be renumbered
+	transposes []bool       // the transpositions to try
+	values     []int        // the value of each square
+	sums       []int        // the sum of each square's cage
+	cages      []int        // the cage of each square
+	regions    []int        // the region of each square
+	transpose  bool         // whether the current form is transposed
+	blankRows  []bool       // which rows are blank
+	blankCols  []bool       // which columns are blank
+	rows, cols []int        // the rows and columns chosen so far
+	rused      []bool       // which rows have been chosen
+	cused      []bool       // which columns have been chosen
+	vlabels    []int        // the numbers given to values so far
+	clabels    []int        // the numbers given to cages so far
+	rlabels    []int        // the numbers given to regions so far
+	vnext      int          // the last number given to a value
+	cnext      int          // the last number given to a cage
+	rnext      int          // the last number given to a region
+	undo       []*int       // the labels given, for backtracking
+	out, best  []canonicalKey
+	less       int        // where out became less than best, or -1
+	found      *Transform // the transform that gives best
+}
+
+// A canonicalMark records the labeling state, for backtracking.
+type canonicalMark struct {
+	undo, vnext, cnext, rnext int
+}
+
+// newCanonicalizer sets up the search for the canonical form of
+// a puzzle with the given mapping, values, regions, and cages.
+// The values must be either empty or one per square.
+func newCanonicalizer(pm *puzzleMapping, values, regions []int, cages []Cage) *canonicalizer {
+	n := pm.sidelen
+	c := &canonicalizer{
+		n: n, h: pm.tileY, w: pm.tileX,
+		relabel:    len(cages) == 0,
+		transposes: []bool{false},
+		values:     make([]int, pm.scount),
+		sums:       make([]int, pm.scount),
+		cages:      make([]int, pm.scount),
+		regions:    make([]int, pm.scount),
+		blankRows:  make([]bool, n),
+		blankCols:  make([]bool, n),
+		rows:       make([]int, n),
+		cols:       make([]int, n),
+		rused:      make([]bool, n),
+		cused:      make([]bool, n),
+		vlabels:    make([]int, n+1),
+		clabels:    make([]int, len(cages)+1),
+		rlabels:    make([]int, pm.scount+1),
+		out:        make([]canonicalKey, pm.scount),
+		less:       -1,
+	}
+	switch pm.geometry {
+	case StandardGeometryName, RectangularGeometryName:
+		c.mode = tileSymmetry
+		if c.h == c.w {
+			c.transposes = append(c.transposes, true)
+		}
+	case DiagonalGeometryName:
+		c.mode = diagonalSymmetry
+		c.transposes = append(c.transposes, true)
+	case JigsawGeometryName:
+		c.mode = dihedralSymmetry
+		c.transposes = append(c.transposes, true)
+	}
+	copy(c.values, values)
+	copy(c.regions, regions)
+	for ci, cage := range cages {
+		for _, i := range cage.Indices {
+			c.sums[i-1], c.cages[i-1] = cage.Sum, ci+1
+		}
+	}
+	return c
+}
+
+// square returns the index of the square in row r and column col
+// of the (possibly transposed) puzzle.
+func (c *canonicalizer) square(r, col int) int {
+	if c.transpose {
+		r, col = col, r
+	}
+	return r*c.n + col
+}
+
+// isBlank returns whether a square has no value, cage, or region.
+func (c *canonicalizer) isBlank(i int) bool {
+	return c.values[i] == 0 && c.cages[i] == 0 && c.regions[i] == 0
+}
+
+// findBlanks finds the blank rows and columns of the (possibly
+// transposed) puzzle.
+func (c *canonicalizer) findBlanks() {
+	for i := 0; i < c.n; i++ {
+		c.blankRows[i], c.blankCols[i] = true, true
+	}
+	for r := 0; r < c.n; r++ {
+		for col := 0; col < c.n; col++ {
+			if !c.isBlank(c.square(r, col)) {
+				c.blankRows[r], c.blankCols[col] = false, false
+			}
+		}
+	}
+}
+
+// label returns the number given to x (0 if x is 0), giving it
+// the next number if it doesn't have one yet.
+func (c *canonicalizer) label(labels []int, next *int, x int) int {
+	if x == 0 {
+		return 0
+	}
+	if labels[x] == 0 {
+		*next++
+		labels[x] = *next
+		c.undo = append(c.undo, &labels[x])
+	}
+	return labels[x]
+}
+
+// mark returns the current labeling state.
+func (c *canonicalizer) mark() canonicalMark {
+	return canonicalMark{len(c.undo), c.vnext, c.cnext, c.rnext}
+}
+
+// unwind restores a previous labeling state.
+func (c *canonicalizer) unwind(m canonicalMark) {
+	for _, l := range c.undo[m.undo:] {
+		*l = 0
+	}
+	c.undo = c.undo[:m.undo]
+	c.vnext, c.cnext, c.rnext = m.vnext, m.cnext, m.rnext
+}
+
+// key returns the key for the square in row r and column col,
+// labeling its value, cage, and region as needed.
+func (c *canonicalizer) key(r, col int) canonicalKey {
+	i := c.square(r, col)
+	k := canonicalKey{value: c.values[i], sum: c.sums[i]}
+	if k.value == 0 {
+		k.value = c.n + 1
+	} else if c.relabel {
+		k.value = c.label(c.vlabels, &c.vnext, k.value)
+	}
+	k.cage = c.label(c.clabels, &c.cnext, c.cages[i])
+	k.region = c.label(c.rlabels, &c.rnext, c.regions[i])
+	return k
+}
+
+// place puts a key at a position of the current form, and
+// returns whether the form can still be the least one.
+func (c *canonicalizer) place(pos int, k canonicalKey) bool {
+	c.out[pos] = k
+	if c.less < 0 && c.best != nil {
+		switch k.compare(c.best[pos]) {
+		case 1:
+			return false
+		case -1:
+			c.less = pos
+		}
+	}
+	return true
+}
+
+// backtrack forgets that the current form is less than the best
+// one, if it became less at or after the given position.
+func (c *canonicalizer) backtrack(pos int) {
+	if c.less >= pos {
+		c.less = -1
+	}
+}
+
+// candidates returns the lines (rows or columns) that can be
+// chosen as line i of the form, given the lines chosen so far.
+// The lines are in groups of size size (bands or stacks).
+func (c *canonicalizer) candidates(i, size int, chosen []int, used, blank []bool) []int {
+	switch c.mode {
+	case tileSymmetry:
+		lo, hi := 0, c.n
+		if i%size != 0 {
+			lo = chosen[i-1] / size * size
+			hi = lo + size
+		}
+		var result []int
+		triedBlank := make([]bool, c.n/size)
+		for x := lo; x < hi; x++ {
+			if used[x] {
+				continue
+			}
+			if blank[x] {
+				if triedBlank[x/size] {
+					continue
+				}
+				triedBlank[x/size] = true
+			}
+			result = append(result, x)
+		}
+		return result
+	case diagonalSymmetry:
+		return c.mirrorCandidates(i, size, chosen, used)
+	case dihedralSymmetry:
+		if i == 0 {
+			return []int{0, c.n - 1}
+		}
+		if chosen[0] != 0 {
+			return []int{c.n - 1 - i}
+		}
+	}
+	return []int{i}
+}
+
+// mirrorCandidates returns the lines that can be chosen as line
+// i of the form in a diagonal puzzle.  These keep the groups
+// together, as for tile symmetry, and also keep the choice
+// symmetric: if line i is line x, then line n-1-i must be line
+// n-1-x, so the middle line and group (if any) must stay in the
+// middle.  Blank lines can't be skipped, because the same
+// choice is made for the lines in the other direction.
+func (c *canonicalizer) mirrorCandidates(i, size int, chosen []int, used []bool) []int {
+	mi, groups := c.n-1-i, c.n/size
+	if mi < i {
+		return []int{c.n - 1 - chosen[mi]}
+	}
+	middle := func(x int) bool { return x/size == groups-1-x/size }
+	lo, hi := 0, c.n
+	if i%size != 0 {
+		lo = chosen[i-1] / size * size
+		hi = lo + size
+	}
+	var result []int
+	for x := lo; x < hi; x++ {
+		mx := c.n - 1 - x
+		if used[x] || (mi == i) != (mx == x) || middle(i) != middle(x) {
+			continue
+		}
+		if mi > i && used[mx] {
+			continue
+		}
+		result = append(result, x)
+	}
+	return result
+}
+
+// matching returns the lines that can be chosen as line i of the
+// form in a diagonal puzzle, when it has to match line i in the
+// other direction.  The lines of the other direction are given
+// by others.  The first line can match either way, and the
+// others match the way the first one did.
+func (c *canonicalizer) matching(i int, others, chosen []int) []int {
+	x := others[i]
+	switch {
+	case i == 0:
+		return []int{x, c.n - 1 - x}
+	case chosen[0] != others[0]:
+		return []int{c.n - 1 - x}
+	}
+	return []int{x}
+}
+
+// search finds the least form of the puzzle.
+func (c *canonicalizer) search() {
+	for _, t := range c.transposes {
+		c.transpose = t
+		c.findBlanks()
+		c.searchBand(0)
+	}
+}
+
+// searchBand chooses row i of the first band of the form.  The
+// rows of the first band don't give any squares until the
+// columns are chosen.
+func (c *canonicalizer) searchBand(i int) {
+	if i == c.h {
+		c.searchColumns(0)
+		return
+	}
+	for _, r := range c.candidates(i, c.h, c.rows, c.rused, c.blankRows) {
+		c.rows[i], c.rused[r] = r, true
+		c.searchBand(i + 1)
+		c.rused[r] = false
+	}
+}
+
+// searchColumns chooses column j of the form, which gives the
+// squares in column j of the first band.
+func (c *canonicalizer) searchColumns(j int) {
+	if j == c.n {
+		c.searchRows(c.h)
+		return
+	}
+	var cands []int
+	if c.mode == diagonalSymmetry && j < c.h {
+		cands = c.matching(j, c.rows, c.cols)
+	} else {
+		cands = c.candidates(j, c.w, c.cols, c.cused, c.blankCols)
+	}
+	for _, col := range c.least(cands, c.h, func(i, col int) canonicalKey { return c.key(c.rows[i], col) }) {
+		m := c.mark()
+		ok := true
+		for i := 0; i < c.h && ok; i++ {
+			ok = c.place(j*c.h+i, c.key(c.rows[i], col))
+		}
+		if ok {
+			c.cols[j], c.cused[col] = col, true
+			c.searchColumns(j + 1)
+			c.cused[col] = false
+		}
+		c.unwind(m)
+		c.backtrack(j * c.h)
+	}
+}
+
+// searchRows chooses row i of the form (after the first band),
+// which gives all the squares in that row.
+func (c *canonicalizer) searchRows(i int) {
+	if i == c.n {
+		c.record()
+		return
+	}
+	var cands []int
+	if c.mode == diagonalSymmetry {
+		cands = c.matching(i, c.cols, c.rows)
+	} else {
+		cands = c.candidates(i, c.h, c.rows, c.rused, c.blankRows)
+	}
+	for _, r := range c.least(cands, c.n, func(j, r int) canonicalKey { return c.key(r, c.cols[j]) }) {
+		m := c.mark()
+		ok := true
+		for j := 0; j < c.n && ok; j++ {
+			ok = c.place(i*c.n+j, c.key(r, c.cols[j]))
+		}
+		if ok {
+			c.rows[i], c.rused[r] = r, true
+			c.searchRows(i + 1)
+			c.rused[r] = false
+		}
+		c.unwind(m)
+		c.backtrack(i * c.n)
+	}
+}
+
+// least returns the candidate lines that give the least keys,
+// where key(k, x) is the key of the k-th of the size squares
+// given by line x.  Since the squares given by a line come
+// before those of later lines in the form, the least form must
+// use one of these lines.
+func (c *canonicalizer) least(cands []int, size int, key func(k, x int) canonicalKey) []int {
+	if len(cands) < 2 {
+		return cands
+	}
+	var result []int
+	least, keys := make([]canonicalKey, size), make([]canonicalKey, size)
+	for _, x := range cands {
+		m := c.mark()
+		cmp := 0
+		for k := 0; k < size; k++ {
+			keys[k] = key(k, x)
+			if cmp == 0 && len(result) > 0 {
+				cmp = keys[k].compare(least[k])
+			}
+		}
+		c.unwind(m)
+		switch {
+		case len(result) == 0 || cmp < 0:
+			result = append(result[:0], x)
+			least, keys = keys, least
+		case cmp == 0:
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// record makes the current form the best one, unless it's the
+// same as the best one.
+func (c *canonicalizer) record() {
+	if c.best != nil && c.less < 0 {
+		return
+	}
+	c.best = append(c.best[:0], c.out...)
+	c.less = -1
+	t := &Transform{
+		Transpose: c.transpose,
+		Rows:      append([]int(nil), c.rows...),
+		Columns:   append([]int(nil), c.cols...),
+	}
+	if c.relabel {
+		t.Values = make([]int, c.n+1)
+		next := c.vnext
+		for v := 1; v <= c.n; v++ {
+			if t.Values[v] = c.vlabels[v]; t.Values[v] == 0 {
+				next++
+				t.Values[v] = next
+			}
+		}
+	}
+	c.found = t
+}
+
+// form returns the values, regions, and cages of the best form.
+// The regions and cages are numbered in order of appearance, and
+// the indices in each cage are in order.
+func (c *canonicalizer) form() (values, regions []int, cages []Cage) {
+	values = make([]int, len(c.best))
+	if c.regions[0] != 0 {
+		regions = make([]int, len(c.best))
+	}
+	for pos, k := range c.best {
+		i := pos
+		if band := c.h * c.n; pos < band {
+			i = pos%c.h*c.n + pos/c.h
+		}
+		if k.value <= c.n {
+			values[i] = k.value
+		}
+		if regions != nil {
+			regions[i] = k.region
+		}
+		if k.cage != 0 {
+			if k.cage > len(cages) {
+				cages = append(cages, Cage{Sum: k.sum})
+			}
+			cages[k.cage-1].Indices = append(cages[k.cage-1].Indices, i+1)
+		}
+	}
+	for _, cage := range cages {
+		sort.Ints(cage.Indices)
+	}
+	return
+}
+
+// canonicalSignature returns the signature of the canonical form
+// of a puzzle with the given mapping, values, regions, and
+// cages, together with the transform from the canonical form
+// back to the given puzzle.
+func canonicalSignature(pm *puzzleMapping, values, regions []int, cages []Cage) (Signature, *Transform) {
+	c := newCanonicalizer(pm, values, regions, cages)
+	c.search()
+	vals, rs, cs := c.form()
+	return computeHash(pm.geometry, pm.sidelen, vals, rs, cs), c.found.inverse(pm.sidelen)
+}
+
+// CanonicalSignature returns a Signature for the canonical form
+// of the puzzle, which is shared by every puzzle that can be
+// transformed into this one by a symmetry of its geometry (such
+// as a rotation, or a relabeling of its values).  It also
+// returns the transform that takes the canonical form to this
+// puzzle (up to the numbering of its regions and the order of
+// its cages).
+func (p *Puzzle) CanonicalSignature() (Signature, *Transform, error) {
+	if !p.isValid() {
+		return "", nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	sig, t := canonicalSignature(p.mapping, p.allValues(), p.mapping.regions, p.allCages())
+	return sig, t, nil
+}
+
+// CanonicalSignature returns a Signature for the canonical form
+// of the summarized puzzle, and the transform that takes the
+// canonical form to the summarized puzzle, just as for Puzzles.
+func (s *Summary) CanonicalSignature() (Signature, *Transform, error) {
+	layout, e := NewLayout(s)
+	if e != nil {
+		return "", nil, e
+	}
+	pm := layout.mapping
+	if vlen := len(s.Values); vlen != 0 && vlen != pm.scount {
+		return "", nil, argumentError(SummaryAttribute, InvalidArgumentCondition, s)
+	}
+	for _, v := range s.Values {
+		if v < 0 || v > pm.sidelen {
+			return "", nil, argumentError(SummaryAttribute, InvalidArgumentCondition, s)
+		}
+	}
+	for _, cage := range s.Cages {
+		for _, i := range cage.Indices {
+			if i < 1 || i > pm.scount {
+				return "", nil, argumentError(CageAttribute, InvalidArgumentCondition, cage)
+			}
+		}
+	}
+	sig, t := canonicalSignature(pm, s.Values, pm.regions, s.Cages)
+	return sig, t, nil
+}
@@ -0,0 +1,254 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// helperPermutation returns a random permutation of the n
+// numbers starting at base.
+func helperPermutation(r *rand.Rand, base, n int) []int {
+	perm := r.Perm(n)
+	for i := range perm {
+		perm[i] += base
+	}
+	return perm
+}
+
+// helperTileOrder returns a random order of n lines that are in
+// groups of size size, keeping the groups together.
+func helperTileOrder(r *rand.Rand, n, size int) []int {
+	var order []int
+	for _, g := range r.Perm(n / size) {
+		order = append(order, helperPermutation(r, g*size, size)...)
+	}
+	return order
+}
+
+// helperMirrorOrder returns a random order of n lines that is
+// symmetric about the middle: if line i is line x, then line
+// n-1-i is line n-1-x.
+func helperMirrorOrder(r *rand.Rand, n int) []int {
+	order := make([]int, n)
+	for i, x := range r.Perm(n / 2) {
+		if r.Intn(2) == 1 {
+			x = n - 1 - x
+		}
+		order[i], order[n-1-i] = x, n-1-x
+	}
+	if n%2 == 1 {
+		order[n/2] = n / 2
+	}
+	return order
+}
+
+// helperMirrorTileOrder returns a random order of n lines that
+// are in groups of size size, keeping the groups together and
+// the order symmetric about the middle.
+func helperMirrorTileOrder(r *rand.Rand, n, size int) []int {
+	order := make([]int, n)
+	groups := helperMirrorOrder(r, n/size)
+	for g, to := range groups {
+		if mg := len(groups) - 1 - g; mg < g {
+			continue
+		} else if mg == g {
+			for k, x := range helperMirrorOrder(r, size) {
+				order[g*size+k] = to*size + x
+			}
+			continue
+		}
+		for k, x := range r.Perm(size) {
+			order[g*size+k] = to*size + x
+			order[n-1-g*size-k] = n - 1 - to*size - x
+		}
+	}
+	return order
+}
+
+// helperRandomTransform returns a random transform of a puzzle
+// that is a symmetry of its geometry.
+func helperRandomTransform(r *rand.Rand, pm *puzzleMapping, relabel bool) *Transform {
+	n := pm.sidelen
+	t := &Transform{}
+	switch pm.geometry {
+	case StandardGeometryName, RectangularGeometryName:
+		t.Transpose = pm.tileX == pm.tileY && r.Intn(2) == 1
+		t.Rows = helperTileOrder(r, n, pm.tileY)
+		t.Columns = helperTileOrder(r, n, pm.tileX)
+	case DiagonalGeometryName:
+		t.Transpose = r.Intn(2) == 1
+		t.Rows = helperMirrorTileOrder(r, n, pm.tileY)
+		t.Columns = append([]int(nil), t.Rows...)
+		if r.Intn(2) == 1 {
+			for i := range t.Columns {
+				t.Columns[i] = n - 1 - t.Rows[i]
+			}
+		}
+	case JigsawGeometryName:
+		t.Transpose = r.Intn(2) == 1
+		t.Rows, t.Columns = make([]int, n), make([]int, n)
+		rrev, crev := r.Intn(2) == 1, r.Intn(2) == 1
+		for i := 0; i < n; i++ {
+			t.Rows[i], t.Columns[i] = i, i
+			if rrev {
+				t.Rows[i] = n - 1 - i
+			}
+			if crev {
+				t.Columns[i] = n - 1 - i
+			}
+		}
+	}
+	if relabel {
+		t.Values = append([]int{0}, helperPermutation(r, 1, n)...)
+	}
+	return t
+}
+
+func TestCanonicalSignature(t *testing.T) {
+	tcs := []*Summary{
+		{Geometry: StandardGeometryName, SideLength: 4, Values: multiChoiceStartValues},
+		{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: fiveStarValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: multiSolutionValues},
+		{Geometry: StandardGeometryName, SideLength: 9},
+		{Geometry: StandardGeometryName, SideLength: 16},
+		{Geometry: RectangularGeometryName, SideLength: 6, Values: Su6Difficult1Values},
+		{Geometry: RectangularGeometryName, SideLength: 12, Values: SuDozen61054Values},
+		{Geometry: DiagonalGeometryName, SideLength: 9, Values: diagonal9Values},
+		{Geometry: JigsawGeometryName, SideLength: 6, Values: jigsaw6Values, Regions: jigsaw6Regions},
+		{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages},
+	}
+	r := rand.New(rand.NewSource(1))
+	for i, tc := range tcs {
+		sig, tf, e := tc.CanonicalSignature()
+		if e != nil {
+			t.Fatalf("test %d: Failed to get canonical signature: %v", i+1, e)
+		}
+		layout, _ := NewLayout(tc)
+		n, plain := tc.SideLength, len(tc.Regions) == 0 && len(tc.Cages) == 0
+		canon := tf.inverse(n).apply(tc)
+		if plain {
+			if hash, _ := canon.Hash(); len(tc.Values) > 0 && hash != sig {
+				t.Errorf("test %d: Canonical form has signature %v, expected %v", i+1, hash, sig)
+			}
+		}
+		if p, e := New(tc); e == nil {
+			if psig, _, _ := p.CanonicalSignature(); psig != sig {
+				t.Errorf("test %d: Puzzle signature is %v, expected %v", i+1, psig, sig)
+			}
+		}
+		for j := 0; j < 5; j++ {
+			rt := helperRandomTransform(r, layout.mapping, len(tc.Cages) == 0)
+			ts := rt.apply(tc)
+			tsig, ttf, e := ts.CanonicalSignature()
+			if e != nil {
+				t.Fatalf("test %d.%d: Failed to get canonical signature: %v", i+1, j+1, e)
+			}
+			if tsig != sig {
+				t.Errorf("test %d.%d: Transformed puzzle has signature %v, expected %v", i+1, j+1, tsig, sig)
+			}
+			if back := ttf.apply(canon); !reflect.DeepEqual(back.Values, ts.Values) {
+				t.Errorf("test %d.%d: Transform gave %v from canonical form, expected %v",
+					i+1, j+1, back.Values, ts.Values)
+			}
+		}
+	}
+}
+
+func TestCanonicalSignatureDiagonal(t *testing.T) {
+	// swapping the first and last bands together with the first
+	// and last stacks keeps both diagonals
+	swapped := &Transform{
+		Rows:    []int{6, 7, 8, 3, 4, 5, 0, 1, 2},
+		Columns: []int{6, 7, 8, 3, 4, 5, 0, 1, 2},
+	}
+	s := &Summary{Geometry: DiagonalGeometryName, SideLength: 9, Values: diagonal9Values}
+	sig, _, e := s.CanonicalSignature()
+	if e != nil {
+		t.Fatalf("Failed to get canonical signature: %v", e)
+	}
+	if ssig, _, e := swapped.apply(s).CanonicalSignature(); e != nil {
+		t.Fatalf("Failed to get swapped canonical signature: %v", e)
+	} else if ssig != sig {
+		t.Errorf("Swapped puzzle has signature %v, expected %v", ssig, sig)
+	}
+	// swapping just the bands doesn't
+	swapped.Columns = []int{0, 1, 2, 3, 4, 5, 6, 7, 8}
+	if ssig, _, e := swapped.apply(s).CanonicalSignature(); e != nil {
+		t.Fatalf("Failed to get swapped canonical signature: %v", e)
+	} else if ssig == sig {
+		t.Errorf("Puzzle with only its bands swapped has signature %v, expected a different one", ssig)
+	}
+}
+
+func TestCanonicalSignatureDistinct(t *testing.T) {
+	swapped := append([]int(nil), oneStarValues...)
+	copy(swapped[0:9], oneStarValues[27:36])
+	copy(swapped[27:36], oneStarValues[0:9])
+	tcs := []*Summary{
+		{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: swapped},
+		{Geometry: DiagonalGeometryName, SideLength: 9, Values: oneStarValues},
+		{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages},
+		{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages[1:]},
+	}
+	seen := make(map[Signature]int)
+	for i, tc := range tcs {
+		sig, _, e := tc.CanonicalSignature()
+		if e != nil {
+			t.Fatalf("test %d: Failed to get canonical signature: %v", i+1, e)
+		}
+		if j, ok := seen[sig]; ok {
+			t.Errorf("test %d: Same signature as test %d", i+1, j)
+		}
+		seen[sig] = i + 1
+	}
+}
+
+func TestCanonicalSignatureErrors(t *testing.T) {
+	tcs := []*Summary{
+		nil,
+		{Geometry: StandardGeometryName, SideLength: 4, Values: oneStarValues},
+		{Geometry: StandardGeometryName, SideLength: 4, Values: []int{5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{Geometry: StandardGeometryName, SideLength: 4, Cages: []Cage{{3, []int{1, 17}}}},
+		{Geometry: "pentagonal", SideLength: 4},
+	}
+	for i, tc := range tcs {
+		if _, _, e := tc.CanonicalSignature(); e == nil {
+			t.Errorf("test %d: Expected an error", i+1)
+		}
+	}
+	var p *Puzzle
+	if _, _, e := p.CanonicalSignature(); e == nil {
+		t.Errorf("Nil puzzle gave no error")
+	}
+}
+
+func BenchmarkCanonicalSignature(b *testing.B) {
+	s := &Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues}
+	for i := 0; i < b.N; i++ {
+		s.CanonicalSignature()
+	}
+}
@@ -0,0 +1,362 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+)
+
+/*
+
+Dancing links solver
+
+This is a second solver, independent of Ariadne's thread, that
+uses Knuth's Algorithm X with dancing links.  A puzzle is an
+exact cover problem: every square needs exactly one value, and
+every group needs each value exactly once.  So the matrix has a
+column for each square and a column for each (group, value)
+pair, and a row for each (square, value) pair, which covers the
+square's column and the value's column in each of the square's
+groups.  Since the matrix is built from the puzzle mapping, it
+works for every geometry.
+
+The rows for a puzzle are its assigned values and the possible
+values of its empty squares, so the search starts from the
+puzzle's propagated state.  Cages don't fit into an exact cover,
+so the search prunes partial covers instead: at each node, every
+cage must still be able to reach its sum, given the values
+chosen for its squares and the rows left for its other squares.
+At a full cover this is exactly the check that the cages are
+satisfied.
+
+When the search has to choose among several rows for a column,
+the row it chooses is reported as a Choice of the solution, so
+the solutions have the same form as those from Ariadne's thread
+(but may have different choices, and come in a different order).
+
+*/
+
+// A SolverBackend selects the algorithm used to find solutions.
+type SolverBackend int
+
+// Constants for the solver backends.  Ariadne's thread is the
+// default.
+const (
+	AriadneBackend SolverBackend = iota
+	DancingLinksBackend
+)
+
+// SolverBackends implement Stringer
+func (b SolverBackend) String() string {
+	switch b {
+	case AriadneBackend:
+		return "ariadne"
+	case DancingLinksBackend:
+		return "dlx"
+	default:
+		return "unknown solver backend"
+	}
+}
+
+// A dlx is the dancing links representation of the exact cover
+// problem for a puzzle.  Node 0 is the root, the next nodes are
+// the column headers, and the remaining nodes are the entries of
+// the rows.  Each entry knows its column and the choice its row
+// stands for.
+type dlx struct {
+	left, right, up, down []int
+	col                   []int    // col[n] = the header of node n's column
+	size                  []int    // size[c] = the number of rows in column c
+	choice                []Choice // choice[n] = the choice for node n's row
+	chosen                []int    // the rows (nodes) chosen so far
+	branches              int      // how many of the chosen rows were branches
+	branched              []bool   // branched[i] = whether chosen[i] was a branch
+	cages                 []*cage  // the puzzle's cages
+	value                 []int    // value[i] = the value chosen for square i, if any
+	sidelen               int      // the largest value
+}
+
+// newDLX builds the dancing links matrix for a puzzle.
+func newDLX(p *Puzzle) *dlx {
+	pm := p.mapping
+	ncols := pm.scount + pm.gcount*pm.sidelen
+	d := &dlx{cages: p.cages, value: make([]int, pm.scount+1), sidelen: pm.sidelen}
+	for c := 0; c <= ncols; c++ {
+		d.left = append(d.left, c-1)
+		d.right = append(d.right, c+1)
+		d.up = append(d.up, c)
+		d.down = append(d.down, c)
+		d.col = append(d.col, c)
+		d.choice = append(d.choice, Choice{})
+	}
+	d.left[0], d.right[ncols] = ncols, 0
+	d.size = make([]int, ncols+1)
+	for i := 1; i <= pm.scount; i++ {
+		if s := p.squares[i]; s.aval != 0 {
+			d.addRow(pm, i, s.aval)
+		} else {
+			for v := s.pvals.next(0); v != 0; v = s.pvals.next(v) {
+				d.addRow(pm, i, v)
+			}
+		}
+	}
+	return d
+}
+
+// addRow adds the row for assigning a value to a square.  The
+// square's column is the square's index, and the column for the
+// value in group gi follows all the square columns.
+func (d *dlx) addRow(pm *puzzleMapping, index, value int) {
+	cols := []int{index}
+	for _, gi := range pm.ixmap[index] {
+		cols = append(cols, pm.scount+(gi-1)*pm.sidelen+value)
+	}
+	first := len(d.col)
+	for k, c := range cols {
+		n := len(d.col)
+		d.left = append(d.left, n-1)
+		d.right = append(d.right, n+1)
+		d.up = append(d.up, d.up[c])
+		d.down = append(d.down, c)
+		d.col = append(d.col, c)
+		d.choice = append(d.choice, Choice{index, value})
+		d.down[d.up[c]] = n
+		d.up[c] = n
+		d.size[c]++
+		if k == 0 {
+			d.left[n] = n + len(cols) - 1
+		}
+	}
+	d.right[len(d.col)-1] = first
+}
+
+// cover removes a column from the header list, and removes the
+// column's rows from all the other columns.
+func (d *dlx) cover(c int) {
+	d.right[d.left[c]], d.left[d.right[c]] = d.right[c], d.left[c]
+	for i := d.down[c]; i != c; i = d.down[i] {
+		for j := d.right[i]; j != i; j = d.right[j] {
+			d.down[d.up[j]], d.up[d.down[j]] = d.down[j], d.up[j]
+			d.size[d.col[j]]--
+		}
+	}
+}
+
+// uncover undoes cover, in reverse order.
+func (d *dlx) uncover(c int) {
+	for i := d.up[c]; i != c; i = d.up[i] {
+		for j := d.left[i]; j != i; j = d.left[j] {
+			d.size[d.col[j]]++
+			d.down[d.up[j]], d.up[d.down[j]] = j, j
+		}
+	}
+	d.right[d.left[c]], d.left[d.right[c]] = c, c
+}
+
+// search looks for exact covers, calling found with each one.
+// The search stops if found returns true or if the search's
+// bounds are reached, in which case search returns true.  Each
+// column with more than one row is a node of the search, just
+// as a choice is in solve.
+func (d *dlx) search(s *search, found func() bool) bool {
+	if !d.cagesFeasible() {
+		return false
+	}
+	if d.right[0] == 0 {
+		return found()
+	}
+	// choose the first column with the fewest rows
+	c := d.right[0]
+	for j := d.right[c]; j != 0; j = d.right[j] {
+		if d.size[j] < d.size[c] {
+			c = j
+		}
+	}
+	if d.size[c] == 0 {
+		return false
+	}
+	branch := d.size[c] > 1
+	if branch && s.stopped() {
+		return true
+	}
+	stop := false
+	d.cover(c)
+	for r := d.down[c]; r != c && !stop; r = d.down[r] {
+		d.chosen, d.branched = append(d.chosen, r), append(d.branched, branch)
+		d.value[d.choice[r].Index] = d.choice[r].Value
+		for j := d.right[r]; j != r; j = d.right[j] {
+			d.cover(d.col[j])
+		}
+		stop = d.search(s, found)
+		for j := d.left[r]; j != r; j = d.left[j] {
+			d.uncover(d.col[j])
+		}
+		d.value[d.choice[r].Index] = 0
+		d.chosen, d.branched = d.chosen[:len(d.chosen)-1], d.branched[:len(d.branched)-1]
+	}
+	d.uncover(c)
+	return stop
+}
+
+// values returns the values of the puzzle squares given by the
+// chosen rows, which must be a cover.
+func (d *dlx) values(scount int) []int {
+	vals := make([]int, scount)
+	for _, r := range d.chosen {
+		vals[d.choice[r].Index-1] = d.choice[r].Value
+	}
+	return vals
+}
+
+// choices returns the choices made at the branches of the
+// search, in the order they were made.
+func (d *dlx) choices() []Choice {
+	choices := []Choice{}
+	for i, r := range d.chosen {
+		if d.branched[i] {
+			choices = append(choices, d.choice[r])
+		}
+	}
+	return choices
+}
+
+// cagesFeasible returns whether every cage can still reach its
+// sum.  The values chosen for a cage's squares must differ, and
+// the rest of the sum must lie within the bounds given by the
+// rows left for the cage's other squares, and by the smallest
+// and largest values not yet used in the cage.
+func (d *dlx) cagesFeasible() bool {
+	for _, c := range d.cages {
+		var used valueset
+		rest, open, lo, hi := c.sum, 0, 0, 0
+		for _, i := range c.indices {
+			if v := d.value[i]; v != 0 {
+				if used.insert(v) {
+					return false
+				}
+				rest -= v
+				continue
+			}
+			// the square's column is uncovered, so its
+			// rows are the values it can still have
+			open++
+			min, max := 0, 0
+			for r := d.down[i]; r != i; r = d.down[r] {
+				v := d.choice[r].Value
+				if min == 0 || v < min {
+					min = v
+				}
+				if v > max {
+					max = v
+				}
+			}
+			if max == 0 {
+				return false
+			}
+			lo, hi = lo+min, hi+max
+		}
+		if open == 0 {
+			if rest != 0 {
+				return false
+			}
+			continue
+		}
+		// open distinct values not used in the cage
+		least, most := 0, 0
+		for v, n := 1, 0; v <= d.sidelen && n < open; v++ {
+			if !used.has(v) {
+				least, n = least+v, n+1
+			}
+		}
+		for v, n := d.sidelen, 0; v >= 1 && n < open; v-- {
+			if !used.has(v) {
+				most, n = most+v, n+1
+			}
+		}
+		if least > lo {
+			lo = least
+		}
+		if most < hi {
+			hi = most
+		}
+		if rest < lo || rest > hi {
+			return false
+		}
+	}
+	return true
+}
+
+// dlxSolutions finds the solutions to a given puzzle using
+// dancing links, within the bounds of a search.  As with
+// solutions, puzzles that can be solved by logic alone have the
+// logical solution, and the solutions are graded by adding the
+// choices as guesses to the logical grade of the puzzle.  The
+// puzzle is not altered.
+func (p *Puzzle) dlxSolutions(s *search) []Solution {
+	// first see if logical techniques are enough
+	r, grade := p.logicalSolution(s)
+	if r.solutions == nil && len(p.errors) == 0 {
+		// choices needed: dance
+		d := newDLX(p)
+		d.search(s, func() bool {
+			vals := d.values(p.mapping.scount)
+			choices := d.choices()
+			S := Solution{Values: vals, Choices: choices, Grade: grade.guessed(len(choices))}
+			S.Rating = S.Grade.rating()
+			r.add(S, s.solved(nil))
+			if len(r.solutions) == s.maxSolutions {
+				s.stop(SolutionLimitStop)
+				return true
+			}
+			return false
+		})
+	}
+	s.found = r.stats
+	return r.solutions
+}
+
+// CountSolutions counts the solutions to a puzzle, within the
+// bounds given by the options (only MaxSolutions, MaxNodes, and
+// Deadline apply), stopping early if the context is done.  The
+// count is returned along with the reason the search stopped.
+// It uses dancing links, and doesn't grade the solutions it
+// finds, so it's the fast way to check a puzzle: the puzzle has
+// a unique solution if counting with a MaxSolutions of 2 gives 1
+// and the search is complete.  The puzzle is not altered.
+func (p *Puzzle) CountSolutions(ctx context.Context, options SolveOptions) (int, StopReason, error) {
+	if !p.isValid() {
+		return 0, CompleteStop, argumentError(PuzzleAttribute, InvalidArgumentCondition)
+	}
+	if len(p.errors) > 0 {
+		return 0, CompleteStop, nil
+	}
+	s, cancel := boundedSearch(ctx, options)
+	defer cancel()
+	count := 0
+	d := newDLX(p)
+	d.search(s, func() bool {
+		count++
+		if count == s.maxSolutions {
+			s.stop(SolutionLimitStop)
+			return true
+		}
+		return false
+	})
+	return count, s.reason, nil
+}
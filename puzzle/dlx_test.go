@@ -0,0 +1,272 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// helperValueKeys returns the values of some solutions in a
+// canonical order, so solutions found by different backends can
+// be compared.
+func helperValueKeys(solns []Solution) []string {
+	keys := make([]string, len(solns))
+	for i, s := range solns {
+		keys[i] = fmt.Sprint(s.Values)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDLXSolutions(t *testing.T) {
+	tcs := []struct {
+		summary *Summary
+		max     int
+	}{
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: multiChoiceStartValues}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: fiveStarValues}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: multiSolutionValues}, 0},
+		{&Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: Su6Difficult1Values}, 0},
+		{&Summary{Geometry: RectangularGeometryName, SideLength: 12, Values: SuDozen61054Values}, 0},
+		{&Summary{Geometry: DiagonalGeometryName, SideLength: 4, Values: diagonal4Values}, 0},
+		{&Summary{Geometry: DiagonalGeometryName, SideLength: 9, Values: diagonal9Values}, 0},
+		{&Summary{Geometry: JigsawGeometryName, SideLength: 6, Values: jigsaw6Values, Regions: jigsaw6Regions}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages[:3]}, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: make([]int, 81)}, 10},
+	}
+	for i, tc := range tcs {
+		p, e := New(tc.summary)
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		ariadne, e := p.SolutionsContext(context.Background(), SolveOptions{MaxSolutions: tc.max})
+		if e != nil {
+			t.Fatalf("test %d: Failed to solve puzzle: %v", i+1, e)
+		}
+		options := SolveOptions{MaxSolutions: tc.max, Backend: DancingLinksBackend}
+		dlx, e := p.SolutionsContext(context.Background(), options)
+		if e != nil {
+			t.Fatalf("test %d: Failed to dance puzzle: %v", i+1, e)
+		}
+		if dlx.Reason != ariadne.Reason {
+			t.Errorf("test %d: DLX stopped for %v, expected %v", i+1, dlx.Reason, ariadne.Reason)
+		}
+		if len(dlx.Solutions) != len(ariadne.Solutions) {
+			t.Errorf("test %d: DLX found %d solutions, expected %d",
+				i+1, len(dlx.Solutions), len(ariadne.Solutions))
+			continue
+		}
+		for j, soln := range dlx.Solutions {
+			if !p.allows(soln.Values) {
+				t.Errorf("test %d: DLX solution %d isn't a solution: %v", i+1, j+1, soln.Values)
+			}
+			if soln.Grade == nil || soln.Rating != soln.Grade.rating() {
+				t.Errorf("test %d: DLX solution %d is misgraded: %+v", i+1, j+1, soln)
+			}
+		}
+		if tc.max == 0 && !reflect.DeepEqual(helperValueKeys(dlx.Solutions), helperValueKeys(ariadne.Solutions)) {
+			t.Errorf("test %d: DLX solutions differ from Ariadne solutions", i+1)
+		}
+	}
+}
+
+func TestDLXSolutionsStopped(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: make([]int, 256)})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	options := SolveOptions{MaxNodes: 10, Backend: DancingLinksBackend}
+	result, e := p.SolutionsContext(context.Background(), options)
+	if e != nil {
+		t.Fatalf("Failed to solve puzzle: %v", e)
+	}
+	if result.Reason != NodeLimitStop || result.Nodes != 10 {
+		t.Errorf("Stopped for %v after %d nodes, expected %v after 10", result.Reason, result.Nodes, NodeLimitStop)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, e = p.SolutionsContext(ctx, SolveOptions{Backend: DancingLinksBackend})
+	if e != nil {
+		t.Fatalf("Failed to solve puzzle: %v", e)
+	}
+	if result.Reason != CanceledStop || len(result.Solutions) != 0 {
+		t.Errorf("Got %d solutions (stopped: %v), expected none (stopped: %v)",
+			len(result.Solutions), result.Reason, CanceledStop)
+	}
+
+	_, e = p.SolutionsContext(context.Background(), SolveOptions{Backend: SolverBackend(7)})
+	if err, ok := e.(Error); !ok || err.Attribute != BackendAttribute {
+		t.Errorf("Unknown backend gave error %v, expected a backend error", e)
+	}
+}
+
+func TestCountSolutions(t *testing.T) {
+	tcs := []struct {
+		summary *Summary
+		max     int
+		count   int
+	}{
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: multiChoiceStartValues}, 0, 4},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues}, 0, 288},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues}, 2, 2},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1}, 0, 0},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues}, 2, 1},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: fiveStarValues}, 0, 2},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: make([]int, 81)}, 100, 100},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages}, 2, 1},
+	}
+	for i, tc := range tcs {
+		p, e := New(tc.summary)
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		count, reason, e := p.CountSolutions(context.Background(), SolveOptions{MaxSolutions: tc.max})
+		if e != nil {
+			t.Fatalf("test %d: Failed to count solutions: %v", i+1, e)
+		}
+		ereason := CompleteStop
+		if tc.max > 0 && tc.count == tc.max {
+			ereason = SolutionLimitStop
+		}
+		if count != tc.count || reason != ereason {
+			t.Errorf("test %d: Counted %d solutions (stopped: %v), expected %d (stopped: %v)",
+				i+1, count, reason, tc.count, ereason)
+		}
+	}
+
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: make([]int, 81)})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if _, reason, _ := p.CountSolutions(context.Background(), SolveOptions{MaxNodes: 10}); reason != NodeLimitStop {
+		t.Errorf("Counting with a node budget stopped for %v, expected %v", reason, NodeLimitStop)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if count, reason, _ := p.CountSolutions(ctx, SolveOptions{}); count != 0 || reason != CanceledStop {
+		t.Errorf("Counted %d solutions (stopped: %v), expected none (stopped: %v)", count, reason, CanceledStop)
+	}
+
+	p = nil
+	if _, _, e := p.CountSolutions(context.Background(), SolveOptions{MaxSolutions: 2}); e == nil {
+		t.Errorf("Counting solutions of a nil puzzle didn't fail")
+	}
+}
+
+// killer9Cages returns the cages of a 9x9 killer puzzle with no
+// givens, whose cages cover a valid solution grid in runs of the
+// given width along each row, and in pairs down what's left.
+func killer9Cages(width int) []Cage {
+	grid := make([]int, 81)
+	for r := 0; r < 9; r++ {
+		for c := 0; c < 9; c++ {
+			grid[r*9+c] = (r*3+r/3+c)%9 + 1
+		}
+	}
+	var cages []Cage
+	var rest []int
+	for r := 0; r < 9; r++ {
+		c := 0
+		for ; c+width <= 9; c += width {
+			cage := Cage{}
+			for i := r*9 + c + 1; i <= r*9+c+width; i++ {
+				cage.Sum, cage.Indices = cage.Sum+grid[i-1], append(cage.Indices, i)
+			}
+			cages = append(cages, cage)
+		}
+		for ; c < 9; c++ {
+			rest = append(rest, r*9+c+1)
+		}
+	}
+	for len(rest) > 0 {
+		cage := Cage{}
+		for _, i := range rest[:2-len(rest)%2] {
+			cage.Sum, cage.Indices = cage.Sum+grid[i-1], append(cage.Indices, i)
+		}
+		cages, rest = append(cages, cage), rest[len(cage.Indices):]
+	}
+	return cages
+}
+
+func TestDLXKillerPruning(t *testing.T) {
+	for _, width := range []int{2, 3} {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Cages: killer9Cages(width)})
+		if e != nil {
+			t.Fatalf("Failed to create puzzle with cages of %d: %v", width, e)
+		}
+		// the cages are checked as the cover is built, so the
+		// search shouldn't have to wander
+		options := SolveOptions{MaxSolutions: 2, MaxNodes: 5000, Backend: DancingLinksBackend}
+		result, e := p.SolutionsContext(context.Background(), options)
+		if e != nil {
+			t.Fatalf("Failed to solve puzzle with cages of %d: %v", width, e)
+		}
+		if result.Reason == NodeLimitStop || len(result.Solutions) == 0 {
+			t.Errorf("Cages of %d: got %d solutions (stopped: %v) in %d nodes",
+				width, len(result.Solutions), result.Reason, result.Nodes)
+		}
+		for _, S := range result.Solutions {
+			for _, c := range p.cages {
+				var used valueset
+				total := 0
+				for _, i := range c.indices {
+					if used.insert(S.Values[i-1]) {
+						total = -1
+						break
+					}
+					total += S.Values[i-1]
+				}
+				if total != c.sum {
+					t.Errorf("Cages of %d: solution %v breaks cage %v", width, S.Values, c.indices)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkDLXSolutions(b *testing.B) {
+	p, e := New(&Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: make([]int, 36)})
+	if e != nil {
+		b.Fatalf("Failed to create puzzle: %v", e)
+	}
+	options := SolveOptions{MaxSolutions: 500, Backend: DancingLinksBackend}
+	for i := 0; i < b.N; i++ {
+		p.SolutionsContext(context.Background(), options)
+	}
+}
+
+func BenchmarkCountSolutions(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues})
+	if e != nil {
+		b.Fatalf("Failed to create puzzle: %v", e)
+	}
+	for i := 0; i < b.N; i++ {
+		p.CountSolutions(context.Background(), SolveOptions{MaxSolutions: 2})
+	}
+}
@@ -19,7 +19,9 @@
 package puzzle
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 /*
@@ -29,17 +31,31 @@ Errors
 */
 
 // An Error describes a problem with a puzzle or a requested
-// operation.  It can produce an error message in English, but
-// its main function is to support localized error messaging by
-// clients.  It tells the client "this thing failed to meet this
-// condition", and provides supplemental details about the thing
-// and the condition.
+// operation.  It can produce an error message in any language
+// in the message catalog, but its main function is to support
+// localized error messaging by clients.  It tells the client
+// "this thing failed to meet this condition", and provides
+// supplemental details about the thing and the condition.
+//
+// In JSON, the scope, structure, condition, and attribute are
+// sent as symbolic names (such as "argument" and "tooLarge"),
+// which never change, rather than as the numbers of the
+// constants, which change when constants are added.  The JSON
+// also has the version of its wire format (ErrorFormat).  For
+// backward compatibility, the numbers are still accepted as
+// input.
+//
+// Errors about the content of a puzzle, and about out-of-range
+// arguments, also have typed Details, so clients can find the
+// squares, groups, and values involved without depending on the
+// order of the Values.
 type Error struct {
 	Scope     ErrorScope     `json:"scope"`
 	Structure ErrorStructure `json:"structure,omitempty"`
 	Condition ErrorCondition `json:"condition,omitempty"`
 	Attribute ErrorAttribute `json:"attribute,omitempty"`
 	Values    ErrorData      `json:"values,omitempty"`
+	Details   ErrorDetails   `json:"details,omitempty"`
 	Message   string         `json:"message,omitempty"` // custom message
 }
 
@@ -100,6 +116,16 @@ const (
 	WrongPuzzleSizeCondition
 	InvalidArgumentCondition
 	MismatchedSummaryErrorsCondition
+	NonContiguousRegionCondition
+	WrongRegionSizeCondition
+	ImpossibleCageSumCondition
+	WrongCageSumCondition
+	DuplicateGeometryCondition
+	WrongGroupSizeCondition
+	NotAssignedCondition
+	NotSymmetryCondition
+	NothingToUndoCondition
+	StoppedCondition
 	MaxCondition
 )
 
@@ -126,6 +152,15 @@ const (
 	SideLengthAttribute
 	PuzzleAttribute
 	SummaryAttribute
+	RegionsAttribute
+	RegionAttribute
+	CageAttribute
+	LayoutAttribute
+	PropagationAttribute
+	RatingAttribute
+	BackendAttribute
+	TransformAttribute
+	TraceAttribute
 	MaxAttribute
 )
 
@@ -138,119 +173,349 @@ const (
 // Sadly, there is no good way to express this condition in a way
 // the compiler can check it, so we just have to rely on
 // implementors to "do the right thing" and check the condition
-// at runtime.
+// at runtime.  The ErrorDetails, which are typed, should be
+// preferred where they are available.
 type ErrorData []interface{}
 
+// ErrorDetails are the typed details of an Error.  Which type of
+// details an Error has depends on its condition: see the
+// documentation of each type.  The details include the indices
+// of the squares involved in the Error, if there are any.
+type ErrorDetails interface {
+	Indices() []int
+}
+
+// RangeDetails are the details of an Error with condition
+// TooLargeCondition or TooSmallCondition: the value that was out
+// of range, and the range.
+type RangeDetails struct {
+	Value int `json:"value"`
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+}
+
+// Indices returns nil, since no squares are involved.
+func (d *RangeDetails) Indices() []int {
+	return nil
+}
+
+// AssignmentDetails are the details of an Error with condition
+// DuplicateAssignmentCondition: the square, the value that
+// couldn't be used, and the value the square already has.
+type AssignmentDetails struct {
+	Index    int `json:"index"`
+	Value    int `json:"value"`
+	Assigned int `json:"assigned"`
+}
+
+// Indices returns the square that was already assigned.
+func (d *AssignmentDetails) Indices() []int {
+	return []int{d.Index}
+}
+
+// SquareDetails are the details of an Error with condition
+// NotInSetCondition or NoPossibleValuesCondition: the square, the
+// values that were assigned, bound, or removed, and the values
+// that were possible (for NotInSetCondition).
+type SquareDetails struct {
+	Index    int   `json:"index"`
+	Values   []int `json:"values"`
+	Possible []int `json:"possible,omitempty"`
+}
+
+// Indices returns the square with the problem.
+func (d *SquareDetails) Indices() []int {
+	return []int{d.Index}
+}
+
+// GroupDetails are the details of an Error with condition
+// NoGroupValueCondition or DuplicateGroupValuesCondition: the
+// group (which may be a cage), the value, and the squares that
+// conflict over the value.  For duplicates, these are the
+// squares that have or need the value.  For missing values,
+// this is the square whose assignment, binding, or removal
+// conflicts with the group's binding of the value (if there is
+// one).
+type GroupDetails struct {
+	Group   GroupID `json:"group"`
+	Value   int     `json:"value"`
+	Squares []int   `json:"squares,omitempty"`
+}
+
+// Indices returns the squares that conflict.
+func (d *GroupDetails) Indices() []int {
+	return d.Squares
+}
+
+// CageDetails are the details of an Error with condition
+// ImpossibleCageSumCondition or WrongCageSumCondition: the cage,
+// its sum, and the total of its assigned values (for
+// WrongCageSumCondition).
+type CageDetails struct {
+	Cage  GroupID `json:"cage"`
+	Sum   int     `json:"sum"`
+	Total int     `json:"total,omitempty"`
+}
+
+// Indices returns nil, since the whole cage is involved.
+func (d *CageDetails) Indices() []int {
+	return nil
+}
+
+// newDetails returns empty details of the type used by Errors with
+// the given condition, or nil if they have no details.
+func newDetails(cond ErrorCondition) ErrorDetails {
+	switch cond {
+	case TooLargeCondition, TooSmallCondition:
+		return &RangeDetails{}
+	case DuplicateAssignmentCondition:
+		return &AssignmentDetails{}
+	case NotInSetCondition, NoPossibleValuesCondition:
+		return &SquareDetails{}
+	case NoGroupValueCondition, DuplicateGroupValuesCondition:
+		return &GroupDetails{}
+	case ImpossibleCageSumCondition, WrongCageSumCondition:
+		return &CageDetails{}
+	}
+	return nil
+}
+
 // Return an error string from an Error.  If the Error has a
 // pre-canned message, this will use it, otherwise it will
-// produce an appropriate (English, non-localized) message.
+// produce an appropriate English message from the message
+// catalog.  Use Localize for messages in other languages.
 func (e Error) Error() string {
-	es := e.Message
-	if len(es) > 0 {
-		return es
+	if len(e.Message) > 0 {
+		return e.Message
 	}
-	values := e.Values
-	nextVal := func() interface{} {
-		if len(values) == 0 {
-			return "<unknown>"
-		}
-		val := values[0]
-		values = values[1:]
-		return val
+	return catalogs[DefaultLocale].message(e)
+}
+
+/*
+
+JSON encoding of Errors
+
+*/
+
+// ErrorFormat is the version of the JSON wire format of Errors.
+// Version 1 sent error codes as numbers; version 2 sends them as
+// names.
+const ErrorFormat = 2
+
+// MarshalJSON encodes an Error along with the wire format version.
+func (e Error) MarshalJSON() ([]byte, error) {
+	type wireError Error // without the MarshalJSON method
+	return json.Marshal(struct {
+		Format int `json:"format"`
+		wireError
+	}{ErrorFormat, wireError(e)})
+}
+
+// UnmarshalJSON decodes an Error, decoding its details into the
+// type used for its condition.  Details of unknown type are
+// dropped.
+func (e *Error) UnmarshalJSON(b []byte) error {
+	type wireError Error // without the UnmarshalJSON method
+	var w struct {
+		wireError
+		Details json.RawMessage `json:"details"`
 	}
-	switch e.Scope {
-	case RequestScope:
-		es = "Invalid request: "
-	case ArgumentScope:
-		es = "Invalid argument: "
-	case GeometryScope:
-		es = "Invalid geometry: "
-	case GroupScope:
-		es = fmt.Sprintf("Problem in %v: ", nextVal())
-	case SquareScope:
-		es = fmt.Sprintf("Problem in square %v: ", nextVal())
-	case InternalScope:
-		es = "Internal logic error: "
-	default:
-		es = "Unknown error: "
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
 	}
-	if e.Structure == AttributeStructure || e.Structure == AttributeValueStructure {
-		switch e.Attribute {
-		case DecodeAttribute:
-			es += "JSON Decode error"
-		case EncodeAttribute:
-			es += "JSON Encode error"
-		case URLAttribute:
-			es += "Resource path"
-		case NamedAttribute:
-			es += fmt.Sprint(nextVal())
-		case GeometryAttribute:
-			es += "Geometry"
-		case IndexAttribute:
-			es += "Index"
-		case ValueAttribute:
-			es += "Value"
-		case AssignedValueAttribute:
-			es += "Assigned value"
-		case BoundValueAttribute:
-			es += "Bound value"
-		case RemovedValueAttribute:
-			es += "Removed value"
-		case RemovedValuesAttribute:
-			es += "Removed values"
-		case RetainedValuesAttribute:
-			es += "Retained values"
-		case PuzzleSizeAttribute:
-			es += "Puzzle size"
-		case PuzzleAttribute:
-			es += "Puzzle"
-		case SummaryAttribute:
-			es += "Summary"
-		case SideLengthAttribute:
-			es += "Side length"
-		case LocationAttribute:
-			es += fmt.Sprintf("In puzzle.%v", nextVal())
-		default:
-			es += "<Unknown attribute>"
+	*e = Error(w.wireError)
+	if d := newDetails(e.Condition); d != nil && len(w.Details) > 0 && string(w.Details) != "null" {
+		if err := json.Unmarshal(w.Details, d); err != nil {
+			return err
 		}
-		if e.Structure == AttributeValueStructure {
-			es += " (" + fmt.Sprint(nextVal()) + ")"
+		e.Details = d
+	}
+	return nil
+}
+
+// The names of the error codes.  Once a code has been given a
+// name, the name must never change, because clients depend on it.
+var (
+	scopeNames = [...]string{
+		UnknownScope:  "unknown",
+		RequestScope:  "request",
+		ArgumentScope: "argument",
+		GeometryScope: "geometry",
+		GroupScope:    "group",
+		SquareScope:   "square",
+		InternalScope: "internal",
+	}
+	structureNames = [...]string{
+		UnknownStructure:        "unknown",
+		ScopeStructure:          "scope",
+		AttributeStructure:      "attribute",
+		AttributeValueStructure: "attributeValue",
+	}
+	conditionNames = [...]string{
+		UnknownCondition:                 "unknown",
+		GeneralCondition:                 "general",
+		TooLargeCondition:                "tooLarge",
+		TooSmallCondition:                "tooSmall",
+		DuplicateAssignmentCondition:     "duplicateAssignment",
+		NotInSetCondition:                "notInSet",
+		NoPossibleValuesCondition:        "noPossibleValues",
+		NoGroupValueCondition:            "noGroupValue",
+		DuplicateGroupValuesCondition:    "duplicateGroupValues",
+		UnknownGeometryCondition:         "unknownGeometry",
+		NonSquareCondition:               "nonSquare",
+		NonRectangularCondition:          "nonRectangular",
+		InvalidPuzzleAssignmentCondition: "invalidPuzzleAssignment",
+		WrongPuzzleSizeCondition:         "wrongPuzzleSize",
+		InvalidArgumentCondition:         "invalidArgument",
+		MismatchedSummaryErrorsCondition: "mismatchedSummaryErrors",
+		NonContiguousRegionCondition:     "nonContiguousRegion",
+		WrongRegionSizeCondition:         "wrongRegionSize",
+		ImpossibleCageSumCondition:       "impossibleCageSum",
+		WrongCageSumCondition:            "wrongCageSum",
+		DuplicateGeometryCondition:       "duplicateGeometry",
+		WrongGroupSizeCondition:          "wrongGroupSize",
+		NotAssignedCondition:             "notAssigned",
+		NotSymmetryCondition:             "notSymmetry",
+		NothingToUndoCondition:           "nothingToUndo",
+		StoppedCondition:                 "stopped",
+	}
+	attributeNames = [...]string{
+		UnknownAttribute:        "unknown",
+		DecodeAttribute:         "decode",
+		EncodeAttribute:         "encode",
+		URLAttribute:            "url",
+		LocationAttribute:       "location",
+		NamedAttribute:          "named",
+		GeometryAttribute:       "geometry",
+		IndexAttribute:          "index",
+		ValueAttribute:          "value",
+		AssignedValueAttribute:  "assignedValue",
+		BoundValueAttribute:     "boundValue",
+		RemovedValueAttribute:   "removedValue",
+		RemovedValuesAttribute:  "removedValues",
+		RetainedValuesAttribute: "retainedValues",
+		PuzzleSizeAttribute:     "puzzleSize",
+		SideLengthAttribute:     "sideLength",
+		PuzzleAttribute:         "puzzle",
+		SummaryAttribute:        "summary",
+		RegionsAttribute:        "regions",
+		RegionAttribute:         "region",
+		CageAttribute:           "cage",
+		LayoutAttribute:         "layout",
+		PropagationAttribute:    "propagation",
+		RatingAttribute:         "rating",
+		BackendAttribute:        "backend",
+		TransformAttribute:      "transform",
+		TraceAttribute:          "trace",
+	}
+)
+
+// ErrorScopes implement Stringer, using their JSON names
+func (sc ErrorScope) String() string {
+	return codeName(scopeNames[:], int(sc), "ErrorScope")
+}
+
+// MarshalJSON encodes an ErrorScope as its name.
+func (sc ErrorScope) MarshalJSON() ([]byte, error) {
+	return marshalCode(scopeNames[:], int(sc))
+}
+
+// UnmarshalJSON decodes an ErrorScope from its name or number.
+func (sc *ErrorScope) UnmarshalJSON(b []byte) error {
+	code, err := unmarshalCode(scopeNames[:], b, "ErrorScope")
+	*sc = ErrorScope(code)
+	return err
+}
+
+// ErrorStructures implement Stringer, using their JSON names
+func (st ErrorStructure) String() string {
+	return codeName(structureNames[:], int(st), "ErrorStructure")
+}
+
+// MarshalJSON encodes an ErrorStructure as its name.
+func (st ErrorStructure) MarshalJSON() ([]byte, error) {
+	return marshalCode(structureNames[:], int(st))
+}
+
+// UnmarshalJSON decodes an ErrorStructure from its name or number.
+func (st *ErrorStructure) UnmarshalJSON(b []byte) error {
+	code, err := unmarshalCode(structureNames[:], b, "ErrorStructure")
+	*st = ErrorStructure(code)
+	return err
+}
+
+// ErrorConditions implement Stringer, using their JSON names
+func (co ErrorCondition) String() string {
+	return codeName(conditionNames[:], int(co), "ErrorCondition")
+}
+
+// MarshalJSON encodes an ErrorCondition as its name.
+func (co ErrorCondition) MarshalJSON() ([]byte, error) {
+	return marshalCode(conditionNames[:], int(co))
+}
+
+// UnmarshalJSON decodes an ErrorCondition from its name or number.
+func (co *ErrorCondition) UnmarshalJSON(b []byte) error {
+	code, err := unmarshalCode(conditionNames[:], b, "ErrorCondition")
+	*co = ErrorCondition(code)
+	return err
+}
+
+// ErrorAttributes implement Stringer, using their JSON names
+func (at ErrorAttribute) String() string {
+	return codeName(attributeNames[:], int(at), "ErrorAttribute")
+}
+
+// MarshalJSON encodes an ErrorAttribute as its name.
+func (at ErrorAttribute) MarshalJSON() ([]byte, error) {
+	return marshalCode(attributeNames[:], int(at))
+}
+
+// UnmarshalJSON decodes an ErrorAttribute from its name or number.
+func (at *ErrorAttribute) UnmarshalJSON(b []byte) error {
+	code, err := unmarshalCode(attributeNames[:], b, "ErrorAttribute")
+	*at = ErrorAttribute(code)
+	return err
+}
+
+// codeName returns the name of an error code, or the type and
+// number of codes that don't have names.
+func codeName(names []string, code int, kind string) string {
+	if code >= 0 && code < len(names) {
+		return names[code]
+	}
+	return fmt.Sprintf("%s(%d)", kind, code)
+}
+
+// marshalCode encodes an error code as its name.  Codes that
+// don't have names (which only come from bad data) are encoded
+// as numbers, so they aren't lost.
+func marshalCode(names []string, code int) ([]byte, error) {
+	if code >= 0 && code < len(names) {
+		return json.Marshal(names[code])
+	}
+	return json.Marshal(code)
+}
+
+// unmarshalCode decodes an error code from its name, or from its
+// number (either as a JSON number or as a string) as in version 1
+// of the wire format.
+func unmarshalCode(names []string, b []byte, kind string) (int, error) {
+	var code int
+	if err := json.Unmarshal(b, &code); err == nil {
+		return code, nil
+	}
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return 0, fmt.Errorf("%s must be a name or a number, not %s", kind, b)
+	}
+	for code, n := range names {
+		if n == name {
+			return code, nil
 		}
-		es += ": "
 	}
-	switch e.Condition {
-	case GeneralCondition:
-		es += fmt.Sprint(nextVal())
-	case TooLargeCondition:
-		es += fmt.Sprintf("Must be at most %v", nextVal())
-	case TooSmallCondition:
-		es += fmt.Sprintf("Must be at least %v", nextVal())
-	case DuplicateAssignmentCondition:
-		es += fmt.Sprintf("Square %v is already assigned value %v", nextVal(), nextVal())
-	case NotInSetCondition:
-		es += fmt.Sprintf("Must be in possible values %v", nextVal())
-	case NoPossibleValuesCondition:
-		es += fmt.Sprintf("No remaining possible values")
-	case NoGroupValueCondition:
-		es += fmt.Sprintf("No square can contain %v", nextVal())
-	case DuplicateGroupValuesCondition:
-		es += fmt.Sprintf("Multiple squares have or need value %v", nextVal())
-	case UnknownGeometryCondition:
-		es += fmt.Sprintf("Not a known geometry")
-	case NonSquareCondition:
-		es += fmt.Sprintf("Not a perfect square")
-	case NonRectangularCondition:
-		es += fmt.Sprintf("Not the product of consecutive integers")
-	case InvalidPuzzleAssignmentCondition:
-		es += fmt.Sprintf("Target puzzle has errors; no assignments are allowed")
-	case WrongPuzzleSizeCondition:
-		es += fmt.Sprintf("Doesn't match specified side length (%v)", values)
-	case InvalidArgumentCondition:
-		es += fmt.Sprintf("Required value was missing or invalid")
-	case MismatchedSummaryErrorsCondition:
-		es += fmt.Sprintf("Summary has errors but puzzle created from it does not")
-	default:
-		es += fmt.Sprintf("Supplemental data is %v", values)
+	if code, err := strconv.Atoi(name); err == nil {
+		return code, nil
 	}
-	return es
+	return 0, fmt.Errorf("%q is not the name of an %s", name, kind)
 }
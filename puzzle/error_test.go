@@ -19,6 +19,8 @@
 package puzzle
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -51,3 +53,141 @@ func TestErrorNoPanicNoEmpty(t *testing.T) {
 		}
 	}
 }
+
+// Make sure every error code has a unique name.
+func TestErrorCodeNames(t *testing.T) {
+	tables := []struct {
+		kind  string
+		names []string
+		max   int
+	}{
+		{"scope", scopeNames[:], int(MaxScope)},
+		{"structure", structureNames[:], int(MaxStructure)},
+		{"condition", conditionNames[:], int(MaxCondition)},
+		{"attribute", attributeNames[:], int(MaxAttribute)},
+	}
+	for _, table := range tables {
+		if len(table.names) != table.max {
+			t.Errorf("There are %d %s names for %d codes", len(table.names), table.kind, table.max)
+		}
+		seen := make(map[string]bool)
+		for code, name := range table.names {
+			if name == "" || seen[name] {
+				t.Errorf("The name %q of %s %d is empty or a duplicate", name, table.kind, code)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	err := rangeError(IndexAttribute, 17, 1, 16)
+	err.Message = err.Error()
+	b, e := json.Marshal(err)
+	if e != nil {
+		t.Fatalf("Marshal failed: %v", e)
+	}
+	var wire map[string]interface{}
+	if e := json.Unmarshal(b, &wire); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	expected := map[string]interface{}{
+		"format":    float64(ErrorFormat),
+		"scope":     "argument",
+		"structure": "attributeValue",
+		"attribute": "index",
+		"condition": "tooLarge",
+	}
+	for k, v := range expected {
+		if wire[k] != v {
+			t.Errorf("Got %q of %v, expected %v", k, wire[k], v)
+		}
+	}
+	var result Error
+	if e := json.Unmarshal(b, &result); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if result.Error() != err.Error() || result.Scope != err.Scope || result.Structure != err.Structure ||
+		result.Attribute != err.Attribute || result.Condition != err.Condition {
+		t.Errorf("Got %+v, expected %+v", result, err)
+	}
+
+	// version 1 of the format sent numbers, sometimes as strings
+	old := `{"scope": 2, "structure": "3", "attribute": 7, "condition": "2"}`
+	result = Error{}
+	if e := json.Unmarshal([]byte(old), &result); e != nil {
+		t.Fatalf("Unmarshal of version 1 failed: %v", e)
+	}
+	if expected := (Error{Scope: ArgumentScope, Structure: AttributeValueStructure,
+		Attribute: IndexAttribute, Condition: TooLargeCondition}); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Got %+v, expected %+v", result, expected)
+	}
+
+	// codes without names are kept as numbers
+	b, e = json.Marshal(Error{Scope: MaxScope, Condition: ErrorCondition(-1)})
+	if e != nil {
+		t.Fatalf("Marshal failed: %v", e)
+	}
+	result = Error{}
+	if e := json.Unmarshal(b, &result); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if result.Scope != MaxScope || result.Condition != -1 {
+		t.Errorf("Got %+v from %s, expected unnamed codes", result, b)
+	}
+
+	// unknown names are rejected
+	for _, bad := range []string{`{"scope": "nowhere"}`, `{"condition": true}`} {
+		if e := json.Unmarshal([]byte(bad), &result); e == nil {
+			t.Errorf("Unmarshal of %s succeeded", bad)
+		}
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	values := []int{
+		1, 1, 0, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: values})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	expected := &GroupDetails{GroupID{GtypeRow, 1}, 1, []int{1, 2}}
+	if len(p.errors) == 0 || !reflect.DeepEqual(p.errors[0].Details, expected) {
+		t.Fatalf("Got errors %+v, expected details %+v", p.errors, expected)
+	}
+	if is := p.errors[0].Details.Indices(); !reflect.DeepEqual(is, []int{1, 2}) {
+		t.Errorf("Got indices %v, expected [1 2]", is)
+	}
+
+	tests := []Error{
+		p.errors[0],
+		rangeError(ValueAttribute, 0, 1, 4),
+		squareError(&square{index: 3, pvals: newValueset(2, 4)}, 1, AssignedValueAttribute, NotInSetCondition),
+		squareError(&square{index: 3}, intset{2, 4}, RemovedValuesAttribute, NoPossibleValuesCondition),
+		cageError(GroupID{GtypeCage, 2}, WrongCageSumCondition, 7, 8),
+		argumentError(PuzzleAttribute, InvalidArgumentCondition),
+	}
+	for i, err := range tests {
+		b, e := json.Marshal(err)
+		if e != nil {
+			t.Fatalf("Case %d: Marshal failed: %v", i+1, e)
+		}
+		var result Error
+		if e := json.Unmarshal(b, &result); e != nil {
+			t.Fatalf("Case %d: Unmarshal failed: %v", i+1, e)
+		}
+		if !reflect.DeepEqual(result.Details, err.Details) {
+			t.Errorf("Case %d: Got details %+v from %s, expected %+v", i+1, result.Details, b, err.Details)
+		}
+	}
+	if d := tests[2].Details.(*SquareDetails); !reflect.DeepEqual(d, &SquareDetails{3, []int{1}, []int{2, 4}}) {
+		t.Errorf("Got square details %+v", d)
+	}
+	if d := tests[4].Details.(*CageDetails); *d != (CageDetails{GroupID{GtypeCage, 2}, 8, 7}) {
+		t.Errorf("Got cage details %+v", d)
+	}
+}
@@ -0,0 +1,444 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+
+Explanations
+
+An explanation says why a square is in its current state: why it
+has its bound value, why it has lost the possible values it no
+longer has, and why it is involved in any of the puzzle's errors.
+Each reason may rest on others, so explanations are trees: a
+square is bound because it's the only place for a value in a
+group, which holds because each of the group's other squares
+has lost that value, each for its own reason, and so on.
+
+The cause of each removal is recorded on the square when the
+value is removed, at the same point observers are sent the
+RemoveEvent: the square whose assignment removed it and the
+group they share, the advanced propagation that eliminated it
+(and, for singles, the square whose value is certain), a mark
+struck by the player, or the sum of a cage.  Explanations read
+these records rather than guessing from the puzzle's state, so
+each removal is credited to what actually caused it.  Each
+binding is explained only the first time it comes up, which
+keeps explanations finite.
+
+*/
+
+// A ReasonKind says what sort of fact a Reason states.
+type ReasonKind int
+
+// Constants for the kinds of reasons.
+const (
+	UnknownReason ReasonKind = iota
+	AssignedReason
+	BoundReason
+	SingleReason
+	PeerReason
+	EliminatedReason
+	StruckReason
+	CageReason
+	NoCandidatesReason
+	NoValuesReason
+	ConflictReason
+)
+
+// ReasonKinds implement Stringer
+func (k ReasonKind) String() string {
+	switch k {
+	case AssignedReason:
+		return "assigned"
+	case BoundReason:
+		return "bound"
+	case SingleReason:
+		return "single"
+	case PeerReason:
+		return "peer"
+	case EliminatedReason:
+		return "eliminated"
+	case StruckReason:
+		return "struck"
+	case CageReason:
+		return "cage"
+	case NoCandidatesReason:
+		return "no candidates"
+	case NoValuesReason:
+		return "no values"
+	case ConflictReason:
+		return "conflict"
+	default:
+		return "unknown reason"
+	}
+}
+
+// A Reason is one step in an Explanation.  What the Index,
+// Value, Source, and Groups mean depends on the Kind:
+//
+// - AssignedReason: square Index is assigned Value.
+//
+// - BoundReason: square Index is the only place for Value in
+// Groups[0].
+//
+// - SingleReason: Value is the only possible value left in
+// square Index.
+//
+// - PeerReason: Value was removed from square Index because
+// square Source, in Groups[0], is assigned Value.
+//
+// - EliminatedReason: Value was removed from square Index by
+// advanced propagation using Technique (of the given Size) in
+// Groups.  For singles, Source is the square whose value is
+// certain.
+//
+// - StruckReason: Value was struck from square Index by the
+// player.
+//
+// - CageReason: Value was removed from square Index because it
+// can't help make the sum of the cage Groups[0].
+//
+// - NoCandidatesReason: no square in Groups[0] can have Value.
+//
+// - NoValuesReason: square Index has no possible values left.
+//
+// - ConflictReason: square Index and square Source, both in
+// Groups[0], are assigned or bound to Value.
+//
+// Because gives the reasons this one follows from, if any.
+// Message is an English description of this reason alone.
+type Reason struct {
+	Kind      ReasonKind `json:"kind"`
+	Index     int        `json:"index,omitempty"`
+	Value     int        `json:"value,omitempty"`
+	Source    int        `json:"source,omitempty"`
+	Groups    []GroupID  `json:"groups,omitempty"`
+	Technique Technique  `json:"technique,omitempty"`
+	Size      int        `json:"size,omitempty"`
+	Because   []Reason   `json:"because,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+// An Explanation gives the Reasons for the state of the square
+// with the given Index, and renders the whole tree of them in
+// English as its Message, one reason per line, with the reasons
+// each one follows from indented beneath it.
+type Explanation struct {
+	Index   int      `json:"index"`
+	Reasons []Reason `json:"reasons"`
+	Message string   `json:"message,omitempty"`
+}
+
+// Return an explanation of a Reason.  If the Reason has a
+// pre-canned message, this will use it, otherwise it will
+// produce an appropriate (English, non-localized) message.
+func (r Reason) String() string {
+	if len(r.Message) > 0 {
+		return r.Message
+	}
+	groups := make([]string, len(r.Groups))
+	for i, gid := range r.Groups {
+		groups[i] = gid.String()
+	}
+	group := "<unknown group>"
+	if len(groups) > 0 {
+		group = groups[0]
+	}
+	switch r.Kind {
+	case AssignedReason:
+		return fmt.Sprintf("Square %v is assigned %v.", r.Index, r.Value)
+	case BoundReason:
+		return fmt.Sprintf("Square %v is the only place for %v in %v.", r.Index, r.Value, group)
+	case SingleReason:
+		return fmt.Sprintf("Square %v can only be %v.", r.Index, r.Value)
+	case PeerReason:
+		return fmt.Sprintf("Square %v can't be %v: square %v in %v is assigned %v.",
+			r.Index, r.Value, r.Source, group, r.Value)
+	case EliminatedReason:
+		return fmt.Sprintf("Square %v can't be %v: it was eliminated by a %v in %v.",
+			r.Index, r.Value, r.Technique.Name(r.Size), andStrings(groups))
+	case StruckReason:
+		return fmt.Sprintf("Square %v can't be %v: the player struck it.", r.Index, r.Value)
+	case CageReason:
+		return fmt.Sprintf("Square %v can't be %v: it can't help make the sum of %v.",
+			r.Index, r.Value, group)
+	case NoCandidatesReason:
+		return fmt.Sprintf("No square in %v can be %v.", group, r.Value)
+	case NoValuesReason:
+		return fmt.Sprintf("Square %v has no possible values.", r.Index)
+	case ConflictReason:
+		return fmt.Sprintf("Squares %v and %v in %v are both %v.", r.Index, r.Source, group, r.Value)
+	default:
+		return fmt.Sprintf("Square %v can't be %v, for an unknown reason.", r.Index, r.Value)
+	}
+}
+
+// Return the English rendering of an Explanation.  If the
+// Explanation has a pre-canned message, this will use it.
+func (x Explanation) String() string {
+	if len(x.Message) > 0 {
+		return x.Message
+	}
+	var lines []string
+	var render func(rs []Reason, indent string)
+	render = func(rs []Reason, indent string) {
+		for _, r := range rs {
+			lines = append(lines, indent+r.String())
+			render(r.Because, indent+"  ")
+		}
+	}
+	render(x.Reasons, "")
+	return strings.Join(lines, "\n")
+}
+
+// Explain returns the Explanation of the state of the square
+// with the given index.  Puzzles with errors can be explained;
+// in fact, explaining the squares involved is the best way to
+// see where the errors came from.  The puzzle is not altered.
+func (p *Puzzle) Explain(index int) (*Explanation, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 1 || index > p.mapping.scount {
+		return nil, rangeError(IndexAttribute, index, 1, p.mapping.scount)
+	}
+	x := &explainer{p, make(map[Choice]bool)}
+	result := &Explanation{Index: index, Reasons: x.square(index)}
+	x.fill(result.Reasons)
+	result.Message = result.String()
+	return result, nil
+}
+
+// An explainer builds the reasons for squares in a puzzle,
+// remembering which bindings it has already explained.
+type explainer struct {
+	p    *Puzzle
+	seen map[Choice]bool
+}
+
+// fill in the messages of a tree of reasons.
+func (x *explainer) fill(rs []Reason) {
+	for i := range rs {
+		rs[i].Message = rs[i].String()
+		x.fill(rs[i].Because)
+	}
+}
+
+// square returns the reasons for the state of a square, followed
+// by the reasons for the errors it's involved in.
+func (x *explainer) square(idx int) []Reason {
+	var rs []Reason
+	s := x.p.squares[idx]
+	switch {
+	case s.aval != 0:
+		rs = append(rs, Reason{Kind: AssignedReason, Index: idx, Value: s.aval})
+	case s.bval != 0:
+		x.seen[Choice{idx, s.bval}] = true
+		for _, gid := range s.bsrc {
+			rs = append(rs, x.bound(idx, s.bval, gid))
+		}
+	case s.pvals.len() == 1:
+		x.seen[Choice{idx, s.pvals.next(0)}] = true
+		rs = append(rs, x.single(idx))
+	default:
+		for v := 1; v <= x.p.mapping.sidelen; v++ {
+			if !s.pvals.has(v) {
+				rs = append(rs, x.removed(idx, v))
+			}
+		}
+	}
+	return append(rs, x.errors(idx)...)
+}
+
+// errors returns the reasons for the problems a square is
+// involved in: having no possible values, being in a group with
+// no place for a needed value, or sharing its value with
+// another square in one of its groups.
+func (x *explainer) errors(idx int) []Reason {
+	var rs []Reason
+	p, s := x.p, x.p.squares[idx]
+	if s.aval == 0 && s.pvals == 0 {
+		r := Reason{Kind: NoValuesReason, Index: idx}
+		for v := 1; v <= p.mapping.sidelen; v++ {
+			r.Because = append(r.Because, x.removed(idx, v))
+		}
+		rs = append(rs, r)
+	}
+	value := s.aval
+	if value == 0 {
+		value = s.bval
+	}
+	for _, gi := range p.mapping.ixmap[idx] {
+		g := p.groups[gi]
+		for v := 1; v < len(g.where); v++ {
+			if g.where[v] == 0 && !x.placeable(g, v) {
+				r := Reason{Kind: NoCandidatesReason, Value: v, Groups: []GroupID{g.desc.id}}
+				for _, i := range g.desc.indices {
+					if a, ok := x.absent(i, v); ok {
+						r.Because = append(r.Because, a)
+					}
+				}
+				rs = append(rs, r)
+			}
+		}
+		if value == 0 {
+			continue
+		}
+		for _, i := range g.desc.indices {
+			if o := p.squares[i]; i != idx && (o.aval == value || (o.aval == 0 && o.bval == value)) {
+				rs = append(rs, Reason{Kind: ConflictReason, Index: idx, Value: value, Source: i, Groups: []GroupID{g.desc.id}})
+			}
+		}
+	}
+	return rs
+}
+
+// placeable returns whether some square in a group could still
+// have a value.
+func (x *explainer) placeable(g *group, v int) bool {
+	for _, i := range g.desc.indices {
+		if s := x.p.squares[i]; s.aval == 0 && s.pvals.has(v) && (s.bval == 0 || s.bval == v) {
+			return true
+		}
+	}
+	return false
+}
+
+// bound returns the reason a square is the only place for a
+// value in a group: each of the group's other squares can't
+// have the value.
+func (x *explainer) bound(idx, v int, gid GroupID) Reason {
+	r := Reason{Kind: BoundReason, Index: idx, Value: v, Groups: []GroupID{gid}}
+	for _, g := range x.p.groups[1:] {
+		if g.desc.id != gid {
+			continue
+		}
+		for _, i := range g.desc.indices {
+			if i == idx {
+				continue
+			}
+			if a, ok := x.absent(i, v); ok {
+				r.Because = append(r.Because, a)
+			}
+		}
+		break
+	}
+	return r
+}
+
+// single returns the reason a square has only one possible
+// value: each of its other values was removed.
+func (x *explainer) single(idx int) Reason {
+	s := x.p.squares[idx]
+	r := Reason{Kind: SingleReason, Index: idx, Value: s.pvals.next(0)}
+	for v := 1; v <= x.p.mapping.sidelen; v++ {
+		if v != r.Value {
+			r.Because = append(r.Because, x.removed(idx, v))
+		}
+	}
+	return r
+}
+
+// binding returns the reason a square's value is certain, either
+// because it's bound or because it's the only one left.
+// Bindings that have already been explained are given without
+// their reasons.
+func (x *explainer) binding(idx int) Reason {
+	s := x.p.squares[idx]
+	v := s.bval
+	if v == 0 {
+		v = s.pvals.next(0)
+	}
+	if x.seen[Choice{idx, v}] {
+		if len(s.bsrc) > 0 {
+			return Reason{Kind: BoundReason, Index: idx, Value: v, Groups: []GroupID{s.bsrc[0]}}
+		}
+		return Reason{Kind: SingleReason, Index: idx, Value: v}
+	}
+	x.seen[Choice{idx, v}] = true
+	if len(s.bsrc) > 0 {
+		return x.bound(idx, v, s.bsrc[0])
+	}
+	return x.single(idx)
+}
+
+// absent returns the reason a square can't have a value, if it
+// can't: it's assigned or bound to another value, or it has
+// lost the value.
+func (x *explainer) absent(idx, v int) (Reason, bool) {
+	s := x.p.squares[idx]
+	switch {
+	case s.aval != 0:
+		return Reason{Kind: AssignedReason, Index: idx, Value: s.aval}, s.aval != v
+	case !s.pvals.has(v):
+		return x.removed(idx, v), true
+	case s.bval != 0 && s.bval != v:
+		return x.binding(idx), true
+	}
+	return Reason{}, false
+}
+
+// removed returns the reason a value was removed from a
+// square's possible values, from the cause recorded when it was
+// removed.
+func (x *explainer) removed(idx, v int) Reason {
+	s := x.p.squares[idx]
+	r := Reason{Kind: UnknownReason, Index: idx, Value: v}
+	var c removal
+	for _, rc := range s.causes {
+		if rc.value == v {
+			c = rc
+		}
+	}
+	switch c.kind {
+	case PeerReason:
+		r.Kind, r.Source, r.Groups = PeerReason, c.source, []GroupID{c.group}
+	case EliminatedReason:
+		for _, e := range s.elims {
+			if e.Value != v {
+				continue
+			}
+			r.Kind, r.Technique, r.Size = EliminatedReason, e.Technique, e.Size
+			r.Groups = append([]GroupID(nil), e.Groups...)
+			if c.source != 0 {
+				r.Source = c.source
+				r.Because = []Reason{x.certain(c.source)}
+			}
+			break
+		}
+	case StruckReason:
+		r.Kind = StruckReason
+	case CageReason:
+		r.Kind, r.Groups = CageReason, []GroupID{c.group}
+	}
+	return r
+}
+
+// certain returns the reason a square's value is certain: it's
+// assigned, or it's bound or the only one left.
+func (x *explainer) certain(idx int) Reason {
+	if s := x.p.squares[idx]; s.aval != 0 {
+		return Reason{Kind: AssignedReason, Index: idx, Value: s.aval}
+	}
+	return x.binding(idx)
+}
@@ -0,0 +1,255 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+
+Test helpers
+
+*/
+
+// helperReasons calls f with every reason in a tree of reasons.
+func helperReasons(rs []Reason, f func(r Reason)) {
+	for _, r := range rs {
+		f(r)
+		helperReasons(r.Because, f)
+	}
+}
+
+/*
+
+Tests
+
+*/
+
+func TestExplain(t *testing.T) {
+	// square 1 is the only place for 1 in row 1
+	var hidden []Choice
+	for i := 2; i <= 4; i++ {
+		hidden = append(hidden, Choice{i, 1})
+	}
+	row1, col2, tile1 := GroupID{GtypeRow, 1}, GroupID{GtypeCol, 2}, GroupID{GtypeTile, 1}
+	testcases := []struct {
+		values  []int
+		marks   []Choice
+		index   int
+		reasons []Reason
+		message string
+	}{
+		{
+			bound4PuzzleValues, nil, 2,
+			[]Reason{{Kind: AssignedReason, Index: 2, Value: 2}},
+			"Square 2 is assigned 2.",
+		},
+		{
+			bound4PuzzleValues, nil, 4,
+			[]Reason{{Kind: SingleReason, Index: 4, Value: 4, Because: []Reason{
+				{Kind: PeerReason, Index: 4, Value: 1, Source: 1, Groups: []GroupID{row1}},
+				{Kind: PeerReason, Index: 4, Value: 2, Source: 2, Groups: []GroupID{row1}},
+				{Kind: PeerReason, Index: 4, Value: 3, Source: 3, Groups: []GroupID{row1}},
+			}}},
+			"Square 4 can only be 4.\n" +
+				"  Square 4 can't be 1: square 1 in row 1 is assigned 1.\n" +
+				"  Square 4 can't be 2: square 2 in row 1 is assigned 2.\n" +
+				"  Square 4 can't be 3: square 3 in row 1 is assigned 3.",
+		},
+		{
+			bound4PuzzleValues, nil, 6,
+			[]Reason{
+				{Kind: PeerReason, Index: 6, Value: 1, Source: 1, Groups: []GroupID{tile1}},
+				{Kind: PeerReason, Index: 6, Value: 2, Source: 2, Groups: []GroupID{col2}},
+			},
+			"Square 6 can't be 1: square 1 in tile 1 is assigned 1.\n" +
+				"Square 6 can't be 2: square 2 in column 2 is assigned 2.",
+		},
+		{
+			nil, hidden, 1,
+			[]Reason{{Kind: BoundReason, Index: 1, Value: 1, Groups: []GroupID{row1}, Because: []Reason{
+				{Kind: StruckReason, Index: 2, Value: 1},
+				{Kind: StruckReason, Index: 3, Value: 1},
+				{Kind: StruckReason, Index: 4, Value: 1},
+			}}},
+			"Square 1 is the only place for 1 in row 1.\n" +
+				"  Square 2 can't be 1: the player struck it.\n" +
+				"  Square 3 can't be 1: the player struck it.\n" +
+				"  Square 4 can't be 1: the player struck it.",
+		},
+		{
+			conflicting4Puzzle1, nil, 6,
+			[]Reason{
+				{Kind: AssignedReason, Index: 6, Value: 1},
+				{Kind: ConflictReason, Index: 6, Value: 1, Source: 1, Groups: []GroupID{tile1}},
+			},
+			"Square 6 is assigned 1.\n" +
+				"Squares 6 and 1 in tile 1 are both 1.",
+		},
+		{
+			unsatisfiable4Puzzle, nil, 3,
+			[]Reason{
+				{Kind: PeerReason, Index: 3, Value: 1, Source: 1, Groups: []GroupID{row1}},
+				{Kind: PeerReason, Index: 3, Value: 4, Source: 11, Groups: []GroupID{{GtypeCol, 3}}},
+				{Kind: NoCandidatesReason, Value: 4, Groups: []GroupID{row1}, Because: []Reason{
+					{Kind: AssignedReason, Index: 1, Value: 1},
+					{Kind: PeerReason, Index: 2, Value: 4, Source: 14, Groups: []GroupID{col2}},
+					{Kind: PeerReason, Index: 3, Value: 4, Source: 11, Groups: []GroupID{{GtypeCol, 3}}},
+					{Kind: PeerReason, Index: 4, Value: 4, Source: 8, Groups: []GroupID{{GtypeCol, 4}}},
+				}},
+			},
+			"Square 3 can't be 1: square 1 in row 1 is assigned 1.\n" +
+				"Square 3 can't be 4: square 11 in column 3 is assigned 4.\n" +
+				"No square in row 1 can be 4.\n" +
+				"  Square 1 is assigned 1.\n" +
+				"  Square 2 can't be 4: square 14 in column 2 is assigned 4.\n" +
+				"  Square 3 can't be 4: square 11 in column 3 is assigned 4.\n" +
+				"  Square 4 can't be 4: square 8 in column 4 is assigned 4.",
+		},
+	}
+	for i, tc := range testcases {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: tc.values, Marks: tc.marks, UseMarks: true})
+		if e != nil {
+			t.Fatalf("case %d: Failed to create puzzle: %v", i+1, e)
+		}
+		x, e := p.Explain(tc.index)
+		if e != nil {
+			t.Fatalf("case %d: Explain failed: %v", i+1, e)
+		}
+		if x.Message != tc.message {
+			t.Errorf("case %d: got message %q, expected %q", i+1, x.Message, tc.message)
+		}
+		helperReasons(x.Reasons, func(r Reason) {
+			if r.Message != r.String() {
+				t.Errorf("case %d: reason %+v has message %q", i+1, r, r.Message)
+			}
+		})
+		expected := &Explanation{tc.index, tc.reasons, tc.message}
+		var clear func(rs []Reason)
+		clear = func(rs []Reason) {
+			for i := range rs {
+				rs[i].Message = ""
+				clear(rs[i].Because)
+			}
+		}
+		clear(x.Reasons)
+		if !reflect.DeepEqual(x, expected) {
+			t.Errorf("case %d: got explanation %+v, expected %+v", i+1, x, expected)
+		}
+	}
+}
+
+func TestExplainAdvanced(t *testing.T) {
+	// every removed value has a known cause, and every single
+	// that eliminated a value has a source
+	summaries := []*Summary{
+		{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues, Propagation: AdvancedPropagation},
+		{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues, Propagation: AdvancedPropagation},
+		{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages},
+	}
+	for i, summary := range summaries {
+		p, e := New(summary)
+		if e != nil {
+			t.Fatalf("case %d: Failed to create puzzle: %v", i+1, e)
+		}
+		kinds := make(map[ReasonKind]int)
+		for idx := 1; idx <= p.mapping.scount; idx++ {
+			x, e := p.Explain(idx)
+			if e != nil {
+				t.Fatalf("case %d: Explain(%d) failed: %v", i+1, idx, e)
+			}
+			helperReasons(x.Reasons, func(r Reason) {
+				kinds[r.Kind]++
+				if r.Kind == UnknownReason {
+					t.Errorf("case %d: square %d: unknown reason %+v", i+1, idx, r)
+				}
+				if r.Kind == EliminatedReason && r.Size == 1 && (r.Source == 0 || len(r.Because) != 1) {
+					t.Errorf("case %d: square %d: single with no source %+v", i+1, idx, r)
+				}
+			})
+		}
+		if summary.Propagation == AdvancedPropagation && kinds[EliminatedReason] == 0 {
+			t.Errorf("case %d: no eliminations explained", i+1)
+		}
+		if len(summary.Cages) > 0 && kinds[CageReason] == 0 {
+			t.Errorf("case %d: no cage removals explained", i+1)
+		}
+		if len(kinds) == 0 || kinds[PeerReason] == 0 && len(summary.Values) > 0 {
+			t.Errorf("case %d: got reason kinds %v", i+1, kinds)
+		}
+	}
+}
+
+func TestExplainRecordedCause(t *testing.T) {
+	// square 5 loses 1 to the player's mark before square 1,
+	// in the same column, is assigned 1: the mark gets the credit
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Marks: []Choice{{5, 1}}, UseMarks: true})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if _, e := p.Assign(Choice{1, 1}); e != nil {
+		t.Fatalf("Failed to assign square 1: %v", e)
+	}
+	x, e := p.Explain(5)
+	if e != nil {
+		t.Fatalf("Explain failed: %v", e)
+	}
+	var struck, peer bool
+	helperReasons(x.Reasons, func(r Reason) {
+		if r.Index == 5 && r.Value == 1 {
+			struck, peer = struck || r.Kind == StruckReason, peer || r.Kind == PeerReason
+		}
+	})
+	if !struck || peer {
+		t.Errorf("Removal of 1 from square 5 not credited to the mark: %v", x)
+	}
+	// square 2 loses 1 to the assignment, and undoing it
+	// forgets the cause along with the removal
+	if x, e = p.Explain(2); e != nil {
+		t.Fatalf("Explain failed: %v", e)
+	} else if len(x.Reasons) == 0 || x.Reasons[0].Kind != PeerReason || x.Reasons[0].Source != 1 {
+		t.Errorf("Removal of 1 from square 2 not credited to square 1: %v", x)
+	}
+	if _, e := p.Undo(); e != nil {
+		t.Fatalf("Undo failed: %v", e)
+	}
+	if s := p.squares[2]; len(s.causes) != 0 {
+		t.Errorf("Square 2 still has causes %+v after undo", s.causes)
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	var p *Puzzle
+	if _, e := p.Explain(1); e == nil {
+		t.Errorf("Explained a nil puzzle")
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: bound4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	for _, idx := range []int{0, 17} {
+		if _, e := p.Explain(idx); e == nil {
+			t.Errorf("Explained square %d of a 4x4 puzzle", idx)
+		} else if err, ok := e.(Error); !ok || err.Attribute != IndexAttribute {
+			t.Errorf("Explain(%d) gave error %v, expected an index error", idx, e)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+/*
+
+Puzzle generation
+
+New puzzles are made in two stages.  First, an empty puzzle of
+the requested geometry is filled with random values, using a
+randomized version of the solver's search: the square with the
+fewest possible values is filled with each of its values, in
+random order, until the puzzle is filled in.
+
+Then clues are removed from the filled puzzle, in random order,
+as long as the puzzle still has a unique solution.  Puzzles
+that the grader can solve with logical techniques alone always
+have unique solutions.  For the others, note that before a clue
+is removed the puzzle has a unique solution, so any other
+solution after it's removed must have a different value in the
+removed square: it's enough to check that none of the other
+possible values of the square lead to a solution.  Those checks
+are given a limited number of guesses; if a check runs out of
+guesses, the clue is kept.  If a target rating is given, clues whose
+removal would make the puzzle harder than the target are kept.
+If the puzzle that's left doesn't have the target rating, the
+whole process is repeated with a new filled puzzle, a few times,
+and the closest puzzle found is returned.
+
+If the clues are to be symmetric, they are removed in pairs of
+squares that are opposite each other through the center of the
+puzzle (180-degree rotational symmetry).
+
+Generation can be bounded by a context.  Filling a puzzle is
+also given a limited number of guesses, and a fill that runs out
+of guesses counts as one of the tries.  If the context is done
+while clues are being removed, the rest of the clues are kept,
+so the puzzle still has a unique solution; if it's done before
+any puzzle has been filled, there is no puzzle to return.
+
+*/
+
+// GenerateOptions say what kind of puzzle to generate.  The
+// Geometry, SideLength, and (for geometries that need one)
+// Regions are as in a Summary.  Rating is the target rating
+// (1-5) of the puzzle, or 0 for any rating.  If Symmetric is
+// true, the clues are laid out symmetrically.  Seed is the seed
+// for the random number generator, so a puzzle can be
+// generated again: if it's 0, a seed is chosen.
+type GenerateOptions struct {
+	Geometry   string `json:"geometry"`
+	SideLength int    `json:"sidelen"`
+	Regions    []int  `json:"regions,omitempty"`
+	Rating     int    `json:"rating,omitempty"`
+	Symmetric  bool   `json:"symmetric,omitempty"`
+	Seed       int64  `json:"seed,omitempty"`
+}
+
+// generateAttempts is the number of filled puzzles tried when
+// looking for a puzzle with the target rating.
+const generateAttempts = 10
+
+// fillBudget is the number of guesses fill can make when
+// filling a puzzle.
+const fillBudget = 10000
+
+// Generate returns the Summary of a new puzzle with a unique
+// solution, as described by the options.  The seed and the
+// rating of the puzzle are in the summary's Metadata (as
+// "seed" and "rating"), since the target rating can't always
+// be met.  Returns an Error if the options are invalid.
+func Generate(options *GenerateOptions) (*Summary, error) {
+	return GenerateContext(context.Background(), options)
+}
+
+// GenerateContext is like Generate, but stops early if the
+// context is done.  If no puzzle has been filled by then, it
+// returns an Error giving the reason it stopped.
+func GenerateContext(ctx context.Context, options *GenerateOptions) (*Summary, error) {
+	if options == nil {
+		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, options)
+	}
+	if r := options.Rating; r < 0 || r > 5 {
+		return nil, rangeError(RatingAttribute, r, 0, 5)
+	}
+	empty, err := New(&Summary{
+		Geometry:   options.Geometry,
+		SideLength: options.SideLength,
+		Regions:    options.Regions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	var best *Summary
+	bestRating := 0
+	for i := 0; i < generateAttempts && ctx.Err() == nil; i++ {
+		s := &search{ctx: ctx, maxNodes: fillBudget}
+		filled := empty.copy().fill(rnd, s)
+		if filled == nil {
+			if s.reason == CompleteStop {
+				// a geometry whose constraints can't all be met
+				return nil, argumentError(GeometryAttribute, InvalidArgumentCondition, options.Geometry)
+			}
+			continue
+		}
+		summary, rating := filled.removeClues(ctx, rnd, options.Rating, options.Symmetric)
+		if best == nil || distance(rating, options.Rating) < distance(bestRating, options.Rating) {
+			best, bestRating = summary, rating
+		}
+		if options.Rating == 0 || rating == options.Rating {
+			break
+		}
+	}
+	if best == nil {
+		reason := NodeLimitStop
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			reason = DeadlineStop
+		case context.Canceled:
+			reason = CanceledStop
+		}
+		return nil, Error{
+			Scope:     RequestScope,
+			Structure: ScopeStructure,
+			Condition: StoppedCondition,
+			Values:    ErrorData{reason.String()},
+		}
+	}
+	best.Metadata = map[string]string{
+		"seed":   strconv.FormatInt(seed, 10),
+		"rating": strconv.Itoa(bestRating),
+	}
+	return best, nil
+}
+
+// distance is a helper that measures how far a rating is from
+// the target rating (any rating is on target for target 0).
+func distance(rating, target int) int {
+	if target == 0 || rating == target {
+		return 0
+	}
+	if rating > target {
+		return rating - target
+	}
+	return target - rating
+}
+
+// fill completes a puzzle with random values, within the bounds
+// of a search, returning the filled puzzle, or nil if the puzzle
+// can't be completed or the search stopped.  Each value tried is
+// a node of the search, and is undone with the puzzle's journal
+// if it doesn't work out.  The incoming puzzle may be altered.
+func (p *Puzzle) fill(rnd *rand.Rand, s *search) *Puzzle {
+	if len(p.errors) == 0 && assignKnown(p) {
+		return p
+	}
+	if len(p.errors) > 0 {
+		return nil
+	}
+	// choose among the squares with the fewest possible values
+	cindex, ccount, ties := 0, p.mapping.sidelen+1, 0
+	for i := 1; i <= p.mapping.scount; i++ {
+		if s := p.squares[i]; s.aval == 0 {
+			switch count := s.pvals.len(); {
+			case count < ccount:
+				cindex, ccount, ties = i, count, 1
+			case count == ccount:
+				if ties++; rnd.Intn(ties) == 0 {
+					cindex = i
+				}
+			}
+		}
+	}
+	vals := p.squares[cindex].pvals.values()
+	for _, j := range rnd.Perm(len(vals)) {
+		if s.stopped() {
+			return nil
+		}
+		m := p.mark()
+		p.assign(cindex, vals[j])
+		if f := p.fill(rnd, s); f != nil {
+			return f
+		}
+		p.rollback(m)
+	}
+	return nil
+}
+
+// removeClues removes values from a filled puzzle, in random
+// order, while the puzzle has a unique solution and (if there is
+// a target rating) is no harder than the target.  Returns the
+// summary of the resulting puzzle and its rating.  If the
+// context is done, the remaining clues are kept.  The filled
+// puzzle isn't changed.
+func (p *Puzzle) removeClues(ctx context.Context, rnd *rand.Rand, target int, symmetric bool) (*Summary, int) {
+	summary := p.summary()
+	summary.Metadata, summary.Errors = nil, nil
+	solution := p.allValues()
+	values, rating := summary.Values, 1
+	for _, i := range rnd.Perm(len(values)) {
+		squares := []int{i}
+		if j := len(values) - 1 - i; symmetric && j != i {
+			squares = append(squares, j)
+		}
+		if values[i] == 0 {
+			continue // already removed as a partner
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		saved := make([]int, len(squares))
+		for k, si := range squares {
+			saved[k], values[si] = values[si], 0
+		}
+		if unique, r := rateClues(ctx, summary, solution, squares); unique && (target == 0 || r <= target) {
+			rating = r
+			continue
+		}
+		for k, si := range squares {
+			values[si] = saved[k]
+		}
+	}
+	return summary, rating
+}
+
+// rateClues returns whether the puzzle with the given summary
+// has a unique solution and, if so, its rating.  The summary
+// comes from a puzzle with the given (unique) solution by
+// removing the values of the given squares (0-based).  If the
+// context is done, the puzzle isn't known to be unique.
+func rateClues(ctx context.Context, summary *Summary, solution []int, removed []int) (bool, int) {
+	p, err := New(summary)
+	if err != nil {
+		return false, 0
+	}
+	if c, g := p.grade(); c != nil && len(c.errors) == 0 && c.isFilled() {
+		return true, g.rating()
+	}
+	for _, i := range removed {
+		pvals := p.squares[i+1].pvals
+		for v := pvals.next(0); v != 0; v = pvals.next(v) {
+			if v == solution[i] {
+				continue
+			}
+			c := p.copy()
+			c.assign(i+1, v)
+			if found, done := c.searchSolution(ctx, searchBudget); found || !done {
+				return false, 0
+			}
+		}
+	}
+	return true, 5
+}
+
+// searchBudget is the number of guesses searchSolution can make
+// when checking that a clue can be removed.
+const searchBudget = 100
+
+// searchSolution looks for a solution to a puzzle (using
+// Ariadne's thread), making at most budget guesses and stopping
+// early if the context is done.  Returns whether a solution was
+// found, and whether the search was finished.  The puzzle is not
+// altered.
+func (p *Puzzle) searchSolution(ctx context.Context, budget int) (found, done bool) {
+	s := &search{ctx: ctx, maxNodes: budget}
+	p, _ = solve(p.copy(), nil, s)
+	if s.reason != CompleteStop {
+		return false, false
+	}
+	return len(p.errors) == 0, true
+}
@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tcs := []GenerateOptions{
+		{StandardGeometryName, 9, nil, 0, false, 1},
+		{StandardGeometryName, 9, nil, 1, true, 2},
+		{StandardGeometryName, 9, nil, 3, false, 3},
+		{RectangularGeometryName, 6, nil, 0, true, 4},
+		{DiagonalGeometryName, 9, nil, 0, false, 5},
+		{JigsawGeometryName, 6, jigsaw6Regions, 2, false, 6},
+	}
+	for i, tc := range tcs {
+		summary, e := Generate(&tc)
+		if e != nil {
+			t.Fatalf("test %d: Failed to generate puzzle: %v", i+1, e)
+		}
+		if seed := summary.Metadata["seed"]; seed != strconv.FormatInt(tc.Seed, 10) {
+			t.Errorf("test %d: seed is %q, expected %d", i+1, seed, tc.Seed)
+		}
+		again, e := Generate(&tc)
+		if e != nil || !reflect.DeepEqual(again, summary) {
+			t.Errorf("test %d: regenerated puzzle is %+v (error %v), expected %+v", i+1, again, e, summary)
+		}
+		if tc.Symmetric {
+			vals := summary.Values
+			for j := range vals {
+				if (vals[j] == 0) != (vals[len(vals)-1-j] == 0) {
+					t.Errorf("test %d: clues at %d and %d aren't symmetric: %v", i+1, j+1, len(vals)-j, vals)
+					break
+				}
+			}
+		}
+		p, e := New(summary)
+		if e != nil {
+			t.Fatalf("test %d: Failed to create generated puzzle: %v", i+1, e)
+		}
+		solns := p.allSolutions()
+		if len(solns) != 1 {
+			t.Fatalf("test %d: generated puzzle has %d solutions", i+1, len(solns))
+		}
+		if rating := summary.Metadata["rating"]; rating != strconv.Itoa(solns[0].Rating) {
+			t.Errorf("test %d: rating is %q, but solution is rated %d", i+1, rating, solns[0].Rating)
+		}
+		if tc.Rating != 0 && solns[0].Rating != tc.Rating {
+			t.Errorf("test %d: solution is rated %d, expected %d", i+1, solns[0].Rating, tc.Rating)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tcs := []*GenerateOptions{
+		nil,
+		&GenerateOptions{Geometry: "unknown", SideLength: 9},
+		&GenerateOptions{Geometry: StandardGeometryName, SideLength: 8},
+		&GenerateOptions{Geometry: JigsawGeometryName, SideLength: 6},
+		&GenerateOptions{Geometry: StandardGeometryName, SideLength: 9, Rating: 6},
+		&GenerateOptions{Geometry: StandardGeometryName, SideLength: 9, Rating: -1},
+	}
+	for i, tc := range tcs {
+		summary, e := Generate(tc)
+		if e == nil {
+			t.Errorf("test %d: generated %+v, expected an error", i+1, summary)
+		} else if _, ok := e.(Error); !ok {
+			t.Errorf("test %d: error %v is not an Error", i+1, e)
+		}
+	}
+}
+
+func TestGenerateStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	options := &GenerateOptions{Geometry: StandardGeometryName, SideLength: 9, Seed: 1}
+	summary, e := GenerateContext(ctx, options)
+	if err, ok := e.(Error); !ok || err.Condition != StoppedCondition {
+		t.Errorf("Canceled generation gave %+v (error %v), expected a stopped error", summary, e)
+	}
+
+	// a fill that runs out of guesses doesn't fill
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: make([]int, 81)})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	s := &search{ctx: context.Background(), maxNodes: 1}
+	if f := p.fill(rand.New(rand.NewSource(1)), s); f != nil || s.reason != NodeLimitStop {
+		t.Errorf("Fill with 1 guess stopped for %v", s.reason)
+	}
+}
@@ -18,6 +18,10 @@
 
 package puzzle
 
+import (
+	"sort"
+)
+
 /*
 
 Puzzle Geometries
@@ -39,7 +43,8 @@ type groupDescriptor struct {
 // A puzzleMapping summarizes the geometry parameters of the
 // puzzle, including specifically the indexes in each of the
 // groups, and a mapping from each index to the groups that
-// contain it.
+// contain it.  Geometries whose tiles are not regular keep the
+// region map they were built from, so it can be summarized.
 type puzzleMapping struct {
 	geometry string
 	sidelen  int
@@ -49,8 +54,13 @@ type puzzleMapping struct {
 	gcount   int
 	gdescs   []groupDescriptor
 	ixmap    [][]int
+	regions  []int
 }
 
+// maxSideLength is the largest side length of any puzzle.  It is
+// bounded above by the capacity of valuesets.
+const maxSideLength = maxSetValue
+
 /*
 
 Registered geometries
@@ -61,33 +71,297 @@ const (
 	StandardGeometryName    = "square"
 	SquareGeometryName      = "square"
 	RectangularGeometryName = "rectangular"
+	DiagonalGeometryName    = "diagonal"
+	JigsawGeometryName      = "jigsaw"
 )
 
-// knownGeometries is the lookup table for constructors
-var knownGeometries = map[string]func([]int) (*Puzzle, error){
-	"":                      newStandardPuzzle,
-	"standard":              newStandardPuzzle,
-	"default":               newStandardPuzzle,
-	StandardGeometryName:    newStandardPuzzle,
-	RectangularGeometryName: newRectangularPuzzle,
+// A Geometry lays out the squares of a puzzle: it says which
+// groups of squares must each contain one of every value, and
+// how the squares should be drawn.  The layout can depend on the
+// puzzle summary (typically on its side length, and sometimes on
+// its region map), but not on the puzzle values.
+type Geometry interface {
+	Layout(summary *Summary) (*Layout, error)
+}
+
+// GeometryFunc adapts an ordinary function to the Geometry
+// interface.
+type GeometryFunc func(summary *Summary) (*Layout, error)
+
+// Layout calls f(summary).
+func (f GeometryFunc) Layout(summary *Summary) (*Layout, error) {
+	return f(summary)
+}
+
+// A Layout describes the groups of a puzzle, and gives hints to
+// renderers about how to draw its squares.  Squares are indexed
+// from 1, in row-major order, and every group must contain
+// exactly SideLength distinct squares.
+//
+// The rendering hints are all optional.  Tiles gives the tile
+// number of each square (renderers draw thick borders between
+// squares in different tiles), TileWidth and TileHeight give the
+// size of regular tiles (0 means the tiles aren't regular),
+// Shades gives a shade number for each square (squares with even
+// shades are drawn darker than squares with odd shades), and
+// Marks gives a space-separated list of extra style names for
+// each square (such as "diagonal").  Regions is the region map,
+// if any, that should be kept in the puzzle's summary.
+//
+// If Geometry is empty, the name the geometry was registered
+// under is used in summaries.
+type Layout struct {
+	Geometry   string
+	SideLength int
+	Groups     []LayoutGroup
+	Tiles      []int
+	TileWidth  int
+	TileHeight int
+	Shades     []int
+	Marks      []string
+	Regions    []int
+	mapping    *puzzleMapping
+}
+
+// A LayoutGroup identifies a group and lists the (1-based)
+// indices of its squares.
+type LayoutGroup struct {
+	ID      GroupID
+	Indices []int
+}
+
+// knownGeometries is the lookup table for geometries, including
+// the aliases for the standard geometry.
+var knownGeometries = map[string]Geometry{
+	"":                      GeometryFunc(standardLayout),
+	"standard":              GeometryFunc(standardLayout),
+	"default":               GeometryFunc(standardLayout),
+	StandardGeometryName:    GeometryFunc(standardLayout),
+	RectangularGeometryName: GeometryFunc(rectangularLayout),
+	DiagonalGeometryName:    GeometryFunc(diagonalLayout),
+	JigsawGeometryName:      GeometryFunc(jigsawLayout),
+}
+
+// RegisterGeometry makes a geometry available under the given
+// name, so puzzles can be created with that name in their
+// summaries.  It returns an error if the name is empty or
+// already registered.  Registration is meant to happen during
+// package initialization: it isn't safe to register geometries
+// while puzzles are being created.
+func RegisterGeometry(name string, geometry Geometry) error {
+	if name == "" || geometry == nil {
+		return argumentError(GeometryAttribute, InvalidArgumentCondition, name)
+	}
+	if _, ok := knownGeometries[name]; ok {
+		return argumentError(GeometryAttribute, DuplicateGeometryCondition, name)
+	}
+	knownGeometries[name] = geometry
+	return nil
+}
+
+// NewLayout returns the validated layout of puzzles with the
+// given summary.  Only the Geometry, SideLength, and Regions of
+// the summary are used.  Renderers use this to draw puzzles of
+// any registered geometry.
+func NewLayout(summary *Summary) (*Layout, error) {
+	if summary == nil {
+		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, summary)
+	}
+	geo, err := findGeometry(summary)
+	if err != nil {
+		return nil, err
+	}
+	return findLayout(geo, summary)
+}
+
+// findGeometry looks up the geometry of a summary, and checks
+// that the summary has a side length.
+func findGeometry(summary *Summary) (Geometry, error) {
+	geo, ok := knownGeometries[summary.Geometry]
+	if !ok {
+		return nil, argumentError(GeometryAttribute, UnknownGeometryCondition, summary.Geometry)
+	}
+	if summary.SideLength == 0 {
+		return nil, argumentError(SideLengthAttribute, InvalidArgumentCondition, 0)
+	}
+	return geo, nil
+}
+
+// findLayout gets the layout of a summary from its geometry, and
+// makes sure the layout has a puzzle mapping.  The built-in
+// geometries supply their (memoized) mappings; the mappings for
+// other geometries are computed from their layouts.
+func findLayout(geo Geometry, summary *Summary) (*Layout, error) {
+	layout, err := geo.Layout(summary)
+	if err != nil {
+		return nil, err
+	}
+	if layout == nil {
+		return nil, argumentError(GeometryAttribute, InvalidArgumentCondition, summary.Geometry)
+	}
+	if layout.Geometry == "" {
+		layout.Geometry = summary.Geometry
+	}
+	if layout.mapping == nil {
+		if layout.SideLength != summary.SideLength {
+			return nil, layoutError("SideLength", WrongPuzzleSizeCondition, layout.SideLength, summary.SideLength)
+		}
+		mapping, err := computeLayoutPuzzleMapping(layout)
+		if err != nil {
+			return nil, err
+		}
+		layout.mapping = mapping
+	}
+	return layout, nil
+}
+
+// standardLayout is the layout of a Standard puzzle
+func standardLayout(summary *Summary) (*Layout, error) {
+	mapping, err := squarePuzzleMapping(summary.SideLength * summary.SideLength)
+	if err != nil {
+		return nil, err
+	}
+	return mapping.layout(), nil
+}
+
+// rectangularLayout is the layout of a Rectangular puzzle
+func rectangularLayout(summary *Summary) (*Layout, error) {
+	mapping, err := rectangularPuzzleMapping(summary.SideLength * summary.SideLength)
+	if err != nil {
+		return nil, err
+	}
+	return mapping.layout(), nil
 }
 
-// newStandardPuzzle creates a Standard puzzle from the given values
-func newStandardPuzzle(values []int) (*Puzzle, error) {
-	mapping, err := squarePuzzleMapping(len(values))
+// diagonalLayout is the layout of a Diagonal puzzle
+func diagonalLayout(summary *Summary) (*Layout, error) {
+	mapping, err := diagonalPuzzleMapping(summary.SideLength * summary.SideLength)
 	if err != nil {
 		return nil, err
 	}
-	return create(mapping, values)
+	return mapping.layout(), nil
 }
 
-// newRectangularPuzzle creates a Rectangular puzzle from the given values
-func newRectangularPuzzle(values []int) (*Puzzle, error) {
-	mapping, err := rectangularPuzzleMapping(len(values))
+// jigsawLayout is the layout of a Jigsaw puzzle, which is given
+// by the summary's region map
+func jigsawLayout(summary *Summary) (*Layout, error) {
+	if psize := summary.SideLength * summary.SideLength; len(summary.Regions) != psize {
+		return nil, argumentError(RegionsAttribute, WrongPuzzleSizeCondition, len(summary.Regions), psize)
+	}
+	mapping, err := jigsawPuzzleMapping(summary.Regions)
 	if err != nil {
 		return nil, err
 	}
-	return create(mapping, values)
+	return mapping.layout(), nil
+}
+
+// layout returns the Layout for a puzzle mapping, with the
+// rendering hints filled in from the mapping's groups.  Regular
+// tiles are shaded in a checkerboard pattern; irregular tiles
+// (which only occur with region maps) are shaded by number.
+// Squares on a diagonal are marked as such.
+func (pm *puzzleMapping) layout() *Layout {
+	slen := pm.sidelen
+	l := &Layout{
+		Geometry:   pm.geometry,
+		SideLength: slen,
+		Groups:     make([]LayoutGroup, 0, pm.gcount),
+		Tiles:      make([]int, pm.scount),
+		TileWidth:  pm.tileX,
+		TileHeight: pm.tileY,
+		Shades:     make([]int, pm.scount),
+		Marks:      make([]string, pm.scount),
+		mapping:    pm,
+	}
+	if pm.regions != nil {
+		l.Regions = append([]int(nil), pm.regions...)
+	}
+	for _, gd := range pm.gdescs[1:] {
+		l.Groups = append(l.Groups, LayoutGroup{gd.id, append([]int(nil), gd.indices...)})
+		for _, si := range gd.indices {
+			switch gd.id.Gtype {
+			case GtypeTile, GtypeRegion:
+				l.Tiles[si-1] = gd.id.Index
+			case GtypeDiagonal:
+				l.Marks[si-1] = "diagonal"
+			}
+		}
+	}
+	for i := 0; i < pm.scount; i++ {
+		if pm.tileX < slen || pm.tileY < slen {
+			row, col := i/slen, i%slen
+			l.Shades[i] = row/pm.tileY + col/pm.tileX
+		} else {
+			l.Shades[i] = l.Tiles[i]
+		}
+	}
+	return l
+}
+
+// computeLayoutPuzzleMapping builds the mapping for a layout
+// that was supplied by a registered geometry.  Returns an error
+// if any group has the wrong number of squares, if any square
+// index is out of range, or if any rendering hint doesn't have
+// one entry per square.
+//
+// Since a registered geometry might vary its groups in any way,
+// we don't memoize these mappings.
+func computeLayoutPuzzleMapping(l *Layout) (*puzzleMapping, error) {
+	slen := l.SideLength
+	min, max := 1, maxSideLength
+	if slen < min {
+		return nil, formatError(SideLengthAttribute, slen, TooSmallCondition, min)
+	}
+	if slen > max {
+		return nil, formatError(SideLengthAttribute, slen, TooLargeCondition, max)
+	}
+	scount, gcount := slen*slen, len(l.Groups)
+	if len(l.Tiles) != 0 && len(l.Tiles) != scount {
+		return nil, layoutError("Tiles", WrongPuzzleSizeCondition, len(l.Tiles), scount)
+	}
+	if len(l.Shades) != 0 && len(l.Shades) != scount {
+		return nil, layoutError("Shades", WrongPuzzleSizeCondition, len(l.Shades), scount)
+	}
+	if len(l.Marks) != 0 && len(l.Marks) != scount {
+		return nil, layoutError("Marks", WrongPuzzleSizeCondition, len(l.Marks), scount)
+	}
+	if len(l.Regions) != 0 && len(l.Regions) != scount {
+		return nil, layoutError("Regions", WrongPuzzleSizeCondition, len(l.Regions), scount)
+	}
+	gs := make([]groupDescriptor, gcount+1) // 1-based indexing
+	im := make([][]int, scount+1)           // 1-based indexing
+	for i, g := range l.Groups {
+		gi := i + 1 // 1-based indices
+		indices := make(intset, 0, slen)
+		seen := make(map[int]bool, slen)
+		for _, si := range g.Indices {
+			if si < 1 {
+				return nil, formatError(IndexAttribute, si, TooSmallCondition, 1)
+			}
+			if si > scount {
+				return nil, formatError(IndexAttribute, si, TooLargeCondition, scount)
+			}
+			if !seen[si] {
+				seen[si] = true
+				indices = append(indices, si)
+				im[si] = append(im[si], gi)
+			}
+		}
+		if len(indices) != slen {
+			return nil, layoutError(g.ID, WrongGroupSizeCondition, len(indices), slen)
+		}
+		sort.Ints(indices)
+		gs[gi] = groupDescriptor{gi, g.ID, indices}
+	}
+	tileX, tileY := l.TileWidth, l.TileHeight
+	if tileX <= 0 || tileX > slen {
+		tileX = slen
+	}
+	if tileY <= 0 || tileY > slen {
+		tileY = slen
+	}
+	rs := append([]int(nil), l.Regions...)
+	return &puzzleMapping{l.Geometry, slen, tileX, tileY, scount, gcount, gs, im, rs}, nil
 }
 
 /*
@@ -152,7 +426,7 @@ func computeSquarePuzzleMapping(slen, tlen int) *puzzleMapping {
 		}
 		gs[tgi] = groupDescriptor{tgi, GroupID{GtypeTile, i + 1}, tile}
 	}
-	return &puzzleMapping{StandardGeometryName, slen, tlen, tlen, scount, gcount, gs, im}
+	return &puzzleMapping{StandardGeometryName, slen, tlen, tlen, scount, gcount, gs, im, nil}
 }
 
 // squarePuzzleMapping returns the puzzle map for a square puzzle
@@ -164,7 +438,7 @@ func squarePuzzleMapping(psize int) (*puzzleMapping, error) {
 	if !ok {
 		return nil, formatError(PuzzleSizeAttribute, psize, NonSquareCondition, 0)
 	}
-	min, max := 4, 26 // bounded above by row value representation
+	min, max := 4, maxSideLength
 	if sidelen < min {
 		return nil, formatError(SideLengthAttribute, sidelen, TooSmallCondition, min)
 	}
@@ -285,7 +559,7 @@ func computeRectangularPuzzleMapping(slen, tileX, tileY int) *puzzleMapping {
 		}
 		gs[tgi] = groupDescriptor{tgi, GroupID{GtypeTile, i + 1}, tile}
 	}
-	return &puzzleMapping{RectangularGeometryName, slen, tileX, tileY, scount, gcount, gs, im}
+	return &puzzleMapping{RectangularGeometryName, slen, tileX, tileY, scount, gcount, gs, im, nil}
 }
 
 // rectangularPuzzleMapping returns the puzzle map for a square puzzle
@@ -297,7 +571,7 @@ func rectangularPuzzleMapping(psize int) (*puzzleMapping, error) {
 	if !ok {
 		return nil, formatError(PuzzleSizeAttribute, psize, NonSquareCondition, 0)
 	}
-	min, max := 6, 26 // bounded above by row value representation
+	min, max := 6, maxSideLength
 	if sidelen < min {
 		return nil, formatError(SideLengthAttribute, sidelen, TooSmallCondition, min)
 	}
@@ -319,6 +593,204 @@ func rectangularPuzzleMapping(psize int) (*puzzleMapping, error) {
 
 /*
 
+Diagonal (aka Sudoku-X) puzzles
+
+*/
+
+// diagonalPuzzleMaps is where we memoize computed diagonal
+// puzzle maps for each side length we've encountered, to avoid
+// computing them more than once.
+var diagonalPuzzleMaps = make(map[int]*puzzleMapping)
+
+// computeDiagonalPuzzleMapping starts with the mapping for a
+// square puzzle of the same size and adds the two main
+// diagonals as groups.  The first diagonal runs from top left to
+// bottom right, the second from top right to bottom left.
+func computeDiagonalPuzzleMapping(slen, tlen int) *puzzleMapping {
+	pm := computeSquarePuzzleMapping(slen, tlen)
+	pm.geometry = DiagonalGeometryName
+	for d := 1; d <= 2; d++ {
+		dgi := pm.gcount + d // 1-based indices
+		diag := make(intset, slen)
+		for i := 0; i < slen; i++ {
+			si := slen*i + i + 1 // 1-based indices
+			if d == 2 {
+				si = slen*i + (slen - 1 - i) + 1
+			}
+			diag[i] = si
+			pm.ixmap[si] = append(pm.ixmap[si], dgi)
+		}
+		pm.gdescs = append(pm.gdescs, groupDescriptor{dgi, GroupID{GtypeDiagonal, d}, diag})
+	}
+	pm.gcount += 2
+	return pm
+}
+
+// diagonalPuzzleMapping returns the puzzle map for a diagonal
+// puzzle with the given number of cells.  This computes (first
+// time) and then returns (thereafter) the map.  Returns an error
+// if the sidelength is not a perfect square.
+func diagonalPuzzleMapping(psize int) (*puzzleMapping, error) {
+	sidelen, ok := findIntSquareRoot(psize)
+	if !ok {
+		return nil, formatError(PuzzleSizeAttribute, psize, NonSquareCondition, 0)
+	}
+	min, max := 4, maxSideLength
+	if sidelen < min {
+		return nil, formatError(SideLengthAttribute, sidelen, TooSmallCondition, min)
+	}
+	if sidelen > max {
+		return nil, formatError(SideLengthAttribute, sidelen, TooLargeCondition, max)
+	}
+	tilelen, ok := findIntSquareRoot(sidelen)
+	if !ok {
+		return nil, formatError(SideLengthAttribute, sidelen, NonSquareCondition, 0)
+	}
+	pm, ok := diagonalPuzzleMaps[sidelen]
+	if ok {
+		return pm, nil
+	}
+	pm = computeDiagonalPuzzleMapping(sidelen, tilelen)
+	diagonalPuzzleMaps[sidelen] = pm
+	return pm, nil
+}
+
+/*
+
+Jigsaw (aka irregular) puzzles
+
+*/
+
+// computeJigsawPuzzleMapping builds the mapping for a puzzle
+// whose tiles are given by a region map: one region number for
+// each square, with regions numbered from 1.  The regions become
+// the tile groups, numbered by region.  Because there are no
+// regular tiles, the tile dimensions are the full side length.
+//
+// Unlike the other geometries, we don't memoize these mappings,
+// because every puzzle can have a different region map.
+func computeJigsawPuzzleMapping(slen int, regions []int) *puzzleMapping {
+	gcount := (slen * 3)
+	scount := (slen * slen)
+	gs := make([]groupDescriptor, gcount+1) // 1-based indexing
+	im := make([][]int, scount+1)           // 1-based indexing
+	for i := 1; i <= scount; i++ {
+		im[i] = make([]int, 3) // 3 groups for every square
+	}
+	for i := 0; i < slen; i++ {
+		// row i + 1
+		rgi := i + 1 // 1-based indexes
+		row := make(intset, slen)
+		for ri := 0; ri < slen; ri++ {
+			si := slen*i + ri + 1 // 1-based indexes
+			row[ri] = si
+			im[si][0] = rgi
+		}
+		gs[rgi] = groupDescriptor{rgi, GroupID{GtypeRow, i + 1}, row}
+		// column i + 1
+		cgi := i + slen + 1 // 1-based indices
+		col := make(intset, slen)
+		for ci := 0; ci < slen; ci++ {
+			si := slen*ci + i + 1 // 1-based indices
+			col[ci] = si
+			im[si][1] = cgi
+		}
+		gs[cgi] = groupDescriptor{cgi, GroupID{GtypeCol, i + 1}, col}
+	}
+	// region r is tile r; squares are visited in index order, so
+	// each region's indices come out sorted.
+	for r := 1; r <= slen; r++ {
+		tgi := r + 2*slen // 1-based indices
+		gs[tgi] = groupDescriptor{tgi, GroupID{GtypeRegion, r}, make(intset, 0, slen)}
+	}
+	for i, r := range regions {
+		si, tgi := i+1, r+2*slen // 1-based indices
+		gs[tgi].indices = append(gs[tgi].indices, si)
+		im[si][2] = tgi
+	}
+	rs := append([]int(nil), regions...)
+	return &puzzleMapping{JigsawGeometryName, slen, slen, slen, scount, gcount, gs, im, rs}
+}
+
+// jigsawPuzzleMapping returns the puzzle map for a jigsaw puzzle
+// with the given region map.  Returns an error if the region map
+// isn't square, if any region number is out of range, or if any
+// region is not a contiguous set of side-length many squares.
+func jigsawPuzzleMapping(regions []int) (*puzzleMapping, error) {
+	psize := len(regions)
+	sidelen, ok := findIntSquareRoot(psize)
+	if !ok {
+		return nil, formatError(PuzzleSizeAttribute, psize, NonSquareCondition, 0)
+	}
+	min, max := 4, maxSideLength
+	if sidelen < min {
+		return nil, formatError(SideLengthAttribute, sidelen, TooSmallCondition, min)
+	}
+	if sidelen > max {
+		return nil, formatError(SideLengthAttribute, sidelen, TooLargeCondition, max)
+	}
+	// count the squares in each region, and remember one of them
+	counts := make([]int, sidelen+1) // 1-based region numbers
+	starts := make([]int, sidelen+1) // 1-based region numbers
+	for i, r := range regions {
+		if r < 1 {
+			return nil, formatError(RegionAttribute, r, TooSmallCondition, 1)
+		}
+		if r > sidelen {
+			return nil, formatError(RegionAttribute, r, TooLargeCondition, sidelen)
+		}
+		counts[r]++
+		starts[r] = i
+	}
+	for r := 1; r <= sidelen; r++ {
+		if counts[r] != sidelen {
+			return nil, regionError(r, WrongRegionSizeCondition, counts[r], sidelen)
+		}
+		if filled := fillRegion(sidelen, regions, starts[r]); filled != sidelen {
+			return nil, regionError(r, NonContiguousRegionCondition)
+		}
+	}
+	return computeJigsawPuzzleMapping(sidelen, regions), nil
+}
+
+// fillRegion does a flood fill (through squares sharing a side)
+// of the region containing the given 0-based square position,
+// and returns the number of squares reached.
+func fillRegion(slen int, regions []int, start int) int {
+	region := regions[start]
+	seen := make([]bool, len(regions))
+	seen[start] = true
+	count, pending := 0, []int{start}
+	for len(pending) > 0 {
+		pos := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		count++
+		row, col := pos/slen, pos%slen
+		neighbors := []int{-1, -1, -1, -1}
+		if row > 0 {
+			neighbors[0] = pos - slen
+		}
+		if row < slen-1 {
+			neighbors[1] = pos + slen
+		}
+		if col > 0 {
+			neighbors[2] = pos - 1
+		}
+		if col < slen-1 {
+			neighbors[3] = pos + 1
+		}
+		for _, n := range neighbors {
+			if n >= 0 && !seen[n] && regions[n] == region {
+				seen[n] = true
+				pending = append(pending, n)
+			}
+		}
+	}
+	return count
+}
+
+/*
+
 Errors
 
 */
@@ -336,3 +808,27 @@ func formatError(attr ErrorAttribute, val int, cond ErrorCondition, limit int) E
 	}
 	return err
 }
+
+// regionError returns an Error that describes a region in a
+// region map that can't be a tile.
+func regionError(region int, cond ErrorCondition, values ...interface{}) Error {
+	return Error{
+		Scope:     GeometryScope,
+		Structure: AttributeValueStructure,
+		Attribute: RegionAttribute,
+		Condition: cond,
+		Values:    append(ErrorData{region}, values...),
+	}
+}
+
+// layoutError returns an Error that describes a problem with
+// part of a layout supplied by a registered geometry.
+func layoutError(part interface{}, cond ErrorCondition, values ...interface{}) Error {
+	return Error{
+		Scope:     GeometryScope,
+		Structure: AttributeValueStructure,
+		Attribute: LayoutAttribute,
+		Condition: cond,
+		Values:    append(ErrorData{part}, values...),
+	}
+}
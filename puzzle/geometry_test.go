@@ -140,7 +140,7 @@ func TestSquarePuzzleMapping(t *testing.T) {
 		[]int{9, 13, 26}, []int{9, 14, 26}, []int{9, 15, 26},
 		[]int{9, 16, 27}, []int{9, 17, 27}, []int{9, 18, 27},
 	}
-	sm9 := puzzleMapping{StandardGeometryName, 9, 3, 3, 81, 27, gd9, gm9}
+	sm9 := puzzleMapping{StandardGeometryName, 9, 3, 3, 81, 27, gd9, gm9, nil}
 	sm9c := computeSquarePuzzleMapping(9, 3)
 	sm9a, err := squarePuzzleMapping(81)
 	if err != nil {
@@ -260,7 +260,7 @@ func TestRectangularPuzzleMapping(t *testing.T) {
 		[]int{6, 7, 17}, []int{6, 8, 17}, []int{6, 9, 17},
 		[]int{6, 10, 18}, []int{6, 11, 18}, []int{6, 12, 18},
 	}
-	sm6 := puzzleMapping{RectangularGeometryName, 6, 3, 2, 36, 18, gd6, gm6}
+	sm6 := puzzleMapping{RectangularGeometryName, 6, 3, 2, 36, 18, gd6, gm6, nil}
 	sm6c := computeRectangularPuzzleMapping(6, 3, 2)
 	sm6a, err := rectangularPuzzleMapping(36)
 	if err != nil {
@@ -291,3 +291,333 @@ func TestRectangularPuzzleMapping(t *testing.T) {
 		t.Errorf("First side 6 rectangular puzzle mapping was not reused!")
 	}
 }
+
+func TestDiagonalPuzzleMapping(t *testing.T) {
+	// First make sure the boundary condition logic is working
+	if _, err := diagonalPuzzleMapping(13); err == nil {
+		t.Fatalf("Creating a diagonal puzzle mapping for puzzle size 13 did not fail.")
+	} else {
+		if err.(Error).Condition != NonSquareCondition {
+			t.Logf("diagonalPuzzleMapping(13): %v", err)
+			t.Errorf("Incorrect error!")
+		}
+	}
+	if _, err := diagonalPuzzleMapping(1); err == nil {
+		t.Fatalf("Creating a diagonal puzzle mapping for puzzle size 1 did not fail.")
+	} else {
+		if err.(Error).Condition != TooSmallCondition {
+			t.Logf("diagonalPuzzleMapping(1): %v", err)
+			t.Errorf("Incorrect error!")
+		}
+	}
+	if _, err := diagonalPuzzleMapping(6 * 6); err == nil {
+		t.Fatalf("Creating a diagonal puzzle mapping for sidelen 6 did not fail.")
+	} else {
+		if err.(Error).Attribute != SideLengthAttribute {
+			t.Logf("diagonalPuzzleMapping(6 x 6): %v", err)
+			t.Errorf("Incorrect error!")
+		}
+	}
+
+	// we test the map for 4, which is small enough to simulate
+	// manually.  The row, column, and tile groups are the same
+	// as for the square geometry, so only the diagonals and the
+	// cell map need checking.
+	dm4, err := diagonalPuzzleMapping(16)
+	if err != nil {
+		t.Fatalf("Creating first side 4 diagonal puzzle mapping returned an error: %v", err)
+	}
+	sm4 := computeSquarePuzzleMapping(4, 2)
+	if dm4.geometry != DiagonalGeometryName || dm4.sidelen != 4 ||
+		dm4.tileX != 2 || dm4.tileY != 2 || dm4.scount != 16 || dm4.gcount != 14 {
+		t.Errorf("side 4 diagonal puzzle mapping has wrong parameters: %+v", *dm4)
+	}
+	if !reflect.DeepEqual(dm4.gdescs[:13], sm4.gdescs) {
+		t.Errorf("side 4 diagonal puzzle mapping has wrong non-diagonal groups: %v", dm4.gdescs[:13])
+	}
+	dd4 := []groupDescriptor{
+		groupDescriptor{13, GroupID{GtypeDiagonal, 1}, []int{1, 6, 11, 16}},
+		groupDescriptor{14, GroupID{GtypeDiagonal, 2}, []int{4, 7, 10, 13}},
+	}
+	if !reflect.DeepEqual(dm4.gdescs[13:], dd4) {
+		t.Errorf("side 4 diagonal groups are %v (expected %v)", dm4.gdescs[13:], dd4)
+	}
+	dg4 := [][]int{
+		[]int(nil),
+		[]int{1, 5, 9, 13}, []int{1, 6, 9}, []int{1, 7, 10}, []int{1, 8, 10, 14},
+		[]int{2, 5, 9}, []int{2, 6, 9, 13}, []int{2, 7, 10, 14}, []int{2, 8, 10},
+		[]int{3, 5, 11}, []int{3, 6, 11, 14}, []int{3, 7, 12, 13}, []int{3, 8, 12},
+		[]int{4, 5, 11, 14}, []int{4, 6, 11}, []int{4, 7, 12}, []int{4, 8, 12, 13},
+	}
+	if !reflect.DeepEqual(dm4.ixmap, dg4) {
+		for j := 1; j <= 16; j++ {
+			if !reflect.DeepEqual(dm4.ixmap[j], dg4[j]) {
+				t.Errorf("cell map %d: %v (expected %v)\n", j, dm4.ixmap[j], dg4[j])
+			}
+		}
+	}
+	dm4b, err := diagonalPuzzleMapping(16)
+	if err != nil {
+		t.Fatalf("Creating second side 4 diagonal puzzle mapping returned an error: %v", err)
+	}
+	if reflect.ValueOf(dm4).Pointer() != reflect.ValueOf(dm4b).Pointer() {
+		t.Errorf("First side 4 diagonal puzzle mapping was not reused!")
+	}
+	sm4a, _ := squarePuzzleMapping(16)
+	if len(sm4a.gdescs) != 13 || len(sm4a.ixmap[1]) != 3 {
+		t.Errorf("Computing the diagonal mapping altered the square mapping: %+v", *sm4a)
+	}
+}
+
+type jigsawErrcase struct {
+	regions []int
+	attr    ErrorAttribute
+	cond    ErrorCondition
+}
+
+func TestJigsawPuzzleMapping(t *testing.T) {
+	// First make sure the region map validation is working
+	errcases := []jigsawErrcase{
+		jigsawErrcase{make([]int, 13), PuzzleSizeAttribute, NonSquareCondition},
+		jigsawErrcase{make([]int, 1), SideLengthAttribute, TooSmallCondition},
+		jigsawErrcase{make([]int, 65*65), SideLengthAttribute, TooLargeCondition},
+		jigsawErrcase{
+			[]int{1, 1, 2, 2, 1, 1, 2, 2, 3, 3, 4, 4, 3, 3, 4, 0},
+			RegionAttribute, TooSmallCondition,
+		},
+		jigsawErrcase{
+			[]int{1, 1, 2, 2, 1, 1, 2, 2, 3, 3, 4, 4, 3, 3, 4, 5},
+			RegionAttribute, TooLargeCondition,
+		},
+		jigsawErrcase{
+			[]int{1, 1, 2, 2, 1, 1, 2, 2, 3, 3, 4, 4, 3, 3, 4, 3},
+			RegionAttribute, WrongRegionSizeCondition,
+		},
+		jigsawErrcase{
+			[]int{1, 1, 2, 2, 1, 3, 2, 2, 3, 1, 4, 4, 3, 3, 4, 4},
+			RegionAttribute, NonContiguousRegionCondition,
+		},
+	}
+	for i, ec := range errcases {
+		if _, err := jigsawPuzzleMapping(ec.regions); err == nil {
+			t.Errorf("Creating jigsaw puzzle mapping for case %d did not fail.", i+1)
+		} else {
+			if e := err.(Error); e.Attribute != ec.attr || e.Condition != ec.cond {
+				t.Logf("jigsawPuzzleMapping case %d: %v", i+1, err)
+				t.Errorf("Incorrect error!")
+			}
+		}
+	}
+
+	// we test the map for 6, which is small enough to simulate
+	// manually.  The row and column groups are the same as for
+	// other geometries, so only the regions and the cell map
+	// need checking.
+	jm6, err := jigsawPuzzleMapping(jigsaw6Regions)
+	if err != nil {
+		t.Fatalf("Creating side 6 jigsaw puzzle mapping returned an error: %v", err)
+	}
+	if jm6.geometry != JigsawGeometryName || jm6.sidelen != 6 ||
+		jm6.tileX != 6 || jm6.tileY != 6 || jm6.scount != 36 || jm6.gcount != 18 {
+		t.Errorf("side 6 jigsaw puzzle mapping has wrong parameters: %+v", *jm6)
+	}
+	jd6 := []groupDescriptor{
+		groupDescriptor{13, GroupID{GtypeRegion, 1}, []int{1, 2, 3, 7, 8, 13}},
+		groupDescriptor{14, GroupID{GtypeRegion, 2}, []int{4, 5, 6, 11, 12, 18}},
+		groupDescriptor{15, GroupID{GtypeRegion, 3}, []int{9, 10, 15, 16, 17, 22}},
+		groupDescriptor{16, GroupID{GtypeRegion, 4}, []int{14, 19, 20, 21, 26, 27}},
+		groupDescriptor{17, GroupID{GtypeRegion, 5}, []int{23, 24, 28, 29, 30, 36}},
+		groupDescriptor{18, GroupID{GtypeRegion, 6}, []int{25, 31, 32, 33, 34, 35}},
+	}
+	if !reflect.DeepEqual(jm6.gdescs[13:], jd6) {
+		t.Errorf("side 6 jigsaw regions are %v (expected %v)", jm6.gdescs[13:], jd6)
+	}
+	for j := 1; j <= 36; j++ {
+		if tgi := jm6.ixmap[j][2]; tgi != jigsaw6Regions[j-1]+12 {
+			t.Errorf("cell map %d: %v (expected region %d)", j, jm6.ixmap[j], jigsaw6Regions[j-1])
+		}
+	}
+	if !reflect.DeepEqual(jm6.regions, jigsaw6Regions) {
+		t.Errorf("side 6 jigsaw puzzle mapping has regions %v (expected %v)", jm6.regions, jigsaw6Regions)
+	}
+	if &jm6.regions[0] == &jigsaw6Regions[0] {
+		t.Errorf("side 6 jigsaw puzzle mapping shares its region map with the caller")
+	}
+}
+
+/*
+
+Registered geometries
+
+*/
+
+// latin4Layout lays out a 4x4 puzzle the way a geometry outside
+// this package would: it lists the rows, columns, and 2x2 tiles
+// of a standard puzzle, and marks the corner squares.
+func latin4Layout(summary *Summary) (*Layout, error) {
+	if summary.SideLength != 4 {
+		return nil, formatError(SideLengthAttribute, summary.SideLength, TooLargeCondition, 4)
+	}
+	l := &Layout{SideLength: 4, TileWidth: 2, TileHeight: 2}
+	l.Tiles, l.Shades, l.Marks = make([]int, 16), make([]int, 16), make([]string, 16)
+	rows, cols, tiles := make([]LayoutGroup, 4), make([]LayoutGroup, 4), make([]LayoutGroup, 4)
+	for i := 0; i < 4; i++ {
+		rows[i].ID, cols[i].ID, tiles[i].ID = GroupID{GtypeRow, i + 1}, GroupID{GtypeCol, i + 1}, GroupID{GtypeTile, i + 1}
+		for j := 0; j < 4; j++ {
+			rows[i].Indices = append(rows[i].Indices, 4*i+j+1)
+			cols[i].Indices = append(cols[i].Indices, 4*j+i+1)
+			tsi := 4*(2*(i/2)+j/2) + 2*(i%2) + j%2 // 0-based
+			tiles[i].Indices = append(tiles[i].Indices, tsi+1)
+			l.Tiles[tsi], l.Shades[tsi] = i+1, i/2+i%2
+		}
+	}
+	l.Groups = append(append(rows, cols...), tiles...)
+	l.Marks[0], l.Marks[3], l.Marks[12], l.Marks[15] = "corner", "corner", "corner", "corner"
+	return l, nil
+}
+
+func TestRegisterGeometry(t *testing.T) {
+	// restore known geometries after test
+	defer func(gd map[string]Geometry) {
+		knownGeometries = gd
+	}(knownGeometries)
+	saved := knownGeometries
+	knownGeometries = make(map[string]Geometry, len(saved))
+	for name, geo := range saved {
+		knownGeometries[name] = geo
+	}
+
+	errcases := []struct {
+		name string
+		geo  Geometry
+		cond ErrorCondition
+	}{
+		{"", GeometryFunc(latin4Layout), InvalidArgumentCondition},
+		{"latin4", nil, InvalidArgumentCondition},
+		{JigsawGeometryName, GeometryFunc(latin4Layout), DuplicateGeometryCondition},
+	}
+	for i, ec := range errcases {
+		e := RegisterGeometry(ec.name, ec.geo)
+		if err, ok := e.(Error); !ok || err.Attribute != GeometryAttribute || err.Condition != ec.cond {
+			t.Errorf("RegisterGeometry case %d: wrong error: %v", i+1, e)
+		}
+	}
+	if e := RegisterGeometry("latin4", GeometryFunc(latin4Layout)); e != nil {
+		t.Fatalf("RegisterGeometry failed: %v", e)
+	}
+	if e := RegisterGeometry("latin4", GeometryFunc(latin4Layout)); e == nil {
+		t.Errorf("RegisterGeometry accepted a duplicate name")
+	}
+
+	// a puzzle in the registered geometry acts just like a
+	// standard puzzle, except for its geometry name
+	lp, e := New(&Summary{Geometry: "latin4", SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("New for registered geometry failed: %v", e)
+	}
+	sp, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("New for standard geometry failed: %v", e)
+	}
+	if g := lp.summary().Geometry; g != "latin4" {
+		t.Errorf("Registered geometry puzzle has geometry %q", g)
+	}
+	if ls, ss := lp.ValuesString(true), sp.ValuesString(true); ls != ss {
+		t.Errorf("Registered geometry puzzle prints as:\n%v\nexpected:\n%v", ls, ss)
+	}
+	if ls, ss := lp.allSolutions(), sp.allSolutions(); !reflect.DeepEqual(ls, ss) {
+		t.Errorf("Registered geometry puzzle has solutions %v, expected %v", ls, ss)
+	}
+	if _, e := New(&Summary{Geometry: "latin4", SideLength: 9}); e == nil {
+		t.Errorf("Registered geometry accepted the wrong side length")
+	}
+}
+
+func TestNewLayout(t *testing.T) {
+	if _, e := NewLayout(nil); e == nil {
+		t.Errorf("NewLayout accepted a nil summary")
+	}
+	if _, e := NewLayout(&Summary{Geometry: "no such geometry", SideLength: 4}); e == nil {
+		t.Errorf("NewLayout accepted an unknown geometry")
+	}
+
+	// built-in layouts carry their mappings and rendering hints
+	sl, e := NewLayout(&Summary{Geometry: "standard", SideLength: 4})
+	if e != nil {
+		t.Fatalf("NewLayout for standard geometry failed: %v", e)
+	}
+	if sl.Geometry != StandardGeometryName || sl.SideLength != 4 || len(sl.Groups) != 12 ||
+		sl.TileWidth != 2 || sl.TileHeight != 2 || sl.Regions != nil {
+		t.Errorf("Standard layout has wrong parameters: %+v", *sl)
+	}
+	if m, _ := squarePuzzleMapping(16); sl.mapping != m {
+		t.Errorf("Standard layout doesn't use the memoized mapping")
+	}
+	st := []int{1, 1, 2, 2, 1, 1, 2, 2, 3, 3, 4, 4, 3, 3, 4, 4}
+	ss := []int{0, 0, 1, 1, 0, 0, 1, 1, 1, 1, 2, 2, 1, 1, 2, 2}
+	if !reflect.DeepEqual(sl.Tiles, st) || !reflect.DeepEqual(sl.Shades, ss) {
+		t.Errorf("Standard layout has tiles %v and shades %v", sl.Tiles, sl.Shades)
+	}
+	dl, e := NewLayout(&Summary{Geometry: DiagonalGeometryName, SideLength: 4})
+	if e != nil {
+		t.Fatalf("NewLayout for diagonal geometry failed: %v", e)
+	}
+	for i, m := range dl.Marks {
+		if row, col := i/4, i%4; (row == col || row+col == 3) != (m == "diagonal") {
+			t.Errorf("Diagonal layout square %d has marks %q", i+1, m)
+		}
+	}
+	jl, e := NewLayout(&Summary{Geometry: JigsawGeometryName, SideLength: 6, Regions: jigsaw6Regions})
+	if e != nil {
+		t.Fatalf("NewLayout for jigsaw geometry failed: %v", e)
+	}
+	if !reflect.DeepEqual(jl.Tiles, jigsaw6Regions) || !reflect.DeepEqual(jl.Shades, jigsaw6Regions) ||
+		!reflect.DeepEqual(jl.Regions, jigsaw6Regions) {
+		t.Errorf("Jigsaw layout has tiles %v, shades %v, and regions %v", jl.Tiles, jl.Shades, jl.Regions)
+	}
+
+	// other layouts are validated and get their own mappings
+	good := func() *Layout {
+		l, _ := latin4Layout(&Summary{SideLength: 4})
+		return l
+	}
+	ll, e := findLayout(GeometryFunc(func(*Summary) (*Layout, error) { return good(), nil }),
+		&Summary{Geometry: "latin4", SideLength: 4})
+	if e != nil {
+		t.Fatalf("findLayout for a good layout failed: %v", e)
+	}
+	if ll.Geometry != "latin4" || ll.mapping == nil || ll.mapping.geometry != "latin4" ||
+		ll.mapping.gcount != 12 || ll.mapping.tileX != 2 || ll.mapping.tileY != 2 {
+		t.Errorf("Good layout has wrong parameters: %+v", *ll)
+	}
+	sm, _ := squarePuzzleMapping(16)
+	for i := 1; i <= 16; i++ {
+		if !reflect.DeepEqual(ll.mapping.ixmap[i], sm.ixmap[i]) {
+			t.Errorf("Good layout cell map %d: %v (expected %v)", i, ll.mapping.ixmap[i], sm.ixmap[i])
+		}
+	}
+	errcases := []struct {
+		edit func(*Layout)
+		attr ErrorAttribute
+		cond ErrorCondition
+	}{
+		{func(l *Layout) { l.SideLength = 5 }, LayoutAttribute, WrongPuzzleSizeCondition},
+		{func(l *Layout) { l.Groups[0].Indices = l.Groups[0].Indices[1:] }, LayoutAttribute, WrongGroupSizeCondition},
+		{func(l *Layout) { l.Groups[0].Indices[0] = 2 }, LayoutAttribute, WrongGroupSizeCondition},
+		{func(l *Layout) { l.Groups[0].Indices[0] = 0 }, IndexAttribute, TooSmallCondition},
+		{func(l *Layout) { l.Groups[0].Indices[0] = 17 }, IndexAttribute, TooLargeCondition},
+		{func(l *Layout) { l.Tiles = l.Tiles[1:] }, LayoutAttribute, WrongPuzzleSizeCondition},
+		{func(l *Layout) { l.Shades = l.Shades[1:] }, LayoutAttribute, WrongPuzzleSizeCondition},
+		{func(l *Layout) { l.Marks = l.Marks[1:] }, LayoutAttribute, WrongPuzzleSizeCondition},
+		{func(l *Layout) { l.Regions = []int{1} }, LayoutAttribute, WrongPuzzleSizeCondition},
+	}
+	for i, ec := range errcases {
+		l := good()
+		ec.edit(l)
+		_, e := findLayout(GeometryFunc(func(*Summary) (*Layout, error) { return l, nil }),
+			&Summary{Geometry: "latin4", SideLength: 4})
+		if err, ok := e.(Error); !ok || err.Scope != GeometryScope || err.Attribute != ec.attr || err.Condition != ec.cond {
+			t.Errorf("findLayout case %d: wrong error: %v", i+1, e)
+		}
+	}
+}
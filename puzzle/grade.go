@@ -0,0 +1,222 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"sort"
+)
+
+/*
+
+Grading
+
+A puzzle is graded by solving it the way a human solver would:
+at each step, the easiest technique that makes progress is
+used, and the solver starts over from the easiest technique
+after every step.  The techniques, easiest first, are
+
+1. naked singles (rated 1 star);
+2. hidden singles (2 stars);
+3. pointing and claiming, and naked and hidden pairs (3 stars);
+4. naked and hidden triples and quads (4 stars).
+
+The puzzle's rating is the star rating of the hardest technique
+needed to solve it, and its score is the sum of the weights of
+all the steps taken, so that puzzles with the same rating can
+still be compared.  Puzzles that the techniques can't solve are
+solved by guessing (see the solver), and are rated 5 stars; each
+guess is counted as a use of GuessTechnique.
+
+Grading is done on a fresh copy of the puzzle, without any
+pencil marks or advanced propagation, so that the grade depends
+only on the puzzle's values and structure.
+
+*/
+
+// A Grade is the difficulty of a puzzle, as measured by the
+// techniques needed to solve it.  Technique and Size give the
+// hardest technique used, and Name is its English name.  Score
+// is the total weight of all the steps taken, and Uses counts
+// the steps taken with each technique, easiest first.
+type Grade struct {
+	Technique Technique `json:"technique"`
+	Size      int       `json:"size"`
+	Name      string    `json:"name"`
+	Score     int       `json:"score"`
+	Uses      []Use     `json:"uses"`
+}
+
+// A Use counts the steps taken with a technique (applied to a
+// subset or intersection of the given size) while grading.
+type Use struct {
+	Technique Technique `json:"technique"`
+	Size      int       `json:"size"`
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+}
+
+// difficulty returns the weight of one step taken with a
+// technique of the given size, and the star rating of puzzles
+// that need the technique.
+func difficulty(t Technique, size int) (weight, stars int) {
+	switch {
+	case t == NakedSubsetTechnique && size == 1:
+		return 1, 1
+	case t == HiddenSubsetTechnique && size == 1:
+		return 2, 2
+	case t == PointingTechnique || t == ClaimingTechnique:
+		return 5, 3
+	case t == NakedSubsetTechnique && size == 2:
+		return 10, 3
+	case t == HiddenSubsetTechnique && size == 2:
+		return 15, 3
+	case t == NakedSubsetTechnique && size == 3:
+		return 20, 4
+	case t == HiddenSubsetTechnique && size == 3:
+		return 25, 4
+	case t == NakedSubsetTechnique:
+		return 30, 4
+	case t == HiddenSubsetTechnique:
+		return 35, 4
+	default:
+		return 50, 5
+	}
+}
+
+// use records count steps taken with a technique of the given
+// size, keeping the uses ordered by difficulty (and techniques of
+// equal difficulty by technique and size), and updating the
+// hardest technique and the score.
+func (g *Grade) use(t Technique, size, count int) {
+	weight, _ := difficulty(t, size)
+	g.Score += weight * count
+	if hardest, _ := difficulty(g.Technique, g.Size); g.Technique == UnknownTechnique || weight > hardest {
+		g.Technique, g.Size, g.Name = t, size, t.Name(size)
+	}
+	for i := range g.Uses {
+		if g.Uses[i].Technique == t && g.Uses[i].Size == size {
+			g.Uses[i].Count += count
+			return
+		}
+	}
+	i := sort.Search(len(g.Uses), func(i int) bool {
+		u := g.Uses[i]
+		if w, _ := difficulty(u.Technique, u.Size); w != weight {
+			return w > weight
+		}
+		return u.Technique > t || (u.Technique == t && u.Size > size)
+	})
+	g.Uses = append(g.Uses, Use{})
+	copy(g.Uses[i+1:], g.Uses[i:])
+	g.Uses[i] = Use{t, size, t.Name(size), count}
+}
+
+// rating returns the star rating (1-5) of a grade.  A puzzle
+// that is filled in already needs no technique, so it's rated 1.
+func (g *Grade) rating() int {
+	if g.Technique == UnknownTechnique {
+		return 1
+	}
+	_, stars := difficulty(g.Technique, g.Size)
+	return stars
+}
+
+// guessed returns a copy of a grade with guesses added to it.
+func (g *Grade) guessed(guesses int) *Grade {
+	c := *g
+	c.Uses = append([]Use(nil), g.Uses...)
+	if guesses > 0 {
+		c.use(GuessTechnique, 1, guesses)
+	}
+	return &c
+}
+
+// grade solves a puzzle as far as it can using only logical
+// techniques, returning the grade and the (fresh) puzzle the
+// techniques were applied to.  The puzzle being graded isn't
+// changed.  If the puzzle can't be rebuilt, the returned puzzle
+// is nil.
+func (p *Puzzle) grade() (*Puzzle, *Grade) {
+	summary := p.summary()
+	summary.Metadata, summary.Marks, summary.UseMarks = nil, nil, false
+	summary.Propagation, summary.Errors = BasicPropagation, nil
+	c, err := New(summary)
+	if err != nil {
+		return nil, &Grade{}
+	}
+	g := &Grade{}
+	for len(c.errors) == 0 {
+		if h := c.placementHint(); h != nil {
+			g.use(h.Technique, h.Size, 1)
+			c.assign(h.Index, h.Value)
+			continue
+		}
+		d := c.firstDeduction()
+		if d == nil {
+			break
+		}
+		g.use(d.technique, d.size, 1)
+		c.errors = append(c.errors, c.apply(d)...)
+		c.analyze()
+	}
+	return c, g
+}
+
+// firstDeduction returns the first deduction made by the
+// technique steps, easiest first, or nil if there isn't one.
+func (p *Puzzle) firstDeduction() *deduction {
+	var found *deduction
+	for _, step := range techniqueSteps {
+		for _, g := range p.groups[1:] {
+			p.findDeductions(g, step.technique, step.size, func(d *deduction) bool {
+				found = d
+				return true
+			})
+			if found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// isFilled returns whether every square of a puzzle is
+// assigned.
+func (p *Puzzle) isFilled() bool {
+	for _, s := range p.squares[1:] {
+		if s.aval == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// allows returns whether a puzzle's marks allow all the values
+// of a filled-in puzzle.  Struck values only count when the
+// puzzle uses its marks.
+func (p *Puzzle) allows(values []int) bool {
+	if !p.useMarks {
+		return true
+	}
+	for i, v := range values {
+		if p.squares[i+1].svals.has(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGradeUse(t *testing.T) {
+	g := &Grade{}
+	if r := g.rating(); r != 1 {
+		t.Errorf("Empty grade has rating %d, expected 1", r)
+	}
+	g.use(HiddenSubsetTechnique, 2, 1)
+	g.use(NakedSubsetTechnique, 1, 3)
+	g.use(ClaimingTechnique, 2, 1)
+	g.use(PointingTechnique, 3, 2)
+	g.use(NakedSubsetTechnique, 1, 2)
+	expect := &Grade{HiddenSubsetTechnique, 2, "hidden pair", 15 + 5*1 + 5*2 + 1*5, []Use{
+		{NakedSubsetTechnique, 1, "naked single", 5},
+		{PointingTechnique, 3, "pointing triple", 2},
+		{ClaimingTechnique, 2, "claiming pair", 1},
+		{HiddenSubsetTechnique, 2, "hidden pair", 1},
+	}}
+	if !reflect.DeepEqual(g, expect) {
+		t.Errorf("Grade is %+v, expected %+v", *g, *expect)
+	}
+	if r := g.rating(); r != 3 {
+		t.Errorf("Grade has rating %d, expected 3", r)
+	}
+	gg := g.guessed(2)
+	if gg.Technique != GuessTechnique || gg.Name != "guess" || gg.Score != g.Score+100 || gg.rating() != 5 {
+		t.Errorf("Guessed grade is %+v", *gg)
+	}
+	if len(g.Uses) != 4 || len(gg.Uses) != 5 || gg.Uses[4] != (Use{GuessTechnique, 1, "guess", 2}) {
+		t.Errorf("Guessed grade uses are %v (original uses %v)", gg.Uses, g.Uses)
+	}
+}
+
+func TestGrade(t *testing.T) {
+	tcs := []struct {
+		geometry  string
+		sidelen   int
+		values    []int
+		technique Technique
+		size      int
+		rating    int
+		score     int
+	}{
+		{StandardGeometryName, 9, oneStarValues, HiddenSubsetTechnique, 1, 2, 59},
+		{StandardGeometryName, 9, chronTwoValues, ClaimingTechnique, 2, 3, 82},
+		{RectangularGeometryName, 6, Su6Standard1Values, NakedSubsetTechnique, 1, 1, 18},
+		{StandardGeometryName, 9, fiveStarValues, HiddenSubsetTechnique, 1, 2, 53},
+	}
+	for i, tc := range tcs {
+		p, e := New(&Summary{Geometry: tc.geometry, SideLength: tc.sidelen, Values: tc.values})
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		before := p.summary()
+		_, g := p.grade()
+		if !reflect.DeepEqual(p.summary(), before) {
+			t.Errorf("test %d: grading changed the puzzle", i+1)
+		}
+		if g.Technique != tc.technique || g.Size != tc.size || g.rating() != tc.rating || g.Score != tc.score {
+			t.Errorf("test %d: grade is %+v (rating %d), expected %v/%d (rating %d) with score %d",
+				i+1, *g, g.rating(), tc.technique, tc.size, tc.rating, tc.score)
+		}
+		total := 0
+		for _, u := range g.Uses {
+			w, _ := difficulty(u.Technique, u.Size)
+			total += w * u.Count
+		}
+		if total != g.Score {
+			t.Errorf("test %d: grade uses %v add up to %d, not score %d", i+1, g.Uses, total, g.Score)
+		}
+	}
+}
+
+func TestGradeIgnoresPropagation(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: chronTwoValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	_, g1 := p.grade()
+	if _, e := p.SetPropagation(AdvancedPropagation); e != nil {
+		t.Fatalf("Failed to set propagation: %v", e)
+	}
+	_, g2 := p.grade()
+	if !reflect.DeepEqual(g1, g2) {
+		t.Errorf("Grade with advanced propagation is %+v, expected %+v", *g2, *g1)
+	}
+	solns := p.allSolutions()
+	if len(solns) != 1 || len(solns[0].Choices) != 0 || !reflect.DeepEqual(solns[0].Grade, g1) {
+		t.Errorf("Solutions are %+v, expected one graded %+v", solns, *g1)
+	}
+}
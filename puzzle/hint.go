@@ -0,0 +1,284 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+
+Hints
+
+A hint is the next logical step a human solver could take in a
+puzzle, using the simplest technique that applies.  Placements
+come first: a naked single (a square with only one possible
+value), then a hidden single (a square that is the only place in
+a group for a needed value).  After those come the eliminations
+made by advanced propagation, in the order it tries them.
+
+Eliminations are found on a copy of the puzzle.  If all the
+values a deduction eliminates have already been struck by the
+player, the deduction is applied to the copy and the search goes
+on, so players who keep their marks up to date are always shown
+something new.
+
+*/
+
+// A Hint is the next logical step in solving a puzzle.  It
+// names the Technique (and the Size of its subset or
+// intersection), the Groups involved, and the Squares and Values
+// of the pattern the technique found.  A Hint either places a
+// value in a square, given by Index and Value, or eliminates
+// possible values from squares, given by Eliminations.  Name and
+// Message are English descriptions of the technique and of the
+// whole hint.
+type Hint struct {
+	Technique    Technique `json:"technique"`
+	Size         int       `json:"size"`
+	Name         string    `json:"name,omitempty"`
+	Groups       []GroupID `json:"groups,omitempty"`
+	Squares      []int     `json:"squares"`
+	Values       []int     `json:"values"`
+	Index        int       `json:"index,omitempty"`
+	Value        int       `json:"value,omitempty"`
+	Eliminations []Choice  `json:"eliminations,omitempty"`
+	Message      string    `json:"message,omitempty"`
+}
+
+// Name returns the English name of a technique applied to a
+// subset or intersection of the given size, such as "naked
+// pair" or "pointing triple".
+func (t Technique) Name(size int) string {
+	var sn string
+	switch size {
+	case 1:
+		sn = "single"
+	case 2:
+		sn = "pair"
+	case 3:
+		sn = "triple"
+	case 4:
+		sn = "quad"
+	default:
+		sn = fmt.Sprintf("set of %d", size)
+	}
+	switch t {
+	case NakedSubsetTechnique:
+		return "naked " + sn
+	case HiddenSubsetTechnique:
+		return "hidden " + sn
+	case PointingTechnique:
+		return "pointing " + sn
+	case ClaimingTechnique:
+		return "claiming " + sn
+	default:
+		return t.String()
+	}
+}
+
+// Return an explanation of a Hint.  If the Hint has a
+// pre-canned message, this will use it, otherwise it will
+// produce an appropriate (English, non-localized) message.
+func (h Hint) String() string {
+	hs := h.Message
+	if len(hs) > 0 {
+		return hs
+	}
+	name := h.Technique.Name(h.Size)
+	name = strings.ToUpper(name[:1]) + name[1:]
+	hs = name + ": "
+	groups := make([]string, len(h.Groups))
+	for i, gid := range h.Groups {
+		groups[i] = gid.String()
+	}
+	squares, values := andList(h.Squares), andList(h.Values)
+	switch {
+	case h.Technique == NakedSubsetTechnique && h.Size == 1:
+		hs += fmt.Sprintf("square %v can only be %v.", h.Index, h.Value)
+	case h.Technique == HiddenSubsetTechnique && h.Size == 1:
+		hs += fmt.Sprintf("in %v, square %v is the only place for %v.",
+			andStrings(groups), h.Index, h.Value)
+	case h.Technique == NakedSubsetTechnique:
+		hs += fmt.Sprintf("in %v, squares %v can only be %v, so no other square in %v can be any of them.",
+			groups[0], squares, values, groups[0])
+	case h.Technique == HiddenSubsetTechnique:
+		hs += fmt.Sprintf("in %v, %v can only be in squares %v, so those squares can't be anything else.",
+			groups[0], values, squares)
+	case h.Technique == PointingTechnique || h.Technique == ClaimingTechnique:
+		hs += fmt.Sprintf("in %v, %v can only be in squares %v, which are also in %v, so no other square in %v can be %v.",
+			groups[0], values, squares, groups[1], groups[1], values)
+	default:
+		hs = name + "."
+	}
+	if len(h.Eliminations) > 0 {
+		hs += " Remove " + removalList(h.Eliminations) + "."
+	}
+	return hs
+}
+
+// removalList is a helper that describes eliminations in
+// English, listing squares that lose the same values together,
+// e.g., "8 from squares 1 and 12; 3 and 4 from square 5".
+func removalList(elims []Choice) string {
+	var vals, squares [][]int // squares[i] lose vals[i]
+	for i := 0; i < len(elims); {
+		var vs []int
+		idx := elims[i].Index
+		for ; i < len(elims) && elims[i].Index == idx; i++ {
+			vs = append(vs, elims[i].Value)
+		}
+		j := 0
+		for ; j < len(vals) && !reflect.DeepEqual(vals[j], vs); j++ {
+		}
+		if j == len(vals) {
+			vals, squares = append(vals, vs), append(squares, nil)
+		}
+		squares[j] = append(squares[j], idx)
+	}
+	removals := make([]string, len(vals))
+	for i := range vals {
+		if len(squares[i]) == 1 {
+			removals[i] = fmt.Sprintf("%v from square %v", andList(vals[i]), squares[i][0])
+		} else {
+			removals[i] = fmt.Sprintf("%v from squares %v", andList(vals[i]), andList(squares[i]))
+		}
+	}
+	return strings.Join(removals, "; ")
+}
+
+// andList is a helper that lists values in English, e.g., "1, 2
+// and 3".
+func andList(vals []int) string {
+	strs := make([]string, len(vals))
+	for i, v := range vals {
+		strs[i] = fmt.Sprint(v)
+	}
+	return andStrings(strs)
+}
+
+// andStrings is a helper that lists strings in English, e.g.,
+// "row 1, column 2 and tile 1".
+func andStrings(strs []string) string {
+	if len(strs) < 2 {
+		return strings.Join(strs, "")
+	}
+	return strings.Join(strs[:len(strs)-1], ", ") + " and " + strs[len(strs)-1]
+}
+
+// Hint returns the next logical step in solving the puzzle,
+// using the simplest technique that applies.  If there is no
+// such step, because the puzzle is filled in or because it can
+// only be solved by guessing, the returned Hint is nil.  If the
+// puzzle has errors, an Error is returned.
+func (p *Puzzle) Hint() (*Hint, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if err := p.checkSolvable(); err != nil {
+		return nil, err
+	}
+	h := p.hint()
+	if h != nil {
+		h.Name = h.Technique.Name(h.Size)
+		h.Message = h.String()
+	}
+	return h, nil
+}
+
+// hint finds the next logical step in solving a puzzle, or nil
+// if there isn't one.  The puzzle isn't changed.
+func (p *Puzzle) hint() *Hint {
+	c := p.copy()
+	for len(c.errors) == 0 {
+		if h := c.placementHint(); h != nil {
+			return h
+		}
+		var h *Hint
+		progress := false
+		for _, step := range techniqueSteps {
+			for _, g := range c.groups[1:] {
+				c.findDeductions(g, step.technique, step.size, func(d *deduction) bool {
+					for _, e := range d.elims {
+						if !p.squares[e.Index].svals.has(e.Value) {
+							h = d.hint()
+							return true
+						}
+					}
+					// the player has struck all these values already
+					progress = true
+					c.errors = append(c.errors, c.apply(d)...)
+					return len(c.errors) > 0
+				})
+				if h != nil {
+					return h
+				}
+				if len(c.errors) > 0 {
+					return nil
+				}
+			}
+			if progress {
+				break
+			}
+		}
+		if !progress {
+			return nil
+		}
+		c.analyze()
+	}
+	return nil
+}
+
+// placementHint finds the first naked single in a puzzle, or
+// if there isn't one the first hidden single, or nil if there
+// isn't either.
+func (p *Puzzle) placementHint() *Hint {
+	for _, s := range p.squares[1:] {
+		if s.aval == 0 && s.pvals.len() == 1 {
+			d := &deduction{technique: NakedSubsetTechnique, size: 1, squares: intset{s.index}, values: intset{s.pvals.next(0)}}
+			return d.hint()
+		}
+	}
+	for _, s := range p.squares[1:] {
+		if s.aval == 0 && s.bval != 0 {
+			d := &deduction{technique: HiddenSubsetTechnique, size: 1, squares: intset{s.index}, values: intset{s.bval}}
+			d.groups = append(d.groups, s.bsrc...)
+			return d.hint()
+		}
+	}
+	return nil
+}
+
+// hint returns the Hint for a deduction.  Deductions that don't
+// eliminate anything are placements.
+func (d *deduction) hint() *Hint {
+	h := &Hint{
+		Technique:    d.technique,
+		Size:         d.size,
+		Groups:       append([]GroupID(nil), d.groups...),
+		Squares:      newIntsetCopy(d.squares),
+		Values:       newIntsetCopy(d.values),
+		Eliminations: append([]Choice(nil), d.elims...),
+	}
+	if len(d.elims) == 0 {
+		h.Index, h.Value = d.squares[0], d.values[0]
+	}
+	return h
+}
@@ -0,0 +1,192 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTechniqueName(t *testing.T) {
+	testcases := []struct {
+		technique Technique
+		size      int
+		name      string
+	}{
+		{NakedSubsetTechnique, 1, "naked single"},
+		{HiddenSubsetTechnique, 2, "hidden pair"},
+		{NakedSubsetTechnique, 3, "naked triple"},
+		{HiddenSubsetTechnique, 4, "hidden quad"},
+		{PointingTechnique, 2, "pointing pair"},
+		{ClaimingTechnique, 5, "claiming set of 5"},
+		{UnknownTechnique, 1, "unknown technique"},
+	}
+	for i, tc := range testcases {
+		if name := tc.technique.Name(tc.size); name != tc.name {
+			t.Errorf("case %d: got name %q, expected %q", i+1, name, tc.name)
+		}
+	}
+}
+
+func TestHint(t *testing.T) {
+	// a hidden single, a naked pair, and a pointing pair in
+	// otherwise empty puzzles with basic propagation
+	hidden, pair, pointing := []Choice{}, []Choice{}, []Choice{}
+	for i := 2; i <= 9; i++ {
+		hidden = append(hidden, Choice{i, 1})
+	}
+	for _, i := range []int{1, 2} {
+		for v := 3; v <= 9; v++ {
+			pair = append(pair, Choice{i, v})
+		}
+	}
+	for _, i := range []int{3, 10, 11, 12, 19, 20, 21} {
+		pointing = append(pointing, Choice{i, 1})
+	}
+	row1, tile1 := GroupID{GtypeRow, 1}, GroupID{GtypeTile, 1}
+	var pairElims, pointingElims []Choice
+	for i := 3; i <= 9; i++ {
+		pairElims = append(pairElims, Choice{i, 1}, Choice{i, 2})
+		if i > 3 {
+			pointingElims = append(pointingElims, Choice{i, 1})
+		}
+	}
+	testcases := []struct {
+		values  []int
+		marks   []Choice
+		hint    *Hint
+		message string
+	}{
+		{
+			oneStarValues, nil,
+			&Hint{NakedSubsetTechnique, 1, "naked single", nil, []int{51}, []int{1}, 51, 1, nil, ""},
+			"Naked single: square 51 can only be 1.",
+		},
+		{
+			nil, hidden,
+			&Hint{HiddenSubsetTechnique, 1, "hidden single", []GroupID{row1}, []int{1}, []int{1}, 1, 1, nil, ""},
+			"Hidden single: in row 1, square 1 is the only place for 1.",
+		},
+		{
+			nil, pair,
+			&Hint{NakedSubsetTechnique, 2, "naked pair", []GroupID{row1}, []int{1, 2}, []int{1, 2}, 0, 0, pairElims, ""},
+			"Naked pair: in row 1, squares 1 and 2 can only be 1 and 2, so no other square in row 1 can be any of them." +
+				" Remove 1 and 2 from squares 3, 4, 5, 6, 7, 8 and 9.",
+		},
+		{
+			nil, pointing,
+			&Hint{PointingTechnique, 2, "pointing pair", []GroupID{tile1, row1}, []int{1, 2}, []int{1}, 0, 0, pointingElims, ""},
+			"Pointing pair: in tile 1, 1 can only be in squares 1 and 2, which are also in row 1, so no other square in row 1 can be 1." +
+				" Remove 1 from squares 4, 5, 6, 7, 8 and 9.",
+		},
+	}
+	for i, tc := range testcases {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: tc.values, Marks: tc.marks, UseMarks: true})
+		if e != nil {
+			t.Fatalf("case %d: Failed to create puzzle: %v", i+1, e)
+		}
+		hint, e := p.Hint()
+		if e != nil {
+			t.Fatalf("case %d: Hint failed: %v", i+1, e)
+		}
+		tc.hint.Message = tc.message
+		if !reflect.DeepEqual(hint, tc.hint) {
+			t.Errorf("case %d: got hint %+v, expected %+v", i+1, hint, tc.hint)
+		}
+	}
+	// techniques without a description are just named
+	guess := Hint{Technique: GuessTechnique, Eliminations: []Choice{{1, 2}}}
+	if m, expected := guess.String(), "Guess. Remove 2 from square 1."; m != expected {
+		t.Errorf("Guess hint has message %q, expected %q", m, expected)
+	}
+}
+
+func TestHintSolving(t *testing.T) {
+	// following the hints solves these puzzles, without using
+	// marks to limit the possible values
+	testcases := []struct {
+		values   []int
+		complete bool
+	}{
+		{oneStarValues, true},
+		{chronTwoValues, true},
+		{sixStarValues, false},
+	}
+	for i, tc := range testcases {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: tc.values})
+		if e != nil {
+			t.Fatalf("case %d: Failed to create puzzle: %v", i+1, e)
+		}
+		before, _ := p.Summary()
+		for steps := 0; steps < 200; steps++ {
+			hint, e := p.Hint()
+			if e != nil {
+				t.Fatalf("case %d: Hint failed at step %d: %v", i+1, steps, e)
+			}
+			if hint == nil {
+				break
+			}
+			if hint.Index != 0 {
+				_, e = p.Assign(Choice{hint.Index, hint.Value})
+			}
+			for _, c := range hint.Eliminations {
+				if _, e = p.Mark(Mark{Index: c.Index, Value: c.Value}); e != nil {
+					break
+				}
+			}
+			if e != nil {
+				t.Fatalf("case %d: Following hint %v failed: %v", i+1, hint, e)
+			}
+		}
+		after, _ := p.Summary()
+		complete := true
+		for _, v := range after.Values {
+			complete = complete && v != 0
+		}
+		if complete != tc.complete || len(after.Errors) != 0 {
+			t.Errorf("case %d: following hints gave %v", i+1, after.Values)
+		}
+		if reflect.DeepEqual(after.Values, before.Values) {
+			t.Errorf("case %d: following hints made no progress", i+1)
+		}
+	}
+}
+
+func TestHintErrors(t *testing.T) {
+	var p *Puzzle
+	if _, e := p.Hint(); e == nil || e.(Error).Condition != InvalidArgumentCondition {
+		t.Errorf("Hint on nil puzzle gave error %v", e)
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if _, e = p.Assign(Choice{2, 4}); e != nil {
+		t.Fatalf("Failed to make puzzle unsolvable: %v", e)
+	}
+	if _, e := p.Hint(); e == nil || e.(Error).Condition != InvalidPuzzleAssignmentCondition {
+		t.Errorf("Hint on unsolvable puzzle gave error %v", e)
+	}
+	p, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarBoundValues})
+	if e != nil {
+		t.Fatalf("Failed to create complete puzzle: %v", e)
+	}
+	if hint, e := p.Hint(); hint != nil || e != nil {
+		t.Errorf("Hint on complete puzzle gave %v, %v", hint, e)
+	}
+}
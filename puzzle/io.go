@@ -21,6 +21,7 @@ package puzzle
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 /*
@@ -50,6 +51,73 @@ func vstr(i int) string {
 	return bigValueString
 }
 
+// valueWidth returns the width of the print form of values in a
+// puzzle of the given side length.  Puzzles whose values all
+// have single-character forms use them; larger puzzles print
+// values as right-aligned decimal numbers.
+func valueWidth(slen int) int {
+	if slen < len(valueStrings) {
+		return 1
+	}
+	return len(strconv.Itoa(slen))
+}
+
+// vstrw returns the print form of a value in the given width.
+func vstrw(i, width int) string {
+	if width == 1 {
+		return vstr(i)
+	}
+	if i < 0 {
+		return fmt.Sprintf("%*s", width, nonValueString)
+	}
+	if i == 0 {
+		return strings.Repeat(" ", width)
+	}
+	return fmt.Sprintf("%*d", width, i)
+}
+
+// squareString returns the print form of a square whose values
+// have the given width.  If showBindings is specified,
+// single-value squares, bound squares, and 2-choice squares also
+// show their contents; otherwise unassigned squares show blank
+// centered in the cell.  Every form is 2*width+1 wide.
+func squareString(s *square, showBindings bool, width int, blank string) string {
+	pad := strings.Repeat(" ", width)
+	if s.aval != 0 {
+		return " " + vstrw(s.aval, width) + pad
+	} else if showBindings {
+		if v := s.pvals.next(0); s.pvals.len() == 1 {
+			return "=" + vstrw(v, width) + pad
+		} else if s.bval != 0 {
+			return "+" + vstrw(s.bval, width) + pad
+		} else if s.pvals.len() == 2 {
+			return vstrw(v, width) + "," + vstrw(s.pvals.next(v), width)
+		}
+	}
+	return pad + blank + pad
+}
+
+// RowLabel returns the label of a (0-based) row in the print
+// forms of puzzles: "a" through "z", then "aa" through "az",
+// "ba", and so on.
+func RowLabel(row int) (label string) {
+	for n := row + 1; n > 0; n = (n - 1) / 26 {
+		label = string(rune('a'+(n-1)%26)) + label
+	}
+	return
+}
+
+// rowLabels returns the labels of all the rows in a puzzle of
+// the given side length, padded to the same width.
+func rowLabels(slen int) []string {
+	width := len(RowLabel(slen - 1))
+	labels := make([]string, slen)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("%-*s", width, RowLabel(i))
+	}
+	return labels
+}
+
 /*
 
 Pretty-printed puzzles in strings, for debugging.
@@ -58,7 +126,7 @@ Pretty-printed puzzles in strings, for debugging.
 
 // String gives a pretty-printed view of a puzzle.
 func (p *Puzzle) String() string {
-	return p.ValuesString(true) + p.ErrorsString()
+	return p.ValuesString(true) + p.CagesString() + p.ErrorsString()
 }
 
 // valuesString: return a pretty-printed grid of the values.  If
@@ -69,65 +137,126 @@ func (p *Puzzle) ValuesString(showBindings bool) (result string) {
 		return
 	}
 	slen, tileX, tileY := p.mapping.sidelen, p.mapping.tileX, p.mapping.tileY
+	vw, rowhdrs := valueWidth(slen), rowLabels(slen)
+	margin := strings.Repeat(" ", len(rowhdrs[0]))
 	// first put out the header
-	result += " "
+	result += margin
 	for i := 0; i < slen; i++ {
 		if i%tileX != 0 {
 			result += " "
 		} else {
 			result += "|"
 		}
-		result += fmt.Sprintf("%2d ", i+1)
+		result += fmt.Sprintf("%*d ", 2*vw, i+1)
 	}
 	result += "\n"
 	// next are the rows, including the separator at the top
-	for ri, rowhdr := 0, 'a'; ri < slen; ri, rowhdr = ri+1, rowhdr+1 {
+	for ri := 0; ri < slen; ri++ {
 		if ri%tileY == 0 {
-			result += " "
+			result += margin
 			for i := 0; i < slen; i++ {
-				result += "+---"
+				result += "+" + strings.Repeat("-", 2*vw+1)
 			}
 			result += "\n"
 		}
-		result += string(rowhdr)
+		result += rowhdrs[ri]
 		for i := 0; i < slen; i++ {
-			s := p.squares[(ri*slen)+i+1]
 			if i%tileX != 0 {
 				result += " "
 			} else {
 				result += "|"
 			}
-			if s.aval != 0 {
-				result += fmt.Sprintf(" %s ", vstr(s.aval))
-			} else if showBindings {
-				if len(s.pvals) == 1 {
-					result += fmt.Sprintf("=%s ", vstr(s.pvals[0]))
-				} else if s.bval != 0 {
-					result += fmt.Sprintf("+%s ", vstr(s.bval))
-				} else if len(s.pvals) == 2 {
-					result += fmt.Sprintf("%s,%s", vstr(s.pvals[0]), vstr(s.pvals[1]))
-				} else {
-					result += fmt.Sprintf(" _ ")
-				}
+			result += squareString(p.squares[(ri*slen)+i+1], showBindings, vw, "_")
+		}
+		result += "\n"
+	}
+	return
+}
+
+// CagesString returns a pretty-printed outline of a puzzle's
+// cages, with each cage's sum shown in its first square.  If
+// the puzzle has no cages, the result is empty.
+func (p *Puzzle) CagesString() (result string) {
+	if p == nil || len(p.cages) == 0 {
+		return
+	}
+	slen := p.mapping.sidelen
+	cw, rowhdrs := 2*valueWidth(slen)+1, rowLabels(slen)
+	margin := strings.Repeat(" ", len(rowhdrs[0]))
+	blank, line := strings.Repeat(" ", cw), strings.Repeat("-", cw)
+	// map each square to its (1-based) cage, 0 if uncaged
+	cageOf := make([]int, p.mapping.scount+1)
+	for ci, c := range p.cages {
+		for _, i := range c.indices {
+			cageOf[i] = ci + 1
+		}
+	}
+	// helper: whether two squares (by row and column) share a cage
+	sameCage := func(r1, c1, r2, c2 int) bool {
+		if r2 < 0 || r2 >= slen || c2 < 0 || c2 >= slen {
+			return false
+		}
+		cage := cageOf[r1*slen+c1+1]
+		return cage != 0 && cage == cageOf[r2*slen+c2+1]
+	}
+	// first put out the header
+	result += margin
+	for i := 0; i < slen; i++ {
+		result += fmt.Sprintf(" %*d ", cw-1, i+1)
+	}
+	result += "\n"
+	// next are the rows, each with the outline above it
+	for ri := 0; ri < slen; ri++ {
+		result += margin + "+"
+		for i := 0; i < slen; i++ {
+			if sameCage(ri, i, ri-1, i) {
+				result += blank + "+"
 			} else {
-				result += fmt.Sprintf(" _ ")
+				result += line + "+"
+			}
+		}
+		result += "\n"
+		result += rowhdrs[ri] + "|"
+		for i := 0; i < slen; i++ {
+			idx := ri*slen + i + 1
+			if cage := cageOf[idx]; cage != 0 && p.cages[cage-1].indices[0] == idx {
+				result += fmt.Sprintf("%-*d", cw, p.cages[cage-1].sum)
+			} else {
+				result += blank
+			}
+			if sameCage(ri, i, ri, i+1) {
+				result += " "
+			} else {
+				result += "|"
 			}
 		}
 		result += "\n"
 	}
+	// last comes the bottom line
+	result += margin + "+"
+	for i := 0; i < slen; i++ {
+		result += line + "+"
+	}
+	result += "\n"
 	return
 }
 
-func (p *Puzzle) ErrorsString() (result string) {
+func (p *Puzzle) ErrorsString() string {
+	return p.LocalizedErrorsString(DefaultLocale)
+}
+
+// LocalizedErrorsString is like ErrorsString, but the error
+// messages are in the given locale.
+func (p *Puzzle) LocalizedErrorsString(locale string) (result string) {
 	if p != nil {
 		if elen := len(p.errors); elen > 0 {
 			if elen > 1 {
 				result += fmt.Sprintf("Errors (%d):\n", elen)
 				for i, err := range p.errors {
-					result += fmt.Sprintf("  #%d: %v\n", i+1, err)
+					result += fmt.Sprintf("  #%d: %v\n", i+1, err.Localize(locale))
 				}
 			} else {
-				result += fmt.Sprintf("Error: %v\n", p.errors[0])
+				result += fmt.Sprintf("Error: %v\n", p.errors[0].Localize(locale))
 			}
 		}
 	}
@@ -148,6 +277,7 @@ func (p *Puzzle) ValuesMarkdown(showBindings bool) (result string) {
 		return
 	}
 	slen := p.mapping.sidelen
+	vw := valueWidth(slen)
 
 	// first put out the header
 	result += "|     |"
@@ -162,47 +292,54 @@ func (p *Puzzle) ValuesMarkdown(showBindings bool) (result string) {
 	}
 	result += "\n"
 	// next comes the content of the puzzle,
-	// with each line prefixed by a letter.
-	for ri, rowhdr := 0, 'a'; ri < slen; ri, rowhdr = ri+1, rowhdr+1 {
-		result += "|**" + string(rowhdr) + "**"
+	// with each line prefixed by its row label.
+	for ri := 0; ri < slen; ri++ {
+		result += "|**" + RowLabel(ri) + "**"
 		for i := 0; i < slen; i++ {
-			s := p.squares[(ri*slen)+i+1]
 			if i == 0 {
 				result += "| "
 			} else {
 				result += " | "
 			}
-			if s.aval != 0 {
-				result += fmt.Sprintf(" %s ", vstr(s.aval))
-			} else if showBindings {
-				if len(s.pvals) == 1 {
-					result += fmt.Sprintf("=%s ", vstr(s.pvals[0]))
-				} else if s.bval != 0 {
-					result += fmt.Sprintf("+%s ", vstr(s.bval))
-				} else if len(s.pvals) == 2 {
-					result += fmt.Sprintf("%s,%s", vstr(s.pvals[0]), vstr(s.pvals[1]))
-				} else {
-					result += fmt.Sprintf("   ")
-				}
-			} else {
-				result += "   "
-			}
+			result += squareString(p.squares[(ri*slen)+i+1], showBindings, vw, " ")
 		}
 		result += " |\n"
 	}
 	return
 }
 
-func (p *Puzzle) ErrorsMarkdown() (result string) {
+// CagesMarkdown returns the cage outline of a puzzle (as given
+// by CagesString) as a markdown code block.  If the puzzle has
+// no cages, the result is empty.
+func (p *Puzzle) CagesMarkdown() (result string) {
+	if outline := p.CagesString(); outline != "" {
+		result = "\n"
+		for _, line := range strings.SplitAfter(outline, "\n") {
+			if line != "" {
+				result += "    " + line
+			}
+		}
+		result += "\n"
+	}
+	return
+}
+
+func (p *Puzzle) ErrorsMarkdown() string {
+	return p.LocalizedErrorsMarkdown(DefaultLocale)
+}
+
+// LocalizedErrorsMarkdown is like ErrorsMarkdown, but the error
+// messages are in the given locale.
+func (p *Puzzle) LocalizedErrorsMarkdown(locale string) (result string) {
 	if p != nil {
 		if elen := len(p.errors); elen > 0 {
 			if elen > 1 {
 				result += fmt.Sprintf("Errors (%d):\n", elen)
 				for i, err := range p.errors {
-					result += fmt.Sprintf("    %d. %v\n", i+1, err)
+					result += fmt.Sprintf("    %d. %v\n", i+1, err.Localize(locale))
 				}
 			} else {
-				result += fmt.Sprintf("Error: %v\n", p.errors[0])
+				result += fmt.Sprintf("Error: %v\n", p.errors[0].Localize(locale))
 			}
 		}
 	}
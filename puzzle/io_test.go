@@ -20,6 +20,7 @@ package puzzle
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -55,6 +56,15 @@ func TestVstr(t *testing.T) {
 	}
 }
 
+func TestRowLabel(t *testing.T) {
+	labels := map[int]string{0: "a", 25: "z", 26: "aa", 51: "az", 52: "ba", 63: "bl", 701: "zz", 702: "aaa"}
+	for row, e := range labels {
+		if l := RowLabel(row); l != e {
+			t.Errorf("Label of row %d is %q, expected %q", row, l, e)
+		}
+	}
+}
+
 /*
 
 Stringer
@@ -99,7 +109,7 @@ func TestPuzzleString(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 	// do a 9x9 empty puzzle test to cover unknown squares
-	p, err = New(&Summary{nil, StandardGeometryName, 9, nil, nil})
+	p, err = New(&Summary{nil, StandardGeometryName, 9, nil, nil, nil, nil, false, 0, nil})
 	if err != nil {
 		t.Fatalf("Puzzle creation failed: %v", err)
 	}
@@ -121,7 +131,7 @@ func TestPuzzleString(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 	// do a 12x12 empty puzzle test to cover rectangular borders
-	p, err = New(&Summary{nil, RectangularGeometryName, 12, nil, nil})
+	p, err = New(&Summary{nil, RectangularGeometryName, 12, nil, nil, nil, nil, false, 0, nil})
 	if err != nil {
 		t.Fatalf("Puzzle creation failed: %v", err)
 	}
@@ -148,6 +158,83 @@ func TestPuzzleString(t *testing.T) {
 	}
 }
 
+func TestPuzzleCagesString(t *testing.T) {
+	// puzzles without cages have no cage outline
+	p, err := New(&Summary{nil, StandardGeometryName, 4, nil, nil, nil, nil, false, 0, nil})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	if s := p.CagesString(); s != "" {
+		t.Errorf("Unexpected cage string for uncaged puzzle: %q", s)
+	}
+	// a 4x4 killer puzzle
+	p, err = New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Cages:      killer4Cages})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	s := p.CagesString()
+	e := "   1   2   3   4 \n" +
+		" +---+---+---+---+\n" +
+		"a|4  |6  |7      |\n" +
+		" +   +   +---+---+\n" +
+		"b|   |   |5  |6  |\n" +
+		" +---+---+   +   +\n" +
+		"c|7      |   |   |\n" +
+		" +   +---+---+   +\n" +
+		"d|   |5      |   |\n" +
+		" +---+---+---+---+\n"
+	if s != e {
+		t.Errorf("Unexpected cage string:\n%vExpected:\n%v", s, e)
+	}
+}
+
+func TestLargePuzzleString(t *testing.T) {
+	vals := make([]int, 36*36)
+	vals[0], vals[1], vals[36*36-1] = 36, 7, 12
+	p, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 36, Values: vals})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	lines := strings.Split(p.ValuesString(false), "\n")
+	if len(lines) != 1+36+6+1 {
+		t.Fatalf("Values string has %d lines, expected %d", len(lines), 1+36+6+1)
+	}
+	checks := []struct {
+		line   int
+		prefix string
+		suffix string
+	}{
+		{0, "  |   1     2     3 ", "    35    36 "},
+		{1, "  +-----+-----+-----+", "-----+-----"},
+		{2, "a | 36     7     _  ", "  _     _  "},
+		{37, "ae|  _     _     _  ", "  _     _  "},
+		{42, "aj|  _     _     _  ", "  _    12  "},
+	}
+	for _, c := range checks {
+		if !strings.HasPrefix(lines[c.line], c.prefix) || !strings.HasSuffix(lines[c.line], c.suffix) {
+			t.Errorf("Line %d of values string is %q, expected %q...%q",
+				c.line, lines[c.line], c.prefix, c.suffix)
+		}
+	}
+	p, err = New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 36,
+		Cages:      []Cage{{Sum: 71, Indices: []int{1, 2}}, {Sum: 3, Indices: []int{37}}}})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	lines = strings.Split(p.CagesString(), "\n")
+	if e := "a |71         |     |"; !strings.HasPrefix(lines[2], e) {
+		t.Errorf("Line 2 of cage string is %q, expected %q...", lines[2], e)
+	}
+	if e := "b |3    |     |"; !strings.HasPrefix(lines[4], e) {
+		t.Errorf("Line 4 of cage string is %q, expected %q...", lines[4], e)
+	}
+}
+
 /*
 
 Markdown
@@ -190,7 +277,7 @@ func TestPuzzleValuesMarkdown(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 	// do a 9x9 empty puzzle test to cover unknown squares
-	p, err = New(&Summary{nil, StandardGeometryName, 9, nil, nil})
+	p, err = New(&Summary{nil, StandardGeometryName, 9, nil, nil, nil, nil, false, 0, nil})
 	if err != nil {
 		t.Fatalf("Puzzle creation failed: %v", err)
 	}
@@ -210,3 +297,36 @@ func TestPuzzleValuesMarkdown(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 }
+
+func TestPuzzleCagesMarkdown(t *testing.T) {
+	p, err := New(&Summary{nil, StandardGeometryName, 4, nil, nil, nil, nil, false, 0, nil})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	if s := p.CagesMarkdown(); s != "" {
+		t.Errorf("Unexpected cage markdown for uncaged puzzle: %q", s)
+	}
+	p, err = New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Cages:      killer4Cages})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	s := p.CagesMarkdown()
+	e := "\n" +
+		"       1   2   3   4 \n" +
+		"     +---+---+---+---+\n" +
+		"    a|4  |6  |7      |\n" +
+		"     +   +   +---+---+\n" +
+		"    b|   |   |5  |6  |\n" +
+		"     +---+---+   +   +\n" +
+		"    c|7      |   |   |\n" +
+		"     +   +---+---+   +\n" +
+		"    d|   |5      |   |\n" +
+		"     +---+---+---+---+\n" +
+		"\n"
+	if s != e {
+		t.Errorf("Unexpected cage markdown:\n%vExpected:\n%v", s, e)
+	}
+}
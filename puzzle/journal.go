@@ -0,0 +1,194 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"reflect"
+)
+
+/*
+
+Undo journal
+
+A puzzle's journal records the state of every square and group
+just before it is changed, so the changes can be undone in the
+reverse order, in time proportional to the number of changes
+rather than the size of the puzzle.  The solver marks the
+journal before each choice it makes and rolls the puzzle back to
+the mark when the choice fails, instead of copying the puzzle.
+
+The public operations that change a puzzle (Assign, Unassign,
+Mark, SetUseMarks and SetPropagation) each start a step in the
+journal, and Undo rolls back the last step.  The operations that
+rebuild the puzzle from its summary record the whole puzzle as
+it was, since rebuilding replaces all its squares and groups.
+
+Journals are per-puzzle, like observers: copies of a puzzle
+start with an empty journal.  Nothing is journaled until the
+journal is first marked, so puzzles that are never changed (and
+the copies made while grading and hinting) pay nothing for it.
+
+*/
+
+// A journal is the list of changes made to a puzzle since it was
+// first marked, and the marks at the start of each public step.
+type journal struct {
+	changes []change
+	steps   []journalMark
+}
+
+// A journalMark is a point in a puzzle's history that it can be
+// rolled back to: the number of journaled changes and the number
+// of the puzzle's Errors at that point.
+type journalMark struct {
+	changes int
+	errors  int
+}
+
+// A change saves the state of one part of a puzzle before it was
+// changed.  Exactly one of square, group, and puzzle is set.
+// For groups, freed is the index that was removed from the free
+// squares (if any), and value is the value whose where entry was
+// set (if any).
+type change struct {
+	square *square
+	saved  square
+	group  *group
+	need   valueset
+	freed  int
+	value  int
+	where  int
+	puzzle *Puzzle
+}
+
+// saveSquare journals the state of a square that is about to be
+// changed.
+func (l *indexLogger) saveSquare(s *square) {
+	if l != nil && l.journal != nil {
+		l.journal.changes = append(l.journal.changes, change{square: s, saved: *s})
+	}
+}
+
+// saveGroup journals the state of a group that is about to have
+// the square at idx removed from its free squares (if it's free)
+// and, if val isn't 0, the assignment of val recorded.
+func (l *indexLogger) saveGroup(g *group, idx, val int) {
+	if l != nil && l.journal != nil {
+		c := change{group: g, need: g.need, value: val}
+		if _, found := g.free.find(idx); found {
+			c.freed = idx
+		}
+		if val != 0 {
+			c.where = g.where[val]
+		}
+		l.journal.changes = append(l.journal.changes, c)
+	}
+}
+
+// savePuzzle journals the state of a whole puzzle that is about
+// to be replaced.
+func (l *indexLogger) savePuzzle(p *Puzzle) {
+	if l != nil && l.journal != nil {
+		l.journal.changes = append(l.journal.changes, change{puzzle: p})
+	}
+}
+
+// mark returns the current point in a puzzle's history, starting
+// its journal if need be.
+func (p *Puzzle) mark() journalMark {
+	if p.logger.journal == nil {
+		p.logger.journal = &journal{}
+	}
+	return journalMark{len(p.logger.journal.changes), len(p.errors)}
+}
+
+// rollback undoes the changes made to a puzzle since the given
+// mark, returning an intset of the indices of the squares whose
+// content changed.
+func (p *Puzzle) rollback(m journalMark) intset {
+	j := p.logger.journal
+	var is intset
+	for i := len(j.changes) - 1; i >= m.changes; i-- {
+		c := &j.changes[i]
+		switch {
+		case c.square != nil:
+			*c.square = c.saved
+			is.insert(c.square.index)
+		case c.group != nil:
+			c.group.need = c.need
+			if c.value != 0 {
+				c.group.where[c.value] = c.where
+			}
+			if c.freed != 0 {
+				c.group.free.insert(c.freed)
+			}
+		case c.puzzle != nil:
+			before := p.allSquares()
+			observers := p.logger.observers
+			*p = *c.puzzle
+			p.logger.observers, p.logger.journal = observers, j
+			for i, S := range p.allSquares() {
+				if !reflect.DeepEqual(S, before[i]) {
+					is.insert(S.Index)
+				}
+			}
+		}
+		*c = change{} // release storage held in the change
+	}
+	j.changes = j.changes[:m.changes]
+	p.errors = p.errors[:m.errors]
+	return is
+}
+
+// beginStep marks the start of a public operation that changes a
+// puzzle, so it can be undone.
+func (p *Puzzle) beginStep() {
+	m := p.mark()
+	p.logger.journal.steps = append(p.logger.journal.steps, m)
+}
+
+// Undo reverses the last change made to the puzzle by Assign,
+// Unassign, Mark, SetUseMarks, or SetPropagation, returning an
+// update to the puzzle's State.  Operations that didn't change
+// the puzzle are skipped.  Unlike Assign, this works on puzzles
+// that are unsolvable: undoing the assignment that made a puzzle
+// unsolvable is the usual way to recover.  If there are no
+// changes to undo, an Error is returned.
+func (p *Puzzle) Undo() (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if j := p.logger.journal; j != nil {
+		for len(j.steps) > 0 {
+			m := j.steps[len(j.steps)-1]
+			j.steps = j.steps[:len(j.steps)-1]
+			if m.changes == len(j.changes) && m.errors == len(p.errors) {
+				continue
+			}
+			is := p.rollback(m)
+			return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+		}
+	}
+	err := Error{
+		Scope:     ArgumentScope,
+		Structure: ScopeStructure,
+		Condition: NothingToUndoCondition,
+	}
+	err.Message = err.Error()
+	return nil, err
+}
@@ -0,0 +1,146 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: bound4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if _, e := p.Undo(); e == nil || e.(Error).Condition != NothingToUndoCondition {
+		t.Errorf("Undo of new puzzle produced incorrect error: %v", e)
+	}
+
+	// apply a sequence of steps, remembering the puzzle before
+	// each of them; steps that don't change the puzzle aren't
+	// remembered, since there is nothing to undo
+	var strike Mark
+	for _, S := range p.allSquares() {
+		if S.Aval == 0 && len(S.Pvals) > 1 {
+			strike = Mark{Index: S.Index, Value: S.Pvals[0]}
+			break
+		}
+	}
+	restore := strike
+	restore.Restore = true
+	steps := []struct {
+		name    string
+		changes bool
+		step    func() (*Content, error)
+	}{
+		{"assign", true, func() (*Content, error) { return p.Assign(Choice{7, 1}) }},
+		{"use marks", true, func() (*Content, error) { return p.SetUseMarks(true) }},
+		{"use marks again", false, func() (*Content, error) { return p.SetUseMarks(true) }},
+		{"strike", true, func() (*Content, error) { return p.Mark(strike) }},
+		{"restore", true, func() (*Content, error) { return p.Mark(restore) }},
+		{"propagation", true, func() (*Content, error) { return p.SetPropagation(AdvancedPropagation) }},
+		{"unassign", true, func() (*Content, error) { return p.Unassign(7) }},
+		{"reassign", true, func() (*Content, error) { return p.Assign(Choice{7, 1}) }},
+		{"conflict", true, func() (*Content, error) { return p.Assign(Choice{8, 1}) }},
+	}
+	var befores []*Puzzle
+	for _, s := range steps {
+		before := p.copy()
+		if _, e := s.step(); e != nil {
+			t.Fatalf("Step %q failed: %v", s.name, e)
+		}
+		if s.changes {
+			befores = append(befores, before)
+		}
+	}
+	if len(p.errors) == 0 {
+		t.Fatalf("Conflicting assignment produced no errors")
+	}
+
+	// undoing each step restores the puzzle as it was
+	for i := len(befores) - 1; i >= 0; i-- {
+		update, e := p.Undo()
+		if e != nil {
+			t.Fatalf("Undo %d failed: %v", len(befores)-i, e)
+		}
+		if !reflect.DeepEqual(p.copy(), befores[i]) {
+			t.Errorf("Undo %d: got puzzle %v, expected %v", len(befores)-i, p, befores[i])
+		}
+		if !reflect.DeepEqual(update.Errors, p.allErrors(true)) {
+			t.Errorf("Undo %d: got errors %v, expected %v", len(befores)-i, update.Errors, p.allErrors(true))
+		}
+	}
+	if _, e := p.Undo(); e == nil || e.(Error).Condition != NothingToUndoCondition {
+		t.Errorf("Extra undo produced incorrect error: %v", e)
+	}
+
+	// undo reports the squares that changed
+	p.Assign(Choice{7, 1})
+	update, e := p.Undo()
+	if e != nil {
+		t.Fatalf("Undo failed: %v", e)
+	}
+	found := false
+	for _, S := range update.Squares {
+		if S.Index == 7 {
+			found = S.Aval == 0
+		}
+	}
+	if !found {
+		t.Errorf("Undo update %v doesn't clear square 7", update.Squares)
+	}
+
+	// copies start with no history
+	p.Assign(Choice{7, 1})
+	c, e := p.Copy()
+	if e != nil {
+		t.Fatalf("Copy failed: %v", e)
+	}
+	if _, e := c.Undo(); e == nil || e.(Error).Condition != NothingToUndoCondition {
+		t.Errorf("Undo of copy produced incorrect error: %v", e)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Propagation: AdvancedPropagation})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	start := p.copy()
+	m := p.mark()
+	var marks []journalMark
+	var befores []*Puzzle
+	for !p.isFilled() && len(p.errors) == 0 {
+		marks, befores = append(marks, p.mark()), append(befores, p.copy())
+		cindex, _ := chooseSquare(p)
+		p.assign(cindex, p.squares[cindex].pvals.prev(maxSetValue+1))
+		assignKnown(p)
+	}
+	if len(marks) < 2 {
+		t.Fatalf("Only %d choices were made", len(marks))
+	}
+	for i := len(marks) - 1; i >= 0; i-- {
+		p.rollback(marks[i])
+		if !reflect.DeepEqual(p.copy(), befores[i]) {
+			t.Fatalf("Rollback %d: got puzzle %v, expected %v", i, p, befores[i])
+		}
+	}
+	if p.rollback(m); !reflect.DeepEqual(p.copy(), start) {
+		t.Errorf("Rollback to start: got puzzle %v, expected %v", p, start)
+	}
+}
@@ -0,0 +1,392 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+
+Message catalog
+
+An Error's message is made from up to three parts: a phrase for
+its scope, a phrase for its attribute (if its structure has
+one), and a phrase for its condition.  Each phrase is a format
+that uses as many of the Error's values as it has verbs, taking
+them in order.  (The conditions whose data isn't a fixed number
+of values take all the remaining values as one argument.)
+Values that are GroupIDs are rendered with the phrase for their
+group type, so that "row 1" reads as "1行目" in Japanese.
+
+Each supported locale has a catalog of these phrases, and every
+catalog must have a phrase for every scope, attribute,
+condition, and group type.  When adding a new one, add its
+phrase to every catalog; the tests will fail if it's missing.
+
+Only Error messages are localized.  The messages of Hints and
+Explanations are always in English, whatever the locale.
+
+*/
+
+// DefaultLocale is the locale of the messages returned by the
+// Error method, and the locale used when a requested locale
+// isn't supported.
+const DefaultLocale = "en"
+
+// A catalog holds the message phrases for one locale.  The
+// group phrases are keyed by group type and take the group's
+// index.  The unknown phrase stands in for values that are
+// missing.
+type catalog struct {
+	scopes     map[ErrorScope]string
+	attributes map[ErrorAttribute]string
+	conditions map[ErrorCondition]string
+	groups     map[string]string
+	unknown    string
+}
+
+// catalogs are the supported locales and their catalogs.
+var catalogs = map[string]*catalog{
+	"en": {
+		scopes: map[ErrorScope]string{
+			UnknownScope:  "Unknown error: ",
+			RequestScope:  "Invalid request: ",
+			ArgumentScope: "Invalid argument: ",
+			GeometryScope: "Invalid geometry: ",
+			GroupScope:    "Problem in %v: ",
+			SquareScope:   "Problem in square %v: ",
+			InternalScope: "Internal logic error: ",
+		},
+		attributes: map[ErrorAttribute]string{
+			UnknownAttribute:        "<Unknown attribute>",
+			DecodeAttribute:         "JSON Decode error",
+			EncodeAttribute:         "JSON Encode error",
+			URLAttribute:            "Resource path",
+			LocationAttribute:       "In puzzle.%v",
+			NamedAttribute:          "%v",
+			GeometryAttribute:       "Geometry",
+			IndexAttribute:          "Index",
+			ValueAttribute:          "Value",
+			AssignedValueAttribute:  "Assigned value",
+			BoundValueAttribute:     "Bound value",
+			RemovedValueAttribute:   "Removed value",
+			RemovedValuesAttribute:  "Removed values",
+			RetainedValuesAttribute: "Retained values",
+			PuzzleSizeAttribute:     "Puzzle size",
+			SideLengthAttribute:     "Side length",
+			PuzzleAttribute:         "Puzzle",
+			SummaryAttribute:        "Summary",
+			RegionsAttribute:        "Region map",
+			RegionAttribute:         "Region",
+			CageAttribute:           "Cage",
+			LayoutAttribute:         "Layout",
+			PropagationAttribute:    "Propagation",
+			RatingAttribute:         "Rating",
+			BackendAttribute:        "Solver backend",
+			TransformAttribute:      "Transform",
+			TraceAttribute:          "Search trace",
+		},
+		conditions: map[ErrorCondition]string{
+			UnknownCondition:                 "Supplemental data is %v",
+			GeneralCondition:                 "%v",
+			TooLargeCondition:                "Must be at most %v",
+			TooSmallCondition:                "Must be at least %v",
+			DuplicateAssignmentCondition:     "Square %v is already assigned value %v",
+			NotInSetCondition:                "Must be in possible values %v",
+			NoPossibleValuesCondition:        "No remaining possible values",
+			NoGroupValueCondition:            "No square can contain %v",
+			DuplicateGroupValuesCondition:    "Multiple squares have or need value %v",
+			UnknownGeometryCondition:         "Not a known geometry",
+			NonSquareCondition:               "Not a perfect square",
+			NonRectangularCondition:          "Not the product of consecutive integers",
+			InvalidPuzzleAssignmentCondition: "Target puzzle has errors; no assignments are allowed",
+			WrongPuzzleSizeCondition:         "Doesn't match specified side length (%v)",
+			InvalidArgumentCondition:         "Required value was missing or invalid",
+			MismatchedSummaryErrorsCondition: "Summary has errors but puzzle created from it does not",
+			NonContiguousRegionCondition:     "Squares in the region are not contiguous",
+			WrongRegionSizeCondition:         "Region has %v squares, must have %v",
+			ImpossibleCageSumCondition:       "No possible values can add up to %v",
+			WrongCageSumCondition:            "Values add up to %v, must add up to %v",
+			DuplicateGeometryCondition:       "A geometry with that name is already registered",
+			WrongGroupSizeCondition:          "Group has %v squares, must have %v",
+			NotAssignedCondition:             "Square has no assigned value",
+			NotSymmetryCondition:             "Not a symmetry of the puzzle",
+			NothingToUndoCondition:           "No changes to undo",
+			StoppedCondition:                 "Stopped before finishing (%v)",
+		},
+		groups: map[string]string{
+			"":            "<group> %d",
+			GtypeRow:      "row %d",
+			GtypeCol:      "column %d",
+			GtypeTile:     "tile %d",
+			GtypeDiagonal: "diagonal %d",
+			GtypeRegion:   "region %d",
+			GtypeCage:     "cage %d",
+		},
+		unknown: "<unknown>",
+	},
+	"ja": {
+		scopes: map[ErrorScope]string{
+			UnknownScope:  "不明なエラー: ",
+			RequestScope:  "無効なリクエスト: ",
+			ArgumentScope: "無効な引数: ",
+			GeometryScope: "無効なジオメトリ: ",
+			GroupScope:    "%vの問題: ",
+			SquareScope:   "マス%vの問題: ",
+			InternalScope: "内部ロジックエラー: ",
+		},
+		attributes: map[ErrorAttribute]string{
+			UnknownAttribute:        "<不明な属性>",
+			DecodeAttribute:         "JSONデコードエラー",
+			EncodeAttribute:         "JSONエンコードエラー",
+			URLAttribute:            "リソースパス",
+			LocationAttribute:       "puzzle.%v 内",
+			NamedAttribute:          "%v",
+			GeometryAttribute:       "ジオメトリ",
+			IndexAttribute:          "インデックス",
+			ValueAttribute:          "値",
+			AssignedValueAttribute:  "割り当てられた値",
+			BoundValueAttribute:     "確定した値",
+			RemovedValueAttribute:   "除外された値",
+			RemovedValuesAttribute:  "除外された値の組",
+			RetainedValuesAttribute: "残された値の組",
+			PuzzleSizeAttribute:     "パズルのサイズ",
+			SideLengthAttribute:     "一辺の長さ",
+			PuzzleAttribute:         "パズル",
+			SummaryAttribute:        "概要",
+			RegionsAttribute:        "領域マップ",
+			RegionAttribute:         "領域",
+			CageAttribute:           "ケージ",
+			LayoutAttribute:         "レイアウト",
+			PropagationAttribute:    "制約伝播",
+			RatingAttribute:         "難易度",
+			BackendAttribute:        "ソルバーのバックエンド",
+			TransformAttribute:      "変換",
+			TraceAttribute:          "探索トレース",
+		},
+		conditions: map[ErrorCondition]string{
+			UnknownCondition:                 "補足データ: %v",
+			GeneralCondition:                 "%v",
+			TooLargeCondition:                "%v以下でなければなりません",
+			TooSmallCondition:                "%v以上でなければなりません",
+			DuplicateAssignmentCondition:     "マス%vにはすでに値%vが割り当てられています",
+			NotInSetCondition:                "可能な値%vのいずれかでなければなりません",
+			NoPossibleValuesCondition:        "可能な値が残っていません",
+			NoGroupValueCondition:            "%vを入れられるマスがありません",
+			DuplicateGroupValuesCondition:    "複数のマスが値%vを持っているか必要としています",
+			UnknownGeometryCondition:         "既知のジオメトリではありません",
+			NonSquareCondition:               "平方数ではありません",
+			NonRectangularCondition:          "連続する整数の積ではありません",
+			InvalidPuzzleAssignmentCondition: "対象のパズルにエラーがあるため、割り当てできません",
+			WrongPuzzleSizeCondition:         "指定された一辺の長さと合いません (%v)",
+			InvalidArgumentCondition:         "必要な値がないか、無効です",
+			MismatchedSummaryErrorsCondition: "概要にはエラーがありますが、作成したパズルにはありません",
+			NonContiguousRegionCondition:     "領域のマスがつながっていません",
+			WrongRegionSizeCondition:         "領域のマスは%v個ですが、%v個でなければなりません",
+			ImpossibleCageSumCondition:       "合計が%vになる値の組み合わせがありません",
+			WrongCageSumCondition:            "値の合計は%vですが、%vでなければなりません",
+			DuplicateGeometryCondition:       "その名前のジオメトリはすでに登録されています",
+			WrongGroupSizeCondition:          "グループのマスは%v個ですが、%v個でなければなりません",
+			NotAssignedCondition:             "マスに値が割り当てられていません",
+			NotSymmetryCondition:             "パズルの対称性ではありません",
+			NothingToUndoCondition:           "元に戻す変更がありません",
+			StoppedCondition:                 "完了前に停止しました (%v)",
+		},
+		groups: map[string]string{
+			"":            "<グループ> %d",
+			GtypeRow:      "%d行目",
+			GtypeCol:      "%d列目",
+			GtypeTile:     "ブロック%d",
+			GtypeDiagonal: "対角線%d",
+			GtypeRegion:   "領域%d",
+			GtypeCage:     "ケージ%d",
+		},
+		unknown: "<不明>",
+	},
+}
+
+// restConditions are the conditions whose phrases take all the
+// remaining values as one argument.
+var restConditions = map[ErrorCondition]bool{
+	UnknownCondition:         true,
+	WrongPuzzleSizeCondition: true,
+}
+
+// message produces the message for an Error from a catalog,
+// ignoring any pre-canned message.  Codes that aren't in the
+// catalog get the phrase for the unknown code.
+func (c *catalog) message(e Error) string {
+	values := e.Values
+	format := func(phrase string) string {
+		args := make([]interface{}, verbs(phrase))
+		for i := range args {
+			if len(values) == 0 {
+				args[i] = c.unknown
+				continue
+			}
+			args[i], values = c.value(values[0]), values[1:]
+		}
+		return fmt.Sprintf(phrase, args...)
+	}
+	phrase, ok := c.scopes[e.Scope]
+	if !ok {
+		phrase = c.scopes[UnknownScope]
+	}
+	es := format(phrase)
+	if e.Structure == AttributeStructure || e.Structure == AttributeValueStructure {
+		if phrase, ok = c.attributes[e.Attribute]; !ok {
+			phrase = c.attributes[UnknownAttribute]
+		}
+		es += format(phrase)
+		if e.Structure == AttributeValueStructure {
+			es += format(" (%v)")
+		}
+		es += ": "
+	}
+	if phrase, ok = c.conditions[e.Condition]; !ok {
+		phrase = c.conditions[UnknownCondition]
+	}
+	if restConditions[e.Condition] || !ok {
+		return es + fmt.Sprintf(phrase, values)
+	}
+	return es + format(phrase)
+}
+
+// value renders a GroupID value with the catalog's phrase for
+// its group type.  Other values, and groups of types the catalog
+// doesn't know, are left for fmt to render.
+func (c *catalog) value(v interface{}) interface{} {
+	if gid, ok := v.(GroupID); ok {
+		if phrase, ok := c.groups[gid.Gtype]; ok {
+			return fmt.Sprintf(phrase, gid.Index)
+		}
+	}
+	return v
+}
+
+// verbs returns the number of verbs in a phrase, which is the
+// number of values it uses.
+func verbs(phrase string) int {
+	count := 0
+	for i := 0; i < len(phrase)-1; i++ {
+		if phrase[i] == '%' {
+			if phrase[i+1] != '%' {
+				count++
+			}
+			i++
+		}
+	}
+	return count
+}
+
+// Locales returns the supported locales, in alphabetical order.
+func Locales() []string {
+	var locales []string
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Localize returns the message for an Error in the given locale.
+// A pre-canned message that isn't the Error's English message is
+// returned as is, since there's no way to translate it.  If the
+// locale isn't supported, the message is in the DefaultLocale.
+func (e Error) Localize(locale string) string {
+	c, ok := catalogs[locale]
+	if !ok {
+		c = catalogs[DefaultLocale]
+	}
+	if len(e.Message) > 0 {
+		custom := e.Message
+		if e.Message = ""; custom != e.Error() {
+			return custom
+		}
+	}
+	return c.message(e)
+}
+
+// MatchLocale returns the supported locale that best matches an
+// HTTP Accept-Language header, such as "ja-JP,ja;q=0.9,en;q=0.8".
+// Languages match regardless of region, and languages with the
+// same quality are preferred in the order given.  If no
+// supported locale matches, the DefaultLocale is returned.
+func MatchLocale(accept string) string {
+	best, bestq := DefaultLocale, 0.0
+	for _, lang := range strings.Split(accept, ",") {
+		parts := strings.Split(lang, ";")
+		tag := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[len("q="):], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		if _, ok := catalogs[tag]; ok && q > bestq {
+			best, bestq = tag, q
+		}
+	}
+	return best
+}
+
+// localeKey is the context key for the locale of a request.
+type localeKey struct{}
+
+// WithLocale returns a context that carries a locale, so that
+// the handlers given a request with that context will send
+// their Error messages in that locale.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// contextLocale returns the locale carried by a context, or the
+// DefaultLocale if it carries none.
+func contextLocale(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// localizeErrors returns a copy of a slice of Errors whose
+// messages are in the given locale.
+func localizeErrors(errs []Error, locale string) []Error {
+	if errs == nil {
+		return nil
+	}
+	result := make([]Error, len(errs))
+	for i, err := range errs {
+		result[i] = err
+		result[i].Message = err.Localize(locale)
+	}
+	return result
+}
@@ -0,0 +1,155 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"testing"
+)
+
+// Every catalog must have a phrase for every code, and the
+// phrases for a code must use the same number of values in
+// every catalog, since they share the Error's values.
+func TestCatalogsComplete(t *testing.T) {
+	en := catalogs[DefaultLocale]
+	for _, locale := range Locales() {
+		c := catalogs[locale]
+		for sc := UnknownScope; sc < MaxScope; sc++ {
+			if phrase, ok := c.scopes[sc]; !ok {
+				t.Errorf("Locale %q has no phrase for scope %d", locale, sc)
+			} else if verbs(phrase) != verbs(en.scopes[sc]) {
+				t.Errorf("Locale %q phrase %q for scope %d uses the wrong number of values", locale, phrase, sc)
+			}
+		}
+		for at := UnknownAttribute; at < MaxAttribute; at++ {
+			if phrase, ok := c.attributes[at]; !ok {
+				t.Errorf("Locale %q has no phrase for attribute %d", locale, at)
+			} else if verbs(phrase) != verbs(en.attributes[at]) {
+				t.Errorf("Locale %q phrase %q for attribute %d uses the wrong number of values", locale, phrase, at)
+			}
+		}
+		for co := UnknownCondition; co < MaxCondition; co++ {
+			if phrase, ok := c.conditions[co]; !ok {
+				t.Errorf("Locale %q has no phrase for condition %d", locale, co)
+			} else if verbs(phrase) != verbs(en.conditions[co]) {
+				t.Errorf("Locale %q phrase %q for condition %d uses the wrong number of values", locale, phrase, co)
+			}
+		}
+		for gtype := range en.groups {
+			if _, ok := c.groups[gtype]; !ok {
+				t.Errorf("Locale %q has no phrase for group type %q", locale, gtype)
+			}
+		}
+		if len(c.scopes) != int(MaxScope) || len(c.attributes) != int(MaxAttribute) ||
+			len(c.conditions) != int(MaxCondition) || len(c.groups) != len(en.groups) {
+			t.Errorf("Locale %q has phrases for unknown codes", locale)
+		}
+		if c.unknown == "" {
+			t.Errorf("Locale %q has no phrase for unknown values", locale)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		err    Error
+		en, ja string
+	}{
+		{
+			rangeError(IndexAttribute, 17, 1, 16),
+			"Invalid argument: Index (17): Must be at most 16",
+			"無効な引数: インデックス (17): 16以下でなければなりません",
+		},
+		{
+			groupError(GroupID{GtypeRow, 1}, 3, NoGroupValueCondition),
+			"Problem in row 1: No square can contain 3",
+			"1行目の問題: 3を入れられるマスがありません",
+		},
+		{
+			groupError(GroupID{GtypeCage, 2}, 7, DuplicateGroupValuesCondition),
+			"Problem in cage 2: Multiple squares have or need value 7",
+			"ケージ2の問題: 複数のマスが値7を持っているか必要としています",
+		},
+		{
+			Error{Scope: ArgumentScope, Structure: ScopeStructure, Condition: NothingToUndoCondition},
+			"Invalid argument: No changes to undo",
+			"無効な引数: 元に戻す変更がありません",
+		},
+		{
+			Error{Scope: GeometryScope, Condition: WrongPuzzleSizeCondition, Values: ErrorData{5, 4}},
+			"Invalid geometry: Doesn't match specified side length ([5 4])",
+			"無効なジオメトリ: 指定された一辺の長さと合いません ([5 4])",
+		},
+		{
+			Error{Scope: SquareScope, Condition: MaxCondition, Values: ErrorData{2, "x"}},
+			"Problem in square 2: Supplemental data is [x]",
+			"マス2の問題: 補足データ: [x]",
+		},
+		{
+			Error{Scope: SquareScope, Condition: TooSmallCondition},
+			"Problem in square <unknown>: Must be at least <unknown>",
+			"マス<不明>の問題: <不明>以上でなければなりません",
+		},
+	}
+	for i, test := range tests {
+		if m := test.err.Error(); m != test.en {
+			t.Errorf("Case %d: got English message %q, expected %q", i+1, m, test.en)
+		}
+		if m := test.err.Localize("en"); m != test.en {
+			t.Errorf("Case %d: got en message %q, expected %q", i+1, m, test.en)
+		}
+		if m := test.err.Localize("fr"); m != test.en {
+			t.Errorf("Case %d: got fr message %q, expected %q", i+1, m, test.en)
+		}
+		if m := test.err.Localize("ja"); m != test.ja {
+			t.Errorf("Case %d: got ja message %q, expected %q", i+1, m, test.ja)
+		}
+		// canned English messages are translated...
+		err := test.err
+		err.Message = err.Error()
+		if m := err.Localize("ja"); m != test.ja {
+			t.Errorf("Case %d: got ja message %q for canned message, expected %q", i+1, m, test.ja)
+		}
+		// ... but custom messages are not
+		err.Message = "custom"
+		if m := err.Localize("ja"); m != "custom" {
+			t.Errorf("Case %d: got ja message %q for custom message", i+1, m)
+		}
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	tests := []struct {
+		accept, locale string
+	}{
+		{"", "en"},
+		{"ja", "ja"},
+		{"ja-JP,ja;q=0.9,en;q=0.8", "ja"},
+		{"en-US,en;q=0.9,ja;q=0.8", "en"},
+		{"fr-CA, fr;q=0.9, ja;q=0.5", "ja"},
+		{"fr, ja;q=0", "en"},
+		{"en;q=0.5, JA_jp;q=0.7", "ja"},
+		{"ja;q=bad, en;q=0.1", "en"},
+		{"*", "en"},
+	}
+	for i, test := range tests {
+		if l := MatchLocale(test.accept); l != test.locale {
+			t.Errorf("Case %d: MatchLocale(%q) is %q, expected %q", i+1, test.accept, l, test.locale)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+)
+
+/*
+
+Minimality
+
+A puzzle is minimal if it has a unique solution, but removing
+any of its givens (the values assigned in it) would give it more
+than one.  Puzzle authors want minimal puzzles, so we report
+which givens are redundant.  Each given is tested by itself, so
+removing two redundant givens together may lose uniqueness: after
+removing one, the analysis should be run again.
+
+Each given is tested by counting the solutions of the puzzle
+without it, so the analysis of a large puzzle can take a while.
+It can be bounded by a context, in which case the analysis stops
+early when the context is done, and reports what it found before
+stopping.
+
+*/
+
+// A Minimality reports whether a puzzle has a unique solution,
+// how many givens it has, and which of them can each be removed
+// without losing uniqueness (in index order).  The puzzle is
+// Minimal if it has a unique solution and none of its givens is
+// redundant.  Redundant givens are only reported for puzzles
+// with a unique solution.  The Reason is the reason the analysis
+// stopped.  An analysis that stops early only reports the puzzle
+// as Unique if it got that far, never reports it as Minimal, and
+// only reports the Redundant givens it found before stopping.
+type Minimality struct {
+	Unique    bool       `json:"unique"`
+	Minimal   bool       `json:"minimal"`
+	Givens    int        `json:"givens"`
+	Redundant []Choice   `json:"redundant"`
+	Reason    StopReason `json:"reason"`
+}
+
+// Minimality analyzes the givens of the puzzle.  All the
+// puzzle's assigned values are treated as givens, and its marks
+// are ignored.  The puzzle is not altered.
+func (p *Puzzle) Minimality() (*Minimality, error) {
+	return p.MinimalityContext(context.Background())
+}
+
+// MinimalityContext is like Minimality, but stops early if the
+// context is done, in which case the result has the reason it
+// stopped.
+func (p *Puzzle) MinimalityContext(ctx context.Context) (*Minimality, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	base := &Summary{
+		Geometry:   p.mapping.geometry,
+		SideLength: p.mapping.sidelen,
+		Values:     p.allValues(),
+		Regions:    p.mapping.regions,
+		Cages:      p.allCages(),
+	}
+	m := &Minimality{Redundant: []Choice{}}
+	for _, v := range base.Values {
+		if v != 0 {
+			m.Givens++
+		}
+	}
+	unique, e := base.isUnique(ctx, m)
+	if e != nil || !unique {
+		return m, e
+	}
+	m.Unique = true
+	for i, v := range base.Values {
+		if v == 0 {
+			continue
+		}
+		base.Values[i] = 0
+		redundant, e := base.isUnique(ctx, m)
+		base.Values[i] = v
+		if e != nil {
+			return nil, e
+		}
+		if m.Reason != CompleteStop {
+			return m, nil
+		}
+		if redundant {
+			m.Redundant = append(m.Redundant, Choice{i + 1, v})
+		}
+	}
+	m.Minimal = len(m.Redundant) == 0
+	return m, nil
+}
+
+// isUnique returns whether the summarized puzzle has exactly one
+// solution.  Summaries of puzzles with errors have none.  If the
+// context is done before that is known, the reason is recorded
+// in the analysis, and the result is false.
+func (s *Summary) isUnique(ctx context.Context, m *Minimality) (bool, error) {
+	switch ctx.Err() {
+	case nil:
+	case context.DeadlineExceeded:
+		m.Reason = DeadlineStop
+		return false, nil
+	default:
+		m.Reason = CanceledStop
+		return false, nil
+	}
+	p, e := New(s)
+	if e != nil {
+		return false, e
+	}
+	count, reason, e := p.CountSolutions(ctx, SolveOptions{MaxSolutions: 2})
+	if reason != CompleteStop && reason != SolutionLimitStop {
+		m.Reason = reason
+		return false, e
+	}
+	return count == 1, e
+}
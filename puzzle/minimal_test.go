@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMinimality(t *testing.T) {
+	minimal4Values := []int{
+		1, 0, 0, 0,
+		0, 0, 0, 2,
+		0, 3, 0, 0,
+		4, 0, 0, 0,
+	}
+	redundant4Values := append([]int(nil), minimal4Values...)
+	redundant4Values[6] = 1
+	tcs := []struct {
+		summary   *Summary
+		unique    bool
+		minimal   bool
+		givens    int
+		redundant []Choice
+	}{
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues}, false, false, 0, []Choice{}},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: multiChoiceStartValues}, false, false, 8, []Choice{}},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1}, false, false, 2, []Choice{}},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: minimal4Values}, true, true, 4, []Choice{}},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: redundant4Values}, true, false, 5,
+			[]Choice{{7, 1}}},
+		{&Summary{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages}, true, true, 0, []Choice{}},
+	}
+	for i, tc := range tcs {
+		p, e := New(tc.summary)
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		m, e := p.Minimality()
+		if e != nil {
+			t.Fatalf("test %d: Failed to analyze puzzle: %v", i+1, e)
+		}
+		expected := &Minimality{tc.unique, tc.minimal, tc.givens, tc.redundant, CompleteStop}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("test %d: Got %+v, expected %+v", i+1, m, expected)
+		}
+		if s, _ := p.Summary(); !reflect.DeepEqual(s.Values, p.allValues()) {
+			t.Errorf("test %d: Analysis altered the puzzle", i+1)
+		}
+	}
+
+	// every redundant given of a real puzzle can be removed
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	m, e := p.Minimality()
+	if e != nil {
+		t.Fatalf("Failed to analyze puzzle: %v", e)
+	}
+	if !m.Unique || m.Givens != 32 {
+		t.Errorf("Got %+v, expected a unique puzzle with 32 givens", m)
+	}
+	for _, c := range m.Redundant {
+		values := append([]int(nil), oneStarValues...)
+		values[c.Index-1] = 0
+		if rp, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: values}); rp == nil {
+			t.Errorf("Failed to create puzzle without given %v", c)
+		} else if n, _, _ := rp.CountSolutions(context.Background(), SolveOptions{MaxSolutions: 2}); n != 1 {
+			t.Errorf("Removing given %v gave %d solutions", c, n)
+		}
+	}
+
+	// an analysis that is stopped reports why
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if m, e := p.MinimalityContext(ctx); e != nil {
+		t.Errorf("Canceled analysis failed: %v", e)
+	} else if m.Reason != CanceledStop || m.Unique || m.Minimal || m.Givens != 32 {
+		t.Errorf("Canceled analysis gave %+v", m)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if m, e := p.MinimalityContext(ctx); e != nil {
+		t.Errorf("Timed analysis failed: %v", e)
+	} else if m.Reason != CompleteStop && (m.Reason != DeadlineStop || m.Minimal) {
+		t.Errorf("Timed analysis gave %+v", m)
+	}
+
+	var np *Puzzle
+	if _, e := np.Minimality(); e == nil {
+		t.Errorf("Nil puzzle analysis didn't fail")
+	}
+}
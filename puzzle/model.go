@@ -46,8 +46,38 @@
 // square being equal in length to the area of one tile (e.g, 4x3
 // tiles and a 12x12 square).
 //
-// Another Sudoku variant, not yet implemented, uses the Standard
-// geometry but adds the diagonals as two additional groups.
+// Another Sudoku variant, called here the Diagonal geometry (and
+// elsewhere Sudoku-X), uses the Standard geometry but adds the
+// two main diagonals as additional groups.
+//
+// Jigsaw puzzles, called here the Jigsaw geometry, replace the
+// tiles with irregularly shaped regions, given by a region map
+// that assigns a region number to every square.  Each region
+// must be contiguous and contain side-length many squares.
+//
+// Any geometry can also have cages, as in Killer Sudoku: sets of
+// squares whose values must add up to a given sum without
+// repeating.  Cages are not groups, because they don't need the
+// full range of values, but they constrain the possible values
+// of their squares in much the same way.
+//
+// Players can also strike possible values from empty squares
+// (as pencil marks).  Struck values are kept separately from
+// the possible values computed by the implementation, and only
+// limit the possible values (and so the bindings) of the puzzle
+// if the player opts in to using them.
+//
+// Puzzles can also opt in to advanced constraint propagation,
+// which finds naked and hidden subsets of squares in each group,
+// as well as values whose candidates in one group all lie in
+// another (pointing and claiming).  Each possible value removed
+// this way is recorded with the technique and groups that
+// removed it.
+//
+// New puzzles with unique solutions can be generated for any
+// geometry, with a target difficulty rating.  Ratings come from
+// grading: solving the puzzle with the simplest techniques that
+// work, and seeing which is the hardest one needed.
 //
 // If a square in a group is the only possible location for a
 // needed value, we say that the square is bound by the group,
@@ -61,7 +91,9 @@ package puzzle
 
 import (
 	"crypto/md5"
+	"encoding/binary"
 	"fmt"
+	"reflect"
 )
 
 /*
@@ -78,13 +110,16 @@ Puzzles
 // always use New to create one.  Also, do not try to copy
 // puzzles by assigning them, use Copy instead.
 type Puzzle struct {
-	Metadata map[string]string
-	mapping  *puzzleMapping
-	squares  []*square
-	groups   []*group
-	errors   []Error
-	logger   *indexLogger
-	valid    bool
+	Metadata    map[string]string
+	mapping     *puzzleMapping
+	squares     []*square
+	groups      []*group
+	cages       []*cage
+	useMarks    bool
+	propagation Propagation
+	errors      []Error
+	logger      *indexLogger
+	valid       bool
 }
 
 // isValid checks whether a Puzzle pointer is non-nil and points
@@ -127,7 +162,9 @@ func (p *Puzzle) allValues() []int {
 func (p *Puzzle) indicesToPossibles(is intset) [][]int {
 	vs := make([][]int, len(is))
 	for i, idx := range is {
-		vs[i] = newIntsetCopy(p.squares[idx].pvals)
+		if s := p.squares[idx]; s.aval == 0 {
+			vs[i] = s.pvals.values()
+		}
 	}
 	return vs
 }
@@ -150,8 +187,14 @@ func (p *Puzzle) indicesToSquares(is intset) []Square {
 			S.Aval = s.aval
 			continue
 		}
-		S.Pvals = newIntsetCopy(s.pvals)
-		if len(s.pvals) == 1 {
+		S.Pvals = s.pvals.values()
+		if s.svals != 0 {
+			S.Svals = s.svals.values()
+		}
+		if len(s.elims) > 0 {
+			S.Elims = append([]Elimination(nil), s.elims...)
+		}
+		if s.pvals.len() == 1 {
 			// don't return bindings if only one value,
 			// because they are extraneous and confusing.
 			continue
@@ -182,40 +225,131 @@ func (p *Puzzle) allErrors(verbose bool) []Error {
 	return errs
 }
 
+// allCages returns the puzzle's cages in their public form.  The
+// returned slice doesn't share storage with the puzzle.
+func (p *Puzzle) allCages() []Cage {
+	if len(p.cages) == 0 {
+		return nil
+	}
+	cs := make([]Cage, len(p.cages))
+	for i, c := range p.cages {
+		cs[i] = Cage{Sum: c.sum, Indices: newIntsetCopy(c.indices)}
+	}
+	return cs
+}
+
+// allMarks returns the values struck from the puzzle's empty
+// squares, in index order and then value order.
+func (p *Puzzle) allMarks() []Choice {
+	var marks []Choice
+	for _, s := range p.squares[1:] {
+		for v := s.svals.next(0); v != 0; v = s.svals.next(v) {
+			marks = append(marks, Choice{Index: s.index, Value: v})
+		}
+	}
+	return marks
+}
+
 // hash returns the current hash of a puzzle.
 func (p *Puzzle) hash() Signature {
-	return computeHash(p.mapping.geometry, p.allValues())
+	return computeHash(p.mapping.geometry, p.mapping.sidelen, p.allValues(), p.mapping.regions, p.allCages())
 }
 
 // hash also works on summaries.
 func (s *Summary) hash() Signature {
-	return computeHash(s.Geometry, s.Values)
+	return computeHash(s.Geometry, s.SideLength, s.Values, s.Regions, s.Cages)
 }
 
-// do the actual hashing work.  We hash the geometry name and the
-// values in case there are two different geometries that can use
-// the same value.
-func computeHash(geo string, vals []int) Signature {
-	glen, vlen := len(geo), len(vals)
-	bytes := make([]byte, glen+vlen)
+// hashV1SideLength is the largest side length of puzzles hashed
+// with version 1 of the hash encoding, which packs each value
+// and region number into a byte.  Larger puzzles use version 2.
+const hashV1SideLength = 35
+
+// do the actual hashing work, choosing the encoding by the side
+// length of the puzzle so that the signatures of smaller puzzles
+// never change.
+func computeHash(geo string, sidelen int, vals []int, regions []int, cages []Cage) Signature {
+	if sidelen > hashV1SideLength {
+		return computeHashV2(geo, vals, regions, cages)
+	}
+	return computeHashV1(geo, vals, regions, cages)
+}
+
+// computeHashV1 is version 1 of the hash encoding.  We hash the
+// geometry name and the values in case there are two different
+// geometries that can use the same value.  We hash the region
+// map and cages (if any) after the values, so that puzzles
+// without them keep the hash they have always had.  Cage sums
+// and indices can be bigger than a byte, so they each take two.
+func computeHashV1(geo string, vals []int, regions []int, cages []Cage) Signature {
+	glen, vlen, rlen := len(geo), len(vals), len(regions)
+	bytes := make([]byte, glen+vlen+rlen)
 	for i, c := range geo {
 		bytes[i] = byte(c)
 	}
 	for i, v := range vals {
 		bytes[i+glen] = byte(v)
 	}
+	for i, r := range regions {
+		bytes[i+glen+vlen] = byte(r)
+	}
+	for _, c := range cages {
+		bytes = append(bytes, byte(c.Sum>>8), byte(c.Sum))
+		for _, i := range c.Indices {
+			bytes = append(bytes, byte(i>>8), byte(i))
+		}
+		bytes = append(bytes, 0, 0) // cage terminator (no index is 0)
+	}
 	hash := md5.Sum(bytes)
 	return Signature(fmt.Sprintf("%X", hash[0:md5.Size]))
 }
 
+// computeHashV2 is version 2 of the hash encoding, which is safe
+// for puzzles of any size.  It starts with the version number,
+// every number is a varint, and every string or list is preceded
+// by its length, so nothing is truncated and no two puzzles share
+// an encoding.  Its signatures start with "2-", so they can never
+// match a version 1 signature.
+func computeHashV2(geo string, vals []int, regions []int, cages []Cage) Signature {
+	var bytes []byte
+	var buf [binary.MaxVarintLen64]byte
+	appendInt := func(i int) {
+		n := binary.PutVarint(buf[:], int64(i))
+		bytes = append(bytes, buf[:n]...)
+	}
+	appendInts := func(ints []int) {
+		appendInt(len(ints))
+		for _, i := range ints {
+			appendInt(i)
+		}
+	}
+	appendInt(2)
+	appendInt(len(geo))
+	bytes = append(bytes, geo...)
+	appendInts(vals)
+	appendInts(regions)
+	appendInt(len(cages))
+	for _, c := range cages {
+		appendInt(c.Sum)
+		appendInts(c.Indices)
+	}
+	hash := md5.Sum(bytes)
+	return Signature(fmt.Sprintf("2-%X", hash[0:md5.Size]))
+}
+
 // summary returns the current summary of a puzzle.
 func (p *Puzzle) summary() *Summary {
 	return &Summary{
-		Metadata:   p.allMetadata(),
-		Geometry:   p.mapping.geometry,
-		SideLength: p.mapping.sidelen,
-		Values:     p.allValues(),
-		Errors:     p.allErrors(true),
+		Metadata:    p.allMetadata(),
+		Geometry:    p.mapping.geometry,
+		SideLength:  p.mapping.sidelen,
+		Values:      p.allValues(),
+		Regions:     append([]int(nil), p.mapping.regions...),
+		Cages:       p.allCages(),
+		Marks:       p.allMarks(),
+		UseMarks:    p.useMarks,
+		Propagation: p.propagation,
+		Errors:      p.allErrors(true),
 	}
 }
 
@@ -244,7 +378,7 @@ func (p *Puzzle) assign(idx, val int) intset {
 	// do the assignment
 	errs := p.squares[idx].assign(val)
 	if len(errs) > 0 {
-		p.errors = append(p.errors, errs...)
+		p.addErrors(errs)
 	}
 
 	// propagate the assignment through the containing groups,
@@ -277,7 +411,7 @@ func (p *Puzzle) assign(idx, val int) intset {
 	for _, gi := range p.mapping.ixmap[idx] {
 		if errs := p.groups[gi].assign(p.squares, idx); len(errs) > 0 {
 			// group assign Errors make the puzzle unsolvable
-			p.errors = append(p.errors, errs...)
+			p.addErrors(errs)
 			// all we need is the first error to know we're unsolvable!
 			break
 		}
@@ -293,45 +427,158 @@ func (p *Puzzle) assign(idx, val int) intset {
 			if count > 0 {
 				if errs := p.groups[gi].analyze(p.squares); len(errs) > 0 {
 					// group analyze Errors make the puzzle unsolvable
-					p.errors = append(p.errors, errs...)
+					p.addErrors(errs)
 					// all we need is the first error to know we're unsolvable!
 					break
 				}
 			}
 		}
 	}
+
+	// Part 4: Analyze the cages (if any).  This removes
+	// possible values that can no longer make up the cage sums,
+	// and discovers cages whose sums can't be made.  The groups
+	// of the squares that lose values are analyzed again.
+	p.analyzeCages()
+
+	// Part 5: Apply the advanced propagation techniques (if the
+	// puzzle uses them) across all the groups.
+	p.propagate()
 	return p.logger.entries
 }
 
+// strike a value from an (assumed) empty square in a puzzle,
+// returning an intset of the indices of all the squares modified
+// by the strike (including the struck square).
+//
+// If the puzzle uses its marks, the value is also removed from
+// the square's possible values, and the groups and cages
+// containing the square are analyzed as they are after an
+// assignment.  Any Errors produced are added to the puzzle.
+func (p *Puzzle) strike(idx, val int) intset {
+	// set up to log the affected squares, so they can be returned.
+	p.logger.start(idx)
+	// after we're done, reset the puzzle logger
+	defer func() { p.logger.stop() }()
+
+	s := p.squares[idx]
+	if s.svals.has(val) {
+		return p.logger.entries
+	}
+	s.logger.saveSquare(s)
+	if s.svals.insert(val); !p.useMarks {
+		return p.logger.entries
+	}
+	s.logger.blame(removal{kind: StruckReason})
+	errs := s.remove(val)
+	s.logger.blame(removal{})
+	if len(errs) > 0 {
+		p.addErrors(errs)
+	}
+	// the square's groups have lost a candidate, so analyze them
+	if len(p.errors) == 0 {
+		for _, gi := range p.mapping.ixmap[idx] {
+			if errs := p.groups[gi].analyze(p.squares); len(errs) > 0 {
+				p.addErrors(errs)
+				break
+			}
+		}
+	}
+	p.analyzeCages()
+	p.propagate()
+	return p.logger.entries
+}
+
+// restore a struck value to an (assumed) empty square in a
+// puzzle, returning an intset of the indices of all the squares
+// modified by the restore (including the restored square).
+//
+// If the puzzle uses its marks, the restored value may become
+// possible again in many squares, and bindings based on its
+// absence have to be undone.  Since constraint relaxation only
+// ever removes possibilities, we rebuild the puzzle.
+func (p *Puzzle) restore(idx, val int) (intset, error) {
+	s := p.squares[idx]
+	if !s.svals.has(val) {
+		return intset{idx}, nil
+	}
+	s.logger.saveSquare(s)
+	if s.svals.remove(val); !p.useMarks {
+		return intset{idx}, nil
+	}
+	is, err := p.rebuild(p.summary())
+	if err != nil {
+		return nil, err
+	}
+	is.insert(idx)
+	return is, nil
+}
+
+// rebuild replaces the content of a puzzle with the content of
+// a new puzzle created from the given summary, returning an
+// intset of the indices of the squares whose content changed.
+// The puzzle's metadata is kept as is.
+func (p *Puzzle) rebuild(summary *Summary) (intset, error) {
+	before := p.allSquares()
+	np, err := New(summary)
+	if err != nil {
+		return nil, err
+	}
+	np.Metadata = p.Metadata
+	np.logger.observers = p.logger.observers
+	np.logger.journal = p.logger.journal
+	old := *p
+	p.logger.savePuzzle(&old)
+	*p = *np
+	var is intset
+	for i, S := range p.allSquares() {
+		if !reflect.DeepEqual(S, before[i]) {
+			is = append(is, S.Index)
+		}
+	}
+	return is, nil
+}
+
 // copy returns a deep copy of a puzzle
 func (p *Puzzle) copy() *Puzzle {
 	// first the basic puzzle structure
 	c := &Puzzle{
-		Metadata: p.allMetadata(),    // metadata is mutable, so never shared
-		mapping:  p.mapping,          // mappings are invariant and always shared
-		logger:   &indexLogger{},     // loggers are per-puzzle, initialized empty
-		errors:   p.allErrors(false), // errors are per-puzzle, copied from source
-		valid:    p.valid,            // valid flag is a boolean
-	}
-	// then the squares
+		Metadata:    p.allMetadata(),    // metadata is mutable, so never shared
+		mapping:     p.mapping,          // mappings are invariant and always shared
+		cages:       p.cages,            // cages are invariant and always shared
+		useMarks:    p.useMarks,         // useMarks flag is a boolean
+		propagation: p.propagation,      // propagation level is an int
+		logger:      &indexLogger{},     // loggers are per-puzzle, initialized empty
+		errors:      p.allErrors(false), // errors are per-puzzle, copied from source
+		valid:       p.valid,            // valid flag is a boolean
+	}
+	// then the squares, allocated together since value sets
+	// are copied with them
 	c.squares = make([]*square, c.mapping.scount+1) // 1-based indexing
+	ss := make([]square, c.mapping.scount+1)
 	for i := 1; i <= c.mapping.scount; i++ {
-		c.squares[i] = &square{
+		c.squares[i] = &ss[i]
+		ss[i] = square{
 			index:  p.squares[i].index,
 			aval:   p.squares[i].aval,
-			pvals:  newIntsetCopy(p.squares[i].pvals),
+			pvals:  p.squares[i].pvals,
 			bval:   p.squares[i].bval,
 			bsrc:   append([]GroupID(nil), p.squares[i].bsrc...),
+			svals:  p.squares[i].svals,
+			elims:  append([]Elimination(nil), p.squares[i].elims...),
+			causes: append([]removal(nil), p.squares[i].causes...),
 			logger: c.logger,
 		}
 	}
-	// then the groups
+	// then the groups, also allocated together
 	c.groups = make([]*group, c.mapping.gcount+1) // 1-based indexing
+	gs := make([]group, c.mapping.gcount+1)
 	for i := 1; i <= c.mapping.gcount; i++ {
-		c.groups[i] = &group{
+		c.groups[i] = &gs[i]
+		gs[i] = group{
 			desc:  p.groups[i].desc, // descriptors are part of mappings, so shared
 			where: append([]int(nil), p.groups[i].where...),
-			need:  newIntsetCopy(p.groups[i].need),
+			need:  p.groups[i].need,
 			free:  newIntsetCopy(p.groups[i].free),
 		}
 	}
@@ -351,13 +598,26 @@ encodings so the package entries can be invoked via HTTP.
 // summary of such puzzles includes their errors.
 //
 // For compactness of encoding, an empty values array indicates
-// an empty puzzle; that is, all squares are unassigned.
+// an empty puzzle; that is, all squares are unassigned.  The
+// region map is only present for geometries (such as Jigsaw)
+// whose tiles are not regular; it gives the region number of
+// each square.  The cages are only present for Killer puzzles.
+// The marks are the values struck from empty squares by the
+// player, and UseMarks says whether they limit the possible
+// values of those squares.  Propagation is the level of
+// constraint propagation the puzzle uses.  Marks and Propagation
+// are not part of the puzzle's Hash.
 type Summary struct {
-	Metadata   map[string]string `json:"metadata,omitempty"`
-	Geometry   string            `json:"geometry"`
-	SideLength int               `json:"sidelen"`
-	Values     []int             `json:"values,omitempty"`
-	Errors     []Error           `json:"errors,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Geometry    string            `json:"geometry"`
+	SideLength  int               `json:"sidelen"`
+	Values      []int             `json:"values,omitempty"`
+	Regions     []int             `json:"regions,omitempty"`
+	Cages       []Cage            `json:"cages,omitempty"`
+	Marks       []Choice          `json:"marks,omitempty"`
+	UseMarks    bool              `json:"usemarks,omitempty"`
+	Propagation Propagation       `json:"propagation,omitempty"`
+	Errors      []Error           `json:"errors,omitempty"`
 }
 
 // A Square in a puzzle gives the square's index, assigned value
@@ -372,19 +632,24 @@ type Summary struct {
 // Aval (user-assigned value) is specified, no other fields
 // should be present.  If the square has a Bval (bound value) and
 // Bsrc (bound value source) then the Pvals should not be
-// present.
+// present.  Svals are the values the player has struck from the
+// square (if any); they are only removed from the Pvals if the
+// puzzle uses its marks.  Elims are the values removed from the
+// Pvals by advanced propagation (if any), with their causes.
 type Square struct {
-	Index int       `json:"index"`
-	Aval  int       `json:"aval,omitempty"`
-	Bval  int       `json:"bval,omitempty"`
-	Bsrc  []GroupID `json:"bsrc,omitempty"`
-	Pvals intset    `json:"pvals,omitempty"`
+	Index int           `json:"index"`
+	Aval  int           `json:"aval,omitempty"`
+	Bval  int           `json:"bval,omitempty"`
+	Bsrc  []GroupID     `json:"bsrc,omitempty"`
+	Pvals intset        `json:"pvals,omitempty"`
+	Svals intset        `json:"svals,omitempty"`
+	Elims []Elimination `json:"elims,omitempty"`
 }
 
-// A GroupID names a row, column, tile, diagonal, or other set of
-// constrained squares, collectively called groups.  The
-// numbering and cardinality for each type of group is 1-based
-// and determined by the puzzle geometry.
+// A GroupID names a row, column, tile, region, diagonal, or
+// other set of constrained squares, collectively called groups.
+// The numbering and cardinality for each type of group is
+// 1-based and determined by the puzzle geometry.
 type GroupID struct {
 	Gtype string `json:"gtype"`
 	Index int    `json:"index"`
@@ -399,13 +664,17 @@ func (gid GroupID) String() string {
 }
 
 // GType (group type) constants.  These are human-readable but
-// not localized.  As the implementation supports new geometries,
-// more group types may be added.
+// not localized; Error messages name groups with the phrases in
+// the message catalogs.  As the implementation supports new
+// geometries, more group types may be added, along with their
+// phrases.
 const (
 	GtypeRow      = "row"
 	GtypeCol      = "column"
 	GtypeTile     = "tile"
 	GtypeDiagonal = "diagonal"
+	GtypeRegion   = "region"
+	GtypeCage     = "cage"
 )
 
 // A Choice assigns a value to a cell.  The cell is referred to
@@ -415,6 +684,25 @@ type Choice struct {
 	Value int `json:"value"`
 }
 
+// A Mark strikes a possible value from an empty square, or
+// restores a struck value if Restore is set.  The square is
+// referred to by its index.
+type Mark struct {
+	Index   int  `json:"index"`
+	Value   int  `json:"value"`
+	Restore bool `json:"restore,omitempty"`
+}
+
+// A Cage is a set of squares (referred to by their indices)
+// whose values must add up to the cage's sum, with no value
+// repeated.  Cages are numbered (from 1) in the order they
+// appear in a Summary, and are named in Errors by a GroupID with
+// a Gtype of GtypeCage.
+type Cage struct {
+	Sum     int   `json:"sum"`
+	Indices []int `json:"indices"`
+}
+
 // A Content structure gives the details of the puzzle's squares
 // and errors.  When you ask for the Summary of a puzzle, you get a
 // Content structure that contains all of the squares, and you
@@ -429,16 +717,19 @@ type Content struct {
 
 // A Solution is a filled-in puzzle (expressed as its values)
 // plus the sequence of choices for empty squares that were made
-// to get there and a rating (1-5) of how difficult the puzzle
-// was to solve.  Solutions tend to have far fewer choices than
-// originally empty squares, because most of the empty squares in
-// most puzzles have their values forced (bound) by puzzle
-// structure.  These bound values are present only in the solved
-// puzzle, not in the choice list.
+// to get there, a rating (1-5) of how difficult the puzzle was
+// to solve, and the Grade that the rating comes from.  Solutions
+// tend to have far fewer choices than originally empty squares,
+// because most of the empty squares in most puzzles have their
+// values forced (bound) by puzzle structure.  These bound values
+// are present only in the solved puzzle, not in the choice list.
+// Puzzles that can be solved by logical techniques alone have
+// no choices.
 type Solution struct {
 	Values  []int    `json:"values"`
 	Choices []Choice `json:"choices,omitempty"`
 	Rating  int      `json:"rating"`
+	Grade   *Grade   `json:"grade,omitempty"`
 }
 
 /*
@@ -473,6 +764,9 @@ func (s *Summary) Hash() (Signature, error) {
 	if slen := s.SideLength; s.Geometry == "" || slen == 0 || len(s.Values) != slen*slen {
 		return "", argumentError(SummaryAttribute, InvalidArgumentCondition, s)
 	}
+	if rlen := len(s.Regions); rlen != 0 && rlen != len(s.Values) {
+		return "", argumentError(SummaryAttribute, InvalidArgumentCondition, s)
+	}
 	return s.hash(), nil
 }
 
@@ -504,6 +798,131 @@ func (p *Puzzle) Assign(choice Choice) (*Content, error) {
 	if !p.isValid() {
 		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
 	}
+	if err := p.checkChoice(choice.Index, choice.Value); err != nil {
+		return nil, err
+	}
+
+	// assigning this value to this square is allowed, so try it
+	p.beginStep()
+	is := p.assign(choice.Index, choice.Value)
+	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+}
+
+// Unassign clears the value assigned to a square, returning an
+// update to the puzzle's State.  Any square can be cleared, not
+// just the last one assigned, and the puzzle is left as if the
+// square had never been assigned.  Unlike Assign, this works on
+// puzzles that are unsolvable, whose errors are recomputed.  If
+// the index is out of range or the square isn't assigned, the
+// puzzle isn't updated and an Error is returned.
+func (p *Puzzle) Unassign(index int) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 1 || index > p.mapping.scount {
+		return nil, rangeError(IndexAttribute, index, 1, p.mapping.scount)
+	}
+	if p.squares[index].aval == 0 {
+		err := argumentError(IndexAttribute, NotAssignedCondition, index)
+		err.Message = err.Error()
+		return nil, err
+	}
+
+	// constraint relaxation only ever removes possibilities, so
+	// rebuild the puzzle without the assignment (or its errors)
+	s := p.summary()
+	s.Values[index-1] = 0
+	s.Errors = nil
+	p.beginStep()
+	is, err := p.rebuild(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+}
+
+// Mark strikes a possible value from a square, or restores a
+// struck value, returning an update to the puzzle's State.  If
+// the puzzle uses its marks, striking a value removes it from
+// the square's possible values, which may bind other squares or
+// make the puzzle unsolvable.  Striking a struck value, or
+// restoring a value that isn't struck, does nothing.  If the
+// puzzle is already unsolvable, the target square is assigned,
+// or the index or value are out of range, the puzzle isn't
+// updated and an Error is returned.
+func (p *Puzzle) Mark(mark Mark) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if err := p.checkChoice(mark.Index, mark.Value); err != nil {
+		return nil, err
+	}
+	p.beginStep()
+	if mark.Restore {
+		is, err := p.restore(mark.Index, mark.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+	}
+	is := p.strike(mark.Index, mark.Value)
+	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+}
+
+// SetUseMarks says whether the puzzle's struck values should
+// limit the possible values of their squares, returning an
+// update to the puzzle's State.  If the puzzle is already
+// unsolvable, it isn't updated and an Error is returned.
+func (p *Puzzle) SetUseMarks(use bool) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if err := p.checkSolvable(); err != nil {
+		return nil, err
+	}
+	if use == p.useMarks {
+		return &Content{[]Square{}, p.allErrors(true)}, nil
+	}
+	s := p.summary()
+	s.UseMarks = use
+	p.beginStep()
+	is, err := p.rebuild(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+}
+
+// SetPropagation sets the level of constraint propagation the
+// puzzle uses, returning an update to the puzzle's State.  If the
+// level is unknown or the puzzle is unsolvable, it isn't updated
+// and an Error is returned.
+func (p *Puzzle) SetPropagation(level Propagation) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if err := p.checkSolvable(); err != nil {
+		return nil, err
+	}
+	if level < BasicPropagation || level > AdvancedPropagation {
+		return nil, rangeError(PropagationAttribute, int(level), int(BasicPropagation), int(AdvancedPropagation))
+	}
+	if level == p.propagation {
+		return &Content{[]Square{}, p.allErrors(true)}, nil
+	}
+	s := p.summary()
+	s.Propagation = level
+	p.beginStep()
+	is, err := p.rebuild(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+}
+
+// checkSolvable returns an Error if the puzzle has errors, which
+// means it can't be changed.
+func (p *Puzzle) checkSolvable() error {
 	if count := len(p.errors); count != 0 {
 		err := Error{
 			Scope:     ArgumentScope,
@@ -511,14 +930,23 @@ func (p *Puzzle) Assign(choice Choice) (*Content, error) {
 			Condition: InvalidPuzzleAssignmentCondition,
 		}
 		err.Message = err.Error()
-		return nil, err
+		return err
+	}
+	return nil
+}
+
+// checkChoice returns an Error if the puzzle can't be changed,
+// if the given index or value are out of range, or if the
+// indexed square is already assigned.
+func (p *Puzzle) checkChoice(idx, val int) error {
+	if err := p.checkSolvable(); err != nil {
+		return err
 	}
-	idx, val := choice.Index, choice.Value
 	if idx < 1 || idx > p.mapping.scount {
-		return nil, rangeError(IndexAttribute, idx, 1, p.mapping.scount)
+		return rangeError(IndexAttribute, idx, 1, p.mapping.scount)
 	}
 	if val < 1 || val > p.mapping.sidelen {
-		return nil, rangeError(ValueAttribute, val, 1, p.mapping.sidelen)
+		return rangeError(ValueAttribute, val, 1, p.mapping.sidelen)
 	}
 	if p.squares[idx].aval != 0 {
 		err := Error{
@@ -527,17 +955,16 @@ func (p *Puzzle) Assign(choice Choice) (*Content, error) {
 			Attribute: AssignedValueAttribute,
 			Condition: DuplicateAssignmentCondition,
 			Values:    ErrorData{val, idx, p.squares[idx].aval},
+			Details:   &AssignmentDetails{idx, val, p.squares[idx].aval},
 		}
 		err.Message = err.Error()
-		return nil, err
+		return err
 	}
-
-	// assigning this value to this square is allowed, so try it
-	is := p.assign(idx, val)
-	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+	return nil
 }
 
-// Copy returns a copy of the wrapped puzzle (no shared structure)
+// Copy returns a copy of the wrapped puzzle (no shared structure).
+// The copy has no observers and no changes to undo.
 func (p *Puzzle) Copy() (*Puzzle, error) {
 	if !p.isValid() {
 		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
@@ -599,7 +1026,7 @@ func create(mapping *puzzleMapping, values []int) (*Puzzle, error) {
 	}
 
 	// assemble the puzzle from its pieces
-	return &Puzzle{nil, mapping, squares, groups, errors, logger, true}, nil
+	return &Puzzle{nil, mapping, squares, groups, nil, false, BasicPropagation, errors, logger, true}, nil
 }
 
 // New takes a puzzle summary and returns the puzzle with that
@@ -619,12 +1046,9 @@ func New(summary *Summary) (*Puzzle, error) {
 	if summary == nil {
 		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, summary)
 	}
-	makefn, ok := knownGeometries[summary.Geometry]
-	if !ok {
-		return nil, argumentError(GeometryAttribute, UnknownGeometryCondition, summary.Geometry)
-	}
-	if summary.SideLength == 0 {
-		return nil, argumentError(SideLengthAttribute, InvalidArgumentCondition, 0)
+	geo, e := findGeometry(summary)
+	if e != nil {
+		return nil, e
 	}
 	values := summary.Values
 	if len(values) == 0 {
@@ -632,10 +1056,29 @@ func New(summary *Summary) (*Puzzle, error) {
 	} else if len(values) != summary.SideLength*summary.SideLength {
 		return nil, argumentError(PuzzleSizeAttribute, WrongPuzzleSizeCondition, len(values), summary.SideLength)
 	}
-	p, e := makefn(values)
+	layout, e := findLayout(geo, summary)
 	if e != nil {
 		return nil, e
 	}
+	p, e := create(layout.mapping, values)
+	if e != nil {
+		return nil, e
+	}
+	if len(summary.Cages) > 0 {
+		if e := p.addCages(summary.Cages); e != nil {
+			return nil, e
+		}
+	}
+	if len(summary.Marks) > 0 || summary.UseMarks {
+		if e := p.addMarks(summary.Marks, summary.UseMarks); e != nil {
+			return nil, e
+		}
+	}
+	if summary.Propagation != BasicPropagation {
+		if e := p.setPropagation(summary.Propagation); e != nil {
+			return nil, e
+		}
+	}
 	if len(summary.Errors) > 0 {
 		if len(p.errors) == 0 {
 			// must have been a bogus summary - no errors in the puzzle!
@@ -656,6 +1099,112 @@ func New(summary *Summary) (*Puzzle, error) {
 	return p, nil
 }
 
+// addMarks validates the given struck values against a newly
+// created puzzle and adds them to its squares.  If the puzzle
+// uses its marks, the struck values are removed from the
+// possible values of their squares, and then all the groups and
+// cages are analyzed again.  Returns an Error if any mark isn't
+// valid; problems found by the analysis are added to the
+// puzzle's errors, as for cages.
+func (p *Puzzle) addMarks(marks []Choice, use bool) error {
+	slen, scount := p.mapping.sidelen, p.mapping.scount
+	p.useMarks = use
+	for _, m := range marks {
+		if m.Index < 1 || m.Index > scount {
+			return rangeError(IndexAttribute, m.Index, 1, scount)
+		}
+		if m.Value < 1 || m.Value > slen {
+			return rangeError(ValueAttribute, m.Value, 1, slen)
+		}
+		s := p.squares[m.Index]
+		if s.aval != 0 {
+			err := argumentError(AssignedValueAttribute, DuplicateAssignmentCondition, m.Value, m.Index, s.aval)
+			err.Details = &AssignmentDetails{m.Index, m.Value, s.aval}
+			return err
+		}
+		s.svals.insert(m.Value)
+	}
+	if !use || len(marks) == 0 {
+		return nil
+	}
+	p.logger.blame(removal{kind: StruckReason})
+	for _, s := range p.squares[1:] {
+		if s.svals != 0 {
+			if errs := s.subtract(s.svals); len(errs) > 0 {
+				p.addErrors(errs)
+			}
+		}
+	}
+	p.logger.blame(removal{})
+	p.analyze()
+	return nil
+}
+
+// addErrors adds Errors to a puzzle, notifying its observers of
+// each one.
+func (p *Puzzle) addErrors(errs []Error) {
+	p.errors = append(p.errors, errs...)
+	for i := range errs {
+		p.logger.notify(Event{Kind: ErrorEvent, Error: &errs[i]})
+	}
+}
+
+// analyze all the groups and then all the cages of a puzzle,
+// stopping at the first one that finds Errors, which are added
+// to the puzzle.  Nothing is analyzed if the puzzle already has
+// Errors.
+func (p *Puzzle) analyze() {
+	if len(p.errors) == 0 {
+		for _, g := range p.groups[1:] {
+			if errs := g.analyze(p.squares); len(errs) > 0 {
+				p.addErrors(errs)
+				break
+			}
+		}
+	}
+	p.analyzeCages()
+}
+
+// analyzeCages analyzes the cages of a puzzle (if any), and then
+// analyzes the groups containing the squares that lost possible
+// values, the same way groups are analyzed after an assignment,
+// so that values with only one place left are bound.  This is
+// repeated until the cages remove no more values.  Any Errors
+// found are added to the puzzle.
+func (p *Puzzle) analyzeCages() {
+	for changed := true; changed && len(p.errors) == 0 && len(p.cages) > 0; {
+		changed = false
+		before := make([]valueset, p.mapping.scount+1)
+		for i := 1; i <= p.mapping.scount; i++ {
+			before[i] = p.squares[i].pvals
+		}
+		for _, c := range p.cages {
+			if errs := c.analyze(p.squares, p.mapping.sidelen); len(errs) > 0 {
+				// cage analyze Errors make the puzzle unsolvable
+				p.addErrors(errs)
+				return
+			}
+		}
+		affected := make([]bool, p.mapping.gcount+1) // 1-based group indexes
+		for i := 1; i <= p.mapping.scount; i++ {
+			if p.squares[i].pvals != before[i] {
+				changed = true
+				for _, gi := range p.mapping.ixmap[i] {
+					affected[gi] = true
+				}
+			}
+		}
+		for gi, a := range affected {
+			if a {
+				if errs := p.groups[gi].analyze(p.squares); len(errs) > 0 {
+					p.addErrors(errs)
+					return
+				}
+			}
+		}
+	}
+}
+
 /*
 
 Groups
@@ -677,12 +1226,14 @@ Groups
 // They always assume any of their free squares can take on any
 // of its possible values.  If two groups disagree on the binding
 // of a square, this shows up as an Error when the second group
-// tries to bind the square to a different value.
+// tries to bind the square to a different value.  (With advanced
+// propagation, a bound square loses its other possible values,
+// so the other groups do see the binding.)
 type group struct {
 	desc  *groupDescriptor
-	where []int  // array map: where[v] = index of square with assigned value v
-	need  intset // values the group still needs assigned or bound
-	free  intset // indexes of squares not yet assigned or bound
+	where []int    // array map: where[v] = index of square with assigned value v
+	need  valueset // values the group still needs assigned or bound
+	free  intset   // indexes of squares not yet assigned or bound
 }
 
 // newGroup constructor: create the specified group of squares,
@@ -692,7 +1243,7 @@ func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
 	// initialize the group members
 	sidelen := len(gd.indices)
 	where := make([]int, sidelen+1) // 1-based values
-	need := newIntsetRange(sidelen)
+	need := newValuesetRange(sidelen)
 	free := append(intset(nil), gd.indices...)
 
 	// work in two passes:
@@ -706,7 +1257,7 @@ func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
 		s := ss[i]
 		if a := s.aval; a != 0 {
 			if where[a] != 0 {
-				errs = append(errs, groupError(gd.id, a, DuplicateGroupValuesCondition))
+				errs = append(errs, groupError(gd.id, a, DuplicateGroupValuesCondition, where[a], i))
 			}
 			where[a] = i
 			free.remove(i)
@@ -717,7 +1268,9 @@ func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
 	// Pass 2: Walk the non-assigned (free) squares, removing
 	// assigned values from them.
 	for _, i := range free {
+		ss[i].logger.blame(removal{kind: PeerReason, group: gd.id, where: where})
 		errs = append(errs, ss[i].intersect(need)...)
+		ss[i].logger.blame(removal{})
 	}
 
 	return &group{gd, where, need, free}, errs
@@ -744,22 +1297,23 @@ func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
 // the overlapping groups need to be constructed/assigned before
 // all of them can be analyzed together.
 func (g *group) analyze(ss []*square) []Error {
-	counts := make([]int, len(g.desc.indices)+1) // candidate counts for each needed value
-	lasts := make([]int, len(g.desc.indices)+1)  // last candidates for each needed value
-	var errs []Error                             // errs arising from the analysis
+	var counts [maxSetValue + 1]int // candidate counts for each needed value
+	var lasts [maxSetValue + 1]int  // last candidates for each needed value
+	var errs []Error                // errs arising from the analysis
 
 	// helper: set this index as the candidate for this value in this group
 	setCandidate := func(idx int, val int) {
+		ss[idx].logger.saveGroup(g, idx, 0)
 		g.free.remove(idx)
 		g.need.remove(val)
 		// bind the square, if needed
-		if len(ss[idx].pvals) > 1 {
+		if ss[idx].pvals.len() > 1 {
 			errs = append(errs, ss[idx].bind(val, g.desc.id)...)
 		}
 		// Issue 32: make sure this value isn't bound elsewhere in the group
 		for _, i := range g.desc.indices {
 			if i != idx && ss[i].bval == val {
-				errs = append(errs, groupError(g.desc.id, val, DuplicateGroupValuesCondition))
+				errs = append(errs, groupError(g.desc.id, val, DuplicateGroupValuesCondition, idx, i))
 				break
 			}
 		}
@@ -772,14 +1326,14 @@ func (g *group) analyze(ss []*square) []Error {
 	// candidates without screwing up the iteration.)
 	for fi := len(g.free) - 1; fi >= 0; fi-- {
 		i := g.free[fi]
-		if len(ss[i].pvals) == 1 {
+		if pvals := ss[i].pvals; pvals.len() == 1 {
 			// this square can only have one value, so it
 			// must be used as the candidate for that value
-			setCandidate(i, ss[i].pvals[0])
+			setCandidate(i, pvals.next(0))
 		} else {
 			// remember this square as a potential candidate for
 			// each of its possible values
-			for _, v := range ss[i].pvals {
+			for v := pvals.next(0); v != 0; v = pvals.next(v) {
 				counts[v]++
 				lasts[v] = i
 			}
@@ -789,11 +1343,12 @@ func (g *group) analyze(ss []*square) []Error {
 	// raising an Error if there aren't any, and binding them if
 	// they are the only ones.
 	//
-	// (We walk the list of needed values back to front,
-	// so we can remove needed values without screwing up the
+	// (We walk a copy of the needed values, back to front, so
+	// we can remove needed values without screwing up the
 	// iteration.)
-	for i := len(g.need) - 1; i >= 0; i-- {
-		switch v := g.need[i]; counts[v] {
+	need := g.need
+	for v := need.prev(maxSetValue + 1); v != 0; v = need.prev(v) {
+		switch counts[v] {
 		case 0:
 			errs = append(errs, groupError(g.desc.id, v, NoGroupValueCondition))
 		case 1:
@@ -821,43 +1376,302 @@ func (g *group) assign(ss []*square, ai int) []Error {
 		if wi == ai {
 			return nil
 		}
-		errs = append(errs, groupError(g.desc.id, av, DuplicateGroupValuesCondition))
+		errs = append(errs, groupError(g.desc.id, av, DuplicateGroupValuesCondition, wi, ai))
 	}
 
 	// record the assignment
+	ss[ai].logger.saveGroup(g, ai, av)
 	g.where[av] = ai
 	g.need.remove(av)
 	g.free.remove(ai)
 
 	// remove this possible value from all the unassigned squares in the group
+	ss[ai].logger.blame(removal{kind: PeerReason, source: ai, group: g.desc.id})
 	for _, i := range g.desc.indices {
 		if ss[i].aval == 0 {
 			errs = append(errs, ss[i].remove(av)...)
 		}
 	}
+	ss[ai].logger.blame(removal{})
 	return errs
 }
 
 /*
 
+Cages
+
+*/
+
+// A cage is a set of squares whose values must add up to a sum
+// without repeating.  Unlike groups, cages keep no state of
+// their own: every analysis works from the current values and
+// possible values of their squares.
+type cage struct {
+	id      GroupID
+	sum     int
+	indices intset
+}
+
+// addCages validates the given cages against a newly created
+// puzzle and adds them to it, doing constraint relaxation on
+// the puzzle's squares.  Returns an Error if any cage isn't
+// valid; problems found by the relaxation are added to the
+// puzzle's errors, as for groups.
+func (p *Puzzle) addCages(cages []Cage) error {
+	slen, scount := p.mapping.sidelen, p.mapping.scount
+	p.cages = make([]*cage, len(cages))
+	for ci, c := range cages {
+		if len(c.Indices) == 0 || len(c.Indices) > slen {
+			return argumentError(CageAttribute, InvalidArgumentCondition, ci+1)
+		}
+		indices := make(intset, 0, len(c.Indices))
+		for _, idx := range c.Indices {
+			if idx < 1 || idx > scount {
+				return rangeError(IndexAttribute, idx, 1, scount)
+			}
+			if indices.insert(idx) {
+				return argumentError(CageAttribute, InvalidArgumentCondition, ci+1)
+			}
+		}
+		// the smallest and largest sums of distinct values
+		count := len(indices)
+		min, max := count*(count+1)/2, count*(2*slen-count+1)/2
+		if c.Sum < min || c.Sum > max {
+			err := argumentError(CageAttribute, ImpossibleCageSumCondition, ci+1, c.Sum)
+			err.Details = &CageDetails{Cage: GroupID{GtypeCage, ci + 1}, Sum: c.Sum}
+			return err
+		}
+		p.cages[ci] = &cage{GroupID{GtypeCage, ci + 1}, c.Sum, indices}
+	}
+	p.analyzeCages()
+	return nil
+}
+
+// analyze a cage for solvability.  We find all the sets of
+// distinct unused values that could fill the cage's empty
+// squares and make up its sum.  Then, for each empty square, we
+// remove any possible value that isn't used by one of those
+// sets in some arrangement of values into squares.  When there
+// are too many sets to look at (see cageWalkLimit), we only
+// remove the values that would leave the other squares a sum
+// outside the bounds of what they can make, or no way to take
+// distinct values.
+//
+// The result of the analysis is the sequence of Errors (if any)
+// that were generated.  If the sum can't be made, no possible
+// values are removed.
+func (c *cage) analyze(ss []*square, sidelen int) []Error {
+	var used, free intset
+	total := 0
+	for _, i := range c.indices {
+		if a := ss[i].aval; a != 0 {
+			if used.insert(a) {
+				var squares []int
+				for _, j := range c.indices {
+					if ss[j].aval == a {
+						squares = append(squares, j)
+					}
+				}
+				return []Error{groupError(c.id, a, DuplicateGroupValuesCondition, squares...)}
+			}
+			total += a
+		} else {
+			free = append(free, i)
+		}
+	}
+	if len(free) == 0 {
+		if total != c.sum {
+			return []Error{cageError(c.id, WrongCageSumCondition, total, c.sum)}
+		}
+		return nil
+	}
+
+	// candidates for the empty squares are the unused values
+	var candidates intset
+	var unused valueset
+	for v := 1; v <= sidelen; v++ {
+		if _, found := used.find(v); !found {
+			candidates = append(candidates, v)
+			unused.insert(v)
+		}
+	}
+	remaining := c.sum - total
+
+	keeps := make([]valueset, len(free))
+	found := false
+	if setsWithin(len(candidates), len(free), cageWalkLimit) {
+		// walk the sets of candidates of the right size and sum,
+		// collecting the values each empty square can take
+		set := make(intset, 0, len(free))
+		var walk func(start, remaining int)
+		walk = func(start, remaining int) {
+			if len(set) == len(free) {
+				if remaining != 0 {
+					return
+				}
+				for fi, i := range free {
+					others := append(append([]int(nil), free[:fi]...), free[fi+1:]...)
+					for _, v := range set {
+						if keeps[fi].has(v) || !ss[i].pvals.has(v) {
+							continue
+						}
+						rest := newValueset(set...)
+						rest.remove(v)
+						if matchable(ss, others, rest) {
+							keeps[fi].insert(v)
+							found = true
+						}
+					}
+				}
+				return
+			}
+			for ci := start; ci < len(candidates); ci++ {
+				v := candidates[ci]
+				if v > remaining {
+					break
+				}
+				set = append(set, v)
+				walk(ci+1, remaining-v)
+				set = set[:len(set)-1]
+			}
+		}
+		walk(0, remaining)
+	} else {
+		// too many sets to walk: keep each value that leaves a
+		// sum the other squares can make, as far as the bounds
+		// on their sums can tell, with distinct values
+		for fi, i := range free {
+			others := append(append([]int(nil), free[:fi]...), free[fi+1:]...)
+			vs := ss[i].pvals & unused
+			for v := vs.next(0); v != 0; v = vs.next(v) {
+				rest := unused
+				rest.remove(v)
+				if sumBounded(ss, others, rest, remaining-v) && matchable(ss, others, rest) {
+					keeps[fi].insert(v)
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		return []Error{cageError(c.id, ImpossibleCageSumCondition, c.sum)}
+	}
+
+	var errs []Error
+	for fi, i := range free {
+		ss[i].logger.blame(removal{kind: CageReason, group: c.id})
+		errs = append(errs, ss[i].intersect(keeps[fi])...)
+		ss[i].logger.blame(removal{})
+	}
+	return errs
+}
+
+// cageWalkLimit is the most sets of values that cage analysis
+// walks to find exactly which values a cage's empty squares can
+// take.  When there are more, as there are for big cages in big
+// puzzles, the analysis is bounded instead.
+const cageWalkLimit = 4096
+
+// setsWithin returns whether there are at most limit sets of k
+// values chosen from n.
+func setsWithin(n, k, limit int) bool {
+	if k > n-k {
+		k = n - k
+	}
+	count := 1
+	for i := 0; i < k; i++ {
+		if count = count * (n - i) / (i + 1); count > limit {
+			return false
+		}
+	}
+	return true
+}
+
+// matchable returns whether the given squares can each take a
+// different one of the given values, by finding a matching of
+// squares to values with augmenting paths.
+func matchable(ss []*square, sqs []int, vals valueset) bool {
+	var owner [maxSetValue + 1]int // owner[v] = 1 + position of the square taking v
+	var augment func(k int, seen *valueset) bool
+	augment = func(k int, seen *valueset) bool {
+		vs := ss[sqs[k]].pvals & vals
+		for v := vs.next(0); v != 0; v = vs.next(v) {
+			if seen.has(v) {
+				continue
+			}
+			seen.insert(v)
+			if owner[v] == 0 || augment(owner[v]-1, seen) {
+				owner[v] = k + 1
+				return true
+			}
+		}
+		return false
+	}
+	for k := range sqs {
+		var seen valueset
+		if !augment(k, &seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// sumBounded returns whether the given squares, taking distinct
+// values from the given ones, might add up to sum: it's no less
+// than the smallest values could make (both overall and square
+// by square) and no more than the largest could.
+func sumBounded(ss []*square, sqs []int, vals valueset, sum int) bool {
+	if len(sqs) == 0 || sum <= 0 {
+		return len(sqs) == 0 && sum == 0
+	}
+	lo, hi := 0, 0
+	for k, v, w := 0, vals.next(0), vals.prev(maxSetValue+1); k < len(sqs); k++ {
+		if v == 0 {
+			return false
+		}
+		lo, hi = lo+v, hi+w
+		v, w = vals.next(v), vals.prev(w)
+	}
+	slo, shi := 0, 0
+	for _, i := range sqs {
+		vs := ss[i].pvals & vals
+		if vs == 0 {
+			return false
+		}
+		slo, shi = slo+vs.next(0), shi+vs.prev(maxSetValue+1)
+	}
+	if slo > lo {
+		lo = slo
+	}
+	if shi < hi {
+		hi = shi
+	}
+	return lo <= sum && sum <= hi
+}
+
+/*
+
 Squares
 
 */
 
 // A square in a puzzle.
 type square struct {
-	index  int          // 1-based index of the square
-	aval   int          // value assigned by the user
-	pvals  intset       // possible (not in conflict) values
-	bval   int          // value bound (required) by a containing group
-	bsrc   []GroupID    // group(s) binding the bound value
-	logger *indexLogger // a log of modifications
+	index  int           // 1-based index of the square
+	aval   int           // value assigned by the user
+	pvals  valueset      // possible (not in conflict) values
+	bval   int           // value bound (required) by a containing group
+	bsrc   []GroupID     // group(s) binding the bound value
+	svals  valueset      // values struck by the user
+	elims  []Elimination // values removed by advanced propagation
+	causes []removal     // why possible values were removed
+	logger *indexLogger  // a log of modifications
 }
 
 // Make an empty square with the given index in a puzzle with the
 // given side length.  Doesn't do error checking.
 func newEmptySquare(index, sidelen int, logger *indexLogger) *square {
-	return &square{index: index, pvals: newIntsetRange(sidelen), logger: logger}
+	return &square{index: index, pvals: newValuesetRange(sidelen), logger: logger}
 }
 
 // Make a square with the given index in a puzzle with the given
@@ -873,16 +1687,20 @@ func newFilledSquare(index, sidelen int, value int, logger *indexLogger) *square
 func (s *square) assign(aval int) (errs []Error) {
 	if s.bval != 0 && s.bval != aval {
 		for i := range s.bsrc {
-			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
+			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition, s.index))
 		}
 	}
-	_, found := s.pvals.find(aval)
-	if !found {
+	if !s.pvals.has(aval) {
 		errs = append(errs, squareError(s, aval, AssignedValueAttribute, NotInSetCondition))
 	}
+	s.logger.saveSquare(s)
 	s.aval = aval
-	s.pvals = nil
+	s.pvals = 0
+	s.svals = 0
+	s.elims = nil
+	s.causes = nil
 	s.logger.log(s.index)
+	s.logger.notify(Event{Kind: AssignEvent, Index: s.index, Value: aval})
 	return
 }
 
@@ -893,16 +1711,17 @@ func (s *square) assign(aval int) (errs []Error) {
 func (s *square) bind(bval int, bsrc GroupID) (errs []Error) {
 	if s.bval != 0 && s.bval != bval {
 		for i := range s.bsrc {
-			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
+			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition, s.index))
 		}
 	}
-	_, found := s.pvals.find(bval)
-	if !found {
+	if !s.pvals.has(bval) {
 		errs = append(errs, squareError(s, bval, BoundValueAttribute, NotInSetCondition))
 	}
+	s.logger.saveSquare(s)
 	s.bval = bval
 	s.bsrc = append(s.bsrc, bsrc)
 	s.logger.log(s.index)
+	s.logger.notify(Event{Kind: BindEvent, Index: s.index, Value: bval, Group: bsrc})
 	return
 }
 
@@ -912,39 +1731,58 @@ func (s *square) bind(bval int, bsrc GroupID) (errs []Error) {
 func (s *square) remove(val int) (errs []Error) {
 	if val == s.bval {
 		for i := range s.bsrc {
-			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
+			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition, s.index))
 		}
 	}
-	removed := s.pvals.remove(val)
-	if removed {
-		if len(s.pvals) == 0 {
+	if !s.pvals.has(val) {
+		return
+	}
+	s.logger.saveSquare(s)
+	if s.pvals.remove(val) {
+		if s.pvals == 0 {
 			errs = append(errs,
 				squareError(s, val, RemovedValueAttribute, NoPossibleValuesCondition))
 		}
 		s.logger.log(s.index)
+		s.logger.record(s, val)
+		s.logger.notify(Event{Kind: RemoveEvent, Index: s.index, Value: val})
 	}
 	return
 }
 
+// Eliminate a possible value from an empty square by advanced
+// propagation, remembering why.  Returns whether the value was
+// possible, and any Errors generated by the removal.
+func (s *square) eliminate(e Elimination) (bool, []Error) {
+	if !s.pvals.has(e.Value) {
+		return false, nil
+	}
+	s.logger.saveSquare(s)
+	s.elims = append(s.elims, e)
+	return true, s.remove(e.Value)
+}
+
 // Subtract possible values from a square.  Returns any Errors
 // generated by the removal.  Doesn't guard against the square
 // being assigned, or being left with no possible values.
-func (s *square) subtract(vals intset) []Error {
+func (s *square) subtract(vals valueset) []Error {
 	return s.removeMultiple(vals, false)
 }
 
 // Intersect possible values on a square.  Returns any Errors
 // generated by the intersection.  Doesn't guard against the
 // square being assigned, or being left with no possible values.
-func (s *square) intersect(vals intset) []Error {
+func (s *square) intersect(vals valueset) []Error {
 	return s.removeMultiple(vals, true)
 }
 
 // Validate and apply the result of a set operation on a square.
 // This is a helper that does the work of subract and intersect.
-func (s *square) removeMultiple(vals intset, keepVals bool) (errs []Error) {
+func (s *square) removeMultiple(vals valueset, keepVals bool) (errs []Error) {
 	var remsome, rembound bool
 	var attr ErrorAttribute
+	before := s.pvals
+	s.logger.saveSquare(s)
 	if keepVals {
 		attr = RetainedValuesAttribute
 		remsome, rembound = s.pvals.intersect(vals, s.bval)
@@ -954,14 +1792,19 @@ func (s *square) removeMultiple(vals intset, keepVals bool) (errs []Error) {
 	}
 	if rembound {
 		for i := range s.bsrc {
-			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
+			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition, s.index))
 		}
 	}
-	if len(s.pvals) == 0 {
-		errs = append(errs, squareError(s, vals, attr, NoPossibleValuesCondition))
+	if s.pvals == 0 {
+		errs = append(errs, squareError(s, vals.values(), attr, NoPossibleValuesCondition))
 	}
 	if remsome {
 		s.logger.log(s.index)
+		removed := before &^ s.pvals
+		for v := removed.next(0); v != 0; v = removed.next(v) {
+			s.logger.record(s, v)
+			s.logger.notify(Event{Kind: RemoveEvent, Index: s.index, Value: v})
+		}
 	}
 	return
 }
@@ -972,10 +1815,32 @@ indexLoggers
 
 */
 
-// An indexLogger is an intset that is used to log indices.
+// An indexLogger is an intset that is used to log indices.  It
+// also holds the observers and the undo journal of its puzzle,
+// and the cause of the removals being made, since it's shared by
+// all the puzzle's squares.
 type indexLogger struct {
-	logging bool
-	entries intset
+	logging   bool
+	entries   intset
+	observers []*observation
+	journal   *journal // nil until the puzzle is first marked
+	blamed    removal  // the cause of the removals being made
+}
+
+// A removal records why a value was removed from a square's
+// possible values.  The Kind is one of PeerReason (square source
+// in group is assigned the value), EliminatedReason (advanced
+// propagation removed it; source is the square whose value is
+// certain, for singles), StruckReason, or CageReason (it can't
+// help make the sum of the cage group).  While a cause is being
+// blamed for removals, where can map values to the squares in
+// group that are assigned them, which gives the source of each.
+type removal struct {
+	value  int
+	kind   ReasonKind
+	source int
+	group  GroupID
+	where  []int
 }
 
 // start turns on a logger, giving it an initial entry.
@@ -1002,6 +1867,37 @@ func (l *indexLogger) log(idx int) {
 	}
 }
 
+// blame sets the cause of the removals that follow, until it is
+// set again.  Removals made with no cause blamed are recorded
+// with an UnknownReason.
+func (l *indexLogger) blame(r removal) {
+	if l != nil {
+		l.blamed = r
+	}
+}
+
+// record notes on a square that a value was removed from it,
+// with the cause being blamed.
+func (l *indexLogger) record(s *square, v int) {
+	if l != nil {
+		r := l.blamed
+		r.value = v
+		if r.where != nil {
+			r.source, r.where = r.where[v], nil
+		}
+		s.causes = append(s.causes, r)
+	}
+}
+
+// notify passes an event to a logger's observers, if it has any.
+func (l *indexLogger) notify(e Event) {
+	if l != nil {
+		for _, o := range l.observers {
+			o.observer.Observe(e)
+		}
+	}
+}
+
 /*
 
 Integer sets
@@ -1009,8 +1905,9 @@ Integer sets
 */
 
 // An intset is a set of integers, represented as a sorted slice.
-// We use intsets to represent both sets of possible values for
-// squares and sets of indices.
+// We use intsets to represent sets of indices, and sets of values
+// in the public API.  (Inside puzzles, sets of values are
+// represented as valuesets.)
 type intset []int
 
 // newIntsetRange: Make an intset from a range of values, 1 to max.
@@ -1086,84 +1983,189 @@ func (ps *intset) remove(v int) bool {
 	return false
 }
 
-// Subtract the passed intset, returning whether anything was
-// removed.  Also takes a marker value and returns whether it was
-// removed.
-func (ps *intset) subtract(xs intset, marker int) (bool, bool) {
-	pend, xend := len(*ps), len(xs)
-	pi := 0
-	newend := pi
-	remmarker := false
-	// process the input set
-	for xi := 0; pi < pend && xi < xend; {
-		pv, xv := (*ps)[pi], xs[xi]
-		switch {
-		case pv == xv:
-			if pv == marker {
-				remmarker = true
-			}
-			pi++
-			xi++
-		case pv < xv:
-			if newend != pi {
-				(*ps)[newend] = pv
-			}
-			newend++
-			pi++
-		case pv > xv:
-			xi++
+// Contains checks whether all the values of the passed intset
+// are present.
+func (ps *intset) contains(xs intset) bool {
+	for _, x := range xs {
+		if _, found := ps.find(x); !found {
+			return false
 		}
 	}
-	if newend == pi {
-		// nothing was removed
-		return false, false
-	}
-	// copy any remaining non-removed values
-	newend += copy((*ps)[newend:], (*ps)[pi:])
-	*ps = (*ps)[:newend]
-	return true, remmarker
+	return true
 }
 
-// Intersect the passed intset, returning whether anything was
-// removed.  Also takes a marker value and returns whether it was
-// removed.
-func (ps *intset) intersect(xs intset, marker int) (bool, bool) {
-	pend, xend := len(*ps), len(xs)
-	sawmarker := false
-	savedmarker := false
-	pi := 0
-	newend := pi
-	// process the input set
-	for xi := 0; pi < pend && xi < xend; {
-		pv, xv := (*ps)[pi], xs[xi]
-		if pv == marker {
-			sawmarker = true
-		}
-		switch {
-		case pv == xv:
-			if pv == marker {
-				savedmarker = true
-			}
-			if newend != pi {
-				(*ps)[newend] = pv
-			}
-			newend++
-			pi++
-			xi++
-		case pv < xv:
-			pi++
-		case pv > xv:
-			xi++
+/*
+
+Value sets
+
+*/
+
+// A valueset is a set of puzzle values, represented as a bitset:
+// value v is in the set if bit v-1 is set.  We use valuesets for
+// the possible and struck values of squares and for the needed
+// values of groups, because they are cheap to copy and to
+// combine.  Values must be between 1 and maxSetValue.
+type valueset uint64
+
+// maxSetValue is the largest value a valueset can hold.
+const maxSetValue = 64
+
+// onesCount returns the number of bits set in x.
+func onesCount(x uint64) int {
+	x -= (x >> 1) & 0x5555555555555555
+	x = (x>>2)&0x3333333333333333 + x&0x3333333333333333
+	x = (x>>4 + x) & 0x0f0f0f0f0f0f0f0f
+	return int((x * 0x0101010101010101) >> 56)
+}
+
+// deBruijn64 and deBruijnIndex find the lowest bit set in a
+// word: multiplying the bit by the constant puts a distinct
+// pattern in the top 6 bits for each position.
+const deBruijn64 = 0x03f79d71b4ca8b09
+
+var deBruijnIndex = [64]byte{
+	0, 1, 56, 2, 57, 49, 28, 3, 61, 58, 42, 50, 38, 29, 17, 4,
+	62, 47, 59, 36, 45, 43, 51, 22, 53, 39, 33, 30, 24, 18, 12, 5,
+	63, 55, 48, 27, 60, 41, 37, 16, 46, 35, 44, 21, 52, 32, 23, 11,
+	54, 26, 40, 15, 34, 20, 31, 10, 25, 14, 19, 9, 13, 8, 7, 6,
+}
+
+// trailingZeros returns the number of zero bits below the lowest
+// bit set in x, which must not be 0.
+func trailingZeros(x uint64) int {
+	return int(deBruijnIndex[(x&-x)*deBruijn64>>58])
+}
+
+// bitLen returns the number of bits needed to represent x: the
+// position of its highest bit set, or 0 if x is 0.
+func bitLen(x uint64) (n int) {
+	for _, shift := range [...]uint{32, 16, 8, 4, 2, 1} {
+		if x >= 1<<shift {
+			x >>= shift
+			n += int(shift)
 		}
 	}
-	// process the removed tail
-	for _, pv := range (*ps)[pi:] {
-		if pv == marker {
-			sawmarker = true
-		}
+	if x != 0 {
+		n++
+	}
+	return
+}
+
+// newValuesetRange: Make a valueset from a range of values, 1 to
+// max.
+func newValuesetRange(max int) valueset {
+	if max < 1 {
+		return 0
+	}
+	if max >= maxSetValue {
+		return ^valueset(0)
+	}
+	return valueset(1)<<uint(max) - 1
+}
+
+// newValueset: Make a valueset from a list of values.
+func newValueset(vs ...int) valueset {
+	var out valueset
+	for _, v := range vs {
+		out.insert(v)
+	}
+	return out
+}
+
+// bit returns the bit for value v.
+func bit(v int) valueset {
+	return valueset(1) << uint(v-1)
+}
+
+// Has checks whether value v is in the valueset.
+func (vs valueset) has(v int) bool {
+	return v >= 1 && v <= maxSetValue && vs&bit(v) != 0
+}
+
+// Len returns the number of values in the valueset.
+func (vs valueset) len() int {
+	return onesCount(uint64(vs))
+}
+
+// Next returns the smallest value in the valueset that is
+// greater than v, or 0 if there is none.  Loop over the values
+// in a valueset with:
+//
+//	for v := vs.next(0); v != 0; v = vs.next(v) { ... }
+func (vs valueset) next(v int) int {
+	if v >= maxSetValue {
+		return 0
+	}
+	rest := uint64(vs) >> uint(v)
+	if rest == 0 {
+		return 0
+	}
+	return v + trailingZeros(rest) + 1
+}
+
+// Prev returns the largest value in the valueset that is less
+// than v, or 0 if there is none.
+func (vs valueset) prev(v int) int {
+	if v <= 1 {
+		return 0
+	}
+	return bitLen(uint64(vs) & (uint64(1)<<uint(v-1) - 1))
+}
+
+// String formats a valueset as its list of values.
+func (vs valueset) String() string {
+	return fmt.Sprint([]int(vs.values()))
+}
+
+// Values returns the values in the valueset as a (sorted)
+// intset.  An empty valueset gives an empty (but not nil)
+// intset.
+func (vs valueset) values() intset {
+	out := make(intset, 0, vs.len())
+	for v := vs.next(0); v != 0; v = vs.next(v) {
+		out = append(out, v)
+	}
+	return out
+}
+
+// Insert value v, returning whether it was there already.
+func (vs *valueset) insert(v int) bool {
+	found := *vs&bit(v) != 0
+	*vs |= bit(v)
+	return found
+}
+
+// Remove value v, returning whether it was there.
+func (vs *valueset) remove(v int) bool {
+	found := vs.has(v)
+	if found {
+		*vs &^= bit(v)
 	}
-	*ps = (*ps)[:newend]
-	return newend < pend, sawmarker && !savedmarker
+	return found
+}
+
+// Contains checks whether all the values of the passed valueset
+// are present.
+func (vs valueset) contains(xs valueset) bool {
+	return xs&^vs == 0
+}
+
+// Subtract the passed valueset, returning whether anything was
+// removed.  Also takes a marker value and returns whether it was
+// removed.
+func (vs *valueset) subtract(xs valueset, marker int) (bool, bool) {
+	removed := *vs & xs
+	*vs &^= xs
+	return removed != 0, marker != 0 && removed.has(marker)
+}
+
+// Intersect the passed valueset, returning whether anything was
+// removed.  Also takes a marker value and returns whether it was
+// removed.
+func (vs *valueset) intersect(xs valueset, marker int) (bool, bool) {
+	removed := *vs &^ xs
+	*vs &= xs
+	return removed != 0, marker != 0 && removed.has(marker)
 }
 
 /*
@@ -1192,6 +2194,7 @@ func rangeError(attr ErrorAttribute, val int, min int, max int) Error {
 		Attribute: attr,
 		Condition: TooLargeCondition,
 		Values:    ErrorData{val, max},
+		Details:   &RangeDetails{val, min, max},
 	}
 	if val < min {
 		err.Condition = TooSmallCondition
@@ -1211,9 +2214,18 @@ func squareError(s *square, v interface{}, attr ErrorAttribute, cond ErrorCondit
 		Condition: cond,
 		Values:    ErrorData{s.index, v},
 	}
+	details := &SquareDetails{Index: s.index}
+	switch v := v.(type) {
+	case int:
+		details.Values = []int{v}
+	case intset:
+		details.Values = v
+	}
+	err.Details = details
 	switch cond {
 	case NotInSetCondition:
-		err.Values = append(err.Values, s.pvals)
+		err.Values = append(err.Values, s.pvals.values())
+		details.Possible = s.pvals.values()
 	case NoPossibleValuesCondition:
 	default:
 		panic(fmt.Errorf("Unexpected square error condition (%v) in square %+v", cond, *s))
@@ -1221,13 +2233,36 @@ func squareError(s *square, v interface{}, attr ErrorAttribute, cond ErrorCondit
 	return err
 }
 
-// groupError returns an Error that describes an unsatisfiable group.
-func groupError(gid GroupID, v int, cond ErrorCondition) Error {
+// cageError returns an Error that describes an unsatisfiable cage.
+// The values are the cage's sum or, for a wrong sum, the total
+// of its values and its sum.
+func cageError(gid GroupID, cond ErrorCondition, values ...int) Error {
+	details := &CageDetails{Cage: gid, Sum: values[len(values)-1]}
+	if cond == WrongCageSumCondition {
+		details.Total = values[0]
+	}
+	err := Error{
+		Scope:     GroupScope,
+		Structure: ScopeStructure,
+		Condition: cond,
+		Values:    ErrorData{gid},
+		Details:   details,
+	}
+	for _, v := range values {
+		err.Values = append(err.Values, v)
+	}
+	return err
+}
+
+// groupError returns an Error that describes an unsatisfiable
+// group, given the squares that conflict over the value.
+func groupError(gid GroupID, v int, cond ErrorCondition, squares ...int) Error {
 	err := Error{
 		Scope:     GroupScope,
 		Structure: ScopeStructure,
 		Condition: cond,
 		Values:    ErrorData{gid, v},
+		Details:   &GroupDetails{gid, v, squares},
 	}
 	switch cond {
 	case NoGroupValueCondition:
@@ -42,9 +42,12 @@ func helperDupSquare(sq *square) *square {
 	return &square{
 		sq.index,
 		sq.aval,
-		newIntsetCopy(sq.pvals),
+		sq.pvals,
 		sq.bval,
 		append([]GroupID(nil), sq.bsrc...),
+		sq.svals,
+		append([]Elimination(nil), sq.elims...),
+		append([]removal(nil), sq.causes...),
 		sq.logger,
 	}
 }
@@ -52,7 +55,7 @@ func helperDupSquare(sq *square) *square {
 // depends on newEmptySquare and (*square).subtract, test those first
 func helperRestrictedSquare(index, sidelen int, excepts ...int) *square {
 	sp := newEmptySquare(index, sidelen, nil)
-	errs := sp.subtract(excepts)
+	errs := sp.subtract(newValueset(excepts...))
 	if len(errs) > 0 {
 		panic(errs[0])
 	}
@@ -313,59 +316,59 @@ var (
 	rotation4Puzzle1PartialSquares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2, 4}},
+		&square{index: 2, pvals: newValueset(2, 4)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}},
-		&square{index: 5, pvals: intset{2, 4}},
+		&square{index: 4, pvals: newValueset(2, 4)},
+		&square{index: 5, pvals: newValueset(2, 4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2, 4}},
+		&square{index: 7, pvals: newValueset(2, 4)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
-		&square{index: 10, pvals: intset{2, 4}},
+		&square{index: 10, pvals: newValueset(2, 4)},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2, 4}},
-		&square{index: 13, pvals: intset{2, 4}},
+		&square{index: 12, pvals: newValueset(2, 4)},
+		&square{index: 13, pvals: newValueset(2, 4)},
 		&square{index: 14, aval: 1},
-		&square{index: 15, pvals: intset{2, 4}},
+		&square{index: 15, pvals: newValueset(2, 4)},
 		&square{index: 16, aval: 3},
 	}
 	rotation4Puzzle1PartialGroups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{2, 4}, intset{2, 4},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newValueset(2, 4), intset{2, 4},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{2, 4}, intset{5, 7},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newValueset(2, 4), intset{5, 7},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, intset{2, 4}, intset{10, 12},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, newValueset(2, 4), intset{10, 12},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 0, 16, 0}, intset{2, 4}, intset{13, 15},
+			&square4Map.gdescs[4], []int{0, 14, 0, 16, 0}, newValueset(2, 4), intset{13, 15},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 0, 9, 0}, intset{2, 4}, intset{5, 13},
+			&square4Map.gdescs[5], []int{0, 1, 0, 9, 0}, newValueset(2, 4), intset{5, 13},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, intset{2, 4}, intset{2, 10},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, newValueset(2, 4), intset{2, 10},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, intset{2, 4}, intset{7, 15},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, newValueset(2, 4), intset{7, 15},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{2, 4}, intset{4, 12},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newValueset(2, 4), intset{4, 12},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{2, 4}, intset{2, 5},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newValueset(2, 4), intset{2, 5},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{2, 4}, intset{4, 7},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newValueset(2, 4), intset{4, 7},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 0, 9, 0}, intset{2, 4}, intset{10, 13},
+			&square4Map.gdescs[11], []int{0, 14, 0, 9, 0}, newValueset(2, 4), intset{10, 13},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, intset{2, 4}, intset{12, 15},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, newValueset(2, 4), intset{12, 15},
 		},
 	}
 	rotation4Puzzle1PartialAssign1Values = []int{ // assign(13, 2)
@@ -383,59 +386,59 @@ var (
 	rotation4Puzzle1PartialAssign1Squares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(4+2, 8+1)},
+		&square{index: 2, pvals: newValueset(2, 4), bval: 2, bsrc: helperBsrc(4+2, 8+1)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}},
-		&square{index: 5, pvals: intset{4}},
+		&square{index: 4, pvals: newValueset(2, 4)},
+		&square{index: 5, pvals: newValueset(4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(0+2, 4+3)},
+		&square{index: 7, pvals: newValueset(2, 4), bval: 2, bsrc: helperBsrc(0+2, 4+3)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
-		&square{index: 10, pvals: intset{4}},
+		&square{index: 10, pvals: newValueset(4)},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(0+3, 8+4)},
+		&square{index: 12, pvals: newValueset(2, 4), bval: 2, bsrc: helperBsrc(0+3, 8+4)},
 		&square{index: 13, aval: 2},
 		&square{index: 14, aval: 1},
-		&square{index: 15, pvals: intset{4}},
+		&square{index: 15, pvals: newValueset(4)},
 		&square{index: 16, aval: 3},
 	}
 	rotation4Puzzle1PartialAssign1Groups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{2, 4}, intset{2, 4},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newValueset(2, 4), intset{2, 4},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, newValueset(), intset{},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, newValueset(), intset{},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, newValueset(), intset{},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, newValueset(), intset{},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{2, 4}, intset{4, 12},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newValueset(2, 4), intset{4, 12},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{2, 4}, intset{4, 7},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newValueset(2, 4), intset{4, 7},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[11], []int{0, 14, 13, 9, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, newValueset(), intset{},
 		},
 	}
 	rotation4Puzzle1PartialAssign1CapitalSquares = []Square{
@@ -474,59 +477,59 @@ var (
 	rotation4Puzzle1PartialAssign2Squares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2}, bval: 2, bsrc: helperBsrc(4+2, 8+1)},
+		&square{index: 2, pvals: newValueset(2), bval: 2, bsrc: helperBsrc(4+2, 8+1)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}, bval: 4, bsrc: helperBsrc(0+1, 4+4)},
-		&square{index: 5, pvals: intset{4}},
+		&square{index: 4, pvals: newValueset(2, 4), bval: 4, bsrc: helperBsrc(0+1, 4+4)},
+		&square{index: 5, pvals: newValueset(4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(0+2, 4+3)},
+		&square{index: 7, pvals: newValueset(2, 4), bval: 2, bsrc: helperBsrc(0+2, 4+3)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
 		&square{index: 10, aval: 4},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2}, bval: 2, bsrc: helperBsrc(0+3, 8+4)},
+		&square{index: 12, pvals: newValueset(2), bval: 2, bsrc: helperBsrc(0+3, 8+4)},
 		&square{index: 13, aval: 2},
 		&square{index: 14, aval: 1},
-		&square{index: 15, pvals: intset{4}},
+		&square{index: 15, pvals: newValueset(4)},
 		&square{index: 16, aval: 3},
 	}
 	rotation4Puzzle1PartialAssign2Groups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newValueset(), intset{},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, newValueset(), intset{},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, newValueset(), intset{},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, newValueset(), intset{},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, intset{}, intset{},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, newValueset(), intset{},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, newValueset(), intset{},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{2, 4}, intset{4, 7},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newValueset(2, 4), intset{4, 7},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, newValueset(), intset{},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, newValueset(), intset{},
 		},
 	}
 	rotation4Puzzle1PartialAssign2CapitalSquares = []Square{
@@ -564,17 +567,17 @@ var (
 	rotation4Puzzle1PartialAssign3Squares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2}, bval: 2, bsrc: helperBsrc(4+2, 8+1)},
+		&square{index: 2, pvals: newValueset(2), bval: 2, bsrc: helperBsrc(4+2, 8+1)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}, bval: 4, bsrc: helperBsrc(0+1, 4+4, 8+2)},
-		&square{index: 5, pvals: intset{4}},
+		&square{index: 4, pvals: newValueset(2, 4), bval: 4, bsrc: helperBsrc(0+1, 4+4, 8+2)},
+		&square{index: 5, pvals: newValueset(4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2}, bval: 2, bsrc: helperBsrc(0+2, 4+3)},
+		&square{index: 7, pvals: newValueset(2), bval: 2, bsrc: helperBsrc(0+2, 4+3)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
 		&square{index: 10, aval: 4},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2}, bval: 2, bsrc: helperBsrc(0+3, 8+4)},
+		&square{index: 12, pvals: newValueset(2), bval: 2, bsrc: helperBsrc(0+3, 8+4)},
 		&square{index: 13, aval: 2},
 		&square{index: 14, aval: 1},
 		&square{index: 15, aval: 4},
@@ -583,40 +586,40 @@ var (
 	rotation4Puzzle1PartialAssign3Groups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newValueset(), intset{},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, newValueset(), intset{},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 13, 16, 15}, intset{}, intset{},
+			&square4Map.gdescs[4], []int{0, 14, 13, 16, 15}, newValueset(), intset{},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, newValueset(), intset{},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, intset{}, intset{},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, newValueset(), intset{},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 15}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 15}, newValueset(), intset{},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newValueset(), intset{},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, newValueset(), intset{},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 15}, intset{}, intset{},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 15}, newValueset(), intset{},
 		},
 	}
 	rotation4Puzzle1PartialAssign3CapitalSquares = []Square{
@@ -690,61 +693,61 @@ var (
 	rotation4Puzzle2PartialSquares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2, 4}},
+		&square{index: 2, pvals: newValueset(2, 4)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}},
+		&square{index: 4, pvals: newValueset(2, 4)},
 		&square{index: 5, aval: 3},
-		&square{index: 6, pvals: intset{2, 4}},
+		&square{index: 6, pvals: newValueset(2, 4)},
 		&square{index: 7, aval: 1},
-		&square{index: 8, pvals: intset{2, 4}},
+		&square{index: 8, pvals: newValueset(2, 4)},
 		&square{index: 9, aval: 2},
-		&square{index: 10, pvals: intset{1, 3}},
+		&square{index: 10, pvals: newValueset(1, 3)},
 		&square{index: 11, aval: 4},
-		&square{index: 12, pvals: intset{1, 3}},
+		&square{index: 12, pvals: newValueset(1, 3)},
 		&square{index: 13, aval: 4},
-		&square{index: 14, pvals: intset{1, 3}},
+		&square{index: 14, pvals: newValueset(1, 3)},
 		&square{index: 15, aval: 2},
-		&square{index: 16, pvals: intset{1, 3}},
+		&square{index: 16, pvals: newValueset(1, 3)},
 	}
 	rotation4Puzzle2PartialGroups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{2, 4}, intset{2, 4},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newValueset(2, 4), intset{2, 4},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 7, 0, 5, 0}, intset{2, 4}, intset{6, 8},
+			&square4Map.gdescs[2], []int{0, 7, 0, 5, 0}, newValueset(2, 4), intset{6, 8},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 0, 9, 0, 11}, intset{1, 3}, intset{10, 12},
+			&square4Map.gdescs[3], []int{0, 0, 9, 0, 11}, newValueset(1, 3), intset{10, 12},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 0, 15, 0, 13}, intset{1, 3}, intset{14, 16},
+			&square4Map.gdescs[4], []int{0, 0, 15, 0, 13}, newValueset(1, 3), intset{14, 16},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 9, 5, 13}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 9, 5, 13}, newValueset(), intset{},
 		},
 		&group{ // column 2
 			&square4Map.gdescs[6],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{2, 6, 10, 14},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{2, 6, 10, 14},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 7, 15, 3, 11}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 7, 15, 3, 11}, newValueset(), intset{},
 		},
 		&group{ // column 4
 			&square4Map.gdescs[8],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{4, 8, 12, 16},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{4, 8, 12, 16},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 5, 0}, intset{2, 4}, intset{2, 6},
+			&square4Map.gdescs[9], []int{0, 1, 0, 5, 0}, newValueset(2, 4), intset{2, 6},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 7, 0, 3, 0}, intset{2, 4}, intset{4, 8},
+			&square4Map.gdescs[10], []int{0, 7, 0, 3, 0}, newValueset(2, 4), intset{4, 8},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 0, 9, 0, 13}, intset{1, 3}, intset{10, 14},
+			&square4Map.gdescs[11], []int{0, 0, 9, 0, 13}, newValueset(1, 3), intset{10, 14},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 0, 15, 0, 11}, intset{1, 3}, intset{12, 16},
+			&square4Map.gdescs[12], []int{0, 0, 15, 0, 11}, newValueset(1, 3), intset{12, 16},
 		},
 	}
 	rotation4Puzzle2Complete1 = []int{
@@ -773,22 +776,22 @@ var (
 	}
 	empty4PuzzleSquares = []*square{
 		nil,
-		&square{index: 1, pvals: intset{1, 2, 3, 4}},
-		&square{index: 2, pvals: intset{1, 2, 3, 4}},
-		&square{index: 3, pvals: intset{1, 2, 3, 4}},
-		&square{index: 4, pvals: intset{1, 2, 3, 4}},
-		&square{index: 5, pvals: intset{1, 2, 3, 4}},
-		&square{index: 6, pvals: intset{1, 2, 3, 4}},
-		&square{index: 7, pvals: intset{1, 2, 3, 4}},
-		&square{index: 8, pvals: intset{1, 2, 3, 4}},
-		&square{index: 9, pvals: intset{1, 2, 3, 4}},
-		&square{index: 10, pvals: intset{1, 2, 3, 4}},
-		&square{index: 11, pvals: intset{1, 2, 3, 4}},
-		&square{index: 12, pvals: intset{1, 2, 3, 4}},
-		&square{index: 13, pvals: intset{1, 2, 3, 4}},
-		&square{index: 14, pvals: intset{1, 2, 3, 4}},
-		&square{index: 15, pvals: intset{1, 2, 3, 4}},
-		&square{index: 16, pvals: intset{1, 2, 3, 4}},
+		&square{index: 1, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 2, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 3, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 4, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 5, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 6, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 7, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 8, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 9, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 10, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 11, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 12, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 13, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 14, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 15, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 16, pvals: newValueset(1, 2, 3, 4)},
 	}
 	empty4PuzzleCapitalSquares = []Square{
 		Square{Index: 1, Pvals: intset{1, 2, 3, 4}},
@@ -812,51 +815,51 @@ var (
 		nil,
 		&group{ // row 1
 			&square4Map.gdescs[1],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{1, 2, 3, 4},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{1, 2, 3, 4},
 		},
 		&group{ // row 2
 			&square4Map.gdescs[2],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{5, 6, 7, 8},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{5, 6, 7, 8},
 		},
 		&group{ // row 3
 			&square4Map.gdescs[3],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{9, 10, 11, 12},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{9, 10, 11, 12},
 		},
 		&group{ // row 4
 			&square4Map.gdescs[4],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{13, 14, 15, 16},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{13, 14, 15, 16},
 		},
 		&group{ // column 1
 			&square4Map.gdescs[5],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{1, 5, 9, 13},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{1, 5, 9, 13},
 		},
 		&group{ // column 2
 			&square4Map.gdescs[6],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{2, 6, 10, 14},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{2, 6, 10, 14},
 		},
 		&group{ // column 3
 			&square4Map.gdescs[7],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{3, 7, 11, 15},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{3, 7, 11, 15},
 		},
 		&group{ // column 4
 			&square4Map.gdescs[8],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{4, 8, 12, 16},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{4, 8, 12, 16},
 		},
 		&group{ // tile 1
 			&square4Map.gdescs[9],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{1, 2, 5, 6},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{1, 2, 5, 6},
 		},
 		&group{ // tile 2
 			&square4Map.gdescs[10],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{3, 4, 7, 8},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{3, 4, 7, 8},
 		},
 		&group{ // tile 3
 			&square4Map.gdescs[11],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{9, 10, 13, 14},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{9, 10, 13, 14},
 		},
 		&group{ // tile 4
 			&square4Map.gdescs[12],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{11, 12, 15, 16},
+			[]int{0, 0, 0, 0, 0}, newValueset(1, 2, 3, 4), intset{11, 12, 15, 16},
 		},
 	}
 	empty4PuzzleAssign1Values = []int{
@@ -876,19 +879,19 @@ var (
 		&square{index: 1, aval: 1},
 		&square{index: 2, aval: 2},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{4}},
-		&square{index: 5, pvals: intset{3, 4}},
-		&square{index: 6, pvals: intset{3, 4}},
-		&square{index: 7, pvals: intset{1, 2, 4}},
-		&square{index: 8, pvals: intset{1, 2, 4}},
-		&square{index: 9, pvals: intset{2, 3, 4}},
-		&square{index: 10, pvals: intset{1, 3, 4}},
-		&square{index: 11, pvals: intset{1, 2, 4}},
-		&square{index: 12, pvals: intset{1, 2, 3, 4}},
-		&square{index: 13, pvals: intset{2, 3, 4}},
-		&square{index: 14, pvals: intset{1, 3, 4}},
-		&square{index: 15, pvals: intset{1, 2, 4}},
-		&square{index: 16, pvals: intset{1, 2, 3, 4}},
+		&square{index: 4, pvals: newValueset(4)},
+		&square{index: 5, pvals: newValueset(3, 4)},
+		&square{index: 6, pvals: newValueset(3, 4)},
+		&square{index: 7, pvals: newValueset(1, 2, 4)},
+		&square{index: 8, pvals: newValueset(1, 2, 4)},
+		&square{index: 9, pvals: newValueset(2, 3, 4)},
+		&square{index: 10, pvals: newValueset(1, 3, 4)},
+		&square{index: 11, pvals: newValueset(1, 2, 4)},
+		&square{index: 12, pvals: newValueset(1, 2, 3, 4)},
+		&square{index: 13, pvals: newValueset(2, 3, 4)},
+		&square{index: 14, pvals: newValueset(1, 3, 4)},
+		&square{index: 15, pvals: newValueset(1, 2, 4)},
+		&square{index: 16, pvals: newValueset(1, 2, 3, 4)},
 	}
 	conflicting4Puzzle1 = []int{
 		1, 0, 0, 0,
@@ -1139,258 +1142,6 @@ func TestIntsetRemove(t *testing.T) {
 	}
 }
 
-type intsetSubtractTestcase struct {
-	starter    intset
-	marker     int
-	tosubtract intset
-	remaining  intset
-	removed    bool
-	gotmarker  bool
-}
-
-func TestIntsetSubtract(t *testing.T) {
-	testcases := []intsetSubtractTestcase{
-		intsetSubtractTestcase{ // input equal to target
-			newIntsetRange(9), 0,
-			newIntsetRange(9),
-			intset{},
-			true, false,
-		},
-		intsetSubtractTestcase{ // input overlaps target
-			newIntsetRange(9), -1,
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{1, 2, 5, 7, 8},
-			true, false,
-		},
-		intsetSubtractTestcase{ // input subset of target
-			newIntsetRange(9), 0,
-			intset{2, 5, 7, 8},
-			intset{1, 3, 4, 6, 9},
-			true, false,
-		},
-		intsetSubtractTestcase{ // input overlaps and disjoint from target
-			intset{3, 4, 6, 8}, 0,
-			intset{1, 2, 5, 7, 9},
-			intset{3, 4, 6, 8},
-			false, false,
-		},
-		intsetSubtractTestcase{ // input internal to and disjoint from target
-			intset{1, 4, 6, 9}, 0,
-			intset{2, 3, 5, 7, 8},
-			intset{1, 4, 6, 9},
-			false, false,
-		},
-		intsetSubtractTestcase{ // input leaves just one possible, which is marker
-			intset{3, 4, 6, 9}, 6,
-			intset{1, 2, 3, 4, 5, 7, 8, 9},
-			intset{6},
-			true, false,
-		},
-		// same tests using larger squares
-		intsetSubtractTestcase{ // input equal to target
-			newIntsetRange(16), 0,
-			newIntsetRange(16),
-			intset{},
-			true, false,
-		},
-		intsetSubtractTestcase{ // input overlaps target
-			newIntsetRange(16), -1,
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
-			true, false,
-		},
-		intsetSubtractTestcase{ // input subset of target
-			newIntsetRange(16), 0,
-			intset{2, 5, 7, 8, 10, 11, 14},
-			intset{1, 3, 4, 6, 9, 12, 13, 15, 16},
-			true, false,
-		},
-		intsetSubtractTestcase{ // input overlaps and disjoint from target
-			intset{3, 4, 6, 8, 10, 15}, 0,
-			intset{1, 2, 5, 7, 9, 11, 13, 16},
-			intset{3, 4, 6, 8, 10, 15},
-			false, false,
-		},
-		intsetSubtractTestcase{ // input internal to and disjoint from target
-			intset{1, 4, 6, 9, 12, 13, 15, 16}, 0,
-			intset{2, 3, 5, 7, 8, 10, 11, 14},
-			intset{1, 4, 6, 9, 12, 13, 15, 16},
-			false, false,
-		},
-		intsetSubtractTestcase{ // input leaves just one possible, which is marker
-			intset{3, 4, 6, 9, 12, 13, 15, 16}, 16,
-			intset{1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 13, 15},
-			intset{16},
-			true, false,
-		},
-		// marker tests
-		intsetSubtractTestcase{ // marker at start
-			newIntsetRange(9), 1,
-			intset{1, 3, 5},
-			intset{2, 4, 6, 7, 8, 9},
-			true, true,
-		},
-		intsetSubtractTestcase{ // marker in middle
-			newIntsetRange(9), 3,
-			intset{1, 3, 5},
-			intset{2, 4, 6, 7, 8, 9},
-			true, true,
-		},
-		intsetSubtractTestcase{ // marker at end
-			newIntsetRange(9), 9,
-			intset{1, 3, 9},
-			intset{2, 4, 5, 6, 7, 8},
-			true, true,
-		},
-		intsetSubtractTestcase{ // marker in input but not target
-			intset{1, 5, 9}, 3,
-			intset{1, 3, 9},
-			intset{5},
-			true, false,
-		},
-	}
-	for _, tc := range testcases {
-		// dup input to preserve test case for error messages
-		input := newIntsetCopy(tc.starter)
-		removed, gotmarker := input.subtract(tc.tosubtract, tc.marker)
-		if !reflect.DeepEqual(input, tc.remaining) {
-			t.Errorf("intset.remove(%v, %d) from %v left %v not %v",
-				tc.tosubtract, tc.marker, tc.starter, input, tc.remaining)
-		}
-		if removed != tc.removed || gotmarker != tc.gotmarker {
-			t.Errorf("intset.remove(%v, %d) from %v returned (%v, %v) not (%v, %v)",
-				tc.tosubtract, tc.marker, tc.starter,
-				removed, tc.removed, gotmarker, tc.gotmarker)
-		}
-	}
-}
-
-type intsetIntersectTestcase struct {
-	starter   intset
-	marker    int
-	tokeep    intset
-	remaining intset
-	removed   bool
-	gotmarker bool
-}
-
-func TestIntsetIntersect(t *testing.T) {
-	testcases := []intsetIntersectTestcase{
-		intsetIntersectTestcase{ // input equal to target
-			newIntsetRange(9), 0,
-			newIntsetRange(9),
-			newIntsetRange(9),
-			false, false,
-		},
-		intsetIntersectTestcase{ // input overlaps target
-			newIntsetRange(9), -1,
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{3, 4, 6, 9},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input subset of target
-			newIntsetRange(9), 0,
-			intset{2, 5, 7, 8},
-			intset{2, 5, 7, 8},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input internal to and disjoint from target
-			intset{3, 4, 6, 8}, 0,
-			intset{1, 2, 5, 7, 9},
-			intset{},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input overlaps and disjoint from target
-			intset{1, 4, 6, 9}, 0,
-			intset{2, 3, 5, 7, 8},
-			intset{},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input leaves just one possible, which is marker
-			intset{3, 4, 6, 9}, 6,
-			intset{1, 6, 12},
-			intset{6},
-			true, false,
-		},
-		// same tests using larger squares
-		intsetIntersectTestcase{ // input equal to target
-			newIntsetRange(16), 0,
-			newIntsetRange(16),
-			newIntsetRange(16),
-			false, false,
-		},
-		intsetIntersectTestcase{ // input overlaps target
-			newIntsetRange(16), -1,
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input subset of target
-			newIntsetRange(16), 0,
-			intset{2, 5, 7, 8, 10, 11, 14},
-			intset{2, 5, 7, 8, 10, 11, 14},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input internal to and disjoint from target
-			intset{3, 4, 6, 8, 10, 15}, 0,
-			intset{1, 2, 5, 7, 9, 11, 13, 16},
-			intset{},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input overlaps and disjoint from target
-			intset{1, 4, 6, 9, 12, 13, 15, 16}, 0,
-			intset{2, 3, 5, 7, 8, 10, 11, 14},
-			intset{},
-			true, false,
-		},
-		intsetIntersectTestcase{ // input leaves just one possible, which is marker
-			intset{3, 4, 6, 9, 12, 13, 15, 16}, 16,
-			intset{1, 5, 14, 16, 17, 19},
-			intset{16},
-			true, false,
-		},
-		// marker tests
-		intsetIntersectTestcase{ // marker at start
-			newIntsetRange(9), 1,
-			intset{2, 3, 5},
-			intset{2, 3, 5},
-			true, true,
-		},
-		intsetIntersectTestcase{ // marker in middle
-			newIntsetRange(9), 3,
-			intset{0, 1, 4, 5},
-			intset{1, 4, 5},
-			true, true,
-		},
-		intsetIntersectTestcase{ // marker at end (tail past intersection)
-			newIntsetRange(9), 9,
-			intset{1, 3, 6},
-			intset{1, 3, 6},
-			true, true,
-		},
-		intsetIntersectTestcase{ // marker in input but not target
-			intset{1, 5, 6, 9}, 3,
-			intset{1, 3, 5, 9},
-			intset{1, 5, 9},
-			true, false,
-		},
-	}
-	for _, tc := range testcases {
-		// dup input to preserve test case for error messages
-		input := newIntsetCopy(tc.starter)
-		removed, gotmarker := input.intersect(tc.tokeep, tc.marker)
-		if !reflect.DeepEqual(input, tc.remaining) {
-			t.Errorf("intset.intersect(%v, %d) from %v left %v not %v",
-				tc.tokeep, tc.marker, tc.starter, input, tc.remaining)
-		}
-		if removed != tc.removed || gotmarker != tc.gotmarker {
-			t.Errorf("intset.intersect(%v, %d) from %v returned (%v, %v) not (%v, %v)",
-				tc.tokeep, tc.marker, tc.starter,
-				removed, tc.removed, gotmarker, tc.gotmarker)
-		}
-	}
-}
-
 type intsetRemoveBenchcase struct {
 	starter  intset
 	toremove int
@@ -1441,51 +1192,162 @@ func BenchmarkIntsetRemove(b *testing.B) {
 	}
 }
 
-type intsetSubtractBenchcase struct {
-	starter    intset
-	tosubtract intset
+/*
+
+Value sets
+
+*/
+
+func TestValuesetRange(t *testing.T) {
+	testcases := []struct {
+		max  int
+		vals intset
+	}{
+		{-1, intset{}},
+		{0, intset{}},
+		{1, intset{1}},
+		{4, intset{1, 2, 3, 4}},
+		{maxSetValue, newIntsetRange(maxSetValue)},
+	}
+	for _, tc := range testcases {
+		vs := newValuesetRange(tc.max)
+		if vals := vs.values(); !reflect.DeepEqual(vals, tc.vals) {
+			t.Errorf("newValuesetRange(%d) has values %v (expected %v)", tc.max, vals, tc.vals)
+		}
+		if vs.len() != len(tc.vals) {
+			t.Errorf("newValuesetRange(%d) has length %d (expected %d)", tc.max, vs.len(), len(tc.vals))
+		}
+	}
 }
 
-func BenchmarkIntsetSubtractMulti(b *testing.B) {
-	testcases := []intsetSubtractBenchcase{
-		intsetSubtractBenchcase{
-			newIntsetRange(9),
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-		},
-		intsetSubtractBenchcase{
-			newIntsetRange(9),
-			intset{1, 2, 5, 7, 8},
-		},
-		intsetSubtractBenchcase{
-			intset{3, 4, 6, 9},
-			intset{1, 2, 3, 4, 5, 7, 8, 9},
-		},
-		intsetSubtractBenchcase{
-			intset{3, 4, 6, 9},
-			intset{1, 2, 3, 4, 5, 6, 7, 8},
-		},
-		intsetSubtractBenchcase{
-			newIntsetRange(16),
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-		},
-		intsetSubtractBenchcase{
-			newIntsetRange(16),
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
-		},
-		intsetSubtractBenchcase{
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
-			intset{1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 13, 15},
-		},
-		intsetSubtractBenchcase{
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
-			intset{1, 2, 4, 5, 6, 7, 8, 9, 12, 13, 15, 16},
-		},
+func TestValuesetInsertRemove(t *testing.T) {
+	var vs valueset
+	for _, v := range []int{5, 1, maxSetValue, 26} {
+		if vs.insert(v) {
+			t.Errorf("%v.insert(%d) found the value", vs, v)
+		}
+		if !vs.insert(v) {
+			t.Errorf("%v.insert(%d) didn't find the value", vs, v)
+		}
+	}
+	if vals := vs.values(); !reflect.DeepEqual(vals, intset{1, 5, 26, maxSetValue}) {
+		t.Errorf("Inserted values are %v", vals)
+	}
+	if s := vs.String(); s != fmt.Sprint([]int{1, 5, 26, maxSetValue}) {
+		t.Errorf("Inserted values print as %q", s)
+	}
+	for _, v := range []int{0, 2, maxSetValue + 1} {
+		if vs.has(v) || vs.remove(v) {
+			t.Errorf("%v has %d", vs, v)
+		}
+	}
+	for _, v := range []int{5, maxSetValue} {
+		if !vs.remove(v) || vs.has(v) {
+			t.Errorf("%v.remove(%d) failed", vs, v)
+		}
+	}
+	if vs != newValueset(1, 26) {
+		t.Errorf("Remaining values are %v", vs)
+	}
+}
+
+func TestValuesetNextPrev(t *testing.T) {
+	vs := newValueset(1, 3, 9, 33, maxSetValue)
+	var nexts, prevs intset
+	for v := vs.next(0); v != 0; v = vs.next(v) {
+		nexts = append(nexts, v)
+	}
+	for v := vs.prev(maxSetValue + 1); v != 0; v = vs.prev(v) {
+		prevs = append(prevs, v)
+	}
+	if !reflect.DeepEqual(nexts, intset{1, 3, 9, 33, maxSetValue}) {
+		t.Errorf("Values in increasing order are %v", nexts)
+	}
+	if !reflect.DeepEqual(prevs, intset{maxSetValue, 33, 9, 3, 1}) {
+		t.Errorf("Values in decreasing order are %v", prevs)
+	}
+	if v := valueset(0).next(0); v != 0 {
+		t.Errorf("Empty valueset has a next value %d", v)
+	}
+	if v := valueset(0).prev(maxSetValue + 1); v != 0 {
+		t.Errorf("Empty valueset has a previous value %d", v)
+	}
+}
+
+func TestValuesetOperations(t *testing.T) {
+	testcases := []struct {
+		starter, operand      valueset
+		marker                int
+		subtracted, intersect valueset
+		subRemoved, subMarker bool
+		intRemoved, intMarker bool
+	}{
+		{newValueset(1, 2, 3), newValueset(2), 2, newValueset(1, 3), newValueset(2), true, true, true, false},
+		{newValueset(1, 2, 3), newValueset(2), 1, newValueset(1, 3), newValueset(2), true, false, true, true},
+		{newValueset(1, 2, 3), newValueset(4, 5), 0, newValueset(1, 2, 3), 0, false, false, true, false},
+		{newValueset(1, 2, 3), newValueset(1, 2, 3, 4), 3, 0, newValueset(1, 2, 3), true, true, false, false},
+		{newValuesetRange(16), newValueset(16), 16, newValuesetRange(15), newValueset(16), true, true, true, false},
+	}
+	for i, tc := range testcases {
+		vs := tc.starter
+		removed, marker := vs.subtract(tc.operand, tc.marker)
+		if vs != tc.subtracted || removed != tc.subRemoved || marker != tc.subMarker {
+			t.Errorf("case %d: %v.subtract(%v, %d) gave %v, %v, %v",
+				i+1, tc.starter, tc.operand, tc.marker, vs, removed, marker)
+		}
+		vs = tc.starter
+		removed, marker = vs.intersect(tc.operand, tc.marker)
+		if vs != tc.intersect || removed != tc.intRemoved || marker != tc.intMarker {
+			t.Errorf("case %d: %v.intersect(%v, %d) gave %v, %v, %v",
+				i+1, tc.starter, tc.operand, tc.marker, vs, removed, marker)
+		}
+		if !tc.starter.contains(tc.intersect) || tc.intersect.contains(tc.starter) != (tc.intersect == tc.starter) {
+			t.Errorf("case %d: %v.contains(%v) is wrong", i+1, tc.starter, tc.intersect)
+		}
+	}
+}
+
+func BenchmarkValuesetRemove(b *testing.B) {
+	testcases := []struct {
+		starter  valueset
+		toremove int
+	}{
+		{newValuesetRange(9), 12},
+		{newValuesetRange(9), 1},
+		{newValuesetRange(9), 10},
+		{newValueset(6, 9), 6},
+		{newValuesetRange(16), 16},
+		{newValuesetRange(16), 1},
+		{newValuesetRange(16), 25},
+		{newValueset(3, 16), 16},
 	}
 
 	for i := 0; i < b.N; i++ {
 		for _, tc := range testcases {
-			// dup input intset to preserve test case for next loop
-			input := newIntsetCopy(tc.starter)
+			input := tc.starter
+			input.remove(tc.toremove)
+		}
+	}
+}
+
+func BenchmarkValuesetSubtractMulti(b *testing.B) {
+	testcases := []struct {
+		starter    valueset
+		tosubtract valueset
+	}{
+		{newValuesetRange(9), newValueset(0, 3, 4, 6, 9, 12, 13, 15, 16, 17)},
+		{newValuesetRange(9), newValueset(1, 2, 5, 7, 8)},
+		{newValueset(3, 4, 6, 9), newValueset(1, 2, 3, 4, 5, 7, 8, 9)},
+		{newValueset(3, 4, 6, 9), newValueset(1, 2, 3, 4, 5, 6, 7, 8)},
+		{newValuesetRange(16), newValueset(0, 3, 4, 6, 9, 12, 13, 15, 16, 17)},
+		{newValuesetRange(16), newValueset(1, 2, 5, 7, 8, 10, 11, 14)},
+		{newValueset(3, 4, 6, 9, 12, 13, 15, 16), newValueset(1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 13, 15)},
+		{newValueset(3, 4, 6, 9, 12, 13, 15, 16), newValueset(1, 2, 4, 5, 6, 7, 8, 9, 12, 13, 15, 16)},
+	}
+
+	for i := 0; i < b.N; i++ {
+		for _, tc := range testcases {
+			input := tc.starter
 			input.subtract(tc.tosubtract, -1)
 		}
 	}
@@ -1506,7 +1368,7 @@ func TestNewEmptySquares(t *testing.T) {
 		for _, i := range indices {
 			sq := newEmptySquare(i, s, nil)
 			if sq.index != i || sq.aval != 0 || sq.bval != 0 || sq.bsrc != nil ||
-				!reflect.DeepEqual(sq.pvals, newIntsetRange(s)) {
+				sq.pvals != newValuesetRange(s) {
 				t.Fatalf("newEmptySquare(%d, %d) incorrect: %v", i, s, sq)
 			}
 		}
@@ -1525,7 +1387,7 @@ func TestNewFilledSquares(t *testing.T) {
 				sq := newFilledSquare(i, s, v, nil)
 				if sq.index != i || sq.aval != v ||
 					sq.bval != 0 || sq.bsrc != nil ||
-					sq.pvals != nil {
+					sq.pvals != 0 {
 					t.Fatalf("newFilledSquare(%d, %d, %d) incorrect: %v", i, s, v, sq)
 				}
 			}
@@ -1548,12 +1410,12 @@ type squareAssignTestcase struct {
 func TestSquareAssign(t *testing.T) {
 	errcases := []squareAssignErrcase{
 		squareAssignErrcase{
-			&square{index: 2, pvals: intset{3, 4, 5, 7}, bval: 4, bsrc: helperBsrc(5)},
+			&square{index: 2, pvals: newValueset(3, 4, 5, 7), bval: 4, bsrc: helperBsrc(5)},
 			3,
 			NoGroupValueCondition,
 		},
 		squareAssignErrcase{
-			&square{index: 1, pvals: intset{3, 5}},
+			&square{index: 1, pvals: newValueset(3, 5)},
 			4,
 			NotInSetCondition,
 		},
@@ -1571,27 +1433,27 @@ func TestSquareAssign(t *testing.T) {
 
 	testcases := []squareAssignTestcase{
 		squareAssignTestcase{ // one in the middle
-			&square{index: 1, pvals: intset{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+			&square{index: 1, pvals: newValueset(1, 2, 3, 4, 5, 6, 7, 8, 9)},
 			4,
 			nil,
 		},
 		squareAssignTestcase{ // one at the end
-			&square{index: 2, pvals: intset{3, 4, 6, 9}},
+			&square{index: 2, pvals: newValueset(3, 4, 6, 9)},
 			9,
 			nil,
 		},
 		squareAssignTestcase{ // one at the beginning
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newValueset(3, 4, 6, 9)},
 			3,
 			nil,
 		},
 		squareAssignTestcase{ // one already bound, with a binding source
-			&square{index: 4, pvals: intset{7, 9}, bval: 9, bsrc: helperBsrc(4)},
+			&square{index: 4, pvals: newValueset(7, 9), bval: 9, bsrc: helperBsrc(4)},
 			9,
 			helperBsrc(4),
 		},
 		squareAssignTestcase{ // one already bound, with a double binding source
-			&square{index: 5, pvals: intset{3, 5, 9}, bval: 9, bsrc: helperBsrc(1, 10)},
+			&square{index: 5, pvals: newValueset(3, 5, 9), bval: 9, bsrc: helperBsrc(1, 10)},
 			9,
 			helperBsrc(1, 10),
 		},
@@ -1607,7 +1469,7 @@ func TestSquareAssign(t *testing.T) {
 			t.Errorf("Assigning %v to %v gave assignment %v",
 				tc.toassign, *tc.square, input.aval)
 		}
-		if input.pvals != nil {
+		if input.pvals != 0 {
 			t.Errorf("Assigning %v to %v gave pvals %v",
 				tc.toassign, *tc.square, input.pvals)
 		}
@@ -1635,17 +1497,17 @@ type squareBindTestcase struct {
 func TestSquareBind(t *testing.T) {
 	errcases := []squareBindErrcase{
 		squareBindErrcase{
-			&square{index: 2, bval: 4, bsrc: helperBsrc(6), pvals: intset{3, 4, 5, 6}},
+			&square{index: 2, bval: 4, bsrc: helperBsrc(6), pvals: newValueset(3, 4, 5, 6)},
 			3, helperGID(102),
 			NoGroupValueCondition,
 		},
 		squareBindErrcase{
-			&square{index: 3, pvals: intset{3, 5}},
+			&square{index: 3, pvals: newValueset(3, 5)},
 			4, helperGID(103),
 			NotInSetCondition,
 		},
 		squareBindErrcase{
-			&square{index: 4, pvals: intset{5}},
+			&square{index: 4, pvals: newValueset(5)},
 			4, helperGID(103),
 			NotInSetCondition,
 		},
@@ -1663,32 +1525,32 @@ func TestSquareBind(t *testing.T) {
 
 	testcases := []squareBindTestcase{
 		squareBindTestcase{ // one in the middle
-			&square{index: 1, pvals: intset{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+			&square{index: 1, pvals: newValueset(1, 2, 3, 4, 5, 6, 7, 8, 9)},
 			4, helperGID(101),
 			helperBsrc(101),
 		},
 		squareBindTestcase{ // one at the end
-			&square{index: 2, pvals: intset{3, 4, 6, 9}},
+			&square{index: 2, pvals: newValueset(3, 4, 6, 9)},
 			9, helperGID(102),
 			helperBsrc(102),
 		},
 		squareBindTestcase{ // one at the beginning
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newValueset(3, 4, 6, 9)},
 			3, helperGID(103),
 			helperBsrc(103),
 		},
 		squareBindTestcase{ // one already bound, with a binding source
-			&square{index: 4, bval: 9, pvals: intset{7, 9}, bsrc: helperBsrc(7)},
+			&square{index: 4, bval: 9, pvals: newValueset(7, 9), bsrc: helperBsrc(7)},
 			9, helperGID(6),
 			helperBsrc(7, 6),
 		},
 		squareBindTestcase{ // one already bound, with a double binding source
-			&square{index: 6, pvals: intset{3, 5, 9}, bval: 9, bsrc: helperBsrc(4, 7)},
+			&square{index: 6, pvals: newValueset(3, 5, 9), bval: 9, bsrc: helperBsrc(4, 7)},
 			9, helperGID(8),
 			helperBsrc(4, 7, 8),
 		},
 		squareBindTestcase{ // one with a single value
-			&square{index: 7, pvals: intset{1}},
+			&square{index: 7, pvals: newValueset(1)},
 			1, helperGID(1),
 			helperBsrc(1),
 		},
@@ -1738,7 +1600,7 @@ func TestSquareRemove(t *testing.T) {
 			NoGroupValueCondition,
 		},
 		squareRemoveErrcase{
-			&square{index: 3, pvals: intset{6}},
+			&square{index: 3, pvals: newValueset(6)},
 			6,
 			NoPossibleValuesCondition,
 		},
@@ -1762,19 +1624,19 @@ func TestSquareRemove(t *testing.T) {
 			0, nil,
 		},
 		squareRemoveTestcase{ // input not present
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newValueset(3, 4, 6, 9)},
 			2,
 			intset{3, 4, 6, 9},
 			0, nil,
 		},
 		squareRemoveTestcase{ // input leaves just one possible
-			&square{index: 4, pvals: intset{6, 9}},
+			&square{index: 4, pvals: newValueset(6, 9)},
 			9,
 			intset{6},
 			0, nil,
 		},
 		squareRemoveTestcase{ // reduce to already bound
-			&square{index: 105, pvals: intset{3, 12}, bval: 3, bsrc: helperBsrc(5)},
+			&square{index: 105, pvals: newValueset(3, 12), bval: 3, bsrc: helperBsrc(5)},
 			12,
 			intset{3},
 			3, helperBsrc(5),
@@ -1787,7 +1649,7 @@ func TestSquareRemove(t *testing.T) {
 		if e != nil {
 			t.Fatalf("Removing %v from %v produced error %v", tc.toremove, tc.square, e)
 		}
-		if !reflect.DeepEqual(input.pvals, tc.remaining) {
+		if !reflect.DeepEqual(input.pvals.values(), tc.remaining) {
 			t.Errorf("Removing %v from %v left %v not %v",
 				tc.toremove, *tc.square, input.pvals, tc.remaining)
 		}
@@ -1800,14 +1662,14 @@ func TestSquareRemove(t *testing.T) {
 
 type squareSubtractErrcase struct {
 	square     *square
-	tosubtract intset
+	tosubtract valueset
 	cond       ErrorCondition
 }
 
 type squareSubtractTestcase struct {
 	square     *square
-	tosubtract intset
-	remaining  intset
+	tosubtract valueset
+	remaining  valueset
 	bval       int
 	bsrc       []GroupID
 }
@@ -1816,12 +1678,12 @@ func TestSquareSubtract(t *testing.T) {
 	errcases := []squareSubtractErrcase{
 		squareSubtractErrcase{
 			helperBindSquare(newEmptySquare(2, 9, nil), 5, helperGID(2)),
-			intset{1, 3, 5},
+			newValueset(1, 3, 5),
 			NoGroupValueCondition,
 		},
 		squareSubtractErrcase{
-			&square{index: 3, pvals: intset{3, 5}},
-			intset{1, 3, 5},
+			&square{index: 3, pvals: newValueset(3, 5)},
+			newValueset(1, 3, 5),
 			NoPossibleValuesCondition,
 		},
 	}
@@ -1839,58 +1701,58 @@ func TestSquareSubtract(t *testing.T) {
 	testcases := []squareSubtractTestcase{
 		squareSubtractTestcase{ // input larger than range
 			newEmptySquare(1, 9, nil),
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{1, 2, 5, 7, 8},
+			newValueset(0, 3, 4, 6, 9, 12, 13, 15, 16, 17),
+			newValueset(1, 2, 5, 7, 8),
 			0, nil,
 		},
 		squareSubtractTestcase{ // input subset of empty square
 			newEmptySquare(2, 9, nil),
-			intset{1, 2, 5, 7, 8},
-			intset{3, 4, 6, 9},
+			newValueset(1, 2, 5, 7, 8),
+			newValueset(3, 4, 6, 9),
 			0, nil,
 		},
 		squareSubtractTestcase{ // input disjoint from range
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
-			intset{1, 2, 5, 7, 8},
-			intset{3, 4, 6, 9},
+			&square{index: 3, pvals: newValueset(3, 4, 6, 9)},
+			newValueset(1, 2, 5, 7, 8),
+			newValueset(3, 4, 6, 9),
 			0, nil,
 		},
 		squareSubtractTestcase{ // input leaves just one possible
-			&square{index: 4, pvals: intset{3, 4, 6, 9}},
-			intset{1, 2, 3, 4, 5, 7, 8, 9},
-			intset{6},
+			&square{index: 4, pvals: newValueset(3, 4, 6, 9)},
+			newValueset(1, 2, 3, 4, 5, 7, 8, 9),
+			newValueset(6),
 			0, nil,
 		},
 		squareSubtractTestcase{ // reduce to already bound
-			&square{index: 105, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16},
+			&square{index: 105, pvals: newValueset(3, 4, 6, 9, 12, 13, 15, 16),
 				bval: 3, bsrc: helperBsrc(9)},
-			intset{1, 2, 4, 5, 6, 7, 8, 9, 12, 13, 15, 16},
-			intset{3},
+			newValueset(1, 2, 4, 5, 6, 7, 8, 9, 12, 13, 15, 16),
+			newValueset(3),
 			3, helperBsrc(9),
 		},
 		// same first four tests using larger squares
 		squareSubtractTestcase{ // input larger than range
 			newEmptySquare(101, 16, nil),
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
+			newValueset(0, 3, 4, 6, 9, 12, 13, 15, 16, 17),
+			newValueset(1, 2, 5, 7, 8, 10, 11, 14),
 			0, nil,
 		},
 		squareSubtractTestcase{ // input subset of empty square
 			newEmptySquare(102, 16, nil),
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
+			newValueset(1, 2, 5, 7, 8, 10, 11, 14),
+			newValueset(3, 4, 6, 9, 12, 13, 15, 16),
 			0, nil,
 		},
 		squareSubtractTestcase{ // input disjoint from range
-			&square{index: 103, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
+			&square{index: 103, pvals: newValueset(3, 4, 6, 9, 12, 13, 15, 16)},
+			newValueset(1, 2, 5, 7, 8, 10, 11, 14),
+			newValueset(3, 4, 6, 9, 12, 13, 15, 16),
 			0, nil,
 		},
 		squareSubtractTestcase{ // input leaves just one possible
-			&square{index: 104, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
-			intset{1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 13, 15},
-			intset{16},
+			&square{index: 104, pvals: newValueset(3, 4, 6, 9, 12, 13, 15, 16)},
+			newValueset(1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 13, 15),
+			newValueset(16),
 			0, nil,
 		},
 	}
@@ -1914,14 +1776,14 @@ func TestSquareSubtract(t *testing.T) {
 
 type squareIntersectErrcase struct {
 	square      *square
-	tointersect intset
+	tointersect valueset
 	cond        ErrorCondition
 }
 
 type squareIntersectTestcase struct {
 	square      *square
-	tointersect intset
-	remaining   intset
+	tointersect valueset
+	remaining   valueset
 	bval        int
 	bsrc        []GroupID
 }
@@ -1930,12 +1792,12 @@ func TestSquareIntersect(t *testing.T) {
 	errcases := []squareIntersectErrcase{
 		squareIntersectErrcase{
 			helperBindSquare(newEmptySquare(2, 9, nil), 5, helperGID(2)),
-			intset{1, 3},
+			newValueset(1, 3),
 			NoGroupValueCondition,
 		},
 		squareIntersectErrcase{
-			&square{index: 3, pvals: intset{3, 5}},
-			intset{1, 2, 4},
+			&square{index: 3, pvals: newValueset(3, 5)},
+			newValueset(1, 2, 4),
 			NoPossibleValuesCondition,
 		},
 	}
@@ -1954,58 +1816,58 @@ func TestSquareIntersect(t *testing.T) {
 	testcases := []squareIntersectTestcase{
 		squareIntersectTestcase{ // input larger than range
 			newEmptySquare(1, 9, nil),
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{3, 4, 6, 9},
+			newValueset(0, 3, 4, 6, 9, 12, 13, 15, 16, 17),
+			newValueset(3, 4, 6, 9),
 			0, nil,
 		},
 		squareIntersectTestcase{ // input subset of empty square
 			newEmptySquare(2, 9, nil),
-			intset{1, 2, 5, 7, 8},
-			intset{1, 2, 5, 7, 8},
+			newValueset(1, 2, 5, 7, 8),
+			newValueset(1, 2, 5, 7, 8),
 			0, nil,
 		},
 		squareIntersectTestcase{ // input equal to range
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
-			intset{3, 4, 6, 9},
-			intset{3, 4, 6, 9},
+			&square{index: 3, pvals: newValueset(3, 4, 6, 9)},
+			newValueset(3, 4, 6, 9),
+			newValueset(3, 4, 6, 9),
 			0, nil,
 		},
 		squareIntersectTestcase{ // input leaves just one possible
-			&square{index: 4, pvals: intset{3, 4, 6, 9}},
-			intset{6},
-			intset{6},
+			&square{index: 4, pvals: newValueset(3, 4, 6, 9)},
+			newValueset(6),
+			newValueset(6),
 			0, nil,
 		},
 		squareIntersectTestcase{ // reduce to already bound
-			&square{index: 105, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16},
+			&square{index: 105, pvals: newValueset(3, 4, 6, 9, 12, 13, 15, 16),
 				bval: 3, bsrc: helperBsrc(105)},
-			intset{3},
-			intset{3},
+			newValueset(3),
+			newValueset(3),
 			3, helperBsrc(105),
 		},
 		// same first four tests using larger squares
 		squareIntersectTestcase{ // input larger than range
 			newEmptySquare(101, 16, nil),
-			intset{0, 3, 4, 6, 9, 12, 13, 15, 16, 17},
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
+			newValueset(0, 3, 4, 6, 9, 12, 13, 15, 16, 17),
+			newValueset(3, 4, 6, 9, 12, 13, 15, 16),
 			0, nil,
 		},
 		squareIntersectTestcase{ // input subset of empty square
 			newEmptySquare(102, 16, nil),
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
-			intset{1, 2, 5, 7, 8, 10, 11, 14},
+			newValueset(1, 2, 5, 7, 8, 10, 11, 14),
+			newValueset(1, 2, 5, 7, 8, 10, 11, 14),
 			0, nil,
 		},
 		squareIntersectTestcase{ // input equal to range
-			&square{index: 103, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
-			intset{3, 4, 6, 9, 12, 13, 15, 16},
+			&square{index: 103, pvals: newValueset(3, 4, 6, 9, 12, 13, 15, 16)},
+			newValueset(3, 4, 6, 9, 12, 13, 15, 16),
+			newValueset(3, 4, 6, 9, 12, 13, 15, 16),
 			0, nil,
 		},
 		squareIntersectTestcase{ // input leaves just one possible
-			&square{index: 104, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
-			intset{16},
-			intset{16},
+			&square{index: 104, pvals: newValueset(3, 4, 6, 9, 12, 13, 15, 16)},
+			newValueset(16),
+			newValueset(16),
 			0, nil,
 		},
 	}
@@ -2052,7 +1914,7 @@ type newGroupTestcase struct {
 	gindex  int
 	vals    []int
 	where   []int
-	need    intset
+	need    valueset
 	empty   intset
 }
 
@@ -2078,7 +1940,7 @@ func TestNewGroup(t *testing.T) {
 				nil,
 				newFilledSquare(1, 4, 1, nil),
 				newFilledSquare(2, 4, 2, nil),
-				&square{index: 3, pvals: intset{1, 2}},
+				&square{index: 3, pvals: newValueset(1, 2)},
 				newEmptySquare(4, 4, nil),
 			},
 			NotInSetCondition,
@@ -2107,32 +1969,32 @@ func TestNewGroup(t *testing.T) {
 		newGroupTestcase{ // first 2 of 4 assigned, no other info
 			"test 1", 4, GtypeRow, 1,
 			[]int{1, 2, 0, 0},
-			[]int{0, 1, 2, 0, 0}, intset{3, 4}, intset{3, 4},
+			[]int{0, 1, 2, 0, 0}, newValueset(3, 4), intset{3, 4},
 		},
 		newGroupTestcase{ // first 3 of 4 assigned, forces last via removal
 			"test 2", 4, GtypeRow, 1,
 			[]int{1, 2, 3, 0},
-			[]int{0, 1, 2, 3, 0}, intset{4}, intset{4},
+			[]int{0, 1, 2, 3, 0}, newValueset(4), intset{4},
 		},
 		newGroupTestcase{ // last 2 of 4 assigned, no other info
 			"test 3", 4, GtypeRow, 1,
 			[]int{0, 0, 3, 4},
-			[]int{0, 0, 0, 3, 4}, intset{1, 2}, intset{1, 2},
+			[]int{0, 0, 0, 3, 4}, newValueset(1, 2), intset{1, 2},
 		},
 		newGroupTestcase{ // 2 of 4 assigned out of order, with a gap
 			"test 4", 4, GtypeRow, 1,
 			[]int{0, 4, 0, 3},
-			[]int{0, 0, 0, 4, 2}, intset{1, 2}, intset{1, 3},
+			[]int{0, 0, 0, 4, 2}, newValueset(1, 2), intset{1, 3},
 		},
 		newGroupTestcase{ // 1 of 4 assigned out of order
 			"test 5", 4, GtypeRow, 1,
 			[]int{0, 0, 0, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newValueset(1, 2, 4), intset{1, 2, 3},
 		},
 		newGroupTestcase{ // 1 of 4 assigned, the other three reduced
 			"test 6", 4, GtypeRow, 1,
 			[]int{-2, -1, -4, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newValueset(1, 2, 4), intset{1, 2, 3},
 		},
 	}
 	for _, tc := range testcases {
@@ -2162,7 +2024,7 @@ type groupAnalyzeTestcase struct {
 	gindex  int
 	vals    []int
 	where   []int
-	need    intset
+	need    valueset
 	empty   intset
 	bs      []binding
 }
@@ -2183,8 +2045,8 @@ func TestGroupAnalyze(t *testing.T) {
 				nil,
 				newFilledSquare(1, 4, 2, nil),
 				newFilledSquare(2, 4, 1, nil),
-				&square{index: 3, pvals: intset{1, 3}},
-				&square{index: 4, pvals: intset{2, 3}},
+				&square{index: 3, pvals: newValueset(1, 3)},
+				&square{index: 4, pvals: newValueset(2, 3)},
 			},
 			NoGroupValueCondition,
 		},
@@ -2194,8 +2056,8 @@ func TestGroupAnalyze(t *testing.T) {
 				nil,
 				newFilledSquare(1, 4, 2, nil),
 				newFilledSquare(2, 4, 1, nil),
-				&square{index: 3, pvals: intset{1, 3}},
-				&square{index: 4, pvals: intset{3, 4}, bval: 3, bsrc: helperBsrc(2)},
+				&square{index: 3, pvals: newValueset(1, 3)},
+				&square{index: 4, pvals: newValueset(3, 4), bval: 3, bsrc: helperBsrc(2)},
 			},
 			NoGroupValueCondition,
 		},
@@ -2204,9 +2066,9 @@ func TestGroupAnalyze(t *testing.T) {
 			[]*square{
 				nil,
 				newFilledSquare(1, 4, 2, nil),
-				&square{index: 2, pvals: intset{3, 4}, bval: 3, bsrc: helperBsrc(2)},
-				&square{index: 3, pvals: intset{3}},
-				&square{index: 4, pvals: intset{1, 4}},
+				&square{index: 2, pvals: newValueset(3, 4), bval: 3, bsrc: helperBsrc(2)},
+				&square{index: 3, pvals: newValueset(3)},
+				&square{index: 4, pvals: newValueset(1, 4)},
 			},
 			DuplicateGroupValuesCondition,
 		},
@@ -2226,49 +2088,49 @@ func TestGroupAnalyze(t *testing.T) {
 		groupAnalyzeTestcase{ // first 2 of 4 assigned, no other info
 			"test 1", 4, GtypeRow, 1,
 			[]int{2, 1, 0, 0},
-			[]int{0, 2, 1, 0, 0}, intset{3, 4}, intset{3, 4},
+			[]int{0, 2, 1, 0, 0}, newValueset(3, 4), intset{3, 4},
 			nil,
 		},
 		groupAnalyzeTestcase{ // first 3 of 4 assigned, forces last
 			"test 2", 4, GtypeRow, 1,
 			[]int{3, 2, 1, 0},
-			[]int{0, 3, 2, 1, 0}, intset{}, intset{},
+			[]int{0, 3, 2, 1, 0}, newValueset(), intset{},
 			nil,
 		},
 		groupAnalyzeTestcase{ // last 2 of 4 assigned, no other info
 			"test 3", 4, GtypeRow, 1,
 			[]int{0, 0, 4, 3},
-			[]int{0, 0, 0, 4, 3}, intset{1, 2}, intset{1, 2},
+			[]int{0, 0, 0, 4, 3}, newValueset(1, 2), intset{1, 2},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 2 of 4 assigned, with a gap
 			"test 4", 4, GtypeRow, 1,
 			[]int{0, 3, 0, 1},
-			[]int{0, 4, 0, 2, 0}, intset{2, 4}, intset{1, 3},
+			[]int{0, 4, 0, 2, 0}, newValueset(2, 4), intset{1, 3},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 1 of 4 assigned
 			"test 5", 4, GtypeRow, 1,
 			[]int{0, 0, 0, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newValueset(1, 2, 4), intset{1, 2, 3},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 1 of 4 assigned, the other three reduced
 			"test 6", 4, GtypeRow, 1,
 			[]int{-2, -1, -4, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newValueset(1, 2, 4), intset{1, 2, 3},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 2 of 4 assigned, reduction forces binding
 			"test 7", 4, GtypeRow, 1,
 			[]int{0, 4, -1, 2},
-			[]int{0, 0, 4, 0, 2}, intset{}, intset{},
+			[]int{0, 0, 4, 0, 2}, newValueset(), intset{},
 			[]binding{binding{1, 1, helperBsrc(0 + 1)}},
 		},
 		groupAnalyzeTestcase{ // like the prior one, but a tile instead.
 			"test 8", 4, GtypeTile, 2,
 			[]int{0, 4, -1, 2},
-			[]int{0, 0, 8, 0, 4}, intset{}, intset{},
+			[]int{0, 0, 8, 0, 4}, newValueset(), intset{},
 			[]binding{binding{3, 1, helperBsrc(8 + 2)}},
 		},
 	}
@@ -2448,7 +2310,7 @@ func TestGroupAssign(t *testing.T) {
 			s := ss[si]
 			if si == tc.ai {
 				// make sure group noticed the assignment
-				_, needed := g.need.find(tc.av)
+				needed := g.need.has(tc.av)
 				_, free := g.free.find(tc.ai)
 				if g.where[tc.av] != si || needed || free {
 					t.Errorf("groupAssign case %v: assign(%d, %d) didn't take: %v",
@@ -2792,6 +2654,259 @@ func TestNewEmptyRectangular(t *testing.T) {
 	}
 }
 
+func TestNewJigsaw(t *testing.T) {
+	// a region map is required, and must match the values
+	errcases := [][]int{nil, jigsaw6Regions[:35]}
+	for i, regions := range errcases {
+		_, e := New(&Summary{
+			Geometry:   JigsawGeometryName,
+			SideLength: 6,
+			Values:     jigsaw6Values,
+			Regions:    regions,
+		})
+		if e == nil {
+			t.Fatalf("newJigsaw error case %d create didn't fail", i+1)
+		}
+		if err := e.(Error); err.Attribute != RegionsAttribute || err.Condition != WrongPuzzleSizeCondition {
+			t.Errorf("newJigsaw error case %d, create failure wrong error: %v", i+1, e)
+		}
+	}
+	// region map errors are structured geometry errors
+	_, e := New(&Summary{
+		Geometry:   JigsawGeometryName,
+		SideLength: 4,
+		Regions:    []int{1, 1, 2, 2, 1, 3, 2, 2, 3, 1, 4, 4, 3, 3, 4, 4},
+	})
+	if err, ok := e.(Error); !ok || err.Scope != GeometryScope || err.Condition != NonContiguousRegionCondition {
+		t.Errorf("newJigsaw non-contiguous region gave wrong error: %v", e)
+	} else if !reflect.DeepEqual(err.Values, ErrorData{1}) {
+		t.Errorf("newJigsaw non-contiguous region error has wrong values: %v", err.Values)
+	}
+
+	// the region map round-trips through the summary and is
+	// part of the hash
+	s := &Summary{
+		Geometry:   JigsawGeometryName,
+		SideLength: 6,
+		Values:     jigsaw6Values,
+		Regions:    jigsaw6Regions,
+	}
+	p, e := New(s)
+	if e != nil {
+		t.Fatalf("newJigsaw failed: %v", e)
+	}
+	ps := p.summary()
+	if !reflect.DeepEqual(ps.Regions, jigsaw6Regions) {
+		t.Errorf("newJigsaw summary has regions %v, expected %v", ps.Regions, jigsaw6Regions)
+	}
+	if ps.hash() != s.hash() {
+		t.Errorf("newJigsaw puzzle hash (%v) doesn't match summary hash (%v)", ps.hash(), s.hash())
+	}
+	other := make([]int, len(jigsaw6Regions))
+	copy(other, jigsaw6Regions)
+	other[12], other[13] = 4, 1 // swap the region 1 and 4 squares in row 3
+	os := &Summary{
+		Geometry:   JigsawGeometryName,
+		SideLength: 6,
+		Values:     jigsaw6Values,
+		Regions:    other,
+	}
+	if os.hash() == s.hash() {
+		t.Errorf("newJigsaw puzzles with different regions have the same hash: %v", s.hash())
+	}
+	if h, e := (&Summary{
+		Geometry:   JigsawGeometryName,
+		SideLength: 6,
+		Values:     jigsaw6Values,
+		Regions:    jigsaw6Regions[:35],
+	}).Hash(); e == nil {
+		t.Errorf("Hash of summary with short region map didn't fail: %v", h)
+	}
+}
+
+type newKillerErrcase struct {
+	name  string
+	cages []Cage
+	attr  ErrorAttribute
+	cond  ErrorCondition
+}
+
+func TestNewKiller(t *testing.T) {
+	// invalid cages can't be used to create puzzles
+	errcases := []newKillerErrcase{
+		newKillerErrcase{"empty cage", []Cage{Cage{3, nil}},
+			CageAttribute, InvalidArgumentCondition},
+		newKillerErrcase{"big cage", []Cage{Cage{10, []int{1, 2, 3, 4, 5}}},
+			CageAttribute, InvalidArgumentCondition},
+		newKillerErrcase{"repeated index", []Cage{Cage{3, []int{1, 1}}},
+			CageAttribute, InvalidArgumentCondition},
+		newKillerErrcase{"bad index", []Cage{Cage{3, []int{1, 17}}},
+			IndexAttribute, TooLargeCondition},
+		newKillerErrcase{"small sum", []Cage{Cage{2, []int{1, 2}}},
+			CageAttribute, ImpossibleCageSumCondition},
+		newKillerErrcase{"large sum", []Cage{Cage{8, []int{1, 2}}},
+			CageAttribute, ImpossibleCageSumCondition},
+	}
+	for _, ec := range errcases {
+		_, e := New(&Summary{
+			Geometry:   StandardGeometryName,
+			SideLength: 4,
+			Cages:      ec.cages,
+		})
+		if e == nil {
+			t.Fatalf("newKiller case %s create didn't fail", ec.name)
+		}
+		if err := e.(Error); err.Attribute != ec.attr || err.Condition != ec.cond {
+			t.Errorf("newKiller case %s, create failure wrong error: %v", ec.name, e)
+		}
+	}
+
+	// cages constrain the possible values of their squares
+	p, e := New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Cages:      killer4Cages,
+	})
+	if e != nil {
+		t.Fatalf("newKiller failed: %v", e)
+	}
+	if pvals := p.squares[1].pvals; pvals != newValueset(1, 3) {
+		t.Errorf("newKiller square 1 has possible values %v, expected [1 3]", pvals)
+	}
+	if pvals := p.squares[3].pvals; pvals != newValueset(3, 4) {
+		t.Errorf("newKiller square 3 has possible values %v, expected [3 4]", pvals)
+	}
+
+	// assignments are constrained by the cages, too
+	_, e = p.Assign(Choice{1, 1})
+	if e != nil {
+		t.Fatalf("newKiller assign failed: %v", e)
+	}
+	if sq := p.squares[5]; sq.pvals != newValueset(3) {
+		t.Errorf("newKiller square 5 has possible values %v, expected [3]", sq.pvals)
+	}
+
+	// givens with the wrong sum produce puzzle errors
+	p, e = New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Values:     []int{2, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		Cages:      killer4Cages,
+	})
+	if e != nil {
+		t.Fatalf("newKiller with wrong sum failed: %v", e)
+	}
+	wrongSum := cageError(GroupID{GtypeCage, 1}, WrongCageSumCondition, 5, 4)
+	if len(p.errors) == 0 || !reflect.DeepEqual(p.errors[0], wrongSum) {
+		t.Errorf("newKiller with wrong sum has errors %v, expected %v", p.errors, wrongSum)
+	}
+
+	// givens that can't make the sum produce puzzle errors
+	p, e = New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Values:     []int{4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		Cages:      killer4Cages,
+	})
+	if e != nil {
+		t.Fatalf("newKiller with bad givens failed: %v", e)
+	}
+	if len(p.errors) == 0 || p.errors[0].Condition != ImpossibleCageSumCondition {
+		t.Errorf("newKiller with bad givens has wrong errors: %v", p.errors)
+	}
+
+	// the cages round-trip through the summary and are part of
+	// the hash
+	s := &Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Values:     make([]int, 16),
+		Cages:      killer4Cages,
+	}
+	p, e = New(s)
+	if e != nil {
+		t.Fatalf("newKiller failed: %v", e)
+	}
+	ps := p.summary()
+	if !reflect.DeepEqual(ps.Cages, killer4Cages) {
+		t.Errorf("newKiller summary has cages %v, expected %v", ps.Cages, killer4Cages)
+	}
+	if ps.hash() != s.hash() {
+		t.Errorf("newKiller puzzle hash (%v) doesn't match summary hash (%v)", ps.hash(), s.hash())
+	}
+	plain := &Summary{Geometry: StandardGeometryName, SideLength: 4, Values: make([]int, 16)}
+	if plain.hash() == s.hash() {
+		t.Errorf("newKiller puzzle has the same hash as the uncaged puzzle: %v", s.hash())
+	}
+}
+
+func TestKillerCageFeedback(t *testing.T) {
+	// a cage of squares 1 to 3 summing to 6 leaves 4 only one
+	// place in row 1, which the row finds right away
+	p, e := New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Cages:      []Cage{{6, []int{1, 2, 3}}},
+	})
+	if e != nil {
+		t.Fatalf("newKiller failed: %v", e)
+	}
+	if sq := p.squares[4]; sq.bval != 4 {
+		t.Errorf("Square 4 has bound value %d (sources %v), expected 4", sq.bval, sq.bsrc)
+	}
+	// the same goes for cage removals made by assignments
+	p, e = New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Cages:      []Cage{{5, []int{1, 2}}},
+	})
+	if e != nil {
+		t.Fatalf("newKiller failed: %v", e)
+	}
+	if _, e = p.Assign(Choice{3, 4}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	// squares 1 and 2 are now 2 and 3 in some order, so 1 has
+	// only square 4 left in row 1
+	if sq := p.squares[4]; sq.bval != 1 && sq.pvals != newValueset(1) {
+		t.Errorf("Square 4 has bound value %d, possible values %v, expected 1", sq.bval, sq.pvals)
+	}
+}
+
+func TestKillerBigCages(t *testing.T) {
+	// big cages in big puzzles are analyzed with bounds, rather
+	// than by walking every set of values that makes the sum
+	testcases := []struct {
+		sidelen, size, sum int
+		pvals              valueset
+	}{
+		{36, 14, 259, newValuesetRange(36)},
+		{36, 14, 105, newValuesetRange(14)},
+		{25, 12, 150, newValuesetRange(25)},
+		{25, 12, 78, newValuesetRange(12)},
+	}
+	for i, tc := range testcases {
+		indices := make([]int, tc.size)
+		for j := range indices {
+			indices[j] = j + 1
+		}
+		p, e := New(&Summary{
+			Geometry:   StandardGeometryName,
+			SideLength: tc.sidelen,
+			Cages:      []Cage{{tc.sum, indices}},
+		})
+		if e != nil {
+			t.Fatalf("case %d: newKiller failed: %v", i+1, e)
+		}
+		if pvals := p.squares[1].pvals; pvals != tc.pvals {
+			t.Errorf("case %d: square 1 has possible values %v, expected %v", i+1, pvals, tc.pvals)
+		}
+		if _, e = p.Assign(Choice{1, 1}); e != nil {
+			t.Fatalf("case %d: Assign failed: %v", i+1, e)
+		}
+	}
+}
+
 /*
 
 Puzzle Operations
@@ -2837,6 +2952,16 @@ func TestHash(t *testing.T) {
 			RectangularGeometryName, 20,
 			Signature("AD9452449B972134BF458697A65C52E1"),
 		},
+		hashTestcase{
+			map[string]string{"name": "square 36x36"},
+			StandardGeometryName, 36,
+			Signature("2-47D14E56720ADFBAE0AFDAD4E83BD60F"),
+		},
+		hashTestcase{
+			map[string]string{"name": "rectangle 42x42"},
+			RectangularGeometryName, 42,
+			Signature("2-46FE5C33939265DDBB9BDA0483768643"),
+		},
 	}
 	for _, tc := range testcases {
 		s := &Summary{
@@ -2861,6 +2986,39 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestHashVersionBoundary(t *testing.T) {
+	// the encoding is chosen by side length: 35x35 is the
+	// largest puzzle hashed with version 1, 36x36 the smallest
+	// hashed with version 2.  Only jigsaws come in both sizes.
+	testcases := []struct {
+		sidelen int
+		sig     Signature
+	}{
+		{35, Signature("48325C5A05C9BF6CBC2B924F596204CF")},
+		{36, Signature("2-37EC3AD834FAFA059239422800B51CD7")},
+	}
+	for _, tc := range testcases {
+		regions := make([]int, tc.sidelen*tc.sidelen)
+		for i := range regions {
+			regions[i] = i/tc.sidelen + 1
+		}
+		s := &Summary{
+			Geometry:   JigsawGeometryName,
+			SideLength: tc.sidelen,
+			Values:     make([]int, tc.sidelen*tc.sidelen),
+			Regions:    regions,
+		}
+		p, e := New(s)
+		if e != nil {
+			t.Fatalf("%dx%d jigsaw creation failed: %v", tc.sidelen, tc.sidelen, e)
+		}
+		if shash, phash := s.hash(), p.hash(); shash != tc.sig || phash != tc.sig {
+			t.Errorf("%dx%d jigsaw hashes were %v (summary) and %v (puzzle), expected %v",
+				tc.sidelen, tc.sidelen, shash, phash, tc.sig)
+		}
+	}
+}
+
 type summaryTestcase struct {
 	metadata map[string]string
 	vals     []int
@@ -2872,17 +3030,17 @@ func TestSummary(t *testing.T) {
 		summaryTestcase{
 			map[string]string{"name": "test 1"},
 			rotation4Puzzle1PartialAssign1Values,
-			Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil},
+			Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil, nil, nil, false, 0, nil},
 		},
 		summaryTestcase{
 			map[string]string{"name": "test 2"},
 			empty4PuzzleValues,
-			Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil},
+			Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil, nil, nil, false, 0, nil},
 		},
 		summaryTestcase{
 			map[string]string{"name": "test 3"},
 			rotation4Puzzle1Complete1,
-			Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil},
+			Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil, nil, nil, false, 0, nil},
 		},
 	}
 	for _, tc := range testcases {
@@ -2933,7 +3091,7 @@ func TestInternalAssign(t *testing.T) {
 		},
 	}
 	// we apply the testcases in sequence to a base setup
-	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -2986,7 +3144,7 @@ func BenchmarkInternalAssign(b *testing.B) {
 		assignInternalBenchcase{"test 3", 15, 4},
 	}
 	// we apply the benchcases in sequence to a base setup
-	master, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	master, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
 	if e != nil {
 		b.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3020,7 +3178,7 @@ func TestExternalAssign(t *testing.T) {
 	if e.(Error).Scope != ArgumentScope {
 		t.Errorf("Assign to puzzle with one issue returned wrong error: %v", e.Error())
 	}
-	pi, e = New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	pi, e = New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
 	if e != nil {
 		t.Fatalf("Creation of valid 4 puzzle produced error: %v", e)
 	}
@@ -3060,7 +3218,7 @@ func TestExternalAssign(t *testing.T) {
 		},
 	}
 	// we apply the testcases in sequence to a base setup
-	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3079,6 +3237,210 @@ func TestExternalAssign(t *testing.T) {
 	}
 }
 
+type markTestcase struct {
+	name    string
+	mark    Mark
+	use     bool
+	squares []Square
+}
+
+func TestExternalMark(t *testing.T) {
+	// boundary cases are the same as for Assign
+	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	errcases := []struct {
+		mark Mark
+		cond ErrorCondition
+	}{
+		{Mark{Index: 0, Value: 2}, TooSmallCondition},
+		{Mark{Index: 17, Value: 2}, TooLargeCondition},
+		{Mark{Index: 2, Value: 0}, TooSmallCondition},
+		{Mark{Index: 2, Value: 5}, TooLargeCondition},
+		{Mark{Index: 1, Value: 2}, DuplicateAssignmentCondition},
+		{Mark{Index: 1, Value: 2, Restore: true}, DuplicateAssignmentCondition},
+	}
+	for i, ec := range errcases {
+		if _, e := p.Mark(ec.mark); e == nil || e.(Error).Condition != ec.cond {
+			t.Errorf("Mark case %d produced incorrect error: %v", i+1, e)
+		}
+	}
+
+	// we apply the testcases in sequence to the same puzzle
+	testcases := []markTestcase{
+		markTestcase{
+			"strike without use", Mark{Index: 2, Value: 2}, false,
+			[]Square{{Index: 2, Pvals: intset{2, 4}, Svals: intset{2}}},
+		},
+		markTestcase{
+			"strike again", Mark{Index: 2, Value: 2}, false,
+			[]Square{{Index: 2, Pvals: intset{2, 4}, Svals: intset{2}}},
+		},
+		markTestcase{
+			"restore without use", Mark{Index: 2, Value: 2, Restore: true}, false,
+			[]Square{{Index: 2, Pvals: intset{2, 4}}},
+		},
+		markTestcase{
+			"strike with use", Mark{Index: 2, Value: 2}, true,
+			[]Square{
+				{Index: 2, Pvals: intset{4}, Svals: intset{2}},
+				{Index: 4, Bval: 2, Bsrc: []GroupID{{GtypeRow, 1}}, Pvals: intset{2, 4}},
+				{Index: 5, Bval: 2, Bsrc: []GroupID{{GtypeTile, 1}}, Pvals: intset{2, 4}},
+				{Index: 10, Bval: 2, Bsrc: []GroupID{{GtypeCol, 2}}, Pvals: intset{2, 4}},
+			},
+		},
+		markTestcase{
+			"restore with use", Mark{Index: 2, Value: 2, Restore: true}, true,
+			[]Square{
+				{Index: 2, Pvals: intset{2, 4}},
+				{Index: 4, Pvals: intset{2, 4}},
+				{Index: 5, Pvals: intset{2, 4}},
+				{Index: 10, Pvals: intset{2, 4}},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		if _, e := p.SetUseMarks(tc.use); e != nil {
+			t.Fatalf("%s: SetUseMarks(%v) failed: %v", tc.name, tc.use, e)
+		}
+		c, e := p.Mark(tc.mark)
+		if e != nil {
+			t.Fatalf("%s: Mark(%+v) failed: %v", tc.name, tc.mark, e)
+		}
+		if !reflect.DeepEqual(c.Squares, tc.squares) || len(c.Errors) != 0 {
+			t.Errorf("%s: Mark(%+v) gave %+v, expected %+v", tc.name, tc.mark, *c, tc.squares)
+		}
+	}
+
+	// marks round-trip through summaries, and using them or
+	// not changes the possible values
+	if _, e := p.Mark(Mark{Index: 2, Value: 4}); e != nil {
+		t.Fatalf("Mark of square 2 failed: %v", e)
+	}
+	s := p.summary()
+	if !reflect.DeepEqual(s.Marks, []Choice{{2, 4}}) || !s.UseMarks {
+		t.Errorf("Summary has marks %v and use %v", s.Marks, s.UseMarks)
+	}
+	if h, _ := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil}); h.hash() != p.hash() {
+		t.Errorf("Marks changed the puzzle hash")
+	}
+	np, e := New(s)
+	if e != nil {
+		t.Fatalf("New from summary with marks failed: %v", e)
+	}
+	if !reflect.DeepEqual(np.summary(), s) || !reflect.DeepEqual(np.allSquares(), p.allSquares()) {
+		t.Errorf("New from summary with marks gave a different puzzle:\n%v\n%v", np, p)
+	}
+	c, e := np.SetUseMarks(false)
+	if e != nil {
+		t.Fatalf("SetUseMarks(false) failed: %v", e)
+	}
+	if len(c.Squares) != 4 || !reflect.DeepEqual(c.Squares[0], Square{Index: 2, Pvals: intset{2, 4}, Svals: intset{4}}) {
+		t.Errorf("SetUseMarks(false) gave %+v", *c)
+	}
+	if cp := np.copy(); !reflect.DeepEqual(cp.summary(), np.summary()) {
+		t.Errorf("Copy of puzzle with marks has summary %+v", *cp.summary())
+	}
+
+	// striking every possible value makes the puzzle unsolvable
+	c, e = p.Mark(Mark{Index: 2, Value: 2})
+	if e != nil {
+		t.Fatalf("Mark of last value of square 2 failed: %v", e)
+	}
+	if len(c.Errors) != 1 || c.Errors[0].Condition != NoPossibleValuesCondition {
+		t.Errorf("Mark of last value of square 2 gave errors %v", c.Errors)
+	}
+	if _, e := p.Mark(Mark{Index: 4, Value: 2}); e == nil || e.(Error).Condition != InvalidPuzzleAssignmentCondition {
+		t.Errorf("Mark of unsolvable puzzle produced incorrect error: %v", e)
+	}
+	if _, e := p.SetUseMarks(false); e == nil || e.(Error).Condition != InvalidPuzzleAssignmentCondition {
+		t.Errorf("SetUseMarks of unsolvable puzzle produced incorrect error: %v", e)
+	}
+
+	// marks in summaries are validated
+	sumcases := []struct {
+		marks []Choice
+		cond  ErrorCondition
+	}{
+		{[]Choice{{0, 2}}, TooSmallCondition},
+		{[]Choice{{2, 5}}, TooLargeCondition},
+		{[]Choice{{1, 2}}, DuplicateAssignmentCondition},
+	}
+	for i, sc := range sumcases {
+		_, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues, Marks: sc.marks})
+		if e == nil || e.(Error).Condition != sc.cond {
+			t.Errorf("New with marks case %d produced incorrect error: %v", i+1, e)
+		}
+	}
+}
+
+func TestExternalUnassign(t *testing.T) {
+	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	errcases := []struct {
+		index int
+		cond  ErrorCondition
+	}{
+		{0, TooSmallCondition},
+		{17, TooLargeCondition},
+		{2, NotAssignedCondition},
+	}
+	for i, ec := range errcases {
+		if _, e := p.Unassign(ec.index); e == nil || e.(Error).Condition != ec.cond {
+			t.Errorf("Unassign case %d produced incorrect error: %v", i+1, e)
+		}
+	}
+
+	// assign three squares, then clear the middle one
+	for _, choice := range []Choice{{2, 2}, {7, 2}, {12, 2}} {
+		if _, e := p.Assign(choice); e != nil {
+			t.Fatalf("Assign of %v failed: %v", choice, e)
+		}
+	}
+	update, e := p.Unassign(7)
+	if e != nil {
+		t.Fatalf("Unassign of 7 failed: %v", e)
+	}
+	if len(update.Errors) != 0 {
+		t.Errorf("Unassign of 7 produced errors: %v", update.Errors)
+	}
+	found := false
+	for _, sq := range update.Squares {
+		if sq.Index == 7 {
+			found = sq.Aval == 0 && reflect.DeepEqual(sq.Pvals, intset{2, 4})
+		}
+	}
+	if !found {
+		t.Errorf("Unassign of 7 didn't clear square 7: %+v", update.Squares)
+	}
+	// the result is as if square 7 had never been assigned
+	values := append([]int(nil), rotation4Puzzle1PartialValues...)
+	values[1], values[11] = 2, 2
+	expected, e := New(&Summary{nil, StandardGeometryName, 4, values, nil, nil, nil, false, 0, nil})
+	if e != nil {
+		t.Fatalf("Creation of expected puzzle failed: %v", e)
+	}
+	if s1, s2 := p.allSquares(), expected.allSquares(); !reflect.DeepEqual(s1, s2) {
+		t.Errorf("After unassign, squares are %+v, expected %+v", s1, s2)
+	}
+
+	// clearing a bad assignment makes the puzzle solvable again
+	update, e = p.Assign(Choice{4, 2})
+	if e != nil || len(update.Errors) == 0 {
+		t.Fatalf("Assign of {4, 2} didn't make puzzle unsolvable: %v, %v", update, e)
+	}
+	update, e = p.Unassign(4)
+	if e != nil || len(update.Errors) != 0 || len(p.errors) != 0 {
+		t.Errorf("Unassign of 4 didn't clear errors: %v, %v", update, e)
+	}
+	if s1, s2 := p.allSquares(), expected.allSquares(); !reflect.DeepEqual(s1, s2) {
+		t.Errorf("After second unassign, squares are %+v, expected %+v", s1, s2)
+	}
+}
+
 type stateTestcase struct {
 	name   string
 	ai, av int
@@ -3103,7 +3465,7 @@ func TestState(t *testing.T) {
 		},
 	}
 	// we apply the testcases in sequence to a base setup
-	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3180,7 +3542,7 @@ func TestPuzzleInternalCopy(t *testing.T) {
 		},
 	}
 	for _, tc := range testcases {
-		p, e := New(&Summary{nil, StandardGeometryName, 4, tc.vals, nil})
+		p, e := New(&Summary{nil, StandardGeometryName, 4, tc.vals, nil, nil, nil, false, 0, nil})
 		if e != nil {
 			t.Fatalf("puzzleCopy %s failed to make puzzle: %v", tc.name, e)
 		}
@@ -3214,7 +3576,7 @@ func TestPuzzleInternalCopy(t *testing.T) {
 }
 
 func TestPuzzleExternalCopy(t *testing.T) {
-	in, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	in, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil, nil, nil, false, 0, nil})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3313,13 +3675,13 @@ func TestNewErrorCases(t *testing.T) {
 	}
 
 	// restore known geometries after test
-	defer func(gd map[string]func([]int) (*Puzzle, error)) {
+	defer func(gd map[string]Geometry) {
 		knownGeometries = gd
 	}(knownGeometries)
 
-	// constructor with error
-	knownGeometries = map[string]func([]int) (*Puzzle, error){
-		"test": func(_ []int) (*Puzzle, error) { return nil, Error{Message: "test error"} },
+	// geometry with error
+	knownGeometries = map[string]Geometry{
+		"test": GeometryFunc(func(*Summary) (*Layout, error) { return nil, Error{Message: "test error"} }),
 	}
 	_, e = New(&Summary{Geometry: "test", SideLength: 9})
 	err, ok = e.(Error)
@@ -3398,9 +3760,9 @@ func TestEndToEndPuzzleAssignment(t *testing.T) {
 	}
 	for _, test := range tests {
 		if test.init == nil {
-			p, _ = New(&Summary{nil, StandardGeometryName, 4, nil, nil})
+			p, _ = New(&Summary{nil, StandardGeometryName, 4, nil, nil, nil, nil, false, 0, nil})
 		} else {
-			p, _ = New(&Summary{nil, StandardGeometryName, 4, test.init, nil})
+			p, _ = New(&Summary{nil, StandardGeometryName, 4, test.init, nil, nil, nil, false, 0, nil})
 		}
 		for _, assign := range test.setup {
 			tryassign(assign.ai, assign.av, true)
@@ -3445,6 +3807,21 @@ func TestExternalNil(t *testing.T) {
 			t.Errorf("case %v Copy: No error or incorrect condition on invalid puzzle: %v",
 				i, err)
 		}
+		_, err = p.Mark(Mark{Index: 1, Value: 1})
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v Mark: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
+		_, err = p.SetUseMarks(true)
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v SetUseMarks: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
+		_, err = p.Unassign(1)
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v Unassign: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
 	}
 
 	// test Hash on bad summaries
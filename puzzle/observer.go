@@ -0,0 +1,123 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+/*
+
+Observers
+
+Observers see the fine-grained changes a puzzle goes through as
+it does constraint relaxation: every value assigned to a square,
+every possible value removed from a square, every square bound
+to a value by a group, and every Error found.  The squares in the
+Content returned by an operation are just the ones that were
+touched; observers see what happened to them, in order.
+
+Observers are called synchronously, while the puzzle is in the
+middle of changing, so they must not call the puzzle's methods.
+They are per-puzzle: copies of a puzzle (including the ones the
+solver makes) start out with no observers.  Operations that
+rebuild a puzzle from its summary, such as Unassign, keep the
+puzzle's observers but don't report the changes.
+
+*/
+
+// An EventKind says what happened to a puzzle.
+type EventKind int
+
+// Constants for the kinds of events.
+const (
+	UnknownEvent EventKind = iota
+	AssignEvent
+	RemoveEvent
+	BindEvent
+	ErrorEvent
+)
+
+// EventKinds implement Stringer
+func (k EventKind) String() string {
+	switch k {
+	case AssignEvent:
+		return "assign"
+	case RemoveEvent:
+		return "remove"
+	case BindEvent:
+		return "bind"
+	case ErrorEvent:
+		return "error"
+	default:
+		return "unknown event"
+	}
+}
+
+// An Event is one change to a puzzle.  For AssignEvents, Value
+// was assigned to the square at Index.  For RemoveEvents, Value
+// was removed from the possible values of the square at Index.
+// For BindEvents, the square at Index was bound to Value by
+// Group.  For ErrorEvents, Error was added to the puzzle.
+type Event struct {
+	Kind  EventKind `json:"kind"`
+	Index int       `json:"index,omitempty"`
+	Value int       `json:"value,omitempty"`
+	Group GroupID   `json:"group"`
+	Error *Error    `json:"error,omitempty"`
+}
+
+// An Observer is notified of the Events in a puzzle.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer
+// interface.
+type ObserverFunc func(e Event)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// An observation is a registered observer.  Observers may not be
+// comparable, so they are registered (and unregistered) by
+// reference to their observation.
+type observation struct {
+	observer Observer
+}
+
+// AddObserver registers an observer of the puzzle's events,
+// which will be notified after any observers already registered.
+// It returns a function that unregisters the observer.
+func (p *Puzzle) AddObserver(o Observer) (func(), error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if o == nil {
+		return nil, argumentError(NamedAttribute, InvalidArgumentCondition, "observer", o)
+	}
+	ob := &observation{o}
+	p.logger.observers = append(p.logger.observers, ob)
+	return func() {
+		obs := p.logger.observers
+		for i := range obs {
+			if obs[i] == ob {
+				p.logger.observers = append(obs[:i:i], obs[i+1:]...)
+				return
+			}
+		}
+	}, nil
+}
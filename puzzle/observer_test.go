@@ -0,0 +1,137 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"testing"
+)
+
+func TestObserver(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: bound4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	var events []Event
+	stop, e := p.AddObserver(ObserverFunc(func(e Event) { events = append(events, e) }))
+	if e != nil {
+		t.Fatalf("Failed to add observer: %v", e)
+	}
+
+	// the assignment comes first, and every event is for a
+	// square in the update
+	update, e := p.Assign(Choice{7, 1})
+	if e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if len(events) == 0 || events[0] != (Event{Kind: AssignEvent, Index: 7, Value: 1}) {
+		t.Fatalf("Got events %+v, expected assignment of 1 to square 7 first", events)
+	}
+	updated := make(map[int]bool)
+	for _, s := range update.Squares {
+		updated[s.Index] = true
+	}
+	counts := make(map[EventKind]int)
+	for _, ev := range events {
+		counts[ev.Kind]++
+		if !updated[ev.Index] {
+			t.Errorf("Got event %+v for a square not in the update", ev)
+		}
+		switch ev.Kind {
+		case RemoveEvent:
+			if S := p.allSquares()[ev.Index-1]; S.Aval == 0 {
+				if _, found := S.Pvals.find(ev.Value); found {
+					t.Errorf("Got event %+v for a value that is still possible", ev)
+				}
+			}
+		case BindEvent:
+			if ev.Group.Gtype == "" {
+				t.Errorf("Got event %+v with no binding group", ev)
+			}
+		}
+	}
+	if counts[AssignEvent] != 1 || counts[RemoveEvent] == 0 || counts[BindEvent] == 0 || counts[ErrorEvent] != 0 {
+		t.Errorf("Got event counts %v", counts)
+	}
+
+	// an assignment that makes the puzzle unsolvable reports
+	// the errors it finds
+	events = nil
+	update, e = p.Assign(Choice{8, 1})
+	if e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	var errs []Error
+	for _, ev := range events {
+		if ev.Kind == ErrorEvent {
+			errs = append(errs, *ev.Error)
+		}
+	}
+	if len(errs) == 0 || len(errs) != len(update.Errors) {
+		t.Errorf("Got error events %v, expected %v", errs, update.Errors)
+	}
+
+	// copies aren't observed, and stopped observers aren't
+	// called any more
+	p, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: bound4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	count1, count2 := 0, 0
+	stop, e = p.AddObserver(ObserverFunc(func(e Event) { count1++ }))
+	if e != nil {
+		t.Fatalf("Failed to add observer: %v", e)
+	}
+	if _, e = p.AddObserver(ObserverFunc(func(e Event) { count2++ })); e != nil {
+		t.Fatalf("Failed to add observer: %v", e)
+	}
+	c, e := p.Copy()
+	if e != nil {
+		t.Fatalf("Failed to copy puzzle: %v", e)
+	}
+	if _, e = c.Assign(Choice{5, 3}); e != nil || count1 != 0 || count2 != 0 {
+		t.Errorf("Copy assign notified observers (%d, %d) or failed: %v", count1, count2, e)
+	}
+	stop()
+	stop()
+	if _, e = p.Assign(Choice{5, 3}); e != nil || count1 != 0 || count2 == 0 {
+		t.Errorf("Assign notified observers (%d, %d) or failed: %v", count1, count2, e)
+	}
+
+	// observers survive rebuilding the puzzle
+	if _, e = p.Unassign(5); e != nil {
+		t.Fatalf("Unassign failed: %v", e)
+	}
+	count2 = 0
+	if _, e = p.Assign(Choice{5, 4}); e != nil || count2 == 0 {
+		t.Errorf("Assign after unassign didn't notify observer or failed: %v", e)
+	}
+}
+
+func TestObserverErrors(t *testing.T) {
+	var p *Puzzle
+	if _, e := p.AddObserver(ObserverFunc(func(e Event) {})); e == nil {
+		t.Errorf("Added an observer to a nil puzzle")
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if _, e := p.AddObserver(nil); e == nil {
+		t.Errorf("Added a nil observer")
+	}
+}
@@ -0,0 +1,197 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Parallel solving
+
+A parallel search splits the search tree of Ariadne's thread into
+subtrees, which we call branches, and hands the branches to a
+pool of worker goroutines.  The branches are found by expanding
+choices breadth-first from the top of the tree, each choice
+being replaced in place by one branch for each of its values.
+This keeps the branches in the order that the serial search
+would visit them, so concatenating the solutions of the branches
+gives the same solutions, in the same order, as the serial
+search.
+
+Each branch starts with the thread of choices that leads to it.
+Those choices have no values left to try, so popping the thread
+past them exhausts the branch.  The choices are still reported
+in the branch's solutions, so solutions (and their ratings) are
+the same as in the serial search.
+
+The workers share the search, and so share its node budget,
+deadline, and context.  When there is a limit on the number of
+solutions, the search is stopped as soon as the branches that
+have been finished in order have enough solutions.  A search
+that stops early keeps only the solutions found before the
+first unfinished branch, so its solutions are always the first
+ones the serial search would find.
+
+*/
+
+// branchesPerWorker is how many branches each worker should get,
+// on average, so that workers with easy branches can help out
+// with the hard ones.
+const branchesPerWorker = 4
+
+// A branch is a subtree of a search: a puzzle and the thread of
+// choices that leads to it.
+type branch struct {
+	puz *Puzzle
+	t   thread
+}
+
+// The result of searching a branch: its solutions, the
+// statistics for each solution (if the search keeps them), and
+// whether the branch was finished.  A serial search has just one
+// branch: the whole search tree.
+type branchResult struct {
+	solutions []Solution
+	stats     []SolveStats
+	finished  bool
+}
+
+// add adds a solution and its statistics to a result.
+func (r *branchResult) add(solution Solution, stats *SolveStats) {
+	r.solutions = append(r.solutions, solution)
+	if stats != nil {
+		r.stats = append(r.stats, *stats)
+	}
+}
+
+// parallelSolutions finds the solutions to a given puzzle, within
+// the bounds of a search, using the given number of workers.
+// The solutions are the same as those found by solutions.  The
+// puzzle is not altered.
+func (p *Puzzle) parallelSolutions(s *search, workers int) []Solution {
+	// first see if logical techniques are enough
+	r, grade := p.logicalSolution(s)
+	if r.solutions != nil {
+		s.found = r.stats
+		return r.solutions
+	}
+
+	// choices needed: hand out the branches
+	branches := splitBranches(p.copy(), s, workers*branchesPerWorker)
+	results := make([]branchResult, len(branches))
+	next, done := make(chan int), make(chan int, len(branches))
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				b := branches[i]
+				results[i] = threadSolutions(b.puz, b.t, s, grade, s.maxSolutions)
+				done <- i
+			}
+		}()
+	}
+	go func() {
+		for i := range branches {
+			next <- i
+		}
+		close(next)
+	}()
+
+	// collect the results, stopping the search once the
+	// branches finished in order have enough solutions
+	returned := make([]bool, len(branches))
+	inOrder, count := 0, 0
+	for range branches {
+		returned[<-done] = true
+		for inOrder < len(branches) && returned[inOrder] && results[inOrder].finished {
+			count += len(results[inOrder].solutions)
+			inOrder++
+		}
+		if s.maxSolutions > 0 && count >= s.maxSolutions {
+			s.stop(SolutionLimitStop)
+		}
+	}
+	return mergeBranches(results, s)
+}
+
+// splitBranches expands the choices at the top of the search
+// tree of a puzzle until there are at least n branches, or there
+// are no more choices to expand.  Each expanded choice counts as
+// a node of the search, just as it does in solve.  Branches that
+// are found to have errors are dropped, since they have no
+// solutions.
+func splitBranches(p *Puzzle, s *search, n int) []branch {
+	branches := []branch{{p, nil}}
+	for len(branches) < n {
+		var next []branch
+		expanded := false
+		for _, b := range branches {
+			if len(b.puz.errors) == 0 && s.assignKnown(b.puz, b.t) {
+				next = append(next, b) // solved
+				continue
+			}
+			if len(b.puz.errors) > 0 {
+				continue // no solutions
+			}
+			if s.stopped() {
+				next = append(next, b) // workers will stop, too
+				continue
+			}
+			expanded = true
+			cindex, ccount := chooseSquare(b.puz)
+			pvals := b.puz.squares[cindex].pvals
+			for v := pvals.next(0); v != 0; v = pvals.next(v) {
+				c := b.puz.copy()
+				c.assign(cindex, v)
+				t := append(make(thread, 0, len(b.t)+1), b.t...)
+				t = append(t, choice{cindex: cindex, ccount: ccount, cvalue: v})
+				next = append(next, branch{c, t})
+			}
+		}
+		branches = next
+		if !expanded {
+			break
+		}
+	}
+	return branches
+}
+
+// mergeBranches concatenates the solutions of the branches, in
+// order, up to and including the first branch that wasn't
+// finished.  If the search has a limit on solutions, only that
+// many are kept, and if the limit is reached then that is the
+// reason the search stopped, just as in the serial search.  The
+// statistics of the solutions are kept with them.
+func mergeBranches(results []branchResult, s *search) []Solution {
+	var solutions []Solution
+	for _, r := range results {
+		solutions = append(solutions, r.solutions...)
+		s.found = append(s.found, r.stats...)
+		if !r.finished {
+			break
+		}
+	}
+	if s.maxSolutions > 0 && len(solutions) >= s.maxSolutions {
+		solutions = solutions[:s.maxSolutions]
+		if len(s.found) > s.maxSolutions {
+			s.found = s.found[:s.maxSolutions]
+		}
+		s.mutex.Lock()
+		s.reason = SolutionLimitStop
+		s.mutex.Unlock()
+	}
+	return solutions
+}
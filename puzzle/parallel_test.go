@@ -0,0 +1,126 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParallelSolutions(t *testing.T) {
+	tcs := []struct {
+		geometry string
+		sidelen  int
+		values   []int
+		options  SolveOptions
+	}{
+		{StandardGeometryName, 4, multiChoiceStartValues, SolveOptions{}},
+		{StandardGeometryName, 4, empty4PuzzleValues, SolveOptions{}},
+		{StandardGeometryName, 4, empty4PuzzleValues, SolveOptions{MaxSolutions: 17}},
+		{StandardGeometryName, 4, conflicting4Puzzle1, SolveOptions{}},
+		{StandardGeometryName, 9, oneStarValues, SolveOptions{}},
+		{StandardGeometryName, 9, sixStarValues, SolveOptions{}},
+		{StandardGeometryName, 9, make([]int, 81), SolveOptions{MaxSolutions: 50}},
+		{RectangularGeometryName, 6, make([]int, 36), SolveOptions{MaxSolutions: 200}},
+		{StandardGeometryName, 16, make([]int, 256), SolveOptions{MaxSolutions: 5}},
+	}
+	for i, tc := range tcs {
+		p, e := New(&Summary{Geometry: tc.geometry, SideLength: tc.sidelen, Values: tc.values})
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		serial, e := p.SolutionsContext(context.Background(), tc.options)
+		if e != nil {
+			t.Fatalf("test %d: Failed to solve puzzle: %v", i+1, e)
+		}
+		for _, workers := range []int{2, 3, 8} {
+			options := tc.options
+			options.Workers = workers
+			parallel, e := p.SolutionsContext(context.Background(), options)
+			if e != nil {
+				t.Fatalf("test %d (%d workers): Failed to solve puzzle: %v", i+1, workers, e)
+			}
+			if !reflect.DeepEqual(parallel.Solutions, serial.Solutions) {
+				t.Errorf("test %d (%d workers): got %d solutions, expected %d (or they differ)",
+					i+1, workers, len(parallel.Solutions), len(serial.Solutions))
+			}
+			if parallel.Reason != serial.Reason {
+				t.Errorf("test %d (%d workers): stopped for %v, expected %v",
+					i+1, workers, parallel.Reason, serial.Reason)
+			}
+			if serial.Reason == CompleteStop && parallel.Nodes != serial.Nodes {
+				t.Errorf("test %d (%d workers): searched %d nodes, expected %d",
+					i+1, workers, parallel.Nodes, serial.Nodes)
+			}
+		}
+	}
+}
+
+func TestParallelSolutionsStopped(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: make([]int, 81)})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	all, e := p.SolutionsContext(context.Background(), SolveOptions{MaxSolutions: 100})
+	if e != nil {
+		t.Fatalf("Failed to solve puzzle: %v", e)
+	}
+	result, e := p.SolutionsContext(context.Background(), SolveOptions{MaxNodes: 60, Workers: 4})
+	if e != nil {
+		t.Fatalf("Failed to solve puzzle: %v", e)
+	}
+	if result.Reason != NodeLimitStop || result.Nodes != 60 {
+		t.Errorf("Stopped for %v after %d nodes, expected %v after 60", result.Reason, result.Nodes, NodeLimitStop)
+	}
+	if n := len(result.Solutions); n > 0 && !reflect.DeepEqual(result.Solutions, all.Solutions[:n]) {
+		t.Errorf("Stopped search's solutions aren't the first %d solutions", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, e = p.SolutionsContext(ctx, SolveOptions{Workers: 4})
+	if e != nil {
+		t.Fatalf("Failed to solve puzzle: %v", e)
+	}
+	if result.Reason != CanceledStop || len(result.Solutions) != 0 {
+		t.Errorf("Got %d solutions (stopped: %v), expected none (stopped: %v)",
+			len(result.Solutions), result.Reason, CanceledStop)
+	}
+}
+
+func benchmarkSolutions(b *testing.B, workers int) {
+	p, e := New(&Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: make([]int, 36)})
+	if e != nil {
+		b.Fatalf("Failed to create puzzle: %v", e)
+	}
+	options := SolveOptions{MaxSolutions: 500, Workers: workers}
+	for i := 0; i < b.N; i++ {
+		p.SolutionsContext(context.Background(), options)
+	}
+}
+
+func BenchmarkSerialSolutions(b *testing.B) {
+	benchmarkSolutions(b, 1)
+}
+
+func BenchmarkParallelSolutions(b *testing.B) {
+	benchmarkSolutions(b, runtime.NumCPU())
+}
@@ -0,0 +1,393 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+/*
+
+Advanced constraint propagation
+
+The basic propagation done by groups finds naked singles
+(squares with only one possible value) and hidden singles
+(values with only one possible square in a group), and binds
+them.  Advanced propagation goes on to remove possible values
+using these techniques, simplest first:
+
+1. Naked and hidden singles: the value of a naked single is
+removed from the other squares in its groups, and the other
+values of a hidden single are removed from its square.
+
+2. Pointing and claiming: if the candidates for a value in one
+group all lie in another group, the value is removed from the
+rest of the other group.  When the first group is a tile (or
+region) this is called pointing; when it's a row, column, or
+diagonal it's called claiming (aka box/line reduction).
+
+3. Naked and hidden subsets (pairs, triples, and quads): if the
+possible values of N squares in a group are N values in all,
+those values are removed from the other squares in the group;
+if the candidates for N values in a group are N squares in all,
+the other values are removed from those squares.
+
+Whenever a technique removes possible values, the groups and
+cages are analyzed again and the techniques start over, until
+none of them can remove anything.
+
+*/
+
+// A Propagation is a level of constraint propagation.  Puzzles
+// use BasicPropagation unless they opt in to more.
+type Propagation int
+
+// Constants for the propagation levels.
+const (
+	BasicPropagation Propagation = iota
+	AdvancedPropagation
+)
+
+// A Technique names the advanced propagation technique that
+// removed a possible value from a square.  Grades also use
+// GuessTechnique, for puzzles that can't be solved without
+// guessing.
+type Technique int
+
+// Constants for the techniques.  Singles are subsets of size 1.
+const (
+	UnknownTechnique Technique = iota
+	NakedSubsetTechnique
+	HiddenSubsetTechnique
+	PointingTechnique
+	ClaimingTechnique
+	GuessTechnique
+)
+
+// Techniques implement Stringer
+func (t Technique) String() string {
+	switch t {
+	case NakedSubsetTechnique:
+		return "naked subset"
+	case HiddenSubsetTechnique:
+		return "hidden subset"
+	case PointingTechnique:
+		return "pointing"
+	case ClaimingTechnique:
+		return "claiming"
+	case GuessTechnique:
+		return "guess"
+	default:
+		return "unknown technique"
+	}
+}
+
+// An Elimination records a possible value removed from a square
+// by advanced propagation, with the technique that removed it.
+// Size is the number of squares in the subset (for subsets) or
+// in the intersection (for pointing and claiming).  Groups are
+// the group containing the subset, or the group whose
+// candidates lie in the intersection followed by the group they
+// were removed from.
+type Elimination struct {
+	Value     int       `json:"value"`
+	Technique Technique `json:"technique"`
+	Size      int       `json:"size"`
+	Groups    []GroupID `json:"groups"`
+}
+
+// setPropagation validates and sets the propagation level of a
+// newly created puzzle, and then does the propagation.
+func (p *Puzzle) setPropagation(level Propagation) error {
+	if level < BasicPropagation || level > AdvancedPropagation {
+		return rangeError(PropagationAttribute, int(level), int(BasicPropagation), int(AdvancedPropagation))
+	}
+	p.propagation = level
+	p.propagate()
+	return nil
+}
+
+// propagate applies the advanced propagation techniques (if the
+// puzzle uses them) until they can't remove any more possible
+// values.  Any Errors found are added to the puzzle.
+func (p *Puzzle) propagate() {
+	if p.propagation < AdvancedPropagation {
+		return
+	}
+	for len(p.errors) == 0 && p.eliminate() {
+		p.analyze()
+	}
+}
+
+// techniqueSteps are the steps taken by eliminate, in order.
+var techniqueSteps = []struct {
+	technique Technique
+	size      int
+}{
+	{NakedSubsetTechnique, 1},
+	{HiddenSubsetTechnique, 1},
+	{PointingTechnique, 0}, // also does claiming
+	{NakedSubsetTechnique, 2},
+	{HiddenSubsetTechnique, 2},
+	{NakedSubsetTechnique, 3},
+	{HiddenSubsetTechnique, 3},
+	{NakedSubsetTechnique, 4},
+	{HiddenSubsetTechnique, 4},
+}
+
+// A deduction is one application of a technique: the squares
+// and values of the pattern it found in its groups, and the
+// possible values (as choices) that the pattern eliminates.
+type deduction struct {
+	technique Technique
+	size      int
+	groups    []GroupID
+	squares   intset
+	values    intset
+	elims     []Choice
+}
+
+// eliminate takes the first technique step that removes any
+// possible values, applying it across all the groups.  Returns
+// whether any values were removed.  Any Errors found are added
+// to the puzzle.
+func (p *Puzzle) eliminate() bool {
+	for _, step := range techniqueSteps {
+		removed := false
+		for _, g := range p.groups[1:] {
+			p.findDeductions(g, step.technique, step.size, func(d *deduction) bool {
+				removed = true
+				if errs := p.apply(d); len(errs) > 0 {
+					p.addErrors(errs)
+					return true
+				}
+				return false
+			})
+			if len(p.errors) > 0 {
+				return true
+			}
+		}
+		if removed {
+			return true
+		}
+	}
+	return false
+}
+
+// apply a deduction's eliminations to the puzzle's squares,
+// returning any Errors generated by the removals.
+func (p *Puzzle) apply(d *deduction) []Error {
+	var errs []Error
+	cause := removal{kind: EliminatedReason}
+	if d.size == 1 {
+		cause.source = d.squares[0]
+	}
+	p.logger.blame(cause)
+	for _, c := range d.elims {
+		_, e := p.squares[c.Index].eliminate(Elimination{c.Value, d.technique, d.size, d.groups})
+		errs = append(errs, e...)
+	}
+	p.logger.blame(removal{})
+	return errs
+}
+
+// findDeductions calls f with each deduction that a technique
+// step makes in a group, until f returns true.  Only deductions
+// that eliminate some possible value are found, and the puzzle
+// isn't changed: it's up to f to apply them (or not).
+func (p *Puzzle) findDeductions(g *group, tech Technique, size int, f func(d *deduction) bool) {
+	switch tech {
+	case NakedSubsetTechnique:
+		p.findNakedSubsets(g, size, f)
+	case HiddenSubsetTechnique:
+		p.findHiddenSubsets(g, size, f)
+	default:
+		p.findIntersections(g, f)
+	}
+}
+
+// openSquares returns the unassigned squares in a group.
+func (p *Puzzle) openSquares(g *group) []*square {
+	var open []*square
+	for _, i := range g.desc.indices {
+		if s := p.squares[i]; s.aval == 0 {
+			open = append(open, s)
+		}
+	}
+	return open
+}
+
+// findNakedSubsets finds sets of size squares in a group whose
+// possible values are size values in all, which eliminates
+// those values from the group's other squares.
+func (p *Puzzle) findNakedSubsets(g *group, size int, f func(d *deduction) bool) {
+	open := p.openSquares(g)
+	if len(open) <= size {
+		return
+	}
+	var cands []*square
+	for _, s := range open {
+		if s.pvals.len() <= size {
+			cands = append(cands, s)
+		}
+	}
+	forEachSubset(len(cands), size, func(sub []int) bool {
+		d := &deduction{technique: NakedSubsetTechnique, size: size, groups: []GroupID{g.desc.id}}
+		var vals valueset
+		for _, ci := range sub {
+			d.squares.insert(cands[ci].index)
+			vals |= cands[ci].pvals
+		}
+		if vals.len() != size {
+			return false
+		}
+		d.values = vals.values()
+		for _, s := range open {
+			if _, ok := d.squares.find(s.index); ok {
+				continue
+			}
+			elims := s.pvals & vals
+			for v := elims.next(0); v != 0; v = elims.next(v) {
+				d.elims = append(d.elims, Choice{s.index, v})
+			}
+		}
+		return len(d.elims) > 0 && f(d)
+	})
+}
+
+// findHiddenSubsets finds sets of size values in a group whose
+// candidates are size squares in all, which eliminates the
+// other values from those squares.
+func (p *Puzzle) findHiddenSubsets(g *group, size int, f func(d *deduction) bool) {
+	open := p.openSquares(g)
+	if len(open) <= size {
+		return
+	}
+	var vals []int
+	var where []intset // where[i] = the candidates for vals[i]
+	for v := 1; v < len(g.where); v++ {
+		if g.where[v] != 0 {
+			continue
+		}
+		var is intset
+		for _, s := range open {
+			if s.pvals.has(v) {
+				is = append(is, s.index)
+			}
+		}
+		if len(is) > 0 && len(is) <= size {
+			vals, where = append(vals, v), append(where, is)
+		}
+	}
+	forEachSubset(len(vals), size, func(sub []int) bool {
+		d := &deduction{technique: HiddenSubsetTechnique, size: size, groups: []GroupID{g.desc.id}}
+		var keep valueset
+		for _, vi := range sub {
+			keep.insert(vals[vi])
+			for _, i := range where[vi] {
+				d.squares.insert(i)
+			}
+		}
+		if len(d.squares) != size {
+			return false
+		}
+		d.values = keep.values()
+		for _, i := range d.squares {
+			elims := p.squares[i].pvals &^ keep
+			for v := elims.next(0); v != 0; v = elims.next(v) {
+				d.elims = append(d.elims, Choice{i, v})
+			}
+		}
+		return len(d.elims) > 0 && f(d)
+	})
+}
+
+// findIntersections finds values whose candidates in a group all
+// lie in some other group, which eliminates those values from
+// the other group's squares outside the first group.
+func (p *Puzzle) findIntersections(g *group, f func(d *deduction) bool) {
+	technique := ClaimingTechnique
+	if gt := g.desc.id.Gtype; gt == GtypeTile || gt == GtypeRegion {
+		technique = PointingTechnique
+	}
+	open := p.openSquares(g)
+	for v := 1; v < len(g.where); v++ {
+		if g.where[v] != 0 {
+			continue
+		}
+		var is intset
+		for _, s := range open {
+			if s.pvals.has(v) {
+				is = append(is, s.index)
+			}
+		}
+		if len(is) < 2 {
+			// singles are handled as subsets
+			continue
+		}
+		for _, gi := range p.mapping.ixmap[is[0]] {
+			other := p.groups[gi]
+			if other == g || !other.desc.indices.contains(is) {
+				continue
+			}
+			d := &deduction{
+				technique: technique,
+				size:      len(is),
+				groups:    []GroupID{g.desc.id, other.desc.id},
+				squares:   is,
+				values:    intset{v},
+			}
+			for _, i := range other.desc.indices {
+				if _, ok := g.desc.indices.find(i); ok || p.squares[i].aval != 0 {
+					continue
+				}
+				if p.squares[i].pvals.has(v) {
+					d.elims = append(d.elims, Choice{i, v})
+				}
+			}
+			if len(d.elims) > 0 && f(d) {
+				return
+			}
+		}
+	}
+}
+
+// forEachSubset calls f with each size-element subset of the
+// integers 0 to n-1 (in increasing order), until f returns true.
+// The subset passed to f is reused between calls.
+func forEachSubset(n, size int, f func(sub []int) bool) {
+	if size < 1 || size > n {
+		return
+	}
+	sub := make([]int, size)
+	for i := range sub {
+		sub[i] = i
+	}
+	for {
+		if f(sub) {
+			return
+		}
+		i := size - 1
+		for i >= 0 && sub[i] == n-size+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		sub[i]++
+		for j := i + 1; j < size; j++ {
+			sub[j] = sub[j-1] + 1
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+
+Test helpers
+
+*/
+
+// helperMarkedPuzzle makes an empty 9x9 puzzle with advanced
+// propagation, striking values from squares as the given marks.
+func helperMarkedPuzzle(t *testing.T, marks []Choice) *Puzzle {
+	p, e := New(&Summary{
+		Geometry:    StandardGeometryName,
+		SideLength:  9,
+		Marks:       marks,
+		UseMarks:    true,
+		Propagation: AdvancedPropagation,
+	})
+	if e != nil {
+		t.Fatalf("Failed to create marked puzzle: %v", e)
+	}
+	if len(p.errors) > 0 {
+		t.Fatalf("Marked puzzle has errors: %v", p.errors)
+	}
+	return p
+}
+
+// helperElims makes the eliminations of the given values by a
+// technique with the given size and groups.
+func helperElims(vals intset, tech Technique, size int, gids ...GroupID) []Elimination {
+	var elims []Elimination
+	for _, v := range vals {
+		elims = append(elims, Elimination{v, tech, size, gids})
+	}
+	return elims
+}
+
+/*
+
+Tests
+
+*/
+
+func TestForEachSubset(t *testing.T) {
+	testcases := []struct {
+		n, size int
+		count   int
+	}{
+		{4, 0, 0},
+		{3, 4, 0},
+		{4, 1, 4},
+		{4, 4, 1},
+		{5, 2, 10},
+		{9, 3, 84},
+	}
+	for i, tc := range testcases {
+		count, last := 0, -1
+		forEachSubset(tc.n, tc.size, func(sub []int) bool {
+			count++
+			// subsets are increasing, and come in increasing order
+			key := 0
+			for j := range sub {
+				if j > 0 && sub[j] <= sub[j-1] {
+					t.Errorf("case %d: subset %v isn't increasing", i+1, sub)
+				}
+				key = key*tc.n + sub[j]
+			}
+			if key <= last {
+				t.Errorf("case %d: subset %v is out of order", i+1, sub)
+			}
+			last = key
+			return false
+		})
+		if count != tc.count {
+			t.Errorf("case %d: got %d subsets, expected %d", i+1, count, tc.count)
+		}
+	}
+	count := 0
+	forEachSubset(5, 2, func(sub []int) bool {
+		count++
+		return count == 3
+	})
+	if count != 3 {
+		t.Errorf("Stopped after %d subsets, expected 3", count)
+	}
+}
+
+func TestNakedSubsets(t *testing.T) {
+	// squares 1 and 2 can only be 1 or 2
+	var marks []Choice
+	for _, i := range []int{1, 2} {
+		for v := 3; v <= 9; v++ {
+			marks = append(marks, Choice{i, v})
+		}
+	}
+	p := helperMarkedPuzzle(t, marks)
+	rest := intset{3, 4, 5, 6, 7, 8, 9}
+	testcases := []struct {
+		index int
+		pvals intset
+		elims []Elimination
+	}{
+		{1, intset{1, 2}, nil},
+		{3, rest, helperElims(intset{1, 2}, NakedSubsetTechnique, 2, GroupID{GtypeRow, 1})},
+		{9, rest, helperElims(intset{1, 2}, NakedSubsetTechnique, 2, GroupID{GtypeRow, 1})},
+		{10, rest, helperElims(intset{1, 2}, NakedSubsetTechnique, 2, GroupID{GtypeTile, 1})},
+		{28, newIntsetRange(9), nil},
+		{19, rest, helperElims(intset{1, 2}, NakedSubsetTechnique, 2, GroupID{GtypeTile, 1})},
+	}
+	for i, tc := range testcases {
+		s := p.squares[tc.index]
+		if !reflect.DeepEqual(s.pvals.values(), tc.pvals) || !reflect.DeepEqual(s.elims, tc.elims) {
+			t.Errorf("case %d: square %d has pvals %v, elims %+v; expected %v, %+v",
+				i+1, tc.index, s.pvals, s.elims, tc.pvals, tc.elims)
+		}
+	}
+	// eliminations are part of the squares
+	S := p.allSquares()[2]
+	if !reflect.DeepEqual(S.Elims, testcases[1].elims) {
+		t.Errorf("Square 3 has Elims %+v, expected %+v", S.Elims, testcases[1].elims)
+	}
+}
+
+func TestHiddenSubsets(t *testing.T) {
+	// only squares 1 and 2 in row 1 can be 1 or 2
+	var marks []Choice
+	for i := 3; i <= 9; i++ {
+		marks = append(marks, Choice{i, 1}, Choice{i, 2})
+	}
+	p := helperMarkedPuzzle(t, marks)
+	rest := intset{3, 4, 5, 6, 7, 8, 9}
+	testcases := []struct {
+		index int
+		pvals intset
+		elims []Elimination
+	}{
+		{1, intset{1, 2}, helperElims(rest, HiddenSubsetTechnique, 2, GroupID{GtypeRow, 1})},
+		{2, intset{1, 2}, helperElims(rest, HiddenSubsetTechnique, 2, GroupID{GtypeRow, 1})},
+		{3, rest, nil},
+		{10, rest, helperElims(intset{1, 2}, ClaimingTechnique, 2, GroupID{GtypeRow, 1}, GroupID{GtypeTile, 1})},
+		{28, newIntsetRange(9), nil},
+	}
+	for i, tc := range testcases {
+		s := p.squares[tc.index]
+		if !reflect.DeepEqual(s.pvals.values(), tc.pvals) || !reflect.DeepEqual(s.elims, tc.elims) {
+			t.Errorf("case %d: square %d has pvals %v, elims %+v; expected %v, %+v",
+				i+1, tc.index, s.pvals, s.elims, tc.pvals, tc.elims)
+		}
+	}
+}
+
+func TestPointing(t *testing.T) {
+	// only squares 1 and 2 in tile 1 can be 1
+	var marks []Choice
+	for _, i := range []int{3, 10, 11, 12, 19, 20, 21} {
+		marks = append(marks, Choice{i, 1})
+	}
+	p := helperMarkedPuzzle(t, marks)
+	pointed := helperElims(intset{1}, PointingTechnique, 2, GroupID{GtypeTile, 1}, GroupID{GtypeRow, 1})
+	for i := 4; i <= 9; i++ {
+		s := p.squares[i]
+		if !reflect.DeepEqual(s.pvals.values(), intset{2, 3, 4, 5, 6, 7, 8, 9}) || !reflect.DeepEqual(s.elims, pointed) {
+			t.Errorf("Square %d has pvals %v, elims %+v; expected 1 pointed out", i, s.pvals, s.elims)
+		}
+	}
+	if s := p.squares[13]; !reflect.DeepEqual(s.pvals.values(), newIntsetRange(9)) || s.elims != nil {
+		t.Errorf("Square 13 has pvals %v, elims %+v; expected all values", s.pvals, s.elims)
+	}
+}
+
+func TestAdvancedSolutions(t *testing.T) {
+	testcases := []struct {
+		geo     string
+		sidelen int
+		values  []int
+		choices int // choices made with advanced propagation
+	}{
+		{StandardGeometryName, 9, sixStarValues, 1},
+		{StandardGeometryName, 9, chronTwoValues, 0},
+		{StandardGeometryName, 9, fiveStarValues, 2},
+		{RectangularGeometryName, 12, SuDozen78097Values, 0},
+	}
+	for i, tc := range testcases {
+		basic, e := New(&Summary{Geometry: tc.geo, SideLength: tc.sidelen, Values: tc.values})
+		if e != nil {
+			t.Fatalf("case %d: Failed to create basic puzzle: %v", i+1, e)
+		}
+		advanced, e := New(&Summary{
+			Geometry: tc.geo, SideLength: tc.sidelen, Values: tc.values, Propagation: AdvancedPropagation,
+		})
+		if e != nil {
+			t.Fatalf("case %d: Failed to create advanced puzzle: %v", i+1, e)
+		}
+		bsolns, asolns := basic.allSolutions(), advanced.allSolutions()
+		if len(asolns) != len(bsolns) {
+			t.Fatalf("case %d: got %d solutions, expected %d", i+1, len(asolns), len(bsolns))
+		}
+		choices := 0
+		for j := range asolns {
+			if !reflect.DeepEqual(asolns[j].Values, bsolns[j].Values) {
+				t.Errorf("case %d: solution %d is %v, expected %v", i+1, j+1, asolns[j].Values, bsolns[j].Values)
+			}
+			choices += len(asolns[j].Choices)
+		}
+		if choices != tc.choices {
+			t.Errorf("case %d: made %d choices, expected %d", i+1, choices, tc.choices)
+		}
+	}
+}
+
+func TestSetPropagation(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: chronTwoValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	before, _ := p.Summary()
+	hash, _ := p.Hash()
+
+	update, e := p.SetPropagation(AdvancedPropagation)
+	if e != nil {
+		t.Fatalf("Failed to set advanced propagation: %v", e)
+	}
+	if len(update.Squares) == 0 || p.propagation != AdvancedPropagation {
+		t.Errorf("Setting advanced propagation changed no squares")
+	}
+	after, _ := p.Summary()
+	if after.Propagation != AdvancedPropagation || !reflect.DeepEqual(after.Values, before.Values) {
+		t.Errorf("Summary after setting advanced propagation is %+v", after)
+	}
+	if h, _ := p.Hash(); h != hash {
+		t.Errorf("Propagation changed the hash from %v to %v", hash, h)
+	}
+	// copies and rebuilt puzzles keep the propagation level
+	if c := p.copy(); !reflect.DeepEqual(c.allSquares(), p.allSquares()) || c.propagation != p.propagation {
+		t.Errorf("Copy of advanced puzzle differs from the original")
+	}
+	if np, e := New(after); e != nil || !reflect.DeepEqual(np.allSquares(), p.allSquares()) {
+		t.Errorf("Puzzle from advanced summary differs from the original (%v)", e)
+	}
+	if update, e = p.SetPropagation(AdvancedPropagation); e != nil || len(update.Squares) != 0 {
+		t.Errorf("Setting advanced propagation again gave %v, %v", update, e)
+	}
+
+	update, e = p.SetPropagation(BasicPropagation)
+	if e != nil {
+		t.Fatalf("Failed to set basic propagation: %v", e)
+	}
+	if again, _ := p.Summary(); !reflect.DeepEqual(again, before) {
+		t.Errorf("Summary after setting basic propagation is %+v, expected %+v", again, before)
+	}
+	for _, S := range p.allSquares() {
+		if S.Elims != nil {
+			t.Errorf("Square %d has Elims after basic propagation: %+v", S.Index, S.Elims)
+		}
+	}
+
+	// bad levels
+	for _, level := range []Propagation{-1, AdvancedPropagation + 1} {
+		if _, e := p.SetPropagation(level); e == nil || e.(Error).Attribute != PropagationAttribute {
+			t.Errorf("Setting propagation to %d gave error %v", level, e)
+		}
+		s := &Summary{Geometry: StandardGeometryName, SideLength: 9, Propagation: level}
+		if _, e := New(s); e == nil || e.(Error).Attribute != PropagationAttribute {
+			t.Errorf("Creating puzzle with propagation %d gave error %v", level, e)
+		}
+	}
+}
@@ -19,9 +19,14 @@
 package puzzle
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"time"
 )
 
 /*
@@ -64,6 +69,41 @@ func NewHandler(w http.ResponseWriter, r *http.Request) (*Puzzle, error) {
 	return p, p.StateHandler(w, r)
 }
 
+// GenerateHandler is a POST handler that reads JSON-encoded
+// GenerateOptions from the request body and calls Generate with
+// them.  The Summary of the generated puzzle is sent as a 200
+// response, and is also returned to the golang caller.  If
+// Generate returns an error, or if we can't decode the posted
+// options, the error is sent as a 400 response and returned to
+// the caller, just as with NewHandler.  Puzzles with side lengths
+// over maxGenerateSideLength are refused, and generation always
+// stops after maxSolveTimeout, or when the client goes away.
+func GenerateHandler(w http.ResponseWriter, r *http.Request) (*Summary, error) {
+	dec := json.NewDecoder(r.Body)
+	var options GenerateOptions
+	e := dec.Decode(&options)
+	if e != nil {
+		return nil, writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), maxSolveTimeout)
+	defer cancel()
+	var summary *Summary
+	if sl := options.SideLength; sl > maxGenerateSideLength {
+		e = rangeError(SideLengthAttribute, sl, 0, maxGenerateSideLength)
+	} else {
+		summary, e = GenerateContext(ctx, &options)
+	}
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return nil, writeError(errorFormatError, ErrorData{"GenerateHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return nil, writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return summary, writeJSON(summary, http.StatusOK, w, r)
+}
+
 /*
 
 Puzzle Download Methods
@@ -90,15 +130,184 @@ func (p *Puzzle) StateHandler(w http.ResponseWriter, r *http.Request) error {
 	return writeJSON(p.state(), http.StatusOK, w, r)
 }
 
-// SolutionsHandler responds with the Puzzle's solutions (or the
-// Error produced by computing the puzzle's solutions).  If we
-// can't encode the response to the client successfully, we give
-// both the client and the golang caller an Error response.
+// SolutionsHandler responds with a SolveResult giving the
+// Puzzle's solutions (or the Error produced by computing the
+// puzzle's solutions).  The search can be bounded by query
+// parameters: max is the most solutions to find, nodes is the
+// most guesses to make, timeout is a duration (such as "5s") to
+// search for, and deadline is an RFC 3339 time at which to stop
+// searching.  The workers parameter is the number of goroutines
+// to search with (at most the number of CPUs), and backend is
+// the solver to use ("ariadne", the default, or "dlx").  If the
+// stats parameter is true, the result has statistics about the
+// search, and if the trace parameter is true, it has a trace of
+// the search.  The search always stops after maxSolveTimeout,
+// and it also stops if the client goes away.  If we can't decode
+// the query parameters, we send a 400 response.  If we can't
+// encode the response to the client successfully, we give both
+// the client and the golang caller an Error response.
 func (p *Puzzle) SolutionsHandler(w http.ResponseWriter, r *http.Request) error {
 	if !p.isValid() {
 		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
 	}
-	return writeJSON(p.allSolutions(), http.StatusOK, w, r)
+	options, e := solveOptions(r.URL.Query(), time.Now())
+	if e != nil {
+		return writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+	}
+	result, e := p.SolutionsContext(r.Context(), options)
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return writeError(errorFormatError, ErrorData{"SolutionsHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return writeJSON(result, http.StatusOK, w, r)
+}
+
+// maxSolveTimeout is the longest a solutions request can take,
+// so clients can't tie up the server indefinitely.
+const maxSolveTimeout = 30 * time.Second
+
+// maxGenerateSideLength is the largest side length of puzzles
+// that clients can have generated.
+const maxGenerateSideLength = 16
+
+// solveOptions decodes the query parameters of a solutions
+// request.  The deadline is the earliest of the one given, the
+// one implied by the timeout, and the one implied by
+// maxSolveTimeout, all relative to now.
+func solveOptions(query url.Values, now time.Time) (SolveOptions, error) {
+	options := SolveOptions{Deadline: now.Add(maxSolveTimeout)}
+	var e error
+	if s := query.Get("max"); s != "" {
+		if options.MaxSolutions, e = strconv.Atoi(s); e != nil || options.MaxSolutions < 0 {
+			return options, fmt.Errorf("Invalid max solutions: %q", s)
+		}
+	}
+	if s := query.Get("nodes"); s != "" {
+		if options.MaxNodes, e = strconv.Atoi(s); e != nil || options.MaxNodes < 0 {
+			return options, fmt.Errorf("Invalid node budget: %q", s)
+		}
+	}
+	if s := query.Get("workers"); s != "" {
+		if options.Workers, e = strconv.Atoi(s); e != nil || options.Workers < 1 {
+			return options, fmt.Errorf("Invalid number of workers: %q", s)
+		}
+		if max := runtime.NumCPU(); options.Workers > max {
+			options.Workers = max
+		}
+	}
+	switch s := query.Get("backend"); s {
+	case "", AriadneBackend.String():
+	case DancingLinksBackend.String():
+		options.Backend = DancingLinksBackend
+	default:
+		return options, fmt.Errorf("Invalid solver backend: %q", s)
+	}
+	if s := query.Get("stats"); s != "" {
+		if options.Stats, e = strconv.ParseBool(s); e != nil {
+			return options, fmt.Errorf("Invalid stats flag: %q", s)
+		}
+	}
+	if s := query.Get("trace"); s != "" {
+		if options.Trace, e = strconv.ParseBool(s); e != nil {
+			return options, fmt.Errorf("Invalid trace flag: %q", s)
+		}
+	}
+	if s := query.Get("timeout"); s != "" {
+		timeout, e := time.ParseDuration(s)
+		if e != nil || timeout <= 0 {
+			return options, fmt.Errorf("Invalid timeout: %q", s)
+		}
+		if deadline := now.Add(timeout); deadline.Before(options.Deadline) {
+			options.Deadline = deadline
+		}
+	}
+	if s := query.Get("deadline"); s != "" {
+		deadline, e := time.Parse(time.RFC3339, s)
+		if e != nil {
+			return options, fmt.Errorf("Invalid deadline: %q", s)
+		}
+		if deadline.Before(options.Deadline) {
+			options.Deadline = deadline
+		}
+	}
+	return options, nil
+}
+
+// HintHandler responds with the Puzzle's next Hint (or the
+// Error produced by finding it).  The response is null if there
+// is no logical next step.  If we can't encode the response to
+// the client successfully, we give both the client and the
+// golang caller an Error response.
+func (p *Puzzle) HintHandler(w http.ResponseWriter, r *http.Request) error {
+	if !p.isValid() {
+		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
+	}
+	hint, e := p.Hint()
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return writeError(errorFormatError, ErrorData{"HintHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return writeJSON(hint, http.StatusOK, w, r)
+}
+
+// MinimalityHandler responds with the Puzzle's Minimality (or
+// the Error produced by analyzing it).  As with solutions, the
+// analysis always stops after maxSolveTimeout, and it also stops
+// if the client goes away, in which case the response gives the
+// reason it stopped.  If we can't encode the response to the
+// client successfully, we give both the client and the golang
+// caller an Error response.
+func (p *Puzzle) MinimalityHandler(w http.ResponseWriter, r *http.Request) error {
+	if !p.isValid() {
+		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), maxSolveTimeout)
+	defer cancel()
+	m, e := p.MinimalityContext(ctx)
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return writeError(errorFormatError, ErrorData{"MinimalityHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return writeJSON(m, http.StatusOK, w, r)
+}
+
+// ExplainHandler responds with the Explanation of the square
+// whose index is given by the "index" query parameter (or the
+// Error produced by explaining it).  If we can't decode the
+// index, we send a 400 response.  If we can't encode the
+// response to the client successfully, we give both the client
+// and the golang caller an Error response.
+func (p *Puzzle) ExplainHandler(w http.ResponseWriter, r *http.Request) error {
+	if !p.isValid() {
+		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
+	}
+	s := r.URL.Query().Get("index")
+	index, e := strconv.Atoi(s)
+	if e != nil {
+		return writeError(requestDecodingError, ErrorData{fmt.Sprintf("Invalid square index: %q", s)}, w, r)
+	}
+	x, e := p.Explain(index)
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return writeError(errorFormatError, ErrorData{"ExplainHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return writeJSON(x, http.StatusOK, w, r)
 }
 
 /*
@@ -140,6 +349,90 @@ func (p *Puzzle) AssignHandler(w http.ResponseWriter, r *http.Request) (*Choice,
 	return &choice, update, writeJSON(update, http.StatusOK, w, r)
 }
 
+// UnassignHandler is a POST handler that reads a JSON-encoded
+// square index and clears the value assigned to that square.
+// The poster gets the Content object returned from Unassign (or
+// an error).  The caller gets the posted index as well as the
+// response objects, just as with AssignHandler.
+func (p *Puzzle) UnassignHandler(w http.ResponseWriter, r *http.Request) (*int, *Content, error) {
+	if !p.isValid() {
+		return nil, nil, writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
+	}
+	dec := json.NewDecoder(r.Body)
+	var index int
+	e := dec.Decode(&index)
+	if e != nil {
+		return nil, nil, writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+	}
+	update, e := p.Unassign(index)
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return &index, nil, writeError(errorFormatError, ErrorData{"UnassignHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return &index, nil, writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return &index, update, writeJSON(update, http.StatusOK, w, r)
+}
+
+// MarkHandler is a POST handler that applies a posted mark to a
+// puzzle.  The poster gets the Content object returned from the
+// mark (or an error).  The caller gets the posted Mark as well
+// as the response objects.  (If we can't decode the posted mark,
+// we return a null mark to the caller.)
+//
+// As with AssignHandler, if the mark succeeds but the response
+// can't be encoded, the caller gets both the update and an error.
+func (p *Puzzle) MarkHandler(w http.ResponseWriter, r *http.Request) (*Mark, *Content, error) {
+	if !p.isValid() {
+		return nil, nil, writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
+	}
+	dec := json.NewDecoder(r.Body)
+	var mark Mark
+	e := dec.Decode(&mark)
+	if e != nil {
+		return nil, nil, writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+	}
+	update, e := p.Mark(mark)
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return &mark, nil, writeError(errorFormatError, ErrorData{"MarkHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return &mark, nil, writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return &mark, update, writeJSON(update, http.StatusOK, w, r)
+}
+
+// UseMarksHandler is a POST handler that reads a JSON-encoded
+// boolean and passes it to the puzzle's SetUseMarks.  The poster
+// gets the Content object returned from SetUseMarks (or an
+// error).  The caller gets the posted boolean as well as the
+// response objects, just as with MarkHandler.
+func (p *Puzzle) UseMarksHandler(w http.ResponseWriter, r *http.Request) (*bool, *Content, error) {
+	if !p.isValid() {
+		return nil, nil, writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
+	}
+	dec := json.NewDecoder(r.Body)
+	var use bool
+	e := dec.Decode(&use)
+	if e != nil {
+		return nil, nil, writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+	}
+	update, e := p.SetUseMarks(use)
+	if e != nil {
+		err, ok := e.(Error)
+		if !ok {
+			return &use, nil, writeError(errorFormatError, ErrorData{"UseMarksHandler", e.Error()}, w, r)
+		}
+		err.Message = err.Error()
+		return &use, nil, writeJSON(err, http.StatusBadRequest, w, r)
+	}
+	return &use, update, writeJSON(update, http.StatusOK, w, r)
+}
+
 /*
 
 Utilities
@@ -216,6 +509,26 @@ func writeError(et handlerError, ed ErrorData,
 	return writeJSON(err, status, w, r)
 }
 
+// localize returns a response object whose Error messages are in
+// the given locale.  Errors and Content are copied rather than
+// changed.  Summaries are returned as is, since their Errors
+// are part of the puzzle data that clients send back.
+func localize(obj interface{}, locale string) interface{} {
+	if locale == DefaultLocale {
+		return obj
+	}
+	switch o := obj.(type) {
+	case Error:
+		o.Message = o.Localize(locale)
+		return o
+	case *Content:
+		c := *o
+		c.Errors = localizeErrors(o.Errors, locale)
+		return &c
+	}
+	return obj
+}
+
 // writeJSON is called by handlers to encode and send the client
 // response.  It returns an appropriate error status for the
 // handler to return to its caller, as follows:
@@ -232,9 +545,12 @@ func writeError(et handlerError, ed ErrorData,
 // 3. If no encoding error occurs, and the handler is sending a
 // non-Error object as the response to the client, writeJSON will
 // return nil to the handler.
+//
+// Error messages in the response are sent in the locale of the
+// request's context (see WithLocale).
 func writeJSON(obj interface{}, status int, w http.ResponseWriter, r *http.Request) error {
 	err, isErr := obj.(Error)
-	bytes, e := json.Marshal(obj)
+	bytes, e := json.Marshal(localize(obj, contextLocale(r.Context())))
 	if e != nil {
 		if isErr && err.Scope == InternalScope && err.Attribute == EncodeAttribute {
 			// We just failed to encode an Encoding error.  This
@@ -19,14 +19,18 @@
 package puzzle
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 /*
@@ -46,7 +50,7 @@ var badError = Error{Message: "unencodable error", Values: ErrorData{unencodable
 type badEncoderPuzzle Puzzle
 
 func (b *badEncoderPuzzle) Summary() (*Summary, error) {
-	return &Summary{nil, StandardGeometryName, 0, []int{}, nil}, nil
+	return &Summary{nil, StandardGeometryName, 0, []int{}, nil, nil, nil, false, 0, nil}, nil
 }
 
 func (b *badEncoderPuzzle) State() (*Content, error) {
@@ -65,17 +69,14 @@ func (b *badEncoderPuzzle) Copy() (*Puzzle, error) {
 	return (*Puzzle)(b), nil
 }
 
-func newBadEncoder(values []int) (*Puzzle, error) {
-	return (*Puzzle)(&badEncoderPuzzle{}), nil
-}
-
-func newReallyBadEncoder(values []int) (*Puzzle, error) {
+func newReallyBadEncoder(summary *Summary) (*Layout, error) {
 	return nil, badError
 }
 
 func init() {
-	knownGeometries["badgeometry"] = newBadEncoder
-	knownGeometries["reallybadgeometry"] = newReallyBadEncoder
+	if err := RegisterGeometry("reallybadgeometry", GeometryFunc(newReallyBadEncoder)); err != nil {
+		panic(err)
+	}
 }
 
 /*
@@ -86,11 +87,11 @@ GET handlers
 
 func TestPuzzleGetHandlers(t *testing.T) {
 	tests := []*Summary{
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil},
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil},
-		&Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil},
-		&Summary{nil, StandardGeometryName, 9, oneStarValues, nil},
-		&Summary{nil, StandardGeometryName, 9, sixStarValues, nil},
+		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil, nil, nil, false, 0, nil},
+		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil, nil, nil, false, 0, nil},
+		&Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil, nil, nil, false, 0, nil},
+		&Summary{nil, StandardGeometryName, 9, oneStarValues, nil, nil, nil, false, 0, nil},
+		&Summary{nil, StandardGeometryName, 9, sixStarValues, nil, nil, nil, false, 0, nil},
 	}
 	for i, test := range tests {
 		p, e := New(test)
@@ -102,12 +103,27 @@ func TestPuzzleGetHandlers(t *testing.T) {
 			p.SummaryHandler,
 			p.StateHandler,
 			p.SolutionsHandler,
+			p.HintHandler,
+			p.MinimalityHandler,
 		}
 		osummary, isummary := Summary{}, *p.summary()
 		ostate, istate := Content{}, *p.state()
-		osolns, isolns := []Solution{}, p.allSolutions()
-		outputs := []interface{}{&osummary, &ostate, &osolns}
-		inputs := []interface{}{&isummary, &istate, &isolns}
+		isolns, e := p.SolutionsContext(context.Background(), SolveOptions{})
+		if e != nil {
+			t.Fatalf("test %d: Solving puzzle failed: %v", i, e)
+		}
+		osolns := &SolveResult{}
+		ohint, ihint := &Hint{}, p.hint()
+		if ihint != nil {
+			ihint.Name, ihint.Message = ihint.Technique.Name(ihint.Size), ihint.String()
+		}
+		ominimal := &Minimality{}
+		iminimal, e := p.Minimality()
+		if e != nil {
+			t.Fatalf("test %d: Analyzing puzzle failed: %v", i, e)
+		}
+		outputs := []interface{}{&osummary, &ostate, osolns, &ohint, ominimal}
+		inputs := []interface{}{&isummary, &istate, isolns, &ihint, iminimal}
 		for j, handler := range handlers {
 			handlerFunc := func(w http.ResponseWriter, r *http.Request) {
 				err := handler(w, r)
@@ -151,6 +167,9 @@ func TestGetHandlerErrors(t *testing.T) {
 		p.SummaryHandler,
 		p.StateHandler,
 		p.SolutionsHandler,
+		p.HintHandler,
+		p.MinimalityHandler,
+		p.ExplainHandler,
 	}
 	for _, handler := range handlers {
 		handlerFunc := func(w http.ResponseWriter, r *http.Request) {
@@ -173,6 +192,166 @@ func TestGetHandlerErrors(t *testing.T) {
 	}
 }
 
+func TestSolutionsHandlerQuery(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Creation of puzzle failed: %v", e)
+	}
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		p.SolutionsHandler(w, r)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handlerFunc))
+	defer ts.Close()
+
+	testcases := []struct {
+		query    string
+		status   int
+		numsolns int
+		reason   StopReason
+	}{
+		{"?max=2", http.StatusOK, 2, SolutionLimitStop},
+		{"?nodes=1", http.StatusOK, 0, NodeLimitStop},
+		{"?max=1&timeout=10s", http.StatusOK, 1, SolutionLimitStop},
+		{"?max=20&workers=2", http.StatusOK, 20, SolutionLimitStop},
+		{"?deadline=2015-01-01T00:00:00Z", http.StatusOK, 0, DeadlineStop},
+		{"?backend=dlx", http.StatusOK, 288, CompleteStop},
+		{"?backend=dlx&max=5", http.StatusOK, 5, SolutionLimitStop},
+		{"?max=3&stats=true&trace=true", http.StatusOK, 3, SolutionLimitStop},
+		{"?max=two", http.StatusBadRequest, 0, CompleteStop},
+		{"?nodes=-1", http.StatusBadRequest, 0, CompleteStop},
+		{"?timeout=10", http.StatusBadRequest, 0, CompleteStop},
+		{"?deadline=tomorrow", http.StatusBadRequest, 0, CompleteStop},
+		{"?workers=0", http.StatusBadRequest, 0, CompleteStop},
+		{"?backend=knuth", http.StatusBadRequest, 0, CompleteStop},
+		{"?stats=maybe", http.StatusBadRequest, 0, CompleteStop},
+	}
+	for i, tc := range testcases {
+		r, e := http.Get(ts.URL + tc.query)
+		if e != nil {
+			t.Fatalf("test %d: Request error: %v", i, e)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if e != nil {
+			t.Fatalf("test %d: Read error on response body: %v", i, e)
+		}
+		if r.StatusCode != tc.status {
+			t.Errorf("test %d: Status was %v, expected %v", i, r.StatusCode, tc.status)
+		}
+		if r.StatusCode != http.StatusOK {
+			var err Error
+			if e = json.Unmarshal(b, &err); e != nil {
+				t.Fatalf("test %d: Unmarshal failed: %v", i, e)
+			}
+			if err.Attribute != DecodeAttribute {
+				t.Errorf("test %d: Got error %v, expected a decoding error", i, err)
+			}
+			continue
+		}
+		var result SolveResult
+		if e = json.Unmarshal(b, &result); e != nil {
+			t.Fatalf("test %d: Unmarshal failed: %v", i, e)
+		}
+		if len(result.Solutions) != tc.numsolns || result.Reason != tc.reason {
+			t.Errorf("test %d: Got %d solutions (stopped: %v), expected %d (stopped: %v)",
+				i, len(result.Solutions), result.Reason, tc.numsolns, tc.reason)
+		}
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: bound4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Creation of puzzle failed: %v", e)
+	}
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		p.ExplainHandler(w, r)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handlerFunc))
+	defer ts.Close()
+
+	testcases := []struct {
+		query  string
+		status int
+		attr   ErrorAttribute
+	}{
+		{"?index=4", http.StatusOK, UnknownAttribute},
+		{"?index=16", http.StatusOK, UnknownAttribute},
+		{"", http.StatusBadRequest, DecodeAttribute},
+		{"?index=a4", http.StatusBadRequest, DecodeAttribute},
+		{"?index=17", http.StatusBadRequest, IndexAttribute},
+	}
+	for i, tc := range testcases {
+		r, e := http.Get(ts.URL + tc.query)
+		if e != nil {
+			t.Fatalf("test %d: Request error: %v", i, e)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if e != nil {
+			t.Fatalf("test %d: Read error on response body: %v", i, e)
+		}
+		if r.StatusCode != tc.status {
+			t.Errorf("test %d: Status was %v, expected %v", i, r.StatusCode, tc.status)
+		}
+		if r.StatusCode != http.StatusOK {
+			var err Error
+			if e = json.Unmarshal(b, &err); e != nil {
+				t.Fatalf("test %d: Unmarshal failed: %v", i, e)
+			}
+			if err.Attribute != tc.attr {
+				t.Errorf("test %d: Got error %v, expected attribute %v", i, err, tc.attr)
+			}
+			continue
+		}
+		var result Explanation
+		if e = json.Unmarshal(b, &result); e != nil {
+			t.Fatalf("test %d: Unmarshal failed: %v", i, e)
+		}
+		expected, _ := p.Explain(result.Index)
+		if !reflect.DeepEqual(&result, expected) {
+			t.Errorf("test %d: Received %+v, expected %+v", i, result, expected)
+		}
+	}
+}
+
+func TestSolveOptions(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		query   string
+		options SolveOptions
+	}{
+		{"", SolveOptions{0, 0, now.Add(maxSolveTimeout), 0, AriadneBackend, false, false}},
+		{"max=2&nodes=100", SolveOptions{2, 100, now.Add(maxSolveTimeout), 0, AriadneBackend, false, false}},
+		{"timeout=5s", SolveOptions{0, 0, now.Add(5 * time.Second), 0, AriadneBackend, false, false}},
+		{"timeout=1h", SolveOptions{0, 0, now.Add(maxSolveTimeout), 0, AriadneBackend, false, false}},
+		{"deadline=2015-06-01T12:00:01Z", SolveOptions{0, 0, now.Add(time.Second), 0, AriadneBackend, false, false}},
+		{"deadline=2015-06-01T12:00:02Z&timeout=1s", SolveOptions{0, 0, now.Add(time.Second), 0, AriadneBackend, false, false}},
+		{"workers=1", SolveOptions{0, 0, now.Add(maxSolveTimeout), 1, AriadneBackend, false, false}},
+		{"workers=100000", SolveOptions{0, 0, now.Add(maxSolveTimeout), runtime.NumCPU(), AriadneBackend, false, false}},
+		{"backend=ariadne", SolveOptions{0, 0, now.Add(maxSolveTimeout), 0, AriadneBackend, false, false}},
+		{"backend=dlx&max=2", SolveOptions{2, 0, now.Add(maxSolveTimeout), 0, DancingLinksBackend, false, false}},
+		{"stats=true", SolveOptions{0, 0, now.Add(maxSolveTimeout), 0, AriadneBackend, true, false}},
+		{"stats=1&trace=true", SolveOptions{0, 0, now.Add(maxSolveTimeout), 0, AriadneBackend, true, true}},
+		{"trace=false", SolveOptions{0, 0, now.Add(maxSolveTimeout), 0, AriadneBackend, false, false}},
+	}
+	for i, tc := range testcases {
+		query, e := url.ParseQuery(tc.query)
+		if e != nil {
+			t.Fatalf("test %d: Bad query: %v", i, e)
+		}
+		options, e := solveOptions(query, now)
+		if e != nil {
+			t.Errorf("test %d: Failed to decode options: %v", i, e)
+		} else if options.MaxSolutions != tc.options.MaxSolutions ||
+			options.MaxNodes != tc.options.MaxNodes || !options.Deadline.Equal(tc.options.Deadline) ||
+			options.Workers != tc.options.Workers || options.Backend != tc.options.Backend ||
+			options.Stats != tc.options.Stats || options.Trace != tc.options.Trace {
+			t.Errorf("test %d: Got options %+v, expected %+v", i, options, tc.options)
+		}
+	}
+}
+
 /*
 
 POST handlers
@@ -181,9 +360,9 @@ POST handlers
 
 func TestNewHandler(t *testing.T) {
 	testcases := []*Summary{
-		&Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil},
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil},
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil},
+		&Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil, nil, nil, false, 0, nil},
+		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil, nil, nil, false, 0, nil},
+		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil, nil, nil, false, 0, nil},
 	}
 	for i, tc := range testcases {
 		pe, err := New(tc)
@@ -286,6 +465,95 @@ func TestNewHandlerErrors(t *testing.T) {
 	}
 }
 
+func TestGenerateHandler(t *testing.T) {
+	testcases := []string{
+		`{"geometry":"square","sidelen":4,"seed":1}`,
+		`{"geometry":"rectangular","sidelen":6,"rating":2,"symmetric":true,"seed":2}`,
+	}
+	for i, tc := range testcases {
+		var options GenerateOptions
+		if err := json.Unmarshal([]byte(tc), &options); err != nil {
+			t.Fatalf("case %d: Failed to decode options: %v", i, err)
+		}
+		expected, err := Generate(&options)
+		if err != nil {
+			t.Fatalf("case %d: Failed to generate puzzle: %v", i, err)
+		}
+
+		handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+			summary, e := GenerateHandler(w, r)
+			if e != nil {
+				t.Fatalf("Failed to generate puzzle in handler: %v", e)
+			}
+			if !reflect.DeepEqual(summary, expected) {
+				t.Errorf("case %d: Generated summary %+v, expected %+v", i, *summary, *expected)
+			}
+		}
+		ts := httptest.NewServer(http.HandlerFunc(handlerFunc))
+		defer ts.Close()
+
+		r, e := http.Post(ts.URL, "application/json", strings.NewReader(tc))
+		if e != nil {
+			t.Fatalf("case %d: Request error: %v", i, e)
+		}
+		if r.StatusCode != http.StatusOK {
+			t.Errorf("case %d: Status was %v, expected %v", i, r.StatusCode, http.StatusOK)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if e != nil {
+			t.Fatalf("case %d: Read error on body: %v", i, e)
+		}
+		var summary *Summary
+		if e = json.Unmarshal(b, &summary); e != nil {
+			t.Fatalf("case %d: Unmarshal failed: %v", i, e)
+		}
+		if !reflect.DeepEqual(summary, expected) {
+			t.Errorf("case %d: Summary was %+v, expected %+v", i, *summary, *expected)
+		}
+	}
+}
+
+func TestGenerateHandlerErrors(t *testing.T) {
+	testcases := []testNewHandlerErrorTestcase{
+		{"bad input", `"string not options"`, DecodeAttribute},
+		{"unknown geometry", `{"geometry":"nope","sidelen":4}`, GeometryAttribute},
+		{"bad rating", `{"geometry":"square","sidelen":4,"rating":7}`, RatingAttribute},
+		{"too large", `{"geometry":"square","sidelen":25}`, SideLengthAttribute},
+	}
+
+	for _, tc := range testcases {
+		handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+			summary, e := GenerateHandler(w, r)
+			if e == nil {
+				t.Errorf("Test %s: Successfully generated puzzle: %v", tc.name, summary)
+			}
+		}
+		ts := httptest.NewServer(http.HandlerFunc(handlerFunc))
+		defer ts.Close()
+
+		r, e := http.Post(ts.URL, "application/json", strings.NewReader(tc.data))
+		if e != nil {
+			t.Fatalf("Request error: %v", e)
+		}
+		if r.StatusCode != http.StatusBadRequest {
+			t.Errorf("Test %s: HTTP Status was %v, expected %v",
+				tc.name, r.StatusCode, http.StatusBadRequest)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		var err Error
+		e = json.Unmarshal(b, &err)
+		if e != nil {
+			t.Errorf("Test %s: response decode error: %v", tc.name, e)
+		}
+		if err.Attribute != tc.attribute {
+			t.Errorf("Test %s: Attribute was %v, expected %v",
+				tc.name, err.Attribute, tc.attribute)
+		}
+	}
+}
+
 func TestAssignHandler(t *testing.T) {
 	choices := []Choice{{13, 2}, {10, 4}, {15, 4}}
 	p1, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
@@ -432,3 +700,284 @@ func TestAssignHandlerErrors(t *testing.T) {
 		t.Fatalf("Read error on result: %v", e)
 	}
 }
+
+func TestLocalizedHandler(t *testing.T) {
+	p, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: bound4PuzzleValues})
+	if err != nil {
+		t.Fatalf("Failed to create initial puzzle: %v", err)
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		locale := MatchLocale(r.Header.Get("Accept-Language"))
+		p.AssignHandler(w, r.WithContext(WithLocale(r.Context(), locale)))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	post := func(choice Choice, accept string) []byte {
+		bytes, e := json.Marshal(choice)
+		if e != nil {
+			t.Fatalf("Failed to encode %v: %v", choice, e)
+		}
+		req, e := http.NewRequest("POST", ts.URL, strings.NewReader(string(bytes)))
+		if e != nil {
+			t.Fatalf("Failed to create request: %v", e)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", accept)
+		r, e := http.DefaultClient.Do(req)
+		if e != nil {
+			t.Fatalf("Request error: %v", e)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if e != nil {
+			t.Fatalf("Read error on result: %v", e)
+		}
+		return b
+	}
+
+	// errors returned by the handler are localized
+	expected := rangeError(IndexAttribute, 17, 1, 16)
+	for _, accept := range []string{"ja-JP,ja;q=0.9", "en-US", ""} {
+		var err Error
+		if e := json.Unmarshal(post(Choice{17, 1}, accept), &err); e != nil {
+			t.Fatalf("Unmarshal failed: %v", e)
+		}
+		if m := expected.Localize(MatchLocale(accept)); err.Message != m {
+			t.Errorf("Got message %q for %q, expected %q", err.Message, accept, m)
+		}
+	}
+
+	// and so are errors in the puzzle's content
+	post(Choice{7, 1}, "")
+	var update Content
+	if e := json.Unmarshal(post(Choice{8, 1}, "ja"), &update); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if len(update.Errors) == 0 {
+		t.Fatalf("Conflicting assignment produced no errors")
+	}
+	for i, err := range p.allErrors(false) {
+		if m := err.Localize("ja"); update.Errors[i].Message != m {
+			t.Errorf("Got message %q for error %d, expected %q", update.Errors[i].Message, i, m)
+		}
+	}
+	for _, err := range p.errors {
+		if err.Message != "" {
+			t.Errorf("Puzzle error %+v was changed", err)
+		}
+	}
+}
+
+func TestMarkHandler(t *testing.T) {
+	marks := []Mark{{2, 2, false}, {2, 2, true}, {4, 4, false}}
+	p1, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues, UseMarks: true})
+	if err != nil {
+		t.Fatalf("Failed to create initial puzzle1: %v", err)
+	}
+	p2, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues, UseMarks: true})
+	if err != nil {
+		t.Fatalf("Failed to create initial puzzle2: %v", err)
+	}
+
+	for i, mark := range marks {
+		bytes, err := json.Marshal(mark)
+		if err != nil {
+			t.Fatalf("Case %d: Failed to encode mark: %v", i, err)
+		}
+		up2, err := p2.Mark(mark)
+		if err != nil {
+			t.Fatalf("Case %d: Failed to mark p2: %v", i, err)
+		}
+
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			m1, update, err := p1.MarkHandler(w, r)
+			if update == nil {
+				t.Fatalf("Case %d: Failed to mark p1: %v", i, err)
+			}
+			if err != nil {
+				t.Fatalf("Case %d: Error on mark of p1: %v", i, err)
+			}
+			if !reflect.DeepEqual(p1.summary(), p2.summary()) {
+				t.Errorf("Case %d: Identical puzzles differ after mark:\n%v\n%v",
+					i, p1, p2)
+			}
+			if !reflect.DeepEqual(m1, &mark) {
+				t.Errorf("Case %d: Encoded (%v) and returned (%v) mark differ!",
+					i, m1, mark)
+			}
+		}
+		ts := httptest.NewServer(http.HandlerFunc(handler))
+		defer ts.Close()
+
+		r, e := http.Post(ts.URL, "application/json", strings.NewReader(string(bytes)))
+		if e != nil {
+			t.Logf("case %d POST body: %s", i, bytes)
+			t.Fatalf("case %d: Request error: %v", i, e)
+		}
+		if r.StatusCode != http.StatusOK {
+			t.Errorf("case %d: Status was %v, expected %v", i, r.StatusCode, http.StatusOK)
+			t.Logf("case %d headers: %v\n", i, r.Header)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if e != nil {
+			t.Logf("test %d response body: %s\n", i, b)
+			t.Fatalf("test %d: Read error on summary: %v", i, e)
+		}
+
+		var update *Content
+		e = json.Unmarshal(b, &update)
+		if e != nil {
+			t.Fatalf("test %d: Unmarshal failed: %v", i, e)
+		}
+		if !reflect.DeepEqual(update, up2) {
+			t.Errorf("test %d: Content was %+v, expected %+v:", i, update, up2)
+		}
+	}
+}
+
+func TestMarkHandlerErrors(t *testing.T) {
+	p, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if err != nil {
+		t.Fatalf("Failed to create initial puzzle: %v", err)
+	}
+
+	handlers := []func(w http.ResponseWriter, r *http.Request){
+		func(w http.ResponseWriter, r *http.Request) {
+			m, update, err := p.MarkHandler(w, r)
+			if update != nil {
+				t.Errorf("Successful mark!")
+			}
+			if m == nil && err.(Error).Attribute != DecodeAttribute {
+				t.Errorf("No decode error but no returned mark")
+			}
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			use, update, err := p.UseMarksHandler(w, r)
+			if update != nil {
+				t.Errorf("Successful use marks!")
+			}
+			if use == nil && err.(Error).Attribute != DecodeAttribute {
+				t.Errorf("No decode error but no returned use marks")
+			}
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			index, update, err := p.UnassignHandler(w, r)
+			if update != nil {
+				t.Errorf("Successful unassign!")
+			}
+			if index == nil && err.(Error).Attribute != DecodeAttribute {
+				t.Errorf("No decode error but no returned index")
+			}
+		},
+	}
+	bodies := [][]interface{}{
+		{[]int{1, 2, 3}, Mark{1, 2, false}, Mark{2, 5, false}},
+		{[]int{1, 2, 3}},
+		{[]int{1, 2, 3}, 0, 2},
+	}
+	for i, handler := range handlers {
+		ts := httptest.NewServer(http.HandlerFunc(handler))
+		defer ts.Close()
+		for j, body := range bodies[i] {
+			bytes, err := json.Marshal(body)
+			if err != nil {
+				t.Fatalf("Case %d.%d: Failed to encode %v: %v", i, j, body, err)
+			}
+			r, e := http.Post(ts.URL, "application/json", strings.NewReader(string(bytes)))
+			if e != nil {
+				t.Logf("Post body: %s\n", bytes)
+				t.Fatalf("Case %d.%d: Request error: %v", i, j, e)
+			}
+			r.Body.Close()
+			if r.StatusCode != http.StatusBadRequest {
+				t.Errorf("Case %d.%d: Status was %v, expected %v", i, j, r.StatusCode, http.StatusBadRequest)
+			}
+		}
+	}
+}
+
+func TestUseMarksHandler(t *testing.T) {
+	p, err := New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Values:     rotation4Puzzle1PartialValues,
+		Marks:      []Choice{{2, 2}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create initial puzzle: %v", err)
+	}
+
+	var update *Content
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		use, up, err := p.UseMarksHandler(w, r)
+		if err != nil || use == nil || !*use {
+			t.Fatalf("Use marks failed (%v): %v", use, err)
+		}
+		update = up
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	r, e := http.Post(ts.URL, "application/json", strings.NewReader("true"))
+	if e != nil {
+		t.Fatalf("Request error: %v", e)
+	}
+	b, e := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if e != nil {
+		t.Fatalf("Read error on result: %v", e)
+	}
+	if r.StatusCode != http.StatusOK {
+		t.Errorf("Status was %v, expected %v", r.StatusCode, http.StatusOK)
+	}
+	var content *Content
+	if e = json.Unmarshal(b, &content); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if !reflect.DeepEqual(content, update) || len(content.Squares) != 4 || !p.useMarks {
+		t.Errorf("Content was %+v, expected %+v", content, update)
+	}
+}
+
+func TestUnassignHandler(t *testing.T) {
+	p, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if err != nil {
+		t.Fatalf("Failed to create initial puzzle: %v", err)
+	}
+	if _, err := p.Assign(Choice{2, 2}); err != nil {
+		t.Fatalf("Failed to assign initial choice: %v", err)
+	}
+
+	var update *Content
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		index, up, err := p.UnassignHandler(w, r)
+		if err != nil || index == nil || *index != 2 {
+			t.Fatalf("Unassign failed (%v): %v", index, err)
+		}
+		update = up
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	r, e := http.Post(ts.URL, "application/json", strings.NewReader("2"))
+	if e != nil {
+		t.Fatalf("Request error: %v", e)
+	}
+	b, e := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if e != nil {
+		t.Fatalf("Read error on result: %v", e)
+	}
+	if r.StatusCode != http.StatusOK {
+		t.Errorf("Status was %v, expected %v", r.StatusCode, http.StatusOK)
+	}
+	var content *Content
+	if e = json.Unmarshal(b, &content); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if !reflect.DeepEqual(content, update) || p.squares[2].aval != 0 {
+		t.Errorf("Content was %+v, expected %+v", content, update)
+	}
+}
@@ -19,7 +19,10 @@
 package puzzle
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 )
 
 /*
@@ -49,8 +52,8 @@ minotaur's maze.
 possible values.  (Any order for choosing the square works, this
 algorithm uses reading order.)
 
-3.2 Save the puzzle state, the chosen square, and the possible
-values on the top of the stack.
+3.2 Mark the puzzle's undo journal, and save the mark, the chosen
+square, and the possible values on the top of the stack.
 
 3.3 Assign the first of the possible values to the chosen square.
 
@@ -63,7 +66,7 @@ for its chosen square.
 
 4.2 If the stack is empty, stop.  The puzzle can't be solved.
 
-4.3 Restore the puzzle state from the state on the stack.
+4.3 Roll the puzzle back to the mark on the stack.
 
 4.4 Fill in the chosen square with the first remaining possible value.
 
@@ -79,59 +82,243 @@ solutions.  This algorithm can be easily adapted to find all such
 solutions by changing step 2 to save the solution and jump to
 step 4.
 
+Since nearly empty puzzles have an enormous number of solutions,
+the search can be bounded: by the number of solutions found, by
+the number of guesses made in step 3 (the nodes of the search),
+by a deadline, or by cancellation of a context.  When a bound is
+reached, the solutions found so far are returned, along with the
+reason the search stopped.
+
+The search can also be spread across goroutines, as described in
+parallel.go.  Because the subtrees of the search are merged in
+the order the serial search would visit them, the solutions come
+out the same either way.
+
 */
 
 // A choice records a point where Ariadne makes a choice
 type choice struct {
-	puz    *Puzzle
-	cindex int    // where the choice was made
-	ccount int    // how many branchings there are
-	cvalue int    // which branch was taken
-	cnext  intset // the branches left to try
+	mark   journalMark // the puzzle's history before the choice
+	cindex int         // where the choice was made
+	ccount int         // how many branchings there are
+	cvalue int         // which branch was taken
+	cnext  valueset    // the branches left to try
 }
 
 // A thread is a stack of choices
 type thread []choice
 
+// A StopReason says why a search for solutions stopped.
+type StopReason int
+
+// Constants for the stop reasons.  A search that isn't stopped
+// early is complete: it has found all the solutions.
+const (
+	CompleteStop StopReason = iota
+	SolutionLimitStop
+	NodeLimitStop
+	DeadlineStop
+	CanceledStop
+)
+
+// StopReasons implement Stringer
+func (r StopReason) String() string {
+	switch r {
+	case CompleteStop:
+		return "complete"
+	case SolutionLimitStop:
+		return "solution limit"
+	case NodeLimitStop:
+		return "node limit"
+	case DeadlineStop:
+		return "deadline"
+	case CanceledStop:
+		return "canceled"
+	default:
+		return "unknown stop reason"
+	}
+}
+
+// SolveOptions bound a search for solutions.  MaxSolutions is
+// the most solutions to find (2 is enough to check that a
+// puzzle's solution is unique), MaxNodes is the most guesses
+// to make, and Deadline is when to stop searching.  Zero values
+// mean no bound.  If Workers is more than 1, the search is
+// spread across that many goroutines.  Backend selects the
+// solver; Workers only applies to Ariadne's thread.  Stats asks
+// for statistics about the search, and Trace for a trace of it,
+// as described in trace.go.  Dancing links only keeps the Nodes
+// and WallTime statistics, and can't be traced; neither can a
+// search spread across workers.  Asking for a trace of either is
+// an error.
+type SolveOptions struct {
+	MaxSolutions int           `json:"maxSolutions,omitempty"`
+	MaxNodes     int           `json:"maxNodes,omitempty"`
+	Deadline     time.Time     `json:"deadline,omitempty"`
+	Workers      int           `json:"workers,omitempty"`
+	Backend      SolverBackend `json:"backend,omitempty"`
+	Stats        bool          `json:"stats,omitempty"`
+	Trace        bool          `json:"trace,omitempty"`
+}
+
+// A SolveResult gives the solutions found by a bounded search,
+// the Reason the search stopped, and the number of Nodes
+// (guesses) in the search.  Unless the search is complete, the
+// puzzle may have other solutions.  If statistics were asked
+// for, the result has the Stats of the whole search, and the
+// SolutionStats of the search up to the time each solution was
+// found (in the same order as the solutions).  If a trace was
+// asked for, the result has the Trace of the search.
+type SolveResult struct {
+	Solutions     []Solution   `json:"solutions"`
+	Reason        StopReason   `json:"reason"`
+	Nodes         int          `json:"nodes"`
+	Stats         *SolveStats  `json:"stats,omitempty"`
+	SolutionStats []SolveStats `json:"solutionStats,omitempty"`
+	Trace         []TraceStep  `json:"trace,omitempty"`
+}
+
+// A search keeps track of the bounds on a search for solutions
+// and the work done so far.  Once the search has stopped, its
+// reason is the reason it stopped.  A search can be shared by
+// the workers of a parallel search, so its counts are guarded by
+// a mutex.  If the search keeps statistics or a trace, it also
+// has the time it started, and once it's done it has the
+// statistics for each of the solutions it returns.
+type search struct {
+	ctx          context.Context
+	maxSolutions int
+	maxNodes     int
+	start        time.Time
+	tracing      bool
+	mutex        sync.Mutex
+	nodes        int
+	reason       StopReason
+	stats        *SolveStats
+	trace        []TraceStep
+	found        []SolveStats
+}
+
+// newSearch returns an unbounded search.
+func newSearch() *search {
+	return &search{ctx: context.Background()}
+}
+
+// stopped checks whether the search can't make another guess,
+// and counts the guess if it can.
+func (s *search) stopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reason != CompleteStop {
+		return true
+	}
+	switch err := s.ctx.Err(); {
+	case s.maxNodes > 0 && s.nodes >= s.maxNodes:
+		s.reason = NodeLimitStop
+	case err == context.DeadlineExceeded:
+		s.reason = DeadlineStop
+	case err != nil:
+		s.reason = CanceledStop
+	default:
+		s.nodes++
+	}
+	return s.reason != CompleteStop
+}
+
+// stop stops the search for the given reason, unless it has
+// already stopped.
+func (s *search) stop(reason StopReason) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reason == CompleteStop {
+		s.reason = reason
+	}
+}
+
 // solve a puzzle using Ariadne's thread.  Entered with a puzzle
 // and a stack of prior choices (which can be empty), this finds
 // the next possible solution and returns the puzzle and stack at
-// time of solution (or unsolvable error).
-func solve(p *Puzzle, t thread) (*Puzzle, thread) {
+// time of solution (or unsolvable error).  If the search stops
+// before finding a solution, the search has a reason for
+// stopping, and the puzzle returned is unfinished.
+func solve(p *Puzzle, t thread, s *search) (*Puzzle, thread) {
 	for {
-		if len(p.errors) == 0 && assignKnown(p) {
+		if len(p.errors) == 0 && s.assignKnown(p, t) {
 			return p, t
 		}
 		if len(p.errors) > 0 {
-			p, t = popChoice(p, t)
+			s.deadEnd(t)
+			p, t = s.popChoice(p, t)
 			if len(t) == 0 {
 				return p, t
 			}
 			continue
 		}
-		p, t = pushChoice(p, t)
+		if s.stopped() {
+			return p, t
+		}
+		p, t = s.pushChoice(p, t)
 	}
 }
 
 // allSolutions finds all solutions to a given puzzle.  The
 // puzzle is not altered.
 func (p *Puzzle) allSolutions() []Solution {
-	// first see if there are no choices needed
-	if vals, rating := rateNoChoices(p.copy()); vals != nil {
-		return []Solution{{Values: vals, Rating: rating}}
+	return p.solutions(newSearch())
+}
+
+// solutions finds the solutions to a given puzzle, within the
+// bounds of a search.  The puzzle is not altered.
+func (p *Puzzle) solutions(s *search) []Solution {
+	// first see if logical techniques are enough
+	r, grade := p.logicalSolution(s)
+	if r.solutions == nil {
+		// choices needed: do Ariadne's thread
+		r = threadSolutions(p.copy(), nil, s, grade, s.maxSolutions)
+		if s.maxSolutions > 0 && len(r.solutions) == s.maxSolutions {
+			s.stop(SolutionLimitStop)
+		}
 	}
+	s.found = r.stats
+	return r.solutions
+}
 
-	// choices needed: do Ariadne's thread
-	var solutions []Solution
-	var t thread
-	for p, t = solve(p.copy(), t); len(p.errors) == 0; p, t = solve(p, t) {
-		solutions = append(solutions, newSolution(p, t))
-		p, t = popChoice(p, t)
+// logicalSolution grades a puzzle, and returns the grade along
+// with the solution to the puzzle if logical techniques are
+// enough to find it.  Otherwise there are no solutions in the
+// result.
+func (p *Puzzle) logicalSolution(s *search) (r branchResult, grade *Grade) {
+	c, grade := p.grade()
+	if c != nil && len(c.errors) == 0 && c.isFilled() {
+		if vals := c.allValues(); p.allows(vals) {
+			r.add(Solution{Values: vals, Rating: grade.rating(), Grade: grade}, s.solved(nil))
+			r.finished = true
+		}
+	}
+	return r, grade
+}
+
+// threadSolutions follows Ariadne's thread from a puzzle and a
+// stack of prior choices until the choices are exhausted, or it
+// has found max solutions (0 means no maximum), or the search
+// stops.  It returns the solutions found, and whether it
+// finished without the search stopping.
+func threadSolutions(p *Puzzle, t thread, s *search, g *Grade, max int) (r branchResult) {
+	for p, t = solve(p, t, s); len(p.errors) == 0; p, t = solve(p, t, s) {
+		if !p.isFilled() {
+			return r
+		}
+		r.add(newSolution(p, t, g), s.solved(t))
+		if len(r.solutions) == max {
+			break
+		}
+		p, t = s.popChoice(p, t)
 		if len(t) == 0 {
 			break
 		}
 	}
-	return solutions
+	r.finished = true
+	return r
 }
 
 // Solutions finds all solutions to a given puzzle.  The
@@ -144,6 +331,53 @@ func (p *Puzzle) Solutions() ([]Solution, error) {
 	return p.allSolutions(), nil
 }
 
+// SolutionsContext finds the solutions to a given puzzle, within
+// the bounds given by the options, stopping early if the context
+// is done.  The solutions found are returned along with the
+// reason the search stopped.  As with Solutions, the puzzle is
+// not altered.
+func (p *Puzzle) SolutionsContext(ctx context.Context, options SolveOptions) (*SolveResult, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition)
+	}
+	if options.Backend != AriadneBackend && options.Backend != DancingLinksBackend {
+		return nil, argumentError(BackendAttribute, InvalidArgumentCondition, options.Backend)
+	}
+	if options.Trace && options.Backend == DancingLinksBackend {
+		return nil, argumentError(TraceAttribute, InvalidArgumentCondition, options.Backend)
+	}
+	if options.Trace && options.Workers > 1 {
+		return nil, argumentError(TraceAttribute, InvalidArgumentCondition, options.Workers)
+	}
+	s, cancel := boundedSearch(ctx, options)
+	defer cancel()
+	s.start, s.tracing = time.Now(), options.Trace
+	if options.Stats {
+		s.stats = &SolveStats{}
+	}
+	var solutions []Solution
+	if options.Backend == DancingLinksBackend {
+		solutions = p.dlxSolutions(s)
+	} else if options.Workers > 1 {
+		solutions = p.parallelSolutions(s, options.Workers)
+	} else {
+		solutions = p.solutions(s)
+	}
+	return &SolveResult{Solutions: solutions, Reason: s.reason, Nodes: s.nodes,
+		Stats: s.statistics(), SolutionStats: s.found, Trace: s.trace}, nil
+}
+
+// boundedSearch returns a search within the bounds given by the
+// options, which stops early if the context is done, along with
+// the function to call once the search is over.
+func boundedSearch(ctx context.Context, options SolveOptions) (*search, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if !options.Deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, options.Deadline)
+	}
+	return &search{ctx: ctx, maxSolutions: options.MaxSolutions, maxNodes: options.MaxNodes}, cancel
+}
+
 // assignKnown takes a solvable puzzle and tries to solve it by
 // assigning all the single-possible-value empty squares
 // to their known value and then looping to see if those
@@ -153,24 +387,44 @@ func (p *Puzzle) Solutions() ([]Solution, error) {
 // there are empty squares left, or if one of its assignments
 // make the puzzle unsolvable, then it returns false.
 func assignKnown(p *Puzzle) bool {
+	return fillKnown(p, nil)
+}
+
+// fillKnown does the work of assignKnown.  If pass isn't nil, it
+// is called at the end of each pass over the puzzle's squares
+// with the values assigned in that pass.
+func fillKnown(p *Puzzle, pass func(known []Choice)) bool {
 	for {
+		var assigned []Choice
 		known, unknown := 0, 0
 		for i := 1; i <= p.mapping.scount; i++ {
 			if p.squares[i].aval == 0 {
+				v := 0
 				if p.squares[i].bval != 0 {
+					v = p.squares[i].bval
+				} else if p.squares[i].pvals.len() == 1 {
+					v = p.squares[i].pvals.next(0)
+				}
+				if v != 0 {
 					known++
-					p.assign(i, p.squares[i].bval)
-				} else if len(p.squares[i].pvals) == 1 {
-					known++
-					p.assign(i, p.squares[i].pvals[0])
+					p.assign(i, v)
+					if pass != nil {
+						assigned = append(assigned, Choice{Index: i, Value: v})
+					}
 				} else {
 					unknown++
 				}
 				if len(p.errors) > 0 {
-					return false
+					break
 				}
 			}
 		}
+		if pass != nil {
+			pass(assigned)
+		}
+		if len(p.errors) > 0 {
+			return false
+		}
 		if unknown == 0 {
 			return true
 		}
@@ -180,33 +434,57 @@ func assignKnown(p *Puzzle) bool {
 	}
 }
 
-// popChoice resets a puzzle to the next choice after the current
-// choice in a thread has failed.  If there is no next choice,
-// the incoming puzzle is returned, along with the empty thread.
+// popChoice rolls a puzzle back to the next choice after the
+// current choice in a thread has failed.  If there is no next
+// choice, the incoming puzzle is returned unchanged, along with
+// the empty thread.
 func popChoice(p *Puzzle, t thread) (*Puzzle, thread) {
 	for len(t) > 0 {
 		top := &t[len(t)-1]
-		if len(top.cnext) == 0 {
+		if top.cnext == 0 {
 			*top = choice{} // release storage held in choice before pop
 			t = t[:len(t)-1]
 			continue
 		}
-		new := top.puz.copy()
-		top.cvalue, top.cnext = top.cnext[0], top.cnext[1:]
-		new.assign(top.cindex, top.cvalue) // errors handled by caller
-		return new, t
+		p.rollback(top.mark)
+		top.cvalue = top.cnext.next(0)
+		top.cnext.remove(top.cvalue)
+		p.assign(top.cindex, top.cvalue) // errors handled by caller
+		return p, t
 	}
 	return p, t
 }
 
-// pushChoice chooses an unbound square to assign, pushes a
-// puzzle copy and the choice on the stack, and then applies that
-// choice to the puzzle.
+// pushChoice chooses an unbound square to assign, pushes a mark
+// of the puzzle's journal and the choice on the stack, and then
+// applies that choice to the puzzle.
 func pushChoice(p *Puzzle, t thread) (*Puzzle, thread) {
+	cindex, ccount := chooseSquare(p)
+	c := choice{
+		mark:   p.mark(),
+		cindex: cindex,
+		ccount: ccount,
+		cvalue: p.squares[cindex].pvals.next(0),
+		cnext:  p.squares[cindex].pvals,
+	}
+	c.cnext.remove(c.cvalue)
+	// The chosen value is possible for the square, but its
+	// propagation can still make the puzzle unsolvable (e.g., by
+	// removing the last candidate for a value from a group that
+	// overlaps the square's groups).  As in popChoice, those
+	// errors are handled by the caller.
+	p.assign(c.cindex, c.cvalue)
+	return p, append(t, c)
+}
+
+// chooseSquare finds the first unbound square with the fewest
+// possible values, and returns its index and its number of
+// possible values.
+func chooseSquare(p *Puzzle) (int, int) {
 	cindex, ccount := 0, p.mapping.sidelen+1
 	for i := 1; i <= p.mapping.scount; i++ {
 		if p.squares[i].aval == 0 && p.squares[i].bval == 0 {
-			count := len(p.squares[i].pvals)
+			count := p.squares[i].pvals.len()
 			if count == 2 {
 				cindex, ccount = i, 2
 				break
@@ -218,123 +496,22 @@ func pushChoice(p *Puzzle, t thread) (*Puzzle, thread) {
 	}
 	if cindex == 0 {
 		// internal caller error - called when no choice available
-		panic(fmt.Errorf("pushChoice called with no available choices"))
-	}
-	c := choice{
-		puz:    p.copy(),
-		cindex: cindex,
-		ccount: ccount,
-		cvalue: p.squares[cindex].pvals[0],
-		cnext:  newIntsetCopy(p.squares[cindex].pvals[1:]),
+		panic(fmt.Errorf("chooseSquare called with no available choices"))
 	}
-	p.assign(c.cindex, c.cvalue)
-	if len(p.errors) > 0 {
-		// can't happen: the choice was unacceptable for the square
-		panic(fmt.Errorf("Assign of %v to %+v failed: %v",
-			c.cvalue, *p.squares[cindex], p.errors))
-	}
-	return p, append(t, c)
+	return cindex, ccount
 }
 
 // newSolution constructs a solution from a solved puzzle and its
-// solving thread.  The thread must have at least one choice.
-func newSolution(p *Puzzle, t thread) Solution {
+// solving thread, grading it by adding the thread's choices as
+// guesses to the logical grade of the puzzle.  The thread must
+// have at least one choice.
+func newSolution(p *Puzzle, t thread, g *Grade) Solution {
 	S := Solution{Values: p.allValues()}
 	S.Choices = make([]Choice, len(t))
-	counts := make([]int, len(t))
 	for i := range t {
 		S.Choices[i].Index, S.Choices[i].Value = t[i].cindex, t[i].cvalue
-		counts[i] = t[i].ccount
 	}
-	S.Rating = rateChoices(counts)
+	S.Grade = g.guessed(len(t))
+	S.Rating = S.Grade.rating()
 	return S
 }
-
-/*
-
-Rate solutions.
-
-If a puzzle can be filled in just by filling in single-values
-squares, then it's a 1-star.  If it can be filled in just by
-filling in bound squares, then it's a 2-star.
-
-*/
-
-// rate the choices that went into a solution.  If it requires
-// only a single 2-valued choice, then it's a three-star.  If it
-// requires two 2-valued choices, or a single 3-valued choice,
-// then it's a 4-star.  If it requires more than two choices,
-// then it's a 5-star.
-func rateChoices(counts []int) int {
-	switch len(counts) {
-	case 1:
-		if counts[0] > 2 {
-			return 4
-		} else {
-			return 3
-		}
-	case 2:
-		if counts[0] > 2 || counts[1] > 2 {
-			return 5
-		} else {
-			return 4
-		}
-	default:
-		return 5
-	}
-}
-
-// rateNoChoices checks to see if the puzzle does not require a
-// choice.  If so, it returns the solved puzzle values and a
-// rating of 1 or 2 (depending on how many bound squares the
-// solver had to find.).  If not, it returns nil and 0.
-//
-// The solving happens so as to minimize the number of bound squares:
-// 1. Do all single-valued squares.
-// 2. If you find a bound-valued square, fill it and go back to 1.
-// 3. If the puzzle is solved, return the ratio.  If not, return 0.
-func rateNoChoices(p *Puzzle) ([]int, int) {
-	totalBound, totalSingle := 0, 0
-	for {
-		bound, single := 0, 0
-		for i := 1; i <= p.mapping.scount; i++ {
-			if p.squares[i].aval == 0 {
-				if len(p.squares[i].pvals) == 1 {
-					single++
-					p.assign(i, p.squares[i].pvals[0])
-				}
-			}
-		}
-		totalSingle += single
-		if single > 0 {
-			continue
-		}
-		for i := 1; i <= p.mapping.scount; i++ {
-			if p.squares[i].aval == 0 {
-				if p.squares[i].bval != 0 {
-					bound++
-					p.assign(i, p.squares[i].bval)
-					break
-				}
-			}
-		}
-		totalBound += bound
-		if bound > 0 {
-			continue
-		}
-		if len(p.errors) > 0 { // should never happend, but be cautious
-			return nil, 0
-		}
-		for i := 1; i <= p.mapping.scount; i++ {
-			if p.squares[i].aval == 0 {
-				return nil, 0
-			}
-		}
-		break
-	}
-	if totalBound < p.mapping.sidelen/2 {
-		return p.allValues(), 1
-	} else {
-		return p.allValues(), 2
-	}
-}
@@ -19,8 +19,11 @@
 package puzzle
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 /*
@@ -74,7 +77,8 @@ var (
 			4, 3, 2, 1,
 		},
 		[]Choice{Choice{2, 2}, Choice{10, 1}},
-		4,
+		5,
+		nil,
 	}
 	multiChoiceSolution2 = Solution{
 		[]int{
@@ -84,7 +88,8 @@ var (
 			4, 1, 2, 3,
 		},
 		[]Choice{Choice{2, 2}, Choice{10, 3}},
-		4,
+		5,
+		nil,
 	}
 	multiChoiceSolution3 = Solution{
 		[]int{
@@ -94,7 +99,8 @@ var (
 			4, 3, 2, 1,
 		},
 		[]Choice{Choice{2, 4}, Choice{10, 1}},
-		4,
+		5,
+		nil,
 	}
 	multiChoiceSolution4 = Solution{
 		[]int{
@@ -104,7 +110,8 @@ var (
 			4, 1, 2, 3,
 		},
 		[]Choice{Choice{2, 4}, Choice{10, 3}},
-		4,
+		5,
+		nil,
 	}
 	oneStarValues = []int{
 		4, 0, 0, 0, 0, 3, 5, 0, 2,
@@ -174,7 +181,8 @@ var (
 			3, 2, 1, 5, 9, 6, 8, 7, 4,
 		},
 		[]Choice{Choice{2, 4}},
-		3,
+		5,
+		nil,
 	}
 	fiveStarSolution2 = Solution{
 		[]int{
@@ -189,7 +197,8 @@ var (
 			3, 2, 1, 5, 9, 6, 8, 7, 4,
 		},
 		[]Choice{Choice{2, 7}},
-		3,
+		5,
+		nil,
 	}
 	sixStarValues = []int{
 		9, 0, 0, 4, 5, 0, 0, 0, 8,
@@ -215,7 +224,8 @@ var (
 			4, 9, 2, 7, 1, 6, 8, 5, 3,
 		},
 		[]Choice{Choice{2, 6}},
-		3,
+		5,
+		nil,
 	}
 	multiSolutionValues = []int{
 		2, 0, 0, 8, 0, 0, 0, 5, 0,
@@ -273,8 +283,9 @@ var (
 			4, 2, 6, 3, 5, 9, 1, 7, 8,
 			8, 9, 3, 6, 7, 1, 2, 4, 5,
 		},
-		[]Choice{Choice{2, 5}},
+		nil,
 		3,
+		nil,
 	}
 	tileRotationCompleteValues = []int{
 		1, 2, 3, 4, 5, 6, 7, 8, 9,
@@ -319,6 +330,94 @@ var (
 		5, 1, 4, 6, 3, 2,
 		6, 3, 2, 5, 1, 4,
 	}
+	jigsaw6Regions = []int{
+		1, 1, 1, 2, 2, 2,
+		1, 1, 3, 3, 2, 2,
+		1, 4, 3, 3, 3, 2,
+		4, 4, 4, 3, 5, 5,
+		6, 4, 4, 5, 5, 5,
+		6, 6, 6, 6, 6, 5,
+	}
+	jigsaw6Values = []int{
+		0, 0, 0, 0, 5, 0,
+		0, 0, 0, 6, 0, 3,
+		0, 0, 0, 0, 0, 1,
+		2, 0, 0, 0, 0, 0,
+		0, 4, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+	}
+	jigsaw6Solution = Solution{
+		[]int{
+			1, 2, 3, 4, 5, 6,
+			4, 5, 1, 6, 2, 3,
+			6, 3, 2, 5, 4, 1,
+			2, 1, 5, 3, 6, 4,
+			5, 4, 6, 1, 3, 2,
+			3, 6, 4, 2, 1, 5,
+		},
+		nil,
+		3,
+		nil,
+	}
+	killer4Cages = []Cage{
+		Cage{4, []int{1, 5}},
+		Cage{6, []int{2, 6}},
+		Cage{7, []int{3, 4}},
+		Cage{5, []int{7, 11}},
+		Cage{6, []int{8, 12, 16}},
+		Cage{7, []int{9, 10, 13}},
+		Cage{5, []int{14, 15}},
+	}
+	killer4Solution = Solution{
+		[]int{
+			1, 2, 3, 4,
+			3, 4, 1, 2,
+			2, 1, 4, 3,
+			4, 3, 2, 1,
+		},
+		nil,
+		2,
+		nil,
+	}
+	diagonal4Values = []int{
+		0, 0, 0, 0,
+		0, 4, 0, 0,
+		0, 0, 0, 1,
+		2, 0, 0, 0,
+	}
+	diagonal4Complete = []int{
+		1, 2, 3, 4,
+		3, 4, 1, 2,
+		4, 3, 2, 1,
+		2, 1, 4, 3,
+	}
+	diagonal9Values = []int{
+		0, 0, 0, 4, 0, 6, 0, 0, 0,
+		0, 0, 6, 7, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 4, 5, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 7,
+		6, 1, 0, 0, 0, 8, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 5, 3, 0,
+		0, 0, 8, 3, 0, 0, 0, 7, 0,
+		0, 7, 0, 0, 0, 0, 9, 0, 0,
+		0, 0, 4, 0, 0, 0, 0, 0, 0,
+	}
+	diagonal9Solution = Solution{
+		[]int{
+			1, 2, 3, 4, 5, 6, 7, 8, 9,
+			4, 5, 6, 7, 8, 9, 1, 2, 3,
+			7, 8, 9, 1, 2, 3, 4, 5, 6,
+			9, 3, 5, 2, 4, 1, 8, 6, 7,
+			6, 1, 7, 5, 3, 8, 2, 9, 4,
+			8, 4, 2, 6, 9, 7, 5, 3, 1,
+			2, 9, 8, 3, 1, 4, 6, 7, 5,
+			3, 7, 1, 8, 6, 5, 9, 4, 2,
+			5, 6, 4, 9, 7, 2, 3, 1, 8,
+		},
+		[]Choice{Choice{16, 1}},
+		5,
+		nil,
+	}
 	SuDozen78097Values = []int{
 		5, 7, 0, 6, 0, 0, 0, 0, 0, 1, 11, 12,
 		11, 0, 0, 0, 0, 0, 10, 0, 0, 0, 0, 3,
@@ -415,11 +514,11 @@ func TestPopThread(t *testing.T) {
 	if e != nil {
 		t.Fatalf("TestPopThread: Failed to create puzzle: %v", e)
 	}
-	thin := thread{choice{pin, 2, 2, 0, intset{2, 4}}} // artificial stack top
+	thin := thread{choice{pin.mark(), 2, 2, 0, newValueset(2, 4)}} // artificial stack top
 	p, th := popChoice(pin, thin)
-	if reflect.DeepEqual(p, pin) ||
+	if p != pin ||
 		len(th) != 1 || th[0].cindex != 2 ||
-		th[0].cvalue != 2 || !reflect.DeepEqual(th[0].cnext, intset{4}) {
+		th[0].cvalue != 2 || th[0].cnext != newValueset(4) {
 		t.Errorf("TestPopThread: 1st popped stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), solveSimpleFirstValues) {
@@ -428,9 +527,9 @@ func TestPopThread(t *testing.T) {
 	}
 	pin, thin = p, th
 	p, th = popChoice(pin, thin)
-	if reflect.DeepEqual(p, pin) ||
+	if p != pin ||
 		len(th) != 1 || th[0].cindex != 2 ||
-		th[0].cvalue != 4 || !reflect.DeepEqual(th[0].cnext, intset{}) {
+		th[0].cvalue != 4 || th[0].cnext != 0 {
 		t.Errorf("TestPopThread: 2nd popped stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), solveSimpleSecondValues) {
@@ -439,7 +538,7 @@ func TestPopThread(t *testing.T) {
 	}
 	pin, thin = p, th
 	p, th = popChoice(pin, thin)
-	if !reflect.DeepEqual(p, pin) ||
+	if p != pin ||
 		len(th) != 0 {
 		t.Errorf("TestPopThread: 3rd popped stack top is wrong: %+v", th[0])
 	}
@@ -459,15 +558,19 @@ func TestPushThread(t *testing.T) {
 	if len(th) != 1 {
 		t.Fatalf("TestPushThread: 1st pushed stack is too deep.")
 	}
-	if reflect.DeepEqual(p, th[0].puz) ||
+	if th[0].mark != (journalMark{}) ||
 		th[0].cindex != 2 || th[0].cvalue != 2 ||
-		!reflect.DeepEqual(th[0].cnext, intset{4}) {
+		th[0].cnext != newValueset(4) {
 		t.Errorf("TestPushThread: 1st pushed stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), solveSimpleFirstValues) {
 		t.Errorf("TestPushThread: 1st pushed stack puzzle is %v (expected %v)",
 			p.allValues(), solveSimpleFirstValues)
 	}
+	if p.rollback(th[0].mark); !reflect.DeepEqual(p.allValues(), solveSimpleStartValues) {
+		t.Errorf("TestPushThread: 1st rolled back puzzle is %v (expected %v)",
+			p.allValues(), solveSimpleStartValues)
+	}
 	// second test all squares have 4 possibles
 	pin, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues})
 	if e != nil {
@@ -477,9 +580,9 @@ func TestPushThread(t *testing.T) {
 	if len(th) != 1 {
 		t.Fatalf("TestPushThread: 2nd pushed stack is too deep.")
 	}
-	if reflect.DeepEqual(p, th[0].puz) ||
+	if th[0].mark != (journalMark{}) ||
 		th[0].cindex != 1 || th[0].cvalue != 1 ||
-		!reflect.DeepEqual(th[0].cnext, intset{2, 3, 4}) {
+		th[0].cnext != newValueset(2, 3, 4) {
 		t.Errorf("TestPushThread: 2nd pushed stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), empty4PuzzleAssign1Values) {
@@ -496,7 +599,7 @@ type solveTestcase struct {
 	elen    int
 	elasti  int
 	elastv  int
-	elastn  intset
+	elastn  valueset
 }
 
 func TestSolve(t *testing.T) {
@@ -512,7 +615,7 @@ func TestSolve(t *testing.T) {
 		t.Fatalf("TestSolve: Conflicting puzzle has no errors")
 	}
 	pc := p.copy()
-	p, th = solve(p, th)
+	p, th = solve(p, th, newSearch())
 	if th != nil || !reflect.DeepEqual(p.summary(), pc.summary()) {
 		t.Errorf("TestSolve: solving conflicting puzzle gave different puzzle:\n%v", p)
 	}
@@ -521,27 +624,27 @@ func TestSolve(t *testing.T) {
 	tcs := []solveTestcase{
 		solveTestcase{
 			9, oneStarValues, true, oneStarBoundValues,
-			0, 0, 0, nil,
+			0, 0, 0, 0,
 		},
 		solveTestcase{
 			9, oneStarValues, true, oneStarBoundValues,
-			0, 0, 0, nil,
+			0, 0, 0, 0,
 		},
 		solveTestcase{
 			9, sixStarValues, true, sixStarSolution.Values,
-			1, 2, 6, intset{},
+			1, 2, 6, 0,
 		},
 		solveTestcase{
 			9, chronTwoValues, true, chronTwoSolution.Values,
-			1, 2, 5, intset{},
+			1, 2, 5, 0,
 		},
 		solveTestcase{
 			4, solveSimpleStartValues, true, solveSimpleFirstCompleteValues,
-			1, 2, 2, intset{4},
+			1, 2, 2, newValueset(4),
 		},
 		solveTestcase{
 			4, nil, true, solveSimpleSecondCompleteValues,
-			1, 2, 4, intset{},
+			1, 2, 4, 0,
 		},
 	}
 	for i, tc := range tcs {
@@ -558,7 +661,7 @@ func TestSolve(t *testing.T) {
 			th = nil
 		}
 		// t.Logf("TestSolve case %d: start thread %v, puzzle:\n%v", i+1, th, p)
-		p, th = solve(p, th)
+		p, th = solve(p, th, newSearch())
 		// t.Logf("TestSolve case %d: finish thread %v, puzzle:\n%v", i+1, th, p)
 		if tc.done {
 			if len(p.errors) > 0 {
@@ -577,7 +680,7 @@ func TestSolve(t *testing.T) {
 				} else if tc.elen > 0 {
 					if th[tc.elen-1].cindex != tc.elasti ||
 						th[tc.elen-1].cvalue != tc.elastv ||
-						!reflect.DeepEqual(th[tc.elen-1].cnext, tc.elastn) {
+						th[tc.elen-1].cnext != tc.elastn {
 						t.Errorf("TestSolve case %d: Last choice is wrong: %+v",
 							i+1, th[tc.elen-1])
 					}
@@ -594,6 +697,18 @@ func TestSolve(t *testing.T) {
 	}
 }
 
+// helperCheckGrade checks that a solution has a grade that
+// matches its rating, and returns the solution without its grade.
+func helperCheckGrade(t *testing.T, prefix string, soln Solution) Solution {
+	if soln.Grade == nil {
+		t.Errorf("%s has no grade", prefix)
+	} else if r := soln.Grade.rating(); r != soln.Rating {
+		t.Errorf("%s has rating %d, but its grade %+v is rated %d", prefix, soln.Rating, *soln.Grade, r)
+	}
+	soln.Grade = nil
+	return soln
+}
+
 type solutionsTestcase struct {
 	geometry string
 	sidelen  int
@@ -607,15 +722,15 @@ func TestSolutions(t *testing.T) {
 		// first the fully bound puzzles
 		solutionsTestcase{
 			StandardGeometryName, 9, oneStarValues,
-			1, []Solution{Solution{oneStarBoundValues, nil, 2}},
+			1, []Solution{Solution{oneStarBoundValues, nil, 2, nil}},
 		},
 		solutionsTestcase{
 			StandardGeometryName, 9, threeStarValues,
-			1, []Solution{Solution{threeStarBoundValues, nil, 1}},
+			1, []Solution{Solution{threeStarBoundValues, nil, 2, nil}},
 		},
 		solutionsTestcase{
 			StandardGeometryName, 9, chronOneValues,
-			1, []Solution{Solution{chronOneBoundValues, nil, 1}},
+			1, []Solution{Solution{chronOneBoundValues, nil, 2, nil}},
 		},
 		// then the single-solution puzzles
 		solutionsTestcase{
@@ -631,8 +746,8 @@ func TestSolutions(t *testing.T) {
 			StandardGeometryName, 4, solveSimpleStartValues,
 			2,
 			[]Solution{
-				Solution{solveSimpleFirstCompleteValues, []Choice{Choice{2, 2}}, 3},
-				Solution{solveSimpleSecondCompleteValues, []Choice{Choice{2, 4}}, 3},
+				Solution{solveSimpleFirstCompleteValues, []Choice{Choice{2, 2}}, 5, nil},
+				Solution{solveSimpleSecondCompleteValues, []Choice{Choice{2, 4}}, 5, nil},
 			},
 		},
 		solutionsTestcase{
@@ -656,19 +771,28 @@ func TestSolutions(t *testing.T) {
 		// then the rectangular puzzles
 		solutionsTestcase{
 			RectangularGeometryName, 6, Su6Standard1Values,
-			1, []Solution{Solution{Su6Standard1Complete, nil, 1}},
+			1, []Solution{Solution{Su6Standard1Complete, nil, 1, nil}},
 		},
 		solutionsTestcase{
 			RectangularGeometryName, 6, Su6Difficult1Values,
-			1, []Solution{Solution{Su6Difficult1Complete, nil, 1}},
+			1, []Solution{Solution{Su6Difficult1Complete, nil, 1, nil}},
 		},
 		solutionsTestcase{
 			RectangularGeometryName, 12, SuDozen61054Values,
-			1, []Solution{Solution{SuDozen61054Complete, nil, 2}},
+			1, []Solution{Solution{SuDozen61054Complete, nil, 2, nil}},
 		},
 		solutionsTestcase{
 			RectangularGeometryName, 12, SuDozen78097Values,
-			1, []Solution{Solution{SuDozen78097Complete, nil, 2}},
+			1, []Solution{Solution{SuDozen78097Complete, nil, 2, nil}},
+		},
+		// then the diagonal puzzles
+		solutionsTestcase{
+			DiagonalGeometryName, 4, diagonal4Values,
+			1, []Solution{Solution{diagonal4Complete, nil, 1, nil}},
+		},
+		solutionsTestcase{
+			DiagonalGeometryName, 9, diagonal9Values,
+			1, []Solution{diagonal9Solution},
 		},
 		/* removed to clean the verbose output, use when needed
 
@@ -704,7 +828,8 @@ func TestSolutions(t *testing.T) {
 					t.Errorf("test %d: extra solution %d is %v",
 						i+1, j+1, solns[j])
 				} else {
-					if !reflect.DeepEqual(solns[j], tc.solns[j]) {
+					soln := helperCheckGrade(t, fmt.Sprintf("test %d solution %d", i+1, j+1), solns[j])
+					if !reflect.DeepEqual(soln, tc.solns[j]) {
 						t.Errorf("test %d: solution %d is %v (expected %v)",
 							i+1, j+1, solns[j], tc.solns[j])
 					}
@@ -713,3 +838,146 @@ func TestSolutions(t *testing.T) {
 		}
 	}
 }
+
+func TestJigsawSolutions(t *testing.T) {
+	p, e := New(&Summary{
+		Geometry:   JigsawGeometryName,
+		SideLength: 6,
+		Values:     jigsaw6Values,
+		Regions:    jigsaw6Regions,
+	})
+	if e != nil {
+		t.Fatalf("Failed to create jigsaw puzzle: %v", e)
+	}
+	solns := p.allSolutions()
+	if len(solns) != 1 {
+		t.Fatalf("got %d jigsaw solutions, expected 1: %v", len(solns), solns)
+	}
+	if soln := helperCheckGrade(t, "jigsaw solution", solns[0]); !reflect.DeepEqual(soln, jigsaw6Solution) {
+		t.Errorf("jigsaw solution is %v (expected %v)", solns[0], jigsaw6Solution)
+	}
+}
+
+func TestKillerSolutions(t *testing.T) {
+	p, e := New(&Summary{
+		Geometry:   StandardGeometryName,
+		SideLength: 4,
+		Cages:      killer4Cages,
+	})
+	if e != nil {
+		t.Fatalf("Failed to create killer puzzle: %v", e)
+	}
+	solns, e := p.Solutions()
+	if e != nil {
+		t.Fatalf("Failed to solve killer puzzle: %v", e)
+	}
+	if len(solns) != 1 {
+		t.Fatalf("got %d killer solutions, expected 1: %v", len(solns), solns)
+	}
+	if soln := helperCheckGrade(t, "killer solution", solns[0]); !reflect.DeepEqual(soln, killer4Solution) {
+		t.Errorf("killer solution is %v (expected %v)", solns[0], killer4Solution)
+	}
+}
+
+func TestSolutionsContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tcs := []struct {
+		sidelen  int
+		start    []int
+		ctx      context.Context
+		options  SolveOptions
+		numsolns int
+		reason   StopReason
+		nodes    int
+	}{
+		{4, multiChoiceStartValues, context.Background(), SolveOptions{}, 4, CompleteStop, 3},
+		{4, multiChoiceStartValues, context.Background(), SolveOptions{MaxSolutions: 2}, 2, SolutionLimitStop, 2},
+		{4, multiChoiceStartValues, context.Background(), SolveOptions{MaxNodes: 1}, 0, NodeLimitStop, 1},
+		{9, oneStarValues, context.Background(), SolveOptions{MaxSolutions: 1, MaxNodes: 1}, 1, CompleteStop, 0},
+		{9, make([]int, 81), context.Background(), SolveOptions{MaxSolutions: 3}, 3, SolutionLimitStop, -1},
+		{16, make([]int, 256), context.Background(), SolveOptions{MaxNodes: 10}, 0, NodeLimitStop, 10},
+		{16, make([]int, 256), context.Background(), SolveOptions{Deadline: time.Now()}, 0, DeadlineStop, 0},
+		{16, make([]int, 256), canceled, SolveOptions{}, 0, CanceledStop, 0},
+	}
+	for i, tc := range tcs {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: tc.sidelen, Values: tc.start})
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		result, e := p.SolutionsContext(tc.ctx, tc.options)
+		if e != nil {
+			t.Fatalf("test %d: Failed to solve puzzle: %v", i+1, e)
+		}
+		if len(result.Solutions) != tc.numsolns || result.Reason != tc.reason {
+			t.Errorf("test %d: got %d solutions (stopped: %v), expected %d (stopped: %v)",
+				i+1, len(result.Solutions), result.Reason, tc.numsolns, tc.reason)
+		}
+		if tc.nodes >= 0 && result.Nodes != tc.nodes {
+			t.Errorf("test %d: searched %d nodes, expected %d", i+1, result.Nodes, tc.nodes)
+		}
+		if len(result.Solutions) > 0 {
+			first := p.solutions(&search{ctx: context.Background(), maxSolutions: len(result.Solutions)})
+			if !reflect.DeepEqual(result.Solutions, first) {
+				t.Errorf("test %d: got solutions %v, expected %v", i+1, result.Solutions, first)
+			}
+		}
+	}
+
+	var p *Puzzle
+	if _, e := p.SolutionsContext(context.Background(), SolveOptions{}); e == nil {
+		t.Errorf("Solved a nil puzzle")
+	}
+}
+
+/*
+
+benchmarks
+
+*/
+
+func benchmarkPuzzleSolutions(b *testing.B, geometry string, sidelen int, values []int) {
+	p, e := New(&Summary{Geometry: geometry, SideLength: sidelen, Values: values})
+	if e != nil {
+		b.Fatalf("Failed to create puzzle: %v", e)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.allSolutions()
+	}
+}
+
+func BenchmarkSolutionsMultiChoice(b *testing.B) {
+	benchmarkPuzzleSolutions(b, StandardGeometryName, 4, multiChoiceStartValues)
+}
+
+func BenchmarkSolutionsSixStar(b *testing.B) {
+	benchmarkPuzzleSolutions(b, StandardGeometryName, 9, sixStarValues)
+}
+
+func BenchmarkSolutionsFiveStar(b *testing.B) {
+	benchmarkPuzzleSolutions(b, StandardGeometryName, 9, fiveStarValues)
+}
+
+func BenchmarkSolutionsChronTwo(b *testing.B) {
+	benchmarkPuzzleSolutions(b, StandardGeometryName, 9, chronTwoValues)
+}
+
+func BenchmarkSolutionsSu6Difficult1(b *testing.B) {
+	benchmarkPuzzleSolutions(b, RectangularGeometryName, 6, Su6Difficult1Values)
+}
+
+func BenchmarkSolutionsSuDozen61054(b *testing.B) {
+	benchmarkPuzzleSolutions(b, RectangularGeometryName, 12, SuDozen61054Values)
+}
+
+func BenchmarkPuzzleCopy(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues})
+	if e != nil {
+		b.Fatalf("Failed to create puzzle: %v", e)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.copy()
+	}
+}
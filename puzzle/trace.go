@@ -0,0 +1,183 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"time"
+)
+
+/*
+
+Solver statistics and traces
+
+A search for solutions with Ariadne's thread can keep statistics
+about the work it does, and can keep a trace of every step it
+takes.  The statistics are the number of nodes (guesses) in the
+search, the number of backtracks (the times a choice was retried
+with another of its values, either because the thread reached a
+dead end or to look for another solution), the deepest the thread
+got, the number of passes made by assignKnown, and the time the
+search took.  Each solution has the statistics of the search up
+to the time it was found, and the result of the search has the
+statistics of the whole search.  A search with dancing links
+keeps statistics too, but only the nodes and the time, since it
+has no thread.
+
+The trace records the whole of Ariadne's thread, including the
+branches that turned out to be dead ends, so that a search can be
+replayed.  Each step gives the depth of the thread after the
+step.  A traced search can't be spread across goroutines, so
+that its steps are in the order they were taken.
+
+*/
+
+// SolveStats are statistics about the work done by a search for
+// solutions.  WallTime is in nanoseconds when encoded as JSON.
+type SolveStats struct {
+	Nodes      int           `json:"nodes"`
+	Backtracks int           `json:"backtracks"`
+	MaxDepth   int           `json:"maxDepth"`
+	Passes     int           `json:"passes"`
+	WallTime   time.Duration `json:"wallTime"`
+}
+
+// A TraceKind says what happened in a step of a traced search.
+type TraceKind string
+
+// Constants for the kinds of trace steps.  ChooseTrace steps
+// make a choice: they give the chosen square, its first value,
+// and the number of values it had.  RetryTrace steps give the
+// next value tried for an earlier choice, after backtracking to
+// it.  KnownTrace steps give the values assigned by a pass of
+// assignKnown.  DeadEndTrace steps find the puzzle unsolvable,
+// and SolutionTrace steps find a solution.
+const (
+	ChooseTrace   TraceKind = "choose"
+	RetryTrace    TraceKind = "retry"
+	KnownTrace    TraceKind = "known"
+	DeadEndTrace  TraceKind = "deadEnd"
+	SolutionTrace TraceKind = "solution"
+)
+
+// A TraceStep is one step in the trace of a search.
+type TraceStep struct {
+	Kind   TraceKind `json:"kind"`
+	Depth  int       `json:"depth"`
+	Index  int       `json:"index,omitempty"`
+	Value  int       `json:"value,omitempty"`
+	Count  int       `json:"count,omitempty"`
+	Values []Choice  `json:"values,omitempty"`
+}
+
+// recording reports whether the search keeps statistics or a
+// trace.  The search's counts are only updated when it does.
+func (s *search) recording() bool {
+	return s.stats != nil || s.tracing
+}
+
+// statistics returns the statistics of the search so far, or
+// nil if the search doesn't keep statistics.
+func (s *search) statistics() *SolveStats {
+	if s.stats == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := *s.stats
+	stats.Nodes = s.nodes
+	stats.WallTime = time.Since(s.start)
+	return &stats
+}
+
+// record updates the statistics of the search and adds a step
+// to its trace, as the search keeps them.
+func (s *search) record(step TraceStep) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stats != nil {
+		switch step.Kind {
+		case ChooseTrace:
+			if step.Depth > s.stats.MaxDepth {
+				s.stats.MaxDepth = step.Depth
+			}
+		case RetryTrace:
+			s.stats.Backtracks++
+		case KnownTrace:
+			s.stats.Passes++
+		}
+	}
+	if s.tracing {
+		s.trace = append(s.trace, step)
+	}
+}
+
+// assignKnown is assignKnown for a search, which records each
+// of its passes.
+func (s *search) assignKnown(p *Puzzle, t thread) bool {
+	if !s.recording() {
+		return assignKnown(p)
+	}
+	return fillKnown(p, func(known []Choice) {
+		s.record(TraceStep{Kind: KnownTrace, Depth: len(t), Values: known})
+	})
+}
+
+// pushChoice is pushChoice for a search, which records the
+// choice.
+func (s *search) pushChoice(p *Puzzle, t thread) (*Puzzle, thread) {
+	p, t = pushChoice(p, t)
+	if s.recording() {
+		top := t[len(t)-1]
+		s.record(TraceStep{Kind: ChooseTrace, Depth: len(t),
+			Index: top.cindex, Value: top.cvalue, Count: top.ccount})
+	}
+	return p, t
+}
+
+// popChoice is popChoice for a search, which records the retried
+// choice (if any).
+func (s *search) popChoice(p *Puzzle, t thread) (*Puzzle, thread) {
+	p, t = popChoice(p, t)
+	if len(t) > 0 && s.recording() {
+		top := t[len(t)-1]
+		s.record(TraceStep{Kind: RetryTrace, Depth: len(t), Index: top.cindex, Value: top.cvalue})
+	}
+	return p, t
+}
+
+// deadEnd records that the thread has reached a dead end.
+func (s *search) deadEnd(t thread) {
+	if s.tracing {
+		step := TraceStep{Kind: DeadEndTrace, Depth: len(t)}
+		if len(t) > 0 {
+			step.Index, step.Value = t[len(t)-1].cindex, t[len(t)-1].cvalue
+		}
+		s.record(step)
+	}
+}
+
+// solved records a solution found at the end of a thread, and
+// returns the statistics of the search so far (if it keeps
+// them).
+func (s *search) solved(t thread) *SolveStats {
+	if s.tracing {
+		s.record(TraceStep{Kind: SolutionTrace, Depth: len(t)})
+	}
+	return s.statistics()
+}
@@ -0,0 +1,195 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSolveStats(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues})
+	if e != nil {
+		t.Fatalf("Creation of puzzle failed: %v", e)
+	}
+	result, e := p.SolutionsContext(context.Background(), SolveOptions{MaxSolutions: 5})
+	if e != nil {
+		t.Fatalf("Search failed: %v", e)
+	}
+	if result.Stats != nil || result.SolutionStats != nil || result.Trace != nil {
+		t.Errorf("Got statistics or trace without asking: %+v", result)
+	}
+	for _, workers := range []int{1, 2} {
+		options := SolveOptions{MaxSolutions: 5, Workers: workers, Stats: true}
+		result, e := p.SolutionsContext(context.Background(), options)
+		if e != nil {
+			t.Fatalf("Search with %d workers failed: %v", workers, e)
+		}
+		if result.Trace != nil {
+			t.Errorf("Got a trace without asking: %v", result.Trace)
+		}
+		stats := result.Stats
+		if stats == nil {
+			t.Fatalf("No statistics with %d workers", workers)
+		}
+		if stats.Nodes != result.Nodes || stats.MaxDepth == 0 || stats.Passes == 0 || stats.WallTime <= 0 {
+			t.Errorf("Bad statistics with %d workers: %+v (%d nodes)", workers, stats, result.Nodes)
+		}
+		if len(result.SolutionStats) != len(result.Solutions) {
+			t.Fatalf("Got %d solution statistics for %d solutions",
+				len(result.SolutionStats), len(result.Solutions))
+		}
+		if workers > 1 {
+			continue // the solutions are found in parallel
+		}
+		if stats.Backtracks < len(result.Solutions)-1 {
+			t.Errorf("Only %d backtracks for %d solutions", stats.Backtracks, len(result.Solutions))
+		}
+		last := SolveStats{}
+		for i, s := range result.SolutionStats {
+			if s.Nodes < last.Nodes || s.Backtracks < last.Backtracks ||
+				s.Passes < last.Passes || s.WallTime < last.WallTime {
+				t.Errorf("Solution %d statistics %+v are less than the previous %+v", i, s, last)
+			}
+			last = s
+		}
+	}
+}
+
+func TestSolveStatsDLX(t *testing.T) {
+	// dancing links keeps nodes and wall time, for solutions
+	// found by logic as well as by dancing
+	for i, values := range [][]int{empty4PuzzleValues, oneStarValues} {
+		sidelen := 4
+		if len(values) == 81 {
+			sidelen = 9
+		}
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: sidelen, Values: values})
+		if e != nil {
+			t.Fatalf("Case %d: Creation of puzzle failed: %v", i, e)
+		}
+		options := SolveOptions{MaxSolutions: 5, Backend: DancingLinksBackend, Stats: true}
+		result, e := p.SolutionsContext(context.Background(), options)
+		if e != nil {
+			t.Fatalf("Case %d: Search failed: %v", i, e)
+		}
+		if stats := result.Stats; stats == nil || stats.Nodes != result.Nodes || stats.WallTime <= 0 {
+			t.Errorf("Case %d: Bad statistics %+v (%d nodes)", i, stats, result.Nodes)
+		}
+		if len(result.Solutions) == 0 || len(result.SolutionStats) != len(result.Solutions) {
+			t.Errorf("Case %d: Got %d solution statistics for %d solutions",
+				i, len(result.SolutionStats), len(result.Solutions))
+		}
+	}
+}
+
+func TestSolveTrace(t *testing.T) {
+	tcs := []struct {
+		sidelen int
+		values  []int
+	}{
+		{4, empty4PuzzleValues},
+		{4, multiChoiceStartValues},
+		{4, conflicting4Puzzle1},
+		{9, sixStarValues},
+	}
+	for i, tc := range tcs {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: tc.sidelen, Values: tc.values})
+		if e != nil {
+			t.Fatalf("Case %d: Creation of puzzle failed: %v", i, e)
+		}
+		options := SolveOptions{MaxSolutions: 10, Stats: true, Trace: true}
+		result, e := p.SolutionsContext(context.Background(), options)
+		if e != nil {
+			t.Fatalf("Case %d: Search failed: %v", i, e)
+		}
+		// replay the trace, checking the thread against the
+		// choices of each solution
+		var thread []Choice
+		chosen, retried, passes, solved := 0, 0, 0, 0
+		for j, step := range result.Trace {
+			switch step.Kind {
+			case ChooseTrace:
+				chosen++
+				if step.Depth != len(thread)+1 || step.Count < 2 {
+					t.Errorf("Case %d: Bad choose step %d: %+v", i, j, step)
+				}
+				thread = append(thread, Choice{step.Index, step.Value})
+			case RetryTrace:
+				retried++
+				if step.Depth > len(thread) || thread[step.Depth-1].Index != step.Index {
+					t.Fatalf("Case %d: Bad retry step %d: %+v", i, j, step)
+				}
+				thread = thread[:step.Depth]
+				thread[step.Depth-1].Value = step.Value
+			case KnownTrace:
+				passes++
+			case DeadEndTrace:
+				if step.Depth != len(thread) {
+					t.Errorf("Case %d: Bad dead end step %d: %+v", i, j, step)
+				}
+			case SolutionTrace:
+				if solved >= len(result.Solutions) {
+					t.Fatalf("Case %d: More solution steps than solutions", i)
+				}
+				choices := result.Solutions[solved].Choices
+				if len(choices) != len(thread) || (len(thread) > 0 && !reflect.DeepEqual(choices, thread)) {
+					t.Errorf("Case %d: Solution %d has choices %v, trace has %v",
+						i, solved, choices, thread)
+				}
+				solved++
+			default:
+				t.Errorf("Case %d: Unknown step %d: %+v", i, j, step)
+			}
+		}
+		if solved != len(result.Solutions) {
+			t.Errorf("Case %d: Trace has %d solutions, expected %d", i, solved, len(result.Solutions))
+		}
+		if s := result.Stats; chosen != s.Nodes || retried != s.Backtracks || passes != s.Passes {
+			t.Errorf("Case %d: Trace has %d nodes, %d backtracks, %d passes, statistics are %+v",
+				i, chosen, retried, passes, s)
+		}
+		// a traced search can't be spread across goroutines,
+		// or use dancing links
+		for _, bad := range []SolveOptions{
+			{MaxSolutions: 10, Trace: true, Workers: 2},
+			{MaxSolutions: 10, Trace: true, Backend: DancingLinksBackend},
+		} {
+			if _, e := p.SolutionsContext(context.Background(), bad); e == nil {
+				t.Errorf("Case %d: Traced search with %+v succeeded", i, bad)
+			} else if err, ok := e.(Error); !ok || err.Attribute != TraceAttribute {
+				t.Errorf("Case %d: Traced search with %+v gave error %v", i, bad, e)
+			}
+		}
+		// and the trace survives encoding
+		b, e := json.Marshal(result)
+		if e != nil {
+			t.Fatalf("Case %d: Marshal failed: %v", i, e)
+		}
+		var decoded SolveResult
+		if e = json.Unmarshal(b, &decoded); e != nil {
+			t.Fatalf("Case %d: Unmarshal failed: %v", i, e)
+		}
+		if !reflect.DeepEqual(decoded.Trace, result.Trace) || !reflect.DeepEqual(decoded.Stats, result.Stats) {
+			t.Errorf("Case %d: Decoded trace or statistics differ", i)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+
+Transforms
+
+A transform rearranges a puzzle without changing how hard it is
+to solve: it rotates, reflects, or transposes the squares,
+permutes the rows within bands (rows of tiles) and the columns
+within stacks (columns of tiles), permutes whole bands and
+stacks, and relabels the values.  Which of these are allowed
+depends on the geometry.  Rectangular puzzles can't be
+transposed or given a quarter turn, because that would change
+the shape of their tiles, and jigsaw puzzles can only be rotated
+and reflected, so their regions keep their shapes.  Puzzles with
+cages can't have their values relabeled, because that would
+change the cage sums.
+
+*/
+
+// A Transform rearranges the squares and values of a puzzle to
+// give an equivalent puzzle.  The squares are first transposed
+// (if Transpose is set), then row i of the result is taken from
+// row Rows[i] and column j of the result is taken from column
+// Columns[j].  Finally each value v is replaced by Values[v].
+// Rows and columns are numbered from 0, and Values[0] is always
+// 0.  Empty Rows, Columns, or Values mean no change.
+//
+// Transforms can be made by the functions below, and combined
+// with Then.  Whether a transform can be applied to a puzzle is
+// checked when it's applied.
+type Transform struct {
+	Transpose bool  `json:"transpose,omitempty"`
+	Rows      []int `json:"rows,omitempty"`
+	Columns   []int `json:"columns,omitempty"`
+	Values    []int `json:"values,omitempty"`
+}
+
+// Rotation returns the transform that rotates puzzles of the
+// given side length clockwise by the given number of quarter
+// turns.  Negative turns are counterclockwise.
+func Rotation(sidelen, quarterTurns int) *Transform {
+	switch (quarterTurns%4 + 4) % 4 {
+	case 1:
+		return &Transform{Transpose: true, Rows: identityOrder(sidelen), Columns: reverseOrder(sidelen)}
+	case 2:
+		return &Transform{Rows: reverseOrder(sidelen), Columns: reverseOrder(sidelen)}
+	case 3:
+		return &Transform{Transpose: true, Rows: reverseOrder(sidelen), Columns: identityOrder(sidelen)}
+	default:
+		return &Transform{}
+	}
+}
+
+// HorizontalReflection returns the transform that reflects
+// puzzles of the given side length from left to right.
+func HorizontalReflection(sidelen int) *Transform {
+	return &Transform{Columns: reverseOrder(sidelen)}
+}
+
+// VerticalReflection returns the transform that reflects
+// puzzles of the given side length from top to bottom.
+func VerticalReflection(sidelen int) *Transform {
+	return &Transform{Rows: reverseOrder(sidelen)}
+}
+
+// Transposition returns the transform that reflects puzzles
+// across their main diagonal.
+func Transposition() *Transform {
+	return &Transform{Transpose: true}
+}
+
+// Relabeling returns the transform that replaces each value v
+// with values[v-1].
+func Relabeling(values ...int) *Transform {
+	return &Transform{Values: append([]int{0}, values...)}
+}
+
+// RowOrder returns the transform that takes row i of the result
+// from rows[i].  To be applied, it can only permute the rows
+// within each band, and whole bands.
+func RowOrder(rows ...int) *Transform {
+	return &Transform{Rows: append([]int(nil), rows...)}
+}
+
+// ColumnOrder returns the transform that takes column j of the
+// result from columns[j].  To be applied, it can only permute the
+// columns within each stack, and whole stacks.
+func ColumnOrder(columns ...int) *Transform {
+	return &Transform{Columns: append([]int(nil), columns...)}
+}
+
+// BandOrder returns the transform that takes band i of the
+// result from bands[i], where bands are tileHeight rows high.
+func BandOrder(tileHeight int, bands ...int) *Transform {
+	return &Transform{Rows: tileOrder(tileHeight, bands)}
+}
+
+// StackOrder returns the transform that takes stack j of the
+// result from stacks[j], where stacks are tileWidth columns wide.
+func StackOrder(tileWidth int, stacks ...int) *Transform {
+	return &Transform{Columns: tileOrder(tileWidth, stacks)}
+}
+
+// identityOrder returns the lines 0 through n-1, in order.
+func identityOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// reverseOrder returns the lines 0 through n-1, in reverse.
+func reverseOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = n - 1 - i
+	}
+	return order
+}
+
+// tileOrder returns the lines in the given tiles, in order,
+// where each tile has size lines.
+func tileOrder(size int, tiles []int) []int {
+	order := make([]int, 0, size*len(tiles))
+	for _, t := range tiles {
+		for i := 0; i < size; i++ {
+			order = append(order, t*size+i)
+		}
+	}
+	return order
+}
+
+// Then returns the transform that applies this transform and
+// then u, to puzzles of the given side length.
+func (t *Transform) Then(sidelen int, u *Transform) *Transform {
+	tu := &Transform{Transpose: t.Transpose != u.Transpose}
+	tu.Rows, tu.Columns = make([]int, sidelen), make([]int, sidelen)
+	for i := 0; i < sidelen; i++ {
+		if u.Transpose {
+			tu.Rows[i], tu.Columns[i] = t.column(u.row(i)), t.row(u.column(i))
+		} else {
+			tu.Rows[i], tu.Columns[i] = t.row(u.row(i)), t.column(u.column(i))
+		}
+	}
+	if len(t.Values) > 0 || len(u.Values) > 0 {
+		tu.Values = make([]int, sidelen+1)
+		for v := range tu.Values {
+			tu.Values[v] = u.value(t.value(v))
+		}
+	}
+	return tu
+}
+
+// Choices returns the choices (or marks) made in a puzzle of the
+// given side length moved to the squares, and given the values,
+// that the transform moves them to.  This lets a list of moves
+// made in a puzzle follow the puzzle through the transform.
+func (t *Transform) Choices(sidelen int, choices []Choice) []Choice {
+	if choices == nil {
+		return nil
+	}
+	inv := t.inverse(sidelen)
+	result := make([]Choice, len(choices))
+	for i, c := range choices {
+		result[i] = Choice{inv.source(sidelen, c.Index), t.value(c.Value)}
+	}
+	return result
+}
+
+// Transform returns the summary of the puzzle that this
+// summary's puzzle is transformed into.  The marks are moved
+// along with the values, but any errors are dropped, since they
+// will be found again when the transformed puzzle is created.
+// Returns an Error if the transform isn't a symmetry of the
+// puzzle's geometry.
+func (s *Summary) Transform(t *Transform) (*Summary, error) {
+	layout, e := NewLayout(s)
+	if e != nil {
+		return nil, e
+	}
+	if vlen := len(s.Values); vlen != 0 && vlen != layout.mapping.scount {
+		return nil, argumentError(PuzzleSizeAttribute, WrongPuzzleSizeCondition, vlen, s.SideLength)
+	}
+	if t == nil {
+		return nil, argumentError(TransformAttribute, InvalidArgumentCondition, t)
+	}
+	if e := layout.mapping.checkTransform(t, len(s.Cages) == 0); e != nil {
+		return nil, e
+	}
+	return t.apply(s), nil
+}
+
+// Transform returns a new puzzle that is this puzzle transformed,
+// in its current state.  Returns an Error if the transform isn't
+// a symmetry of the puzzle's geometry.
+func (p *Puzzle) Transform(t *Transform) (*Puzzle, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	ts, e := p.summary().Transform(t)
+	if e != nil {
+		return nil, e
+	}
+	return New(ts)
+}
+
+// checkTransform checks that a transform is well-formed for
+// puzzles with this mapping, and that it's a symmetry of their
+// geometry: it must take every group to a group (or, for jigsaw
+// puzzles, only rotate and reflect them).  Values can only be
+// relabeled if relabel is set.
+func (pm *puzzleMapping) checkTransform(t *Transform, relabel bool) error {
+	n := pm.sidelen
+	if !isOrder(t.Rows, 0, n) || !isOrder(t.Columns, 0, n) {
+		return argumentError(TransformAttribute, InvalidArgumentCondition, t)
+	}
+	if len(t.Values) > 0 {
+		if len(t.Values) != n+1 || t.Values[0] != 0 || !isOrder(t.Values[1:], 1, n) {
+			return argumentError(TransformAttribute, InvalidArgumentCondition, t)
+		}
+		if !relabel && !isIdentity(t.Values) {
+			return argumentError(TransformAttribute, NotSymmetryCondition, t)
+		}
+	}
+	if pm.geometry == JigsawGeometryName {
+		if !isIdentity(t.Rows) && !isReverse(t.Rows) || !isIdentity(t.Columns) && !isReverse(t.Columns) {
+			return argumentError(TransformAttribute, NotSymmetryCondition, t)
+		}
+		return nil
+	}
+	groups := make(map[string]bool, pm.gcount)
+	for _, gd := range pm.gdescs[1:] {
+		groups[fmt.Sprint(gd.indices)] = true
+	}
+	inv := t.inverse(n)
+	for _, gd := range pm.gdescs[1:] {
+		indices := make(intset, len(gd.indices))
+		for i, idx := range gd.indices {
+			indices[i] = inv.source(n, idx)
+		}
+		sort.Ints(indices)
+		if !groups[fmt.Sprint(indices)] {
+			return argumentError(TransformAttribute, NotSymmetryCondition, t)
+		}
+	}
+	return nil
+}
+
+// isOrder returns whether xs is empty or an order of the n
+// numbers starting with base.
+func isOrder(xs []int, base, n int) bool {
+	if len(xs) == 0 {
+		return true
+	}
+	if len(xs) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, x := range xs {
+		if x < base || x >= base+n || seen[x-base] {
+			return false
+		}
+		seen[x-base] = true
+	}
+	return true
+}
+
+// isIdentity returns whether xs is empty or xs[i] is i for all i.
+func isIdentity(xs []int) bool {
+	for i, x := range xs {
+		if x != i {
+			return false
+		}
+	}
+	return true
+}
+
+// isReverse returns whether xs is the numbers from len(xs)-1
+// down to 0.
+func isReverse(xs []int) bool {
+	for i, x := range xs {
+		if x != len(xs)-1-i {
+			return false
+		}
+	}
+	return true
+}
+
+// row returns the row that row i of the result is taken from.
+func (t *Transform) row(i int) int {
+	if len(t.Rows) == 0 {
+		return i
+	}
+	return t.Rows[i]
+}
+
+// column returns the column that column j of the result is
+// taken from.
+func (t *Transform) column(j int) int {
+	if len(t.Columns) == 0 {
+		return j
+	}
+	return t.Columns[j]
+}
+
+// value returns the value that v is replaced with.
+func (t *Transform) value(v int) int {
+	if len(t.Values) == 0 {
+		return v
+	}
+	return t.Values[v]
+}
+
+// source returns the (1-based) index of the square in a puzzle
+// of side length n that is moved to the given index.
+func (t *Transform) source(n, index int) int {
+	r, c := t.row((index-1)/n), t.column((index-1)%n)
+	if t.Transpose {
+		r, c = c, r
+	}
+	return r*n + c + 1
+}
+
+// target returns the (1-based) index that the square with the
+// given index is moved to in a puzzle of side length n.
+func (t *Transform) target(n, index int) int {
+	return t.inverse(n).source(n, index)
+}
+
+// inverse returns the transform that undoes this one on puzzles
+// of side length n.  If this transform transposes, the inverse
+// does too, so its row and column orders are swapped.
+func (t *Transform) inverse(n int) *Transform {
+	inv := &Transform{Transpose: t.Transpose}
+	rows, cols := make([]int, n), make([]int, n)
+	for i := 0; i < n; i++ {
+		rows[t.row(i)], cols[t.column(i)] = i, i
+	}
+	if t.Transpose {
+		rows, cols = cols, rows
+	}
+	inv.Rows, inv.Columns = rows, cols
+	if len(t.Values) > 0 {
+		inv.Values = make([]int, len(t.Values))
+		for v, tv := range t.Values {
+			inv.Values[tv] = v
+		}
+	}
+	return inv
+}
+
+// apply returns a copy of a summary with its values, regions,
+// cages, and marks moved by the transform.  The metadata is
+// shared, and the errors are not carried over.  The summary must
+// be well-formed.
+func (t *Transform) apply(s *Summary) *Summary {
+	n := s.SideLength
+	ts := &Summary{
+		Metadata:    s.Metadata,
+		Geometry:    s.Geometry,
+		SideLength:  n,
+		Marks:       t.Choices(n, s.Marks),
+		UseMarks:    s.UseMarks,
+		Propagation: s.Propagation,
+	}
+	if len(s.Values) > 0 {
+		ts.Values = make([]int, len(s.Values))
+		for i := range ts.Values {
+			ts.Values[i] = t.value(s.Values[t.source(n, i+1)-1])
+		}
+	}
+	if len(s.Regions) > 0 {
+		ts.Regions = make([]int, len(s.Regions))
+		for i := range ts.Regions {
+			ts.Regions[i] = s.Regions[t.source(n, i+1)-1]
+		}
+	}
+	if len(s.Cages) > 0 {
+		inv := t.inverse(n)
+		ts.Cages = make([]Cage, len(s.Cages))
+		for i, c := range s.Cages {
+			indices := make(intset, len(c.Indices))
+			for j, idx := range c.Indices {
+				indices[j] = inv.source(n, idx)
+			}
+			sort.Ints(indices)
+			ts.Cages[i] = Cage{c.Sum, indices}
+		}
+	}
+	return ts
+}
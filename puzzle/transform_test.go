@@ -0,0 +1,208 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTransformInverse(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := &Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues, Cages: []Cage{{3, []int{1, 2}}}}
+	pm, _ := squarePuzzleMapping(81)
+	for i := 0; i < 10; i++ {
+		tf := helperRandomTransform(r, pm, true)
+		ts := tf.apply(s)
+		if back := tf.inverse(9).apply(ts); !reflect.DeepEqual(back.Values, s.Values) ||
+			!reflect.DeepEqual(back.Cages, s.Cages) {
+			t.Errorf("test %d: Inverse of %+v gave %v, expected %v", i, tf, back, s)
+		}
+		for idx := 1; idx <= 81; idx++ {
+			if src := tf.source(9, tf.target(9, idx)); src != idx {
+				t.Errorf("test %d: Index %d went to %d, which came from %d", i, idx, tf.target(9, idx), src)
+			}
+		}
+	}
+}
+
+func TestTransformOperations(t *testing.T) {
+	s := &Summary{Geometry: StandardGeometryName, SideLength: 4, Values: []int{
+		1, 2, 3, 4,
+		3, 4, 1, 2,
+		2, 1, 4, 3,
+		4, 3, 2, 1,
+	}}
+	tcs := []struct {
+		transform *Transform
+		values    []int
+	}{
+		{Rotation(4, 0), s.Values},
+		{Rotation(4, 4), s.Values},
+		{Rotation(4, 1), []int{4, 2, 3, 1, 3, 1, 4, 2, 2, 4, 1, 3, 1, 3, 2, 4}},
+		{Rotation(4, -3), []int{4, 2, 3, 1, 3, 1, 4, 2, 2, 4, 1, 3, 1, 3, 2, 4}},
+		{Rotation(4, 2), []int{1, 2, 3, 4, 3, 4, 1, 2, 2, 1, 4, 3, 4, 3, 2, 1}},
+		{Rotation(4, 3), []int{4, 2, 3, 1, 3, 1, 4, 2, 2, 4, 1, 3, 1, 3, 2, 4}},
+		{Rotation(4, 1).Then(4, Rotation(4, 2)), []int{4, 2, 3, 1, 3, 1, 4, 2, 2, 4, 1, 3, 1, 3, 2, 4}},
+		{Rotation(4, 1).Then(4, Rotation(4, -1)), s.Values},
+		{HorizontalReflection(4), []int{4, 3, 2, 1, 2, 1, 4, 3, 3, 4, 1, 2, 1, 2, 3, 4}},
+		{VerticalReflection(4), []int{4, 3, 2, 1, 2, 1, 4, 3, 3, 4, 1, 2, 1, 2, 3, 4}},
+		{Transposition(), []int{1, 3, 2, 4, 2, 4, 1, 3, 3, 1, 4, 2, 4, 2, 3, 1}},
+		{Relabeling(2, 3, 4, 1), []int{2, 3, 4, 1, 4, 1, 2, 3, 3, 2, 1, 4, 1, 4, 3, 2}},
+		{RowOrder(1, 0, 2, 3), []int{3, 4, 1, 2, 1, 2, 3, 4, 2, 1, 4, 3, 4, 3, 2, 1}},
+		{ColumnOrder(0, 1, 3, 2), []int{1, 2, 4, 3, 3, 4, 2, 1, 2, 1, 3, 4, 4, 3, 1, 2}},
+		{BandOrder(2, 1, 0), []int{2, 1, 4, 3, 4, 3, 2, 1, 1, 2, 3, 4, 3, 4, 1, 2}},
+		{StackOrder(2, 1, 0), []int{3, 4, 1, 2, 1, 2, 3, 4, 4, 3, 2, 1, 2, 1, 4, 3}},
+		{Transposition().Then(4, Relabeling(2, 3, 4, 1)), []int{2, 4, 3, 1, 3, 1, 2, 4, 4, 2, 1, 3, 1, 3, 4, 2}},
+	}
+	for i, tc := range tcs {
+		ts, e := s.Transform(tc.transform)
+		if e != nil {
+			t.Fatalf("test %d: Transform %+v failed: %v", i+1, tc.transform, e)
+		}
+		if !reflect.DeepEqual(ts.Values, tc.values) {
+			t.Errorf("test %d: Transform %+v gave %v, expected %v", i+1, tc.transform, ts.Values, tc.values)
+		}
+	}
+}
+
+func TestTransformSymmetries(t *testing.T) {
+	standard := &Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues}
+	rectangular := &Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: Su6Difficult1Values}
+	diagonal := &Summary{Geometry: DiagonalGeometryName, SideLength: 9, Values: diagonal9Values}
+	jigsaw := &Summary{Geometry: JigsawGeometryName, SideLength: 6, Values: jigsaw6Values, Regions: jigsaw6Regions}
+	killer := &Summary{Geometry: StandardGeometryName, SideLength: 4, Cages: killer4Cages}
+	tcs := []struct {
+		summary   *Summary
+		transform *Transform
+		condition ErrorCondition
+	}{
+		{standard, Rotation(9, 1), UnknownCondition},
+		{standard, Transposition(), UnknownCondition},
+		{standard, HorizontalReflection(9), UnknownCondition},
+		{standard, BandOrder(3, 2, 0, 1), UnknownCondition},
+		{standard, StackOrder(3, 1, 2, 0), UnknownCondition},
+		{standard, RowOrder(1, 0, 2, 5, 4, 3, 6, 8, 7), UnknownCondition},
+		{standard, Relabeling(9, 8, 7, 6, 5, 4, 3, 2, 1), UnknownCondition},
+		{standard, RowOrder(3, 1, 2, 0, 4, 5, 6, 7, 8), NotSymmetryCondition},
+		{standard, ColumnOrder(0, 1, 2, 3), InvalidArgumentCondition},
+		{standard, Relabeling(1, 1, 3, 4, 5, 6, 7, 8, 9), InvalidArgumentCondition},
+		{standard, &Transform{Values: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}}, InvalidArgumentCondition},
+		{rectangular, Rotation(6, 2), UnknownCondition},
+		{rectangular, BandOrder(2, 2, 0, 1), UnknownCondition},
+		{rectangular, StackOrder(3, 1, 0), UnknownCondition},
+		{rectangular, Rotation(6, 1), NotSymmetryCondition},
+		{rectangular, Transposition(), NotSymmetryCondition},
+		{rectangular, BandOrder(3, 1, 0), NotSymmetryCondition},
+		{diagonal, Rotation(9, 1), UnknownCondition},
+		{diagonal, Transposition(), UnknownCondition},
+		{diagonal, RowOrder(2, 1, 0, 3, 4, 5, 8, 7, 6).Then(9, ColumnOrder(2, 1, 0, 3, 4, 5, 8, 7, 6)), UnknownCondition},
+		{diagonal, BandOrder(3, 1, 0, 2), NotSymmetryCondition},
+		{jigsaw, Rotation(6, 1), UnknownCondition},
+		{jigsaw, VerticalReflection(6), UnknownCondition},
+		{jigsaw, Relabeling(2, 1, 3, 4, 5, 6), UnknownCondition},
+		{jigsaw, RowOrder(1, 0, 2, 3, 4, 5), NotSymmetryCondition},
+		{killer, Rotation(4, 1), UnknownCondition},
+		{killer, BandOrder(2, 1, 0), UnknownCondition},
+		{killer, Relabeling(2, 1, 3, 4), NotSymmetryCondition},
+		{killer, nil, InvalidArgumentCondition},
+	}
+	for i, tc := range tcs {
+		ts, e := tc.summary.Transform(tc.transform)
+		if tc.condition != UnknownCondition {
+			if err, ok := e.(Error); !ok || err.Attribute != TransformAttribute || err.Condition != tc.condition {
+				t.Errorf("test %d: Transform gave error %v, expected condition %v", i+1, e, tc.condition)
+			}
+			continue
+		}
+		if e != nil {
+			t.Fatalf("test %d: Transform failed: %v", i+1, e)
+		}
+		// a symmetry takes solutions to solutions
+		p, e := New(tc.summary)
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		tp, e := New(ts)
+		if e != nil {
+			t.Fatalf("test %d: Failed to create transformed puzzle: %v", i+1, e)
+		}
+		solns, tsolns := p.allSolutions(), tp.allSolutions()
+		if len(solns) != 1 || len(tsolns) != 1 {
+			t.Fatalf("test %d: Got %d and %d solutions, expected 1", i+1, len(solns), len(tsolns))
+		}
+		solved := tc.transform.apply(&Summary{SideLength: tc.summary.SideLength, Values: solns[0].Values})
+		if !reflect.DeepEqual(solved.Values, tsolns[0].Values) {
+			t.Errorf("test %d: Transformed solution is %v, expected %v", i+1, tsolns[0].Values, solved.Values)
+		}
+	}
+}
+
+func TestPuzzleTransform(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	tf := Rotation(9, 1).Then(9, BandOrder(3, 1, 2, 0)).Then(9, Relabeling(3, 1, 2, 6, 4, 5, 9, 7, 8))
+	tp, e := p.Transform(tf)
+	if e != nil {
+		t.Fatalf("Failed to transform puzzle: %v", e)
+	}
+
+	// moves made before the transform can be replayed after it
+	choices := []Choice{{2, 1}, {3, 6}}
+	for _, c := range choices {
+		if _, e := p.Assign(c); e != nil {
+			t.Fatalf("Failed to assign %v: %v", c, e)
+		}
+	}
+	for _, c := range tf.Choices(9, choices) {
+		if _, e := tp.Assign(c); e != nil {
+			t.Fatalf("Failed to assign %v: %v", c, e)
+		}
+	}
+	if _, e := p.Mark(Mark{Index: 5, Value: 1}); e != nil {
+		t.Fatalf("Failed to mark puzzle: %v", e)
+	}
+	tm := tf.Choices(9, []Choice{{5, 1}})[0]
+	if _, e := tp.Mark(Mark{Index: tm.Index, Value: tm.Value}); e != nil {
+		t.Fatalf("Failed to mark transformed puzzle: %v", e)
+	}
+	ps, _ := p.Summary()
+	expected, e := ps.Transform(tf)
+	if e != nil {
+		t.Fatalf("Failed to transform summary: %v", e)
+	}
+	tps, _ := tp.Summary()
+	if !reflect.DeepEqual(tps.Values, expected.Values) {
+		t.Errorf("Replayed puzzle has values %v, expected %v", tps.Values, expected.Values)
+	}
+	if !reflect.DeepEqual(tps.Marks, expected.Marks) {
+		t.Errorf("Replayed puzzle has marks %v, expected %v", tps.Marks, expected.Marks)
+	}
+
+	if _, e := p.Transform(Transposition().Then(9, RowOrder(8, 1, 2, 3, 4, 5, 6, 7, 0))); e == nil {
+		t.Errorf("Transform that isn't a symmetry didn't fail")
+	}
+	var np *Puzzle
+	if _, e := np.Transform(Transposition()); e == nil {
+		t.Errorf("Transform of nil puzzle didn't fail")
+	}
+}
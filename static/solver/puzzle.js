@@ -11,6 +11,7 @@ var stateURL = "/api/state/";
 var assignURL = "/api/assign/";
 var backURL = "/api/back/";
 var resetURL = "/api/reset/";
+var explainURL = "/api/explain/";
 var homeURL = "/home/";
 var solverURL = "/solver/";
 
@@ -159,14 +160,13 @@ function refillPuzzle() {
     }
 };
 
-function fillGuess(guesses, idx, bval, bsrc) {
+function fillGuess(guesses, idx, bval) {
     if (guesses)
 	guessContent = {
 	    "guesses": guesses,
 	    "max": puzzleSideLength,
 	    "index" : idx,
-	    "bval": bval,
-	    "bsrc": bsrc
+	    "bval": bval
 	};
     else
 	guessContent = null;
@@ -191,7 +191,7 @@ function refillGuess() {
 	var guessbox = document.getElementById("guessbox");
 	guessbox.className = "filled";
 	var whybox = document.getElementById("why")
-	if (guessHints && guessContent.bsrc) {
+	if (guessHints) {
 	    whybox.setAttribute("show", "yes")
 	} else {
 	    whybox.setAttribute("show", "no")
@@ -215,6 +215,18 @@ function puzzleErrorMessage() {
     return message
 }    
 
+function cellInError(idx) {
+    if (puzzleErrors) {
+	for (var i = 0; i < puzzleErrors.length; i++) {
+	    var details = puzzleErrors[i].details;
+	    if (details && (details.index == idx ||
+			    (details.squares && details.squares.indexOf(idx) > -1)))
+		return true;
+	}
+    }
+    return false;
+}
+
 function setFeedback(message) {
     document.getElementById("guessFeedback").innerHTML = message
 }
@@ -253,6 +265,13 @@ function selectCell(idx) {
 	}
 	// fill the guess for the cell
 	if (puzzleErrors) {
+	    // no guesses are allowed, but the cell can be explained
+	    // if it's unassigned or in an error
+	    if (cellInError(idx) ||
+		(puzzleContent && !('aval' in puzzleContent[idx - 1])))
+		fillGuess([], idx);
+	    else
+		fillGuess();
 	    emsg = puzzleErrorMessage()
 	    setFeedback("Cell " + idx + " selected. " + emsg)
 	} else {
@@ -263,7 +282,7 @@ function selectCell(idx) {
 		    fillGuess();
 		} else if ('bval' in puzzleContent[pcIdx]) {
 		    var val = puzzleContent[pcIdx].bval
-		    fillGuess([ val ], idx, val, puzzleContent[pcIdx].bsrc);
+		    fillGuess([ val ], idx, val);
 		} else if ('pvals' in puzzleContent[pcIdx]) {
 		    fillGuess(puzzleContent[pcIdx].pvals, idx);
 		} else {
@@ -294,20 +313,43 @@ function keyGuess(event) {
     }
 }
 
+function receiveExplanation() {
+    if (this.readyState == 4) {
+	if (this.status == 200) {
+	    // console.log("Got explanation:", this.responseText);
+            var result = JSON.parse(this.responseText);
+	    setFeedback("Cell " + result.index + ":" + explanationMessage(result.reasons, ""));
+	} else if (this.status >= 400 && this.status < 500) {
+            var result = JSON.parse(this.responseText);
+	    setFeedback("Couldn't explain cell:<br />" + result.message);
+	} else {
+	    setFeedback("Couldn't explain cell:<br />Internal Server Error.");
+	}
+    }
+}
+
+var getExplainRequest = new XMLHttpRequest();
+getExplainRequest.onreadystatechange = receiveExplanation;
+
+function explanationMessage(reasons, indent) {
+    var message = "";
+    if (reasons) {
+	for (var i = 0; i < reasons.length; i++) {
+	    message += "<br />" + indent + reasons[i].message;
+	    message += explanationMessage(reasons[i].because, indent + "&nbsp;&nbsp;&nbsp;&nbsp;");
+	}
+    }
+    return message;
+}
+
 function clickWhy(event) {
     event.stopPropagation();
-    if (guessContent.bsrc) {
-	var reasons = "Cell " + guessContent.index;
-	reasons += " is the only cell that can contain " + guessContent.bval;
-	for (i = 0; i < guessContent.bsrc.length; i++) {
-	    if (i == 0) {
-		reasons += " in ";
-	    } else {
-		reasons += " and ";
-	    }
-	    reasons += guessContent.bsrc[i].gtype + " " + guessContent.bsrc[i].index;
-	}
-	setFeedback(reasons + ".");
+    if (guessContent) {
+	var url = explainURL + "?index=" + guessContent.index;
+	console.log("GET request for", url);
+	setFeedback("Explaining cell " + guessContent.index + "...");
+	getExplainRequest.open("GET", url, true);
+	getExplainRequest.send(null);
     }
 }
 
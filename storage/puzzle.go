@@ -46,10 +46,55 @@ func (s *Session) loadActivePuzzle() {
 
 // AddStep: add a new step to the active puzzle.
 func (s *Session) AddStep(choice puzzle.Choice) {
+	s.addEntryStep(int32(choice.Index), int32(choice.Value))
+}
+
+// AddUnassignStep: add a new step to the active puzzle that
+// clears an earlier choice.
+func (s *Session) AddUnassignStep(index int) {
+	s.addEntryStep(int32(index), 0)
+}
+
+// AddMarkStep: add a new step to the active puzzle that strikes
+// or restores a possible value.
+func (s *Session) AddMarkStep(mark puzzle.Mark) {
+	if mark.Restore {
+		s.addEntryStep(-int32(mark.Index), int32(mark.Value))
+	} else {
+		s.addEntryStep(int32(mark.Index), -int32(mark.Value))
+	}
+}
+
+// AddUseMarksStep: add a new step to the active puzzle that
+// changes whether its marks are used.
+func (s *Session) AddUseMarksStep(use bool) {
+	if use {
+		s.addEntryStep(0, 1)
+	} else {
+		s.addEntryStep(0, 0)
+	}
+}
+
+// addEntryStep: add an encoded step to the active puzzle.  Steps
+// are pairs of numbers in the session entry's choices:
+//
+// - an assignment is its index and value;
+//
+// - a cleared assignment is its index and 0;
+//
+// - a struck value is its index and the negated value;
+//
+// - a restored value is the negated index and the value;
+//
+// - a change to whether marks are used is 0 and then 1 (use
+// them) or 0 (don't use them).
+//
+// The session's puzzle must already have taken the step.
+func (s *Session) addEntryStep(index, value int32) {
 	// update the session entry, cache, and database
 	se := s.entries[s.active]
 	se.LastView = time.Now()
-	se.Choices = append(se.Choices, int32(choice.Index), int32(choice.Value))
+	se.Choices = append(se.Choices, index, value)
 	s.cacheUpdateEntry(s.active)
 	s.databaseUpdateEntry(s.active)
 	// update the state of the session and the step cache
@@ -94,6 +139,12 @@ func (s *Session) RemoveAllSteps() {
 	s.Info = s.makePuzzleInfo(s.active)
 }
 
+// StartingPuzzle: a fresh copy of the active puzzle as it was
+// before any steps were taken.
+func (s *Session) StartingPuzzle() *puzzle.Puzzle {
+	return loadPuzzleEntry(s.entries[s.active].PuzzleId).makePuzzle()
+}
+
 /*
 
 puzzle info
@@ -104,31 +155,53 @@ puzzle info
 // the session.  It merges the sessionEntry data with the
 // puzzleEntry shape data.
 type PuzzleInfo struct {
-	PuzzleId   string          // unique ID for this puzzle
-	Name       string          // user-facing name of the puzzle
-	Geometry   string          // puzzle geometry
-	SideLength int             // puzzle size
-	Choices    []puzzle.Choice // choices made for this puzzle
-	Remaining  int             // number of remaining choices to make
-	LastView   time.Time       // time when the puzzle was last viewed
+	PuzzleId    string          // unique ID for this puzzle
+	Name        string          // user-facing name of the puzzle
+	Geometry    string          // puzzle geometry
+	SideLength  int             // puzzle size
+	Regions     []int           // puzzle region map, if any
+	Cages       []puzzle.Cage   // puzzle cages, if any
+	CanonicalId string          // signature shared by equivalent puzzles
+	Choices     []puzzle.Choice // choices made for this puzzle
+	Steps       int             // number of steps (choices and marks) taken
+	Remaining   int             // number of remaining choices to make
+	LastView    time.Time       // time when the puzzle was last viewed
 }
 
 // makePuzzleInfo - make a PuzzleInfo from a sessionEntry
 func (s *Session) makePuzzleInfo(index int) *PuzzleInfo {
 	se := s.entries[index]
-	choices := make([]puzzle.Choice, len(se.Choices)/2)
-	for i := range choices {
-		choices[i] = puzzle.Choice{Index: int(se.Choices[2*i]), Value: int(se.Choices[2*i+1])}
+	choices := make([]puzzle.Choice, 0, len(se.Choices)/2)
+	for i := 0; i < len(se.Choices); i = i + 2 {
+		index, value := se.Choices[i], se.Choices[i+1]
+		if index <= 0 || value < 0 {
+			continue
+		}
+		if value > 0 {
+			choices = append(choices, puzzle.Choice{Index: int(index), Value: int(value)})
+			continue
+		}
+		// a cleared assignment removes the choice it cleared
+		for j := range choices {
+			if choices[j].Index == int(index) {
+				choices = append(choices[:j], choices[j+1:]...)
+				break
+			}
+		}
 	}
 	pe := loadPuzzleEntry(se.PuzzleId)
 	return &PuzzleInfo{
-		PuzzleId:   se.PuzzleId,
-		Name:       se.PuzzleName,
-		Geometry:   pe.Geometry,
-		SideLength: int(pe.SideLength),
-		Choices:    choices,
-		Remaining:  countZeroes(pe.Values) - len(choices),
-		LastView:   se.LastView,
+		PuzzleId:    se.PuzzleId,
+		Name:        se.PuzzleName,
+		Geometry:    pe.Geometry,
+		SideLength:  int(pe.SideLength),
+		Regions:     pe.regions(),
+		Cages:       pe.cages(),
+		CanonicalId: pe.CanonicalId,
+		Choices:     choices,
+		Steps:       len(se.Choices) / 2,
+		Remaining:   countZeroes(pe.Values) - len(choices),
+		LastView:    se.LastView,
 	}
 }
 
@@ -175,28 +248,72 @@ puzzle entries
 
 // A puzzleEntry represents the stored form of a starting-point
 // or solution puzzle. It is JSON serializable so it can go into
-// the cache as well as the database.
+// the cache as well as the database.  Puzzles that are
+// equivalent under a symmetry of their geometry have different
+// ids but the same canonical id.
 type puzzleEntry struct {
-	PuzzleId   string // puzzle Signature
-	Geometry   string
-	SideLength int32
-	Values     []int32
+	PuzzleId    string // puzzle Signature
+	Geometry    string
+	SideLength  int32
+	Values      []int32
+	Regions     []int32 // only for irregular geometries
+	Cages       []int32 // flattened array of <sum, count, indices...> cages
+	CanonicalId string  // puzzle CanonicalSignature
 }
 
 // loadPuzzleEntry first checks the cache, then the database, to
 // find the puzzle's entry.  If it loads from the database, it
-// caches the result.  Panics if there is no such stored entry.
+// caches the result.  Entries saved before canonical ids were
+// kept are given one as they are loaded.  Panics if there is no
+// such stored entry.
 func loadPuzzleEntry(id string) *puzzleEntry {
 	pe := &puzzleEntry{PuzzleId: id}
-	if pe.cacheLoad() {
+	if pe.cacheLoad() && pe.CanonicalId != "" {
 		return pe
 	}
 	// cache miss, load from database and save to cache
 	pe.databaseLoad()
+	if pe.CanonicalId == "" {
+		pe.CanonicalId = pe.canonicalId()
+		pe.databaseUpdateCanonical()
+	}
 	pe.cacheInsert()
 	return pe
 }
 
+// newPuzzleEntry: make the entry for a puzzle with the given
+// summary.  Panics if the summary is invalid.
+func newPuzzleEntry(summary *puzzle.Summary) *puzzleEntry {
+	hash, err := summary.Hash()
+	if err != nil {
+		panic(fmt.Errorf("Can't store puzzle with invalid summary: %v", err))
+	}
+	canonical, _, err := summary.CanonicalSignature()
+	if err != nil {
+		panic(fmt.Errorf("Can't store puzzle with invalid summary: %v", err))
+	}
+	pe := &puzzleEntry{
+		PuzzleId:    string(hash),
+		Geometry:    summary.Geometry,
+		SideLength:  int32(summary.SideLength),
+		Values:      make([]int32, len(summary.Values)),
+		CanonicalId: string(canonical),
+	}
+	for i, v := range summary.Values {
+		pe.Values[i] = int32(v)
+	}
+	for _, r := range summary.Regions {
+		pe.Regions = append(pe.Regions, int32(r))
+	}
+	for _, c := range summary.Cages {
+		pe.Cages = append(pe.Cages, int32(c.Sum), int32(len(c.Indices)))
+		for _, idx := range c.Indices {
+			pe.Cages = append(pe.Cages, int32(idx))
+		}
+	}
+	return pe
+}
+
 // makePuzzle: make the puzzle described in a puzzle entry
 func (pe *puzzleEntry) makePuzzle() *puzzle.Puzzle {
 	values := make([]int, len(pe.Values))
@@ -207,6 +324,8 @@ func (pe *puzzleEntry) makePuzzle() *puzzle.Puzzle {
 		Geometry:   pe.Geometry,
 		SideLength: int(pe.SideLength),
 		Values:     values,
+		Regions:    pe.regions(),
+		Cages:      pe.cages(),
 	})
 	if e != nil {
 		panic(fmt.Errorf("Failed to create puzzle %q: %v", pe.PuzzleId, e))
@@ -214,6 +333,48 @@ func (pe *puzzleEntry) makePuzzle() *puzzle.Puzzle {
 	return p
 }
 
+// canonicalId: compute the canonical id of a puzzle entry.
+func (pe *puzzleEntry) canonicalId() string {
+	sig, _, err := pe.makePuzzle().CanonicalSignature()
+	if err != nil {
+		panic(fmt.Errorf("Failed to compute canonical id of puzzle %q: %v", pe.PuzzleId, err))
+	}
+	return string(sig)
+}
+
+// regions: the region map of a puzzle entry, or nil if it
+// doesn't have one.
+func (pe *puzzleEntry) regions() []int {
+	if len(pe.Regions) == 0 {
+		return nil
+	}
+	regions := make([]int, len(pe.Regions))
+	for i, r := range pe.Regions {
+		regions[i] = int(r)
+	}
+	return regions
+}
+
+// cages: the cages of a puzzle entry, or nil if it doesn't have
+// any.
+func (pe *puzzleEntry) cages() []puzzle.Cage {
+	var cages []puzzle.Cage
+	for i := 0; i+1 < len(pe.Cages); {
+		sum, count := int(pe.Cages[i]), int(pe.Cages[i+1])
+		i += 2
+		if i+count > len(pe.Cages) {
+			panic(fmt.Errorf("Puzzle %q has a malformed cage list: %v", pe.PuzzleId, pe.Cages))
+		}
+		indices := make([]int, count)
+		for j := range indices {
+			indices[j] = int(pe.Cages[i+j])
+		}
+		cages = append(cages, puzzle.Cage{Sum: sum, Indices: indices})
+		i += count
+	}
+	return cages
+}
+
 // key: compute the cache key for a puzzleEntry.
 func (pe *puzzleEntry) key() string {
 	return "PID:" + pe.PuzzleId
@@ -255,9 +416,10 @@ func (pe *puzzleEntry) cacheLoad() bool {
 func (pe *puzzleEntry) databaseLoad() {
 	body := func(tx *pgx.Tx) error {
 		row := tx.QueryRow(
-			"SELECT geometry, sideLength, valueList FROM puzzles "+
-				"WHERE puzzleId = $1", pe.PuzzleId)
-		if err := row.Scan(&pe.Geometry, &pe.SideLength, &pe.Values); err != nil {
+			"SELECT geometry, sideLength, valueList, regionList, cageList, "+
+				"coalesce(canonicalId, '') FROM puzzles WHERE puzzleId = $1", pe.PuzzleId)
+		if err := row.Scan(&pe.Geometry, &pe.SideLength, &pe.Values, &pe.Regions, &pe.Cages,
+			&pe.CanonicalId); err != nil {
 			return fmt.Errorf("Failure looking up puzzle %q: %v", pe.PuzzleId, err)
 		}
 		return nil
@@ -265,6 +427,22 @@ func (pe *puzzleEntry) databaseLoad() {
 	pgExecute(body)
 }
 
+// databaseExists: whether there is a saved entry with the
+// puzzle entry's id.
+func (pe *puzzleEntry) databaseExists() bool {
+	var count int64
+	body := func(tx *pgx.Tx) error {
+		row := tx.QueryRow(
+			"SELECT COUNT(*) FROM puzzles WHERE puzzleId = $1", pe.PuzzleId)
+		if err := row.Scan(&count); err != nil {
+			return fmt.Errorf("Failure looking for puzzle %q: %v", pe.PuzzleId, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return count > 0
+}
+
 // cacheInsert: insert a puzzle entry into the cache. Replaces
 // any existing entry with the same id.
 func (pe *puzzleEntry) cacheInsert() {
@@ -287,9 +465,11 @@ func (pe *puzzleEntry) cacheInsert() {
 func (pe *puzzleEntry) databaseInsert() {
 	body := func(tx *pgx.Tx) (err error) {
 		_, err = tx.Exec(
-			"INSERT INTO puzzles (puzzleId, geometry, sideLength, valueList, created) "+
-				"VALUES ($1, $2, $3, $4, $5)",
-			pe.PuzzleId, pe.Geometry, pe.SideLength, pe.Values, time.Now())
+			"INSERT INTO puzzles "+
+				"(puzzleId, geometry, sideLength, valueList, regionList, cageList, canonicalId, created) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			pe.PuzzleId, pe.Geometry, pe.SideLength, pe.Values, pe.Regions, pe.Cages,
+			pe.CanonicalId, time.Now())
 		if err != nil {
 			err = fmt.Errorf("Database error saving puzzle entry %q: %v", pe.PuzzleId, err)
 		}
@@ -298,6 +478,46 @@ func (pe *puzzleEntry) databaseInsert() {
 	pgExecute(body)
 }
 
+// databaseUpdateCanonical: save the canonical id of a puzzle
+// entry that was saved without one.
+func (pe *puzzleEntry) databaseUpdateCanonical() {
+	body := func(tx *pgx.Tx) (err error) {
+		_, err = tx.Exec(
+			"UPDATE puzzles SET canonicalId = $1 WHERE puzzleId = $2",
+			pe.CanonicalId, pe.PuzzleId)
+		if err != nil {
+			err = fmt.Errorf("Database error updating puzzle entry %q: %v", pe.PuzzleId, err)
+		}
+		return
+	}
+	pgExecute(body)
+}
+
+// databaseFindCanonical: the ids of the saved puzzles with the
+// given canonical id, that is, of the saved puzzles equivalent
+// to any one with that id.
+func databaseFindCanonical(canonicalId string) []string {
+	var ids []string
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT puzzleId FROM puzzles WHERE canonicalId = $1 ORDER BY puzzleId", canonicalId)
+		if err != nil {
+			return fmt.Errorf("Failure looking for puzzles like %q: %v", canonicalId, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return fmt.Errorf("Failure reading puzzles like %q: %v", canonicalId, err)
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return ids
+}
+
 /*
 
 solution steps
@@ -380,15 +600,30 @@ func (s *Session) constructActivePuzzle() {
 	s.Puzzle = loadPuzzleEntry(s.entries[s.active].PuzzleId).makePuzzle()
 	s.addStep()
 	for j := 0; j < len(choices); j = j + 2 {
-		choice := puzzle.Choice{Index: int(choices[j]), Value: int(choices[j+1])}
-		_, err := s.Puzzle.Assign(choice)
-		if err != nil {
-			panic(fmt.Errorf("Failure assigning to puzzle: %v", err))
+		if err := applyStep(s.Puzzle, choices[j], choices[j+1]); err != nil {
+			panic(fmt.Errorf("Failure replaying step %d of puzzle: %v", j/2+1, err))
 		}
 		s.addStep()
 	}
 }
 
+// applyStep: apply an encoded step (see addEntryStep) to a puzzle.
+func applyStep(p *puzzle.Puzzle, index, value int32) (err error) {
+	switch {
+	case index == 0:
+		_, err = p.SetUseMarks(value != 0)
+	case index < 0:
+		_, err = p.Mark(puzzle.Mark{Index: int(-index), Value: int(value), Restore: true})
+	case value < 0:
+		_, err = p.Mark(puzzle.Mark{Index: int(index), Value: int(-value)})
+	case value == 0:
+		_, err = p.Unassign(int(index))
+	default:
+		_, err = p.Assign(puzzle.Choice{Index: int(index), Value: int(value)})
+	}
+	return
+}
+
 // marshalPuzzle: serialize a puzzle as JSON
 func (s *Session) marshalPuzzle(puzzle *puzzle.Puzzle) []byte {
 	summary, err := puzzle.Summary()
@@ -141,6 +141,89 @@ func (s *Session) SelectPuzzle(pid string) {
 	s.loadActivePuzzle()
 }
 
+// AddPuzzle: add a new puzzle, given by its summary, to the
+// session, and activate it.  The puzzle is saved (unless it's
+// already known), and is given a name "puzzle-N" that's unique
+// in the session.  Adding a puzzle that's already in the
+// session, or that's equivalent to one in the session (see
+// FindEquivalentPuzzle), just activates the session's puzzle.
+// Returns the info about the active puzzle.
+func (s *Session) AddPuzzle(summary *puzzle.Summary) *PuzzleInfo {
+	pe := newPuzzleEntry(summary)
+	if i := s.findEquivalentEntry(pe); i >= 0 {
+		s.SelectPuzzle(s.entries[i].PuzzleId)
+		return s.Info
+	}
+	if !pe.cacheLoad() {
+		if !pe.databaseExists() {
+			pe.databaseInsert()
+		}
+		pe.cacheInsert()
+	}
+	s.entries = append(s.entries, &sessionEntry{
+		PuzzleId:   pe.PuzzleId,
+		PuzzleName: s.newPuzzleName(),
+		LastView:   time.Now(),
+	})
+	s.cacheAppendEntry(len(s.entries) - 1)
+	s.databaseInsertEntry(len(s.entries) - 1)
+	s.SelectPuzzle(pe.PuzzleId)
+	return s.Info
+}
+
+// FindEquivalentPuzzle: find the puzzle in the session that's
+// equivalent to the one with the given summary, that is, the
+// same puzzle up to a symmetry of its geometry (such as a
+// rotation, or a relabeling of its values).  Returns the info
+// about the session's puzzle, or nil if there isn't one.  Panics
+// if the summary is invalid.
+func (s *Session) FindEquivalentPuzzle(summary *puzzle.Summary) *PuzzleInfo {
+	if i := s.findEquivalentEntry(newPuzzleEntry(summary)); i >= 0 {
+		return s.makePuzzleInfo(i)
+	}
+	return nil
+}
+
+// findEquivalentEntry: the index of the session entry for the
+// given puzzle, or else for a puzzle equivalent to it, or -1 if
+// there's neither.
+func (s *Session) findEquivalentEntry(pe *puzzleEntry) int {
+	for i, se := range s.entries {
+		if se.PuzzleId == pe.PuzzleId {
+			return i
+		}
+	}
+	for i, se := range s.entries {
+		if loadPuzzleEntry(se.PuzzleId).CanonicalId == pe.CanonicalId {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindEquivalentPuzzles: find the ids of all the saved puzzles
+// that are equivalent to the one with the given summary
+// (including it, if it's saved).  Puzzles saved before canonical
+// ids were kept are only found once they've been loaded.  Panics
+// if the summary is invalid.
+func FindEquivalentPuzzles(summary *puzzle.Summary) []string {
+	return databaseFindCanonical(newPuzzleEntry(summary).CanonicalId)
+}
+
+// newPuzzleName: a (lowercase) name for an added puzzle that
+// isn't used by any puzzle in the session.
+func (s *Session) newPuzzleName() string {
+	used := make(map[string]bool, len(s.entries))
+	for _, se := range s.entries {
+		used[se.PuzzleName] = true
+	}
+	for i := len(s.entries) + 1; ; i++ {
+		if name := fmt.Sprintf("puzzle-%d", i); !used[name] {
+			return name
+		}
+	}
+}
+
 /*
 
 Session loading and saving
@@ -466,6 +549,40 @@ func (s *Session) databaseUpdateEntry(index int) {
 	pgExecute(body)
 }
 
+// cacheAppendEntry: add a new session entry to the end of the
+// cached entries.
+func (s *Session) cacheAppendEntry(index int) {
+	bytes := s.marshalEntry(index)
+	body := func(tx redis.Conn) (err error) {
+		_, err = tx.Do("RPUSH", s.entryKey(), bytes)
+		if err != nil {
+			return fmt.Errorf("Cache error adding entry %d for session %q: %v",
+				index, s.sid, err)
+		}
+		return
+	}
+	rdExecute(body)
+}
+
+// databaseInsertEntry: insert a new session entry into the
+// database.  This will fail if the entry already exists.
+func (s *Session) databaseInsertEntry(index int) {
+	se := s.entries[index]
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO sessionEntries "+
+				"(sessionId, puzzleId, puzzleName, choicePairs, lastView) "+
+				"VALUES ($1, $2, $3, $4, $5);",
+			s.sid, se.PuzzleId, se.PuzzleName, se.Choices, se.LastView)
+		if err != nil {
+			return fmt.Errorf("Database error saving entry %d for session %q: %v",
+				index, s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+}
+
 // databaseInsertEntries: insert all the entries for this session
 // into the database.  This will fail if any of the entries
 // already exist.
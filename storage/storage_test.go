@@ -293,6 +293,128 @@ func TestSessionOpsPhase4(t *testing.T) {
 	}
 }
 
+func TestSessionMarkSteps(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession(sid)
+	ts.SelectPuzzle(sampleDefaultName)
+	ts.RemoveAllSteps()
+	// find an empty square with more than one possible value
+	state, err := ts.Puzzle.State()
+	if err != nil {
+		t.Fatalf("Failed to get state of %s: %v", sampleDefaultName, err)
+	}
+	var sq puzzle.Square
+	for _, sq = range state.Squares {
+		if len(sq.Pvals) > 2 {
+			break
+		}
+	}
+	// strike two of its values, use marks, and restore one of them
+	steps := []interface{}{
+		puzzle.Mark{Index: sq.Index, Value: sq.Pvals[0]},
+		puzzle.Mark{Index: sq.Index, Value: sq.Pvals[1]},
+		true,
+		puzzle.Mark{Index: sq.Index, Value: sq.Pvals[0], Restore: true},
+	}
+	for i, step := range steps {
+		switch step := step.(type) {
+		case puzzle.Mark:
+			if _, err := ts.Puzzle.Mark(step); err != nil {
+				t.Fatalf("Failed mark step %d: %v", i, err)
+			}
+			ts.AddMarkStep(step)
+		case bool:
+			if _, err := ts.Puzzle.SetUseMarks(step); err != nil {
+				t.Fatalf("Failed use marks step %d: %v", i, err)
+			}
+			ts.AddUseMarksStep(step)
+		}
+	}
+	if ts.Info.Steps != len(steps) || len(ts.Info.Choices) != 0 {
+		t.Errorf("After marks: %d steps and %d choices", ts.Info.Steps, len(ts.Info.Choices))
+	}
+	expected := []int32{
+		int32(sq.Index), -int32(sq.Pvals[0]),
+		int32(sq.Index), -int32(sq.Pvals[1]),
+		0, 1,
+		-int32(sq.Index), int32(sq.Pvals[0]),
+	}
+	if flat := ts.entries[ts.active].Choices; !reflect.DeepEqual(flat, expected) {
+		t.Errorf("After marks: flattened steps are %v, should be %v", flat, expected)
+	}
+	// replaying the steps gives the same puzzle
+	before, _ := ts.Puzzle.Summary()
+	if !reflect.DeepEqual(before.Marks, []puzzle.Choice{{sq.Index, sq.Pvals[1]}}) || !before.UseMarks {
+		t.Errorf("After marks: summary has marks %v (use %v)", before.Marks, before.UseMarks)
+	}
+	ts.constructActivePuzzle()
+	if after, _ := ts.Puzzle.Summary(); !reflect.DeepEqual(after, before) {
+		t.Errorf("Replayed puzzle has summary %+v, should be %+v", *after, *before)
+	}
+	// and removing a step goes back to the prior step
+	ts.RemoveStep()
+	if back, _ := ts.Puzzle.Summary(); len(back.Marks) != 2 || !back.UseMarks {
+		t.Errorf("After remove: summary has marks %v (use %v)", back.Marks, back.UseMarks)
+	}
+	ts.RemoveAllSteps()
+	if ts.Info.Steps != 0 {
+		t.Errorf("After remove all: %d steps", ts.Info.Steps)
+	}
+}
+
+func TestSessionUnassignStep(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession(sid)
+	ts.SelectPuzzle(sampleDefaultName)
+	ts.RemoveAllSteps()
+	// make two choices, then clear the first one
+	var choices []puzzle.Choice
+	for i := 0; i < 2; i++ {
+		state, err := ts.Puzzle.State()
+		if err != nil {
+			t.Fatalf("Failed to get state of %s: %v", sampleDefaultName, err)
+		}
+		for _, sq := range state.Squares {
+			if len(sq.Pvals) > 1 {
+				choices = append(choices, puzzle.Choice{Index: sq.Index, Value: sq.Pvals[0]})
+				break
+			}
+		}
+		if _, err := ts.Puzzle.Assign(choices[i]); err != nil {
+			t.Fatalf("Failed assign step %d: %v", i, err)
+		}
+		ts.AddStep(choices[i])
+	}
+	remaining := ts.Info.Remaining
+	if _, err := ts.Puzzle.Unassign(choices[0].Index); err != nil {
+		t.Fatalf("Failed unassign step: %v", err)
+	}
+	ts.AddUnassignStep(choices[0].Index)
+	if ts.Info.Steps != 3 || !reflect.DeepEqual(ts.Info.Choices, choices[1:]) {
+		t.Errorf("After unassign: %d steps and choices %v", ts.Info.Steps, ts.Info.Choices)
+	}
+	if ts.Info.Remaining != remaining+1 {
+		t.Errorf("After unassign: %d remaining, expected %d", ts.Info.Remaining, remaining+1)
+	}
+	// replaying the steps gives the same puzzle
+	before, _ := ts.Puzzle.Summary()
+	ts.constructActivePuzzle()
+	if after, _ := ts.Puzzle.Summary(); !reflect.DeepEqual(after, before) {
+		t.Errorf("Replayed puzzle has summary %+v, should be %+v", *after, *before)
+	}
+	ts.RemoveAllSteps()
+}
+
 func TestSelectPuzzle(t *testing.T) {
 	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
 	if _, _, err := Connect(); err != nil {
@@ -317,6 +439,69 @@ func TestSelectPuzzle(t *testing.T) {
 	ts.SelectPuzzle("this is not an actual puzzle name or id!!")
 }
 
+func TestAddPuzzle(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	summary, err := puzzle.Generate(&puzzle.GenerateOptions{
+		Geometry: puzzle.StandardGeometryName, SideLength: 4, Seed: 1})
+	if err != nil {
+		t.Fatalf("Failed to generate puzzle: %v", err)
+	}
+	hash, _ := summary.Hash()
+	ts := LoadSession(sid)
+	count := len(ts.entries)
+	info := ts.AddPuzzle(summary)
+	if info.PuzzleId != string(hash) || ts.Info.PuzzleId != string(hash) {
+		t.Errorf("Added puzzle %q is not active (active is %q)", hash, ts.Info.PuzzleId)
+	}
+	if info.Name != fmt.Sprintf("puzzle-%d", count+1) || info.Steps != 0 {
+		t.Errorf("Added puzzle has info %+v", *info)
+	}
+	if vals, _ := ts.Puzzle.Summary(); !reflect.DeepEqual(vals.Values, summary.Values) {
+		t.Errorf("Added puzzle has values %v, expected %v", vals.Values, summary.Values)
+	}
+
+	// adding it again just selects it
+	ts.SelectPuzzle(sampleDefaultName)
+	ts.AddPuzzle(summary)
+	if len(ts.entries) != count+1 || ts.Info.Name != info.Name {
+		t.Errorf("Re-adding puzzle made %d entries, active %q", len(ts.entries), ts.Info.Name)
+	}
+
+	// a new load of the session has the puzzle
+	ts = LoadSession(sid)
+	ts.SelectPuzzle(info.Name)
+	if ts.Info.PuzzleId != string(hash) {
+		t.Errorf("Reloaded session selected %q, expected %q", ts.Info.PuzzleId, hash)
+	}
+
+	// a rotation of the puzzle is equivalent to it, so adding
+	// it just selects the puzzle
+	rotated, err := summary.Transform(puzzle.Rotation(summary.SideLength, 1))
+	if err != nil {
+		t.Fatalf("Failed to rotate puzzle: %v", err)
+	}
+	if found := ts.FindEquivalentPuzzle(rotated); found == nil || found.PuzzleId != string(hash) {
+		t.Errorf("Rotated puzzle's equivalent is %+v, expected %q", found, hash)
+	}
+	ts.SelectPuzzle(sampleDefaultName)
+	rinfo := ts.AddPuzzle(rotated)
+	if len(ts.entries) != count+1 || rinfo.PuzzleId != string(hash) || rinfo.CanonicalId != info.CanonicalId {
+		t.Errorf("Adding rotated puzzle made %d entries, active %+v, original %+v", len(ts.entries), *rinfo, *info)
+	}
+	found := false
+	for _, id := range FindEquivalentPuzzles(rotated) {
+		found = found || id == string(hash)
+	}
+	if !found {
+		t.Errorf("Saved puzzles equivalent to the rotated puzzle don't include %q", hash)
+	}
+}
+
 /*
 
 multiple, concurrent threads